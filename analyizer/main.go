@@ -70,6 +70,14 @@ func main() {
 			fmt.Println()
 			continue
 		}
+		ops, err := gowbem.ParseOperations(&cimReq)
+		if err != nil || len(ops) != 1 {
+			fmt.Println("====================", err)
+			fmt.Println(string(reqArray[1]))
+			fmt.Println()
+			continue
+		}
+		op := ops[0]
 
 		respBytes := bs[len(bsArray[0]):]
 		respBytes = bytes.Replace(respBytes, []byte("Transfer-Encoding: chunked\r\n"), []byte(""), -1)
@@ -116,23 +124,20 @@ func main() {
 				if err := os.MkdirAll(classPath, 666); err != nil && !os.IsExist(err) {
 					log.Fatalln(err)
 				}
-				for _, paramValue := range cimReq.Message.SimpleReq.IMethodCall.ParamValues {
-					if paramValue.Name == "InstanceName" {
-						filename := filepath.Join(classPath, "instances.txt")
-						bs := []byte(paramValue.InstanceName.String())
-
-						if old, err := ioutil.ReadFile(filename); err == nil {
-							bs = append(bs, []byte("\r\n")...)
-							bs = append(bs, old...)
-						} else if !os.IsNotExist(err) {
-							fmt.Println(err)
-							continue
-						}
+				if instanceName := op.InstanceNameParam("InstanceName"); instanceName != nil {
+					filename := filepath.Join(classPath, "instances.txt")
+					bs := []byte(instanceName.String())
 
+					if old, err := ioutil.ReadFile(filename); err == nil {
+						bs = append(bs, []byte("\r\n")...)
+						bs = append(bs, old...)
 						if err := ioutil.WriteFile(filename, bs, 666); err != nil {
 							fmt.Println(err)
-							continue
 						}
+					} else if !os.IsNotExist(err) {
+						fmt.Println(err)
+					} else if err := ioutil.WriteFile(filename, bs, 666); err != nil {
+						fmt.Println(err)
 					}
 				}
 
@@ -149,13 +154,7 @@ func main() {
 			}
 		} else if "EnumerateInstanceNames" == cim.Message.SimpleRsp.IMethodResponse.Name {
 
-			var className string
-			for _, paramValue := range cimReq.Message.SimpleReq.IMethodCall.ParamValues {
-				if paramValue.Name == "ClassName" {
-					className = paramValue.ClassName.Name
-					break
-				}
-			}
+			className := op.ClassNameParam("ClassName")
 			if className == "" {
 				fmt.Println("==================== class name is empty")
 				fmt.Println(string(bs))
@@ -0,0 +1,173 @@
+package gowbem
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Canonical returns a copy of the instance name in the canonical form: the
+// keybindings are sorted by their names case-insensitively, the key values
+// are untyped with normalized VALUETYPE and values, and the references are
+// canonical too. The names of the class and the keys keep their case.
+func (self *CimInstanceName) Canonical() *CimInstanceName {
+	path := &ObjectPath{}
+	path.setInstanceName(self)
+	keyBindings := canonicalKeyBindings(path.KeyBindings)
+	if 1 == len(keyBindings) && "" == keyBindings[0].Name {
+		// the single key without name
+		return &CimInstanceName{ClassName: self.ClassName,
+			KeyValue: keyBindings[0].KeyValue, ValueReference: keyBindings[0].ValueReference}
+	}
+	return &CimInstanceName{ClassName: self.ClassName, KeyBindings: keyBindings}
+}
+
+// Key returns the canonical string of the instance name, the names are in
+// lower case. The instance names of the same instance have the same key
+// even if they come from different CIMOMs, so it can be used as the key
+// of a map.
+func (self *CimInstanceName) Key() string {
+	path := &ObjectPath{}
+	path.setInstanceName(self)
+	return canonicalPath(path).String()
+}
+
+// Hash returns the hash of Key().
+func (self *CimInstanceName) Hash() uint64 {
+	return hashString(self.Key())
+}
+
+// Equal returns true if the instance names refer to the same instance.
+func (self *CimInstanceName) Equal(other *CimInstanceName) bool {
+	if nil == self || nil == other {
+		return self == other
+	}
+	return self.Key() == other.Key()
+}
+
+// Canonical returns a copy of the instance path in the canonical form, the
+// host and the namespace are in lower case and the instance name is
+// canonical.
+func (self *CimInstancePath) Canonical() *CimInstancePath {
+	return &CimInstancePath{
+		NamespacePath: CimNamespacePath{
+			Host: CimHost{Value: canonicalHost(self.NamespacePath.Host.Value)},
+			LocalNamespacePath: CimLocalNamespacePath{
+				Namespaces: ToCimNamespace(canonicalNamespace(self.NamespacePath.LocalNamespacePath.String()))},
+		},
+		InstanceName: *self.InstanceName.Canonical(),
+	}
+}
+
+// Key returns the canonical string of the instance path, see
+// CimInstanceName.Key.
+func (self *CimInstancePath) Key() string {
+	return canonicalPath(ObjectPathFromReference(&CimValueReference{InstancePath: self})).String()
+}
+
+// Hash returns the hash of Key().
+func (self *CimInstancePath) Hash() uint64 {
+	return hashString(self.Key())
+}
+
+// Equal returns true if the instance paths refer to the same instance.
+func (self *CimInstancePath) Equal(other *CimInstancePath) bool {
+	if nil == self || nil == other {
+		return self == other
+	}
+	return self.Key() == other.Key()
+}
+
+// InstanceNameKey returns the canonical key of the instance name, see
+// CimInstanceName.Key.
+func InstanceNameKey(name CIMInstanceName) string {
+	if cimName, ok := name.(*CimInstanceName); ok && nil != cimName {
+		return cimName.Key()
+	}
+	return name.String()
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// canonicalPath returns the path in lower case with the canonical
+// keybindings, the scheme and the port are dropped.
+func canonicalPath(path *ObjectPath) *ObjectPath {
+	keyBindings := canonicalKeyBindings(path.KeyBindings)
+	for idx := range keyBindings {
+		keyBindings[idx].Name = strings.ToLower(keyBindings[idx].Name)
+		if nil != keyBindings[idx].ValueReference {
+			if ref := ObjectPathFromReference(keyBindings[idx].ValueReference); nil != ref {
+				keyBindings[idx].ValueReference = canonicalPath(ref).ValueReference()
+			}
+		}
+	}
+	return &ObjectPath{
+		Host:        canonicalHost(path.Host),
+		Namespace:   canonicalNamespace(path.Namespace),
+		ClassName:   strings.ToLower(path.ClassName),
+		KeyBindings: keyBindings,
+	}
+}
+
+func canonicalHost(host string) string {
+	host, _ = splitHostPort(host)
+	return strings.ToLower(host)
+}
+
+func canonicalNamespace(namespace string) string {
+	return strings.ToLower(strings.Trim(strings.Replace(namespace, "\\", "/", -1), "/"))
+}
+
+// canonicalKeyBindings returns a sorted copy of the keybindings with the
+// normalized values.
+func canonicalKeyBindings(keyBindings CimKeyBindings) CimKeyBindings {
+	if 0 == len(keyBindings) {
+		return nil
+	}
+	results := make(CimKeyBindings, len(keyBindings))
+	for idx, kb := range keyBindings {
+		results[idx] = CimKeyBinding{Name: kb.Name}
+		switch {
+		case nil != kb.KeyValue:
+			results[idx].KeyValue = canonicalKeyValue(kb.KeyValue)
+		case nil != kb.ValueReference:
+			if ref := ObjectPathFromReference(kb.ValueReference); nil != ref {
+				ref.Scheme = ""
+				ref.Host = canonicalHost(ref.Host)
+				ref.Port = ""
+				ref.Namespace = canonicalNamespace(ref.Namespace)
+				ref.KeyBindings = canonicalKeyBindings(ref.KeyBindings)
+				results[idx].ValueReference = ref.ValueReference()
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+	return results
+}
+
+func canonicalKeyValue(kv *CimKeyValue) *CimKeyValue {
+	valueType := keyValueType(kv)
+	value := kv.Value
+	switch valueType {
+	case "boolean":
+		value = strings.ToLower(strings.TrimSpace(value))
+	case "numeric":
+		value = canonicalNumber(value)
+	}
+	return &CimKeyValue{ValueType: valueType, Value: value}
+}
+
+// canonicalNumber returns the integer or the real in decimal, the value is
+// returned as is if it isn't a number, see parseNumber.
+func canonicalNumber(s string) string {
+	if n, ok := parseNumber(s); ok {
+		return n
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,120 @@
+package gowbem
+
+import (
+	"testing"
+)
+
+func TestCanonicalInstanceName(t *testing.T) {
+	a := &CimInstanceName{ClassName: "CIM_Disk", KeyBindings: []CimKeyBinding{
+		{Name: "SystemName", KeyValue: &CimKeyValue{Type: "string", Value: "host"}},
+		{Name: "DeviceID", KeyValue: &CimKeyValue{Type: "uint32", Value: "0x10"}},
+		{Name: "Removable", KeyValue: &CimKeyValue{ValueType: "boolean", Value: "TRUE"}},
+	}}
+	b := &CimInstanceName{ClassName: "cim_disk", KeyBindings: []CimKeyBinding{
+		{Name: "removable", KeyValue: &CimKeyValue{Type: "boolean", Value: "true"}},
+		{Name: "deviceid", KeyValue: &CimKeyValue{ValueType: "numeric", Value: "16"}},
+		{Name: "systemname", KeyValue: &CimKeyValue{Value: "host"}},
+	}}
+	c := &CimInstanceName{ClassName: "CIM_Disk", KeyBindings: []CimKeyBinding{
+		{Name: "SystemName", KeyValue: &CimKeyValue{ValueType: "string", Value: "HOST"}},
+		{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "numeric", Value: "16"}},
+		{Name: "Removable", KeyValue: &CimKeyValue{ValueType: "boolean", Value: "true"}},
+	}}
+
+	if !a.Equal(b) {
+		t.Errorf("%s != %s", a.Key(), b.Key())
+	}
+	if a.Hash() != b.Hash() {
+		t.Error("hash isn't equal")
+	}
+	if a.Equal(c) {
+		t.Error("the string value is case sensitive")
+	}
+
+	set := map[string]bool{a.Key(): true}
+	if !set[InstanceNameKey(b)] {
+		t.Error(InstanceNameKey(b), "isn't found")
+	}
+
+	canonical := a.Canonical()
+	excepted := `CIM_Disk.DeviceID=16,Removable=true,SystemName="host"`
+	if excepted != canonical.String() {
+		t.Errorf("excepted is %s, actual is %s", excepted, canonical.String())
+	}
+	for _, kb := range canonical.KeyBindings {
+		if "" != kb.KeyValue.Type || "" == kb.KeyValue.ValueType {
+			t.Errorf("%#v", kb.KeyValue)
+		}
+	}
+	if "SystemName" != a.KeyBindings[0].Name || "uint32" != a.KeyBindings[1].KeyValue.Type {
+		t.Error("the instance name is changed")
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	name := func(value string) *CimInstanceName {
+		return &CimInstanceName{ClassName: "CIM_X", KeyBindings: []CimKeyBinding{
+			{Name: "ID", KeyValue: &CimKeyValue{ValueType: "numeric", Value: value}}}}
+	}
+	if !name("010").Equal(name("10")) || !name("+10").Equal(name("0x0A")) || !name("1.5e1").Equal(name("15")) {
+		t.Error("the decimal numbers aren't equal")
+	}
+	if name("010").Equal(name("8")) {
+		t.Error("010 is read as octal")
+	}
+	if name("1_000").Equal(name("1000")) {
+		t.Error("the underscores are accepted")
+	}
+	if excepted := `CIM_X.ID=-1`; excepted != name("-0x1").Canonical().String() {
+		t.Errorf("excepted is %s, actual is %s", excepted, name("-0x1").Canonical().String())
+	}
+}
+
+func TestCanonicalInstanceNameReference(t *testing.T) {
+	ref := func(host, ns string, keyBindings ...CimKeyBinding) *CimValueReference {
+		return &CimValueReference{InstancePath: &CimInstancePath{
+			NamespacePath: CimNamespacePath{Host: CimHost{Value: host},
+				LocalNamespacePath: CimLocalNamespacePath{Namespaces: ToCimNamespace(ns)}},
+			InstanceName: CimInstanceName{ClassName: "CIM_ComputerSystem", KeyBindings: keyBindings}}}
+	}
+	a := &CimInstanceName{ClassName: "CIM_SystemDevice", KeyBindings: []CimKeyBinding{
+		{Name: "GroupComponent", ValueReference: ref("Server:5989", "root/CIMV2",
+			CimKeyBinding{Name: "Name", KeyValue: &CimKeyValue{Value: "x"}},
+			CimKeyBinding{Name: "CreationClassName", KeyValue: &CimKeyValue{Value: "CIM_ComputerSystem"}})},
+	}}
+	b := &CimInstanceName{ClassName: "CIM_SystemDevice", KeyBindings: []CimKeyBinding{
+		{Name: "GroupComponent", ValueReference: ref("server", "/root/cimv2",
+			CimKeyBinding{Name: "CreationClassName", KeyValue: &CimKeyValue{Type: "string", Value: "CIM_ComputerSystem"}},
+			CimKeyBinding{Name: "Name", KeyValue: &CimKeyValue{Type: "string", Value: "x"}})},
+	}}
+	if !a.Equal(b) {
+		t.Errorf("%s != %s", a.Key(), b.Key())
+	}
+}
+
+func TestCanonicalInstancePath(t *testing.T) {
+	a := &CimInstancePath{
+		NamespacePath: CimNamespacePath{Host: CimHost{Value: "Server:5989"},
+			LocalNamespacePath: CimLocalNamespacePath{Namespaces: ToCimNamespace("root/CIMV2")}},
+		InstanceName: CimInstanceName{ClassName: "CIM_Process", KeyBindings: []CimKeyBinding{
+			{Name: "Handle", KeyValue: &CimKeyValue{Value: "1"}},
+			{Name: "CSName", KeyValue: &CimKeyValue{Value: "server"}},
+		}}}
+	b := &CimInstancePath{
+		NamespacePath: CimNamespacePath{Host: CimHost{Value: "server"},
+			LocalNamespacePath: CimLocalNamespacePath{Namespaces: ToCimNamespace("root/cimv2")}},
+		InstanceName: CimInstanceName{ClassName: "cim_process", KeyBindings: []CimKeyBinding{
+			{Name: "csname", KeyValue: &CimKeyValue{ValueType: "string", Value: "server"}},
+			{Name: "handle", KeyValue: &CimKeyValue{ValueType: "string", Value: "1"}},
+		}}}
+	if !a.Equal(b) || a.Hash() != b.Hash() {
+		t.Errorf("%s != %s", a.Key(), b.Key())
+	}
+
+	canonical := a.Canonical()
+	if "server" != canonical.NamespacePath.Host.Value ||
+		"root/cimv2" != canonical.NamespacePath.LocalNamespacePath.String() ||
+		"CSName" != canonical.InstanceName.KeyBindings[0].Name {
+		t.Errorf("%#v", canonical)
+	}
+}
@@ -0,0 +1,628 @@
+package gowbem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ClientCIMRS is the client of DMTF CIM-RS (DSP0210 and DSP0211), the
+// operations are mapped onto the resources below the url of the client:
+//
+//	namespaces/{namespace}/classes/{class}
+//	namespaces/{namespace}/classes/{class}/instances
+//	namespaces/{namespace}/classes/{class}/instances/{key}={value},...
+//	{instance}/associators
+//	{instance}/references
+//	{instance or class}/methods/{method}
+//
+// The payloads are the JSON of the objects (see json.go), the collections
+// are read page by page by following the "next" links. The results are the
+// same types returned by ClientCIMXML.
+type ClientCIMRS struct {
+	Client
+
+	// PageSize is the max number of the instances in a page, the page size
+	// of the server is used if it is 0.
+	PageSize int
+}
+
+// CIMRSMediaType is the media type of the requests and the responses.
+const CIMRSMediaType = "application/json"
+
+// cimrsError is the payload of the error response.
+type cimrsError struct {
+	Kind        string        `json:"kind"`
+	StatusCode  CIMStatusCode `json:"statuscode"`
+	Description string        `json:"description"`
+}
+
+// cimrsInstance is an instance with the path of it in the "self" member.
+type cimrsInstance struct {
+	Self     *ObjectPath
+	Instance CimInstance
+}
+
+func (self *cimrsInstance) UnmarshalJSON(bs []byte) error {
+	var s struct {
+		Self *ObjectPath `json:"self"`
+	}
+	if err := json.Unmarshal(bs, &s); nil != err {
+		return err
+	}
+	self.Self = s.Self
+	return self.Instance.UnmarshalJSON(bs)
+}
+
+func (self *cimrsInstance) namedInstance() (*CimValueNamedInstance, error) {
+	if nil == self.Self || self.Self.IsClass() {
+		return nil, errors.New("path of the instance '" + self.Instance.ClassName + "' is missing")
+	}
+	return &CimValueNamedInstance{InstanceName: *self.Self.InstanceName(), Instance: self.Instance}, nil
+}
+
+// cimrsCollection is a page of the instances or the instance references.
+type cimrsCollection struct {
+	Kind               string          `json:"kind"`
+	Instances          []cimrsInstance `json:"instances,omitempty"`
+	InstanceReferences []*ObjectPath   `json:"instancereferences,omitempty"`
+	Next               string          `json:"next,omitempty"`
+}
+
+type cimrsMethodRequest struct {
+	Kind       string           `json:"kind"`
+	Method     string           `json:"method"`
+	Parameters []*CimParamValue `json:"parameters"`
+}
+
+type cimrsMethodResponse struct {
+	Kind        string           `json:"kind"`
+	Method      string           `json:"method"`
+	ReturnValue *CimParamValue   `json:"returnvalue"`
+	Parameters  []*CimParamValue `json:"parameters"`
+}
+
+func NewClientCIMRS(u *url.URL, insecure bool) (*ClientCIMRS, error) {
+	c := &ClientCIMRS{}
+	c.Client.init(u, insecure)
+	return c, nil
+}
+
+func classResource(namespaceName, className string) string {
+	return "namespaces/" + url.PathEscape(namespaceName) + "/classes/" + url.PathEscape(className)
+}
+
+// instanceResource returns the uri of the instance, the key values are
+// written as {key}={value} and separated by the commas.
+func instanceResource(namespaceName string, instanceName CIMInstanceName) (string, error) {
+	path, err := toReference(instanceName)
+	if nil != err {
+		return "", err
+	}
+	if path.IsClass() {
+		return "", WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"keys of the instance '"+path.ClassName+"' is empty.")
+	}
+
+	var buf strings.Builder
+	buf.WriteString(classResource(namespaceName, path.ClassName))
+	buf.WriteString("/instances/")
+	for idx, kb := range path.KeyBindings {
+		if idx > 0 {
+			buf.WriteString(",")
+		}
+		if "" != kb.Name {
+			buf.WriteString(escapeKey(kb.Name))
+			buf.WriteString("=")
+		}
+		switch {
+		case nil != kb.ValueReference:
+			if ref := ObjectPathFromReference(kb.ValueReference); nil != ref {
+				buf.WriteString(escapeKey(ref.String()))
+			}
+		case nil != kb.KeyValue:
+			buf.WriteString(escapeKey(kb.KeyValue.Value))
+		}
+	}
+	return buf.String(), nil
+}
+
+// resourcePath parses the uri of the class or the instance, see
+// instanceResource, the key values are read as the strings because their
+// types aren't in the uri.
+func resourcePath(uri string) (*ObjectPath, error) {
+	u, err := url.Parse(uri)
+	if nil != err {
+		return nil, err
+	}
+	segments := strings.Split(u.EscapedPath(), "/")
+	for idx := 0; idx+3 < len(segments); idx++ {
+		if "namespaces" != segments[idx] || "classes" != segments[idx+2] {
+			continue
+		}
+		path := &ObjectPath{}
+		if path.Namespace, err = url.PathUnescape(segments[idx+1]); nil != err {
+			return nil, err
+		}
+		if path.ClassName, err = url.PathUnescape(segments[idx+3]); nil != err {
+			return nil, err
+		}
+		if idx+5 >= len(segments) || "instances" != segments[idx+4] {
+			return path, nil
+		}
+		for _, key := range strings.Split(segments[idx+5], ",") {
+			var name string
+			if pos := strings.IndexByte(key, '='); pos >= 0 {
+				if name, err = url.QueryUnescape(key[:pos]); nil != err {
+					return nil, err
+				}
+				key = key[pos+1:]
+			}
+			value, err := url.QueryUnescape(key)
+			if nil != err {
+				return nil, err
+			}
+			path.KeyBindings = append(path.KeyBindings, CimKeyBinding{Name: name,
+				KeyValue: &CimKeyValue{ValueType: "string", Value: value}})
+		}
+		return path, nil
+	}
+	return nil, errors.New("'" + uri + "' isn't the uri of a class or an instance")
+}
+
+func escapeKey(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func checkNamespace(namespaceName string) error {
+	if "" == namespaceName {
+		return WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"namespace name is empty.")
+	}
+	return nil
+}
+
+// resolve returns the url of the resource, the uri is relative to the url
+// of the client if it isn't absolute. The credentials of the client are
+// attached to the absolute uri only if it is on the same host, such as the
+// "next" links of the pages.
+func (c *ClientCIMRS) resolve(uri string, query url.Values) (*url.URL, error) {
+	base := c.u
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	u, err := base.Parse(uri)
+	if nil != err {
+		return nil, err
+	}
+	if nil == u.User && nil != base.User &&
+		strings.EqualFold(u.Scheme, base.Scheme) && strings.EqualFold(u.Host, base.Host) {
+		u.User = base.User
+	}
+	if 0 != len(query) {
+		values := u.Query()
+		for key, value := range query {
+			values[key] = value
+		}
+		u.RawQuery = values.Encode()
+	}
+	return u, nil
+}
+
+// do sends the request and decodes the JSON response into resBody, the
+// error response is converted into the WbemError.
+func (c *ClientCIMRS) do(ctx context.Context, method, uri string, query url.Values, reqBody, resBody interface{}) error {
+	u, err := c.resolve(uri, query)
+	if nil != err {
+		return err
+	}
+
+	var body io.Reader
+	var reqBytes []byte
+	if nil != reqBody {
+		if reqBytes, err = json.Marshal(reqBody); nil != err {
+			return err
+		}
+		body = bytes.NewReader(reqBytes)
+	}
+
+	httpreq, err := http.NewRequest(method, u.String(), body)
+	if nil != err {
+		return err
+	}
+	if ctx != nil {
+		httpreq = httpreq.WithContext(ctx)
+	}
+	httpreq.Header.Set("Accept", CIMRSMediaType)
+	if nil != reqBody {
+		httpreq.Header.Set("Content-Type", CIMRSMediaType)
+	}
+
+	var dumpWriter io.WriteCloser
+	if DebugEnabled() {
+		num := atomic.AddUint64(&c.rn, 1)
+		b, _ := httputil.DumpRequestOut(httpreq, false)
+		dumpWriter = DebugNewFile(fmt.Sprintf("%d-%04d.log", c.cn, num))
+		defer dumpWriter.Close()
+		dumpWriter.Write(b)
+		dumpWriter.Write(reqBytes)
+	}
+
+	httpres, err := c.Client.Client.Do(httpreq)
+	if nil != err {
+		return err
+	}
+	defer httpres.Body.Close()
+	if httpres.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+
+	resBytes, err := io.ReadAll(httpres.Body)
+	if nil != err {
+		return err
+	}
+	if DebugEnabled() {
+		b, _ := httputil.DumpResponse(httpres, false)
+		dumpWriter.Write([]byte("\r\n"))
+		dumpWriter.Write(b)
+		dumpWriter.Write(resBytes)
+	}
+
+	if httpres.StatusCode < http.StatusOK || httpres.StatusCode >= http.StatusMultipleChoices {
+		var e cimrsError
+		if nil == json.Unmarshal(resBytes, &e) && 0 != e.StatusCode {
+			return WBEMException(e.StatusCode, e.Description)
+		}
+		switch httpres.StatusCode {
+		case http.StatusNotFound:
+			return WBEMException(CIM_ERR_NOT_FOUND, httpres.Status)
+		case http.StatusForbidden:
+			return WBEMException(CIM_ERR_ACCESS_DENIED, httpres.Status)
+		case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+			return WBEMException(CIM_ERR_NOT_SUPPORTED, httpres.Status)
+		}
+		if 0 == len(resBytes) {
+			return errors.New(httpres.Status)
+		}
+		return errors.New(httpres.Status + ":" + string(resBytes))
+	}
+
+	if nil == resBody {
+		return nil
+	}
+	if err := json.Unmarshal(resBytes, resBody); nil != err {
+		return &DecodeError{bytes: resBytes, err: err}
+	}
+	return nil
+}
+
+// collect reads the pages of the collection until the "next" link is
+// missing.
+func (c *ClientCIMRS) collect(ctx context.Context, uri string, query url.Values, cb func(page *cimrsCollection) error) error {
+	if nil == query {
+		query = url.Values{}
+	}
+	if c.PageSize > 0 {
+		query.Set("$max", strconv.Itoa(c.PageSize))
+	}
+	for "" != uri {
+		page := &cimrsCollection{}
+		if err := c.do(ctx, "GET", uri, query, nil, page); nil != err {
+			return err
+		}
+		if err := cb(page); nil != err {
+			return err
+		}
+		uri, query = page.Next, nil
+	}
+	return nil
+}
+
+func (c *ClientCIMRS) collectNames(ctx context.Context, uri string, query url.Values) ([]CIMInstanceName, error) {
+	query.Set("$refs", "true")
+	var results []CIMInstanceName
+	err := c.collect(ctx, uri, query, func(page *cimrsCollection) error {
+		for _, path := range page.InstanceReferences {
+			if nil == path || path.IsClass() {
+				return errors.New("instance reference is invalid")
+			}
+			results = append(results, path.InstanceName())
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *ClientCIMRS) collectInstances(ctx context.Context, uri string, query url.Values) ([]CIMInstanceWithName, error) {
+	var results []CIMInstanceWithName
+	err := c.collect(ctx, uri, query, func(page *cimrsCollection) error {
+		for idx := range page.Instances {
+			instance, err := page.Instances[idx].namedInstance()
+			if nil != err {
+				return err
+			}
+			results = append(results, instance)
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return results, nil
+}
+
+func instanceQuery(includeQualifiers, includeClassOrigin bool, propertyList []string) url.Values {
+	query := url.Values{}
+	if includeQualifiers {
+		query.Set("$qualifiers", "true")
+	}
+	if includeClassOrigin {
+		query.Set("$classorigin", "true")
+	}
+	if 0 != len(propertyList) {
+		query.Set("$properties", strings.Join(propertyList, ","))
+	}
+	return query
+}
+
+func associationQuery(assocClass, resultClass, role, resultRole string) url.Values {
+	query := url.Values{}
+	for _, param := range []struct{ name, value string }{
+		{"$class", assocClass}, {"$resultclass", resultClass}, {"$role", role}, {"$resultrole", resultRole},
+	} {
+		if "" != param.value {
+			query.Set(param.name, param.value)
+		}
+	}
+	return query
+}
+
+func (c *ClientCIMRS) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	if "" == className {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	return c.collectNames(ctx, classResource(namespaceName, className)+"/instances", url.Values{})
+}
+
+func (c *ClientCIMRS) GetInstance(ctx context.Context, namespaceName, className string, keyBindings CIMKeyBindings, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	instanceName := &CimInstanceName{
+		ClassName: className,
+	}
+
+	if 0 == keyBindings.Len() {
+		return nil, errors.New("keyBindings is empty.")
+	}
+	kbs, ok := keyBindings.(CimKeyBindings)
+	if !ok {
+		// the other implementations are read from the string of them.
+		path, err := ParseObjectPath(className + "." + keyBindings.String())
+		if nil != err {
+			return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"keyBindings is invalid, "+err.Error())
+		}
+		return c.GetInstanceByInstanceName(ctx, namespaceName, path.InstanceName(), localOnly, includeQualifiers, includeClassOrigin, propertyList)
+	}
+	if 1 == len(kbs) && "_" == kbs[0].Name {
+		instanceName.KeyValue = kbs[0].KeyValue
+		instanceName.ValueReference = kbs[0].ValueReference
+	} else {
+		instanceName.KeyBindings = kbs
+	}
+	return c.GetInstanceByInstanceName(ctx, namespaceName, instanceName, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+}
+
+// GetInstanceByInstanceName fetches the instance, localOnly is ignored
+// because CIM-RS doesn't support it.
+func (c *ClientCIMRS) GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName CIMInstanceName, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	instance := &cimrsInstance{}
+	if err := c.do(ctx, "GET", uri, instanceQuery(includeQualifiers, includeClassOrigin, propertyList), nil, instance); nil != err {
+		return nil, err
+	}
+	return &instance.Instance, nil
+}
+
+// EnumerateInstances fetches the instances of the class and the
+// subclasses, deepInheritance and localOnly are ignored because CIM-RS
+// doesn't support them.
+func (c *ClientCIMRS) EnumerateInstances(ctx context.Context, namespaceName, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	if "" == className {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	return c.collectInstances(ctx, classResource(namespaceName, className)+"/instances",
+		instanceQuery(includeQualifiers, includeClassOrigin, propertyList))
+}
+
+func (c *ClientCIMRS) AssociatorNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string) ([]CIMInstanceName, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	return c.collectNames(ctx, uri+"/associators", associationQuery(assocClass, resultClass, role, resultRole))
+}
+
+func (c *ClientCIMRS) AssociatorInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	query := instanceQuery(false, includeClassOrigin, propertyList)
+	for key, value := range associationQuery(assocClass, resultClass, role, resultRole) {
+		query[key] = value
+	}
+	return c.collectInstances(ctx, uri+"/associators", query)
+}
+
+func (c *ClientCIMRS) ReferenceNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string) ([]CIMInstanceName, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	return c.collectNames(ctx, uri+"/references", associationQuery(resultClass, "", role, ""))
+}
+
+func (c *ClientCIMRS) ReferenceInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string, includeClassOrigin bool, propertyList []string) ([]CIMInstance, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, err
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	query := instanceQuery(false, includeClassOrigin, propertyList)
+	for key, value := range associationQuery(resultClass, "", role, "") {
+		query[key] = value
+	}
+	instances, err := c.collectInstances(ctx, uri+"/references", query)
+	if nil != err {
+		return nil, err
+	}
+	results := make([]CIMInstance, len(instances))
+	for idx, instance := range instances {
+		results[idx] = instance.GetInstance()
+	}
+	return results, nil
+}
+
+func (c *ClientCIMRS) InvokeMethod(ctx context.Context, namespaceName string,
+	instanceName CIMInstanceName, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, nil, err
+	}
+	if nil == instanceName || "" == instanceName.GetClassName() {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	uri, err := instanceResource(namespaceName, instanceName)
+	if nil != err {
+		return nil, nil, err
+	}
+	return c.invokeMethod(ctx, uri, methodName, inParams)
+}
+
+func (c *ClientCIMRS) InvokeStaticMethod(ctx context.Context, namespaceName string,
+	className string, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if err := checkNamespace(namespaceName); nil != err {
+		return nil, nil, err
+	}
+	if "" == className {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	return c.invokeMethod(ctx, classResource(namespaceName, className), methodName, inParams)
+}
+
+func (c *ClientCIMRS) invokeMethod(ctx context.Context, uri, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if "" == methodName {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"method name is empty.")
+	}
+
+	req := &cimrsMethodRequest{Kind: "methodrequest", Method: methodName, Parameters: []*CimParamValue{}}
+	for _, param := range inParams {
+		p, ok := param.(*CimParamValue)
+		if !ok {
+			return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"parameter '"+param.GetName()+"' isn't a *CimParamValue.")
+		}
+		req.Parameters = append(req.Parameters, p)
+	}
+
+	resp := &cimrsMethodResponse{}
+	if err := c.do(ctx, "POST", uri+"/methods/"+url.PathEscape(methodName), nil, req, resp); nil != err {
+		return nil, nil, err
+	}
+
+	var returnValue Valuer
+	if nil != resp.ReturnValue {
+		if nil != resp.ReturnValue.ValueReference {
+			returnValue = resp.ReturnValue.ValueReference
+		} else if nil != resp.ReturnValue.Value {
+			returnValue = resp.ReturnValue.Value
+		}
+	}
+	outParams := make([]CIMParamValue, len(resp.Parameters))
+	for idx, param := range resp.Parameters {
+		outParams[idx] = param
+	}
+	return returnValue, outParams, nil
+}
+
+// The namespaces, the classes and the qualifiers aren't supported by the
+// CIM-RS binding, the operations are here so that ClientCIMRS implements WBEMClient.
+
+func (c *ClientCIMRS) EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error) {
+	return nil, notSupported("CIM-RS", "EnumerateNamespaces")
+}
+
+func (c *ClientCIMRS) EnumerateClassNames(ctx context.Context, namespaceName, className string, deep bool) ([]string, error) {
+	return nil, notSupported("CIM-RS", "EnumerateClassNames")
+}
+
+func (c *ClientCIMRS) EnumerateClasses(ctx context.Context, namespaceName string, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]CimClass, error) {
+	return nil, notSupported("CIM-RS", "EnumerateClasses")
+}
+
+func (c *ClientCIMRS) GetClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClass, error) {
+	return nil, notSupported("CIM-RS", "GetClass")
+}
+
+func (c *ClientCIMRS) EnumerateQualifierTypes(ctx context.Context, namespaceName string) ([]CimQualifierDeclaration, error) {
+	return nil, notSupported("CIM-RS", "EnumerateQualifierTypes")
+}
+
+func (c *ClientCIMRS) AssociatorClasses(ctx context.Context, namespaceName, className, assocClass, resultClass, role, resultRole string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	return nil, notSupported("CIM-RS", "AssociatorClasses")
+}
+
+func (c *ClientCIMRS) ReferenceClasses(ctx context.Context, namespaceName, className, resultClass, role string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	return nil, notSupported("CIM-RS", "ReferenceClasses")
+}
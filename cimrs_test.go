@@ -0,0 +1,338 @@
+package gowbem
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func cimrsDisk(id string) *cimrsInstanceJSON {
+	return &cimrsInstanceJSON{
+		Self: &ObjectPath{Namespace: "root/cimv2", ClassName: "CIM_Disk",
+			KeyBindings: CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: id}}}},
+		Instance: &CimInstance{ClassName: "CIM_Disk", Properties: []CimAnyProperty{
+			{Property: &CimProperty{Name: "DeviceID", Type: "string", Value: &CimValue{Value: id}}},
+			{Property: &CimProperty{Name: "Size", Type: "uint64", Value: &CimValue{Value: "1024"}}},
+		}},
+	}
+}
+
+// cimrsInstanceJSON is the instance written by the stand-in server.
+type cimrsInstanceJSON struct {
+	Self     *ObjectPath
+	Instance *CimInstance
+}
+
+func (self *cimrsInstanceJSON) MarshalJSON() ([]byte, error) {
+	bs, err := self.Instance.MarshalJSON()
+	if nil != err {
+		return nil, err
+	}
+	path, err := json.Marshal(self.Self)
+	if nil != err {
+		return nil, err
+	}
+	return append(append([]byte(`{"self":`), path...), append([]byte(","), bs[1:]...)...), nil
+}
+
+// cimrsServer is a CIM-RS stand-in, it serves three disks of a system, the
+// "next" links are absolute urls without the credentials if absolute is true.
+func cimrsServer(t *testing.T, absolute bool) *httptest.Server {
+	disks := []*cimrsInstanceJSON{cimrsDisk("d,1"), cimrsDisk("d 2"), cimrsDisk("d3")}
+	const prefix = "/cimrs/namespaces/root%2Fcimv2/classes/"
+
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", CIMRSMediaType)
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(v); nil != err {
+			t.Error(err)
+		}
+	}
+	writePage := func(w http.ResponseWriter, r *http.Request, base string) {
+		query := r.URL.Query()
+		skip, _ := strconv.Atoi(query.Get("$skip"))
+		max, _ := strconv.Atoi(query.Get("$max"))
+		end := len(disks)
+		if max > 0 && skip+max < end {
+			end = skip + max
+		}
+		page := map[string]interface{}{"kind": "instancecollection"}
+		if "true" == query.Get("$refs") {
+			var refs []*ObjectPath
+			for _, disk := range disks[skip:end] {
+				refs = append(refs, disk.Self)
+			}
+			page["kind"] = "instancereferencecollection"
+			page["instancereferences"] = refs
+		} else {
+			page["instances"] = disks[skip:end]
+		}
+		if end < len(disks) {
+			query.Set("$skip", strconv.Itoa(end))
+			if absolute {
+				base = "http://" + r.Host + base
+			}
+			page["next"] = base + "?" + query.Encode()
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || "u" != user || "p" != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if CIMRSMediaType != r.Header.Get("Accept") {
+			t.Error("Accept is", r.Header.Get("Accept"))
+		}
+
+		path := r.URL.EscapedPath()
+		switch {
+		case prefix+"CIM_Disk/instances" == path:
+			writePage(w, r, path)
+		case strings.HasPrefix(path, prefix+"CIM_Disk/instances/"):
+			key := strings.TrimPrefix(path, prefix+"CIM_Disk/instances/")
+			for _, disk := range disks {
+				if "DeviceID="+escapeKey(disk.Instance.Properties[0].Property.Value.Value) == key {
+					writeJSON(w, http.StatusOK, disk)
+					return
+				}
+			}
+			writeJSON(w, http.StatusNotFound, &cimrsError{Kind: "error", StatusCode: CIM_ERR_NOT_FOUND, Description: "instance isn't found"})
+		case prefix+"CIM_System/instances/Name=s1/associators" == path:
+			if "CIM_SystemDevice" != r.URL.Query().Get("$class") || "GroupComponent" != r.URL.Query().Get("$role") {
+				t.Error(r.URL.RawQuery)
+			}
+			writePage(w, r, path)
+		case prefix+"CIM_System/instances/Name=s1/methods/RequestStateChange" == path:
+			if "POST" != r.Method || CIMRSMediaType != r.Header.Get("Content-Type") {
+				t.Error(r.Method, r.Header.Get("Content-Type"))
+			}
+			req := &cimrsMethodRequest{}
+			if err := json.NewDecoder(r.Body).Decode(req); nil != err {
+				t.Error(err)
+			}
+			if "RequestStateChange" != req.Method || 1 != len(req.Parameters) ||
+				"RequestedState" != req.Parameters[0].Name || "3" != req.Parameters[0].Value.Value {
+				t.Errorf("%#v", req)
+			}
+			job := (&ObjectPath{Namespace: "root/cimv2", ClassName: "CIM_ConcreteJob",
+				KeyBindings: CimKeyBindings{{Name: "InstanceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "j1"}}}}).ValueReference()
+			writeJSON(w, http.StatusOK, &cimrsMethodResponse{Kind: "methodresponse", Method: req.Method,
+				ReturnValue: &CimParamValue{Name: "ReturnValue", ParamType: "uint32", Value: &CimValue{Value: "4096"}},
+				Parameters:  []*CimParamValue{{Name: "Job", ParamType: "reference", ValueReference: job}}})
+		case prefix+"CIM_System/methods/Create" == path:
+			writeJSON(w, http.StatusOK, &cimrsMethodResponse{Kind: "methodresponse", Method: "Create",
+				ReturnValue: &CimParamValue{Name: "ReturnValue", ParamType: "uint32", Value: &CimValue{Value: "0"}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCIMRS(t *testing.T) {
+	hsrv := cimrsServer(t, false)
+	defer hsrv.Close()
+
+	u, _ := url.Parse(hsrv.URL + "/cimrs")
+	u.User = url.UserPassword("u", "p")
+	c, err := NewClientCIMRS(u, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, pageSize := range []int{0, 1, 2} {
+		c.PageSize = pageSize
+		instances, err := c.EnumerateInstances(ctx, "root/cimv2", "CIM_Disk", true, false, false, false, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 3 != len(instances) {
+			t.Fatal(pageSize, len(instances))
+		}
+		if "d 2" != instances[1].GetName().GetKeyBindings().Get(0).GetValue() ||
+			"1024" != instances[1].GetInstance().GetPropertyByName("Size").GetValue() {
+			t.Errorf("%#v", instances[1])
+		}
+
+		names, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "CIM_Disk")
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 3 != len(names) || "CIM_Disk" != names[2].GetClassName() {
+			t.Errorf("%#v", names)
+		}
+	}
+
+	instance, err := c.GetInstance(ctx, "root/cimv2", "CIM_Disk",
+		CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d,1"}}}, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "d,1" != instance.GetPropertyByName("DeviceID").GetValue() {
+		t.Errorf("%#v", instance)
+	}
+
+	instance, err = c.GetInstance(ctx, "root/cimv2", "CIM_Disk", otherKeyBindings{
+		CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d 2"}}}}, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "d 2" != instance.GetPropertyByName("DeviceID").GetValue() {
+		t.Errorf("%#v", instance)
+	}
+
+	_, err = c.GetInstance(ctx, "root/cimv2", "CIM_Disk",
+		CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d4"}}}, false, false, false, nil)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_NOT_FOUND != code {
+		t.Error(err)
+	}
+
+	system, _ := ParseObjectPath(`CIM_System.Name="s1"`)
+	c.PageSize = 2
+	associators, err := c.AssociatorInstances(ctx, "root/cimv2", system.InstanceName(), "CIM_SystemDevice", "", "GroupComponent", "", false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(associators) {
+		t.Errorf("%#v", associators)
+	}
+	names, err := c.AssociatorNames(ctx, "root/cimv2", system.InstanceName(), "CIM_SystemDevice", "", "GroupComponent", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(names) || "d3" != names[2].GetKeyBindings().Get(0).GetValue() {
+		t.Errorf("%#v", names)
+	}
+
+	returnValue, outParams, err := c.InvokeMethod(ctx, "root/cimv2", system.InstanceName(), "RequestStateChange",
+		[]CIMParamValue{&CimParamValue{Name: "RequestedState", ParamType: "uint16", Value: &CimValue{Value: "3"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "4096" != returnValue.String() || 1 != len(outParams) {
+		t.Errorf("%#v %#v", returnValue, outParams)
+	}
+	if job, ok := paramValue(outParams[0]).(*ObjectPath); !ok || "CIM_ConcreteJob" != job.ClassName {
+		t.Errorf("%#v", outParams[0])
+	}
+
+	returnValue, _, err = c.InvokeStaticMethod(ctx, "root/cimv2", "CIM_System", "Create", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "0" != returnValue.String() {
+		t.Errorf("%#v", returnValue)
+	}
+
+	u.User = url.UserPassword("u", "x")
+	c, _ = NewClientCIMRS(u, false)
+	if _, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "CIM_Disk"); ErrUnauthorized != err {
+		t.Error(err)
+	}
+}
+
+func TestCIMRSAbsoluteNext(t *testing.T) {
+	hsrv := cimrsServer(t, true)
+	defer hsrv.Close()
+
+	u, _ := url.Parse(hsrv.URL + "/cimrs")
+	u.User = url.UserPassword("u", "p")
+	c, err := NewClientCIMRS(u, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	c.PageSize = 1
+	instances, err := c.EnumerateInstances(context.Background(), "root/cimv2", "CIM_Disk", true, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(instances) {
+		t.Error(len(instances))
+	}
+
+	other, err := c.resolve("http://other.example.com/cimrs/namespaces", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != other.User {
+		t.Error("credentials are sent to", other.Host)
+	}
+}
+
+// otherKeyBindings is a CIMKeyBindings which isn't a CimKeyBindings.
+type otherKeyBindings struct {
+	CimKeyBindings
+}
+
+// TestDecodeDSP0211Instance reads an instance written in the form of DSP0211,
+// the values are without the types and the paths are the uris.
+func TestDecodeDSP0211Instance(t *testing.T) {
+	bs, err := ioutil.ReadFile("testfiles/cimrs/dsp0211_instance.json")
+	if nil != err {
+		t.Fatal(err)
+	}
+	instance := &cimrsInstance{}
+	if err := json.Unmarshal(bs, instance); nil != err {
+		t.Fatal(err)
+	}
+	named, err := instance.namedInstance()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if excepted := `ACME_Disk.CreationClassName="ACME_Disk",DeviceID="disk 1"`; excepted != named.InstanceName.String() {
+		t.Errorf("excepted is %s, actual is %s", excepted, named.InstanceName.String())
+	}
+
+	for _, test := range []struct {
+		name, typ string
+		value     interface{}
+	}{
+		{"DeviceID", "string", "disk 1"},
+		{"BlockSize", "sint64", "512"},
+		{"NumberOfBlocks", "uint64", "18446744073709551615"},
+		{"Utilization", "real64", "0.25"},
+		{"IsBasedOnUnderlyingRedundancy", "boolean", "false"},
+		{"InstallDate", "string", "20120131123000.000000+000"},
+		{"System", "string", "/cimrs/namespaces/root%2Fcimv2/classes/ACME_System/instances/Name=sys1"},
+		{"Caption", "string", nil},
+	} {
+		pr := findAnyProperty(named.Instance.Properties, test.name)
+		if nil == pr || nil == pr.Property {
+			t.Errorf("property '%s' isn't found", test.name)
+			continue
+		}
+		var value interface{}
+		if nil != pr.Property.Value {
+			value = pr.Property.Value.Value
+		}
+		if test.typ != pr.Property.Type || test.value != value {
+			t.Errorf("%s: excepted is %s %v, actual is %s %v", test.name, test.typ, test.value, pr.Property.Type, value)
+		}
+	}
+
+	status := findAnyProperty(named.Instance.Properties, "OperationalStatus")
+	if nil == status || nil == status.PropertyArray || 3 != len(status.PropertyArray.ValueArray.Values) ||
+		"sint64" != status.PropertyArray.Type || nil == status.PropertyArray.ValueArray.Values[1].Null {
+		t.Errorf("%#v", status)
+	}
+
+	setting := findAnyProperty(named.Instance.Properties, "Setting")
+	if nil == setting || nil == setting.Property || "object" != setting.Property.EmbeddedObject {
+		t.Fatalf("%#v", setting)
+	}
+	embedded, err := decodeEmbeddedObject(setting.Property.Value.Value)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s, ok := embedded.(*CimInstance); !ok || "ACME_DiskSetting" != s.ClassName || "true" != s.GetPropertyByName("WriteCache").GetValue() {
+		t.Errorf("%#v", embedded)
+	}
+}
@@ -74,7 +74,8 @@ type Client struct {
 
 	cn_str string // Client counter
 	cn     uint64 // Client counter
-	cached *bytes.Buffer
+
+	quirks atomic.Value // quirksValue
 }
 
 func NewClient(u *url.URL, insecure bool) *Client {
@@ -88,7 +89,6 @@ func (c *Client) init(u *url.URL, insecure bool) {
 	c.insecure = insecure
 	c.cn = atomic.AddUint64(&cn, 1)
 	c.rn = 0
-	c.cached = bytes.NewBuffer(make([]byte, 0, 8*1024*1024))
 
 	c.cn_str = strconv.FormatUint(c.cn, 10)
 
@@ -140,7 +140,7 @@ func (c *Client) UnmarshalJSON(b []byte) error {
 func (c *Client) RoundTrip(ctx context.Context, action string, headers map[string]string, reqBody interface{}, resBody HasFault) error {
 	err := c.roundTrip(ctx, action, headers, reqBody, resBody)
 	if err != nil && atomic.LoadUint64(&c.rn) <= 1 {
-		if c.contentType == "" {
+		if c.contentType == "" && c.Quirks().ContentType == "" {
 			if headers == nil {
 				headers = map[string]string{
 					`Content-Type`: `text/xml; charset="utf-8"`,
@@ -168,14 +168,16 @@ func (c *Client) roundTrip(ctx context.Context, action string, headers map[strin
 	var err error
 
 	num := atomic.AddUint64(&c.rn, 1)
-	c.cached.Reset()
-
-	c.cached.WriteString(xml.Header)
+	// the buffers belong to the request, so the client can be used by
+	// multiple goroutines, and the body isn't changed while net/http
+	// still sends it.
+	rawreqbody := bytes.NewBuffer(make([]byte, 0, 8*1024))
+	rawreqbody.WriteString(xml.Header)
 
-	if err = xml.NewEncoder(c.cached).Encode(reqBody); err != nil {
+	if err = xml.NewEncoder(rawreqbody).Encode(reqBody); err != nil {
 		panic(err)
 	}
-	rawreqbody := c.cached
+	reqbytes := rawreqbody.Bytes()
 
 	httpreq, err = http.NewRequest(action, c.u.String(), rawreqbody)
 	if err != nil {
@@ -190,10 +192,12 @@ func (c *Client) roundTrip(ctx context.Context, action string, headers map[strin
 	//}
 
 	//httpreq.Header.Set(`Content-Type`, `text/xml; charset="utf-8"`)
-	if c.contentType == "" {
-		httpreq.Header.Set(`Content-Type`, `application/xml; charset="utf-8"`)
-	} else {
+	if c.contentType != "" {
 		httpreq.Header.Set(`Content-Type`, c.contentType)
+	} else if contentType := c.Quirks().ContentType; contentType != "" {
+		httpreq.Header.Set(`Content-Type`, contentType)
+	} else {
+		httpreq.Header.Set(`Content-Type`, `application/xml; charset="utf-8"`)
 	}
 	if 0 != len(headers) {
 		for k, v := range headers {
@@ -206,7 +210,7 @@ func (c *Client) roundTrip(ctx context.Context, action string, headers map[strin
 		dumpWriter = DebugNewFile(fmt.Sprintf("%d-%04d.log", c.cn, num))
 		defer dumpWriter.Close()
 		dumpWriter.Write(b)
-		dumpWriter.Write(c.cached.Bytes())
+		dumpWriter.Write(reqbytes)
 	}
 
 	//tstart := time.Now()
@@ -242,29 +246,17 @@ func (c *Client) roundTrip(ctx context.Context, action string, headers map[strin
 			b, _ := httputil.DumpResponse(httpres, false)
 			dumpWriter.Write([]byte("\r\n"))
 			dumpWriter.Write(b)
-			dumpWriter.Write(c.cached.Bytes())
 		}
 
 		// 修复 pg 导到一个问题， 当pg出错时返回错误响应时，没有 ContentLength， tcp 连接也不关闭。
 		// 这时读 httpres.Body 时会导致本方法挂起。
 		// This is Pegasus bug, pegasus will return a error response that http version is 1.0 and ContentLength is missing.
 		// And tcp connection isn't disconnect by the pegasus server.
-		cimError := httpres.Header.Get("CIMError")
-		errorDetail := httpres.Header.Get("PGErrorDetail")
-		if "" == cimError {
-			if "" != errorDetail {
-				return errors.New(errorDetail)
-			}
-			return errors.New(httpres.Status)
-		}
-		if "" != errorDetail {
-			return errors.New(cimError + ": " + errorDetail)
-		}
-		return errors.New(cimError)
+		return headerError(httpres.Status, httpres.Header.Get("CIMError"), httpres.Header.Get("PGErrorDetail"))
 	}
 
-	c.cached.Reset()
-	if _, err = io.Copy(c.cached, httpres.Body); nil != err {
+	cached := bytes.NewBuffer(make([]byte, 0, 8*1024))
+	if _, err = io.Copy(cached, httpres.Body); nil != err {
 		return err
 	}
 
@@ -272,24 +264,24 @@ func (c *Client) roundTrip(ctx context.Context, action string, headers map[strin
 		b, _ := httputil.DumpResponse(httpres, false)
 		dumpWriter.Write([]byte("\r\n"))
 		dumpWriter.Write(b)
-		dumpWriter.Write(c.cached.Bytes())
+		dumpWriter.Write(cached.Bytes())
 	}
 
 	if 200 != httpres.StatusCode {
-		if 0 == c.cached.Len() {
+		if 0 == cached.Len() {
 			return errors.New(httpres.Status)
 		}
-		return errors.New(httpres.Status + ":" + c.cached.String())
+		return errors.New(httpres.Status + ":" + cached.String())
 	}
 
-	dec := xml.NewDecoder(bytes.NewReader(c.cached.Bytes()))
+	dec := xml.NewDecoder(bytes.NewReader(cached.Bytes()))
 	err = dec.Decode(resBody)
 	if err != nil {
-		return &DecodeError{bytes: c.cached.Bytes(), err: err}
+		return &DecodeError{bytes: cached.Bytes(), err: err}
 	}
 
 	if fault := resBody.Fault(); fault != nil {
-		return &FaultError{bytes: c.cached.Bytes(), err: fault}
+		return &FaultError{bytes: cached.Bytes(), err: fault}
 	}
 
 	return nil
@@ -1,12 +1,15 @@
 package gowbem
 
 import (
-	"bytes"
 	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -54,6 +57,12 @@ type ClientCIMXML struct {
 	CimVersion      string
 	DtdVersion      string
 	ProtocolVersion string
+
+	schemaOnce sync.Once
+	schema     *SchemaCache
+
+	capabilitiesMu sync.Mutex
+	capabilities   *Capabilities
 }
 
 func (c *ClientCIMXML) init(u *url.URL, insecure bool) {
@@ -65,126 +74,37 @@ func (c *ClientCIMXML) init(u *url.URL, insecure bool) {
 	//fmt.Println(c.Client.u.User)
 }
 
+// EnumerateNamespaces returns the names of the namespaces, nsList are
+// probed before the interop namespaces of the quirks and InteropNamespaces. cb is called with the total and
+// the done numbers of the probes, see DiscoverNamespaces for the details.
+// The result is empty if no namespace is found, the errors of the probes
+// are logged.
 func (c *ClientCIMXML) EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error) {
-	defaultNS := []string{"interop",
-		"root/interop",
-		"root/cimv2",
-		"root/PG_InterOp",
-		"root/PG_Internal"}
-
-	var errList []error
-	allList := append(nsList, defaultNS...)
-
-	if timeout == 0 {
-		timeout = 10 * time.Second
-	}
-
-	total := len(allList)*3 + 4
-	var namespaces = map[string]struct{}{}
-	for idx, ns := range allList {
-		for _, className := range []string{"CIM_Namespace",
-			"__Namespace",
-			"PG_NameSpace"} {
-			timerCtx, _ := context.WithTimeout(ctx, timeout)
-			instances, err := c.EnumerateInstances(timerCtx, ns, className, true, false, true, true, nil)
-			if err != nil {
-				if !IsErrNotSupported(err) && !IsEmptyResults(err) {
-					errList = append(errList, err)
-				}
-				continue
-			}
-
-			for _, instance := range instances {
-				name := instance.GetInstance().GetPropertyByName("Name").GetValue()
-				if name != nil && fmt.Sprint(name) != "" {
-					namespaces[fmt.Sprint(name)] = struct{}{}
-				}
-			}
-		}
-
-		if cb != nil {
-			cb(total, (idx+1)*3)
-		}
-	}
-
-	if len(namespaces) == 0 {
-		for idx, ns := range []string{"interop",
-			"root/interop",
-			"root/PG_InterOp",
-			"root/PG_Internal"} {
-			for _, className := range []string{"PG_ProviderCapabilities"} {
-				timerCtx, _ := context.WithTimeout(ctx, timeout)
-				instanceNames, err := c.EnumerateInstanceNames(timerCtx, ns, className)
-				if err != nil {
-					if !IsErrNotSupported(err) && !IsEmptyResults(err) {
-						errList = append(errList, err)
-					}
-					continue
-				}
-				if len(instanceNames) <= 0 {
-					continue
-				}
-
-				timerCtx, _ = context.WithTimeout(ctx, 2*time.Second)
-
-				// instance, err := GetInstanceByInstanceName(timerCtx, ns, instanceNames[0], false, false, false, nil)
-				instance, err := c.GetInstanceByInstanceName(timerCtx, ns, instanceNames[0], false, false, false, nil)
-				if err != nil {
-					if !IsErrNotSupported(err) {
-						errList = append(errList, err)
-					}
-					continue
-				}
-
-				names := StringsWith(instance, "Namespaces", nil)
-				for _, name := range names {
-					if name != "" {
-						namespaces[name] = struct{}{}
-					}
-				}
-			}
-
-			if cb != nil {
-				cb(total, len(allList)*3+idx)
-			}
-		}
-	}
-
-	noDefault := 0
-	var results = make([]string, 0, len(namespaces))
-	for ns := range namespaces {
-		isDefault := false
-		for _, s := range defaultNS {
-			if s == ns {
-				isDefault = true
-				break
+	opts := &NamespaceDiscoveryOptions{Timeout: timeout}
+	opts.InteropNamespaces = append(opts.InteropNamespaces, nsList...)
+	opts.InteropNamespaces = append(opts.InteropNamespaces, c.interopNamespaces()...)
+	if cb != nil {
+		opts.OnEvent = func(event NamespaceEvent) {
+			if ProbeFinished == event.Type {
+				cb(event.Total, event.Done)
 			}
 		}
-		if !isDefault {
-			noDefault++
-		}
-		results = append(results, ns)
 	}
 
-	if noDefault == 0 {
-		if len(errList) > 0 {
-			var buf bytes.Buffer
-			buf.WriteString("list namespaces is unsuccessful:")
-			for _, e := range errList {
-				buf.WriteString("\r\n\t")
-				buf.WriteString(e.Error())
-			}
-			log.Println("[wbem]", c.u.Host, "-", buf.String())
-		} else {
+	result, err := c.DiscoverNamespaces(ctx, opts)
+	if errs, ok := err.(ProbeErrors); ok {
+		// nothing is found, the result is empty like the old versions.
+		if 0 == len(errs) {
 			log.Println("[wbem]", c.u.Host, "- list namespaces is unsuccessful.")
+		} else {
+			log.Println("[wbem]", c.u.Host, "- list namespaces is unsuccessful:", errs.Error())
 		}
+		err = nil
 	}
-
-	if cb != nil {
-		cb(total, total)
+	if err != nil {
+		return nil, err
 	}
-
-	return results, nil
+	return result.Names(), nil
 }
 
 func (c *ClientCIMXML) EnumerateClassNames(ctx context.Context, namespaceName, className string, deep bool) ([]string, error) {
@@ -268,6 +188,8 @@ func (c *ClientCIMXML) EnumerateClassNames(ctx context.Context, namespaceName, c
 	return results, nil
 }
 
+// EnumerateInstanceNames returns the names of the instances of the class,
+// they are read page by page by the pull operations if Probe finds them.
 func (c *ClientCIMXML) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error) {
 	if "" == namespaceName {
 		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
@@ -279,6 +201,10 @@ func (c *ClientCIMXML) EnumerateInstanceNames(ctx context.Context, namespaceName
 			"class name is empty.")
 	}
 
+	if caps := c.Capabilities(); nil != caps && caps.PullOperations && caps.MaxObjectCount > 0 {
+		return c.pullInstanceNames(ctx, namespaceName, className, caps.MaxObjectCount)
+	}
+
 	names := SplitNamespaces(namespaceName)
 	namespaces := make([]CimNamespace, len(names))
 	for idx, name := range names {
@@ -426,6 +352,9 @@ func (c *ClientCIMXML) GetInstanceByInstanceName(ctx context.Context, namespaceN
 				ValueArray: &CimValueArray{Values: properties},
 			})
 	}
+	if localOnly && c.Quirks().omitLocalOnly(instanceName.GetClassName()) {
+		paramValues = withoutParamValue(paramValues, "LocalOnly")
+	}
 
 	simpleReq := &CimSimpleReq{IMethodCall: &CimIMethodCall{
 		Name:               "GetInstance",
@@ -544,6 +473,10 @@ func (c *ClientCIMXML) EnumerateInstances(ctx context.Context, namespaceName, cl
 				ValueArray: &CimValueArray{Values: properties},
 			})
 	}
+	quirks := c.Quirks()
+	if localOnly && quirks.omitLocalOnly(className) {
+		paramValues = withoutParamValue(paramValues, "LocalOnly")
+	}
 
 	simpleReq := &CimSimpleReq{IMethodCall: &CimIMethodCall{
 		Name:               "EnumerateInstances",
@@ -580,6 +513,9 @@ func (c *ClientCIMXML) EnumerateInstances(ctx context.Context, namespaceName, cl
 			return ireturnValueNotExists
 		}
 		if nil == cim.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances {
+			if quirks.BareInstances && 0 != len(cim.Message.SimpleRsp.IMethodResponse.ReturnValue.Instances) {
+				return nil
+			}
 			return valueNamedInstancesNotExists
 		}
 		return nil
@@ -597,6 +533,10 @@ func (c *ClientCIMXML) EnumerateInstances(ctx context.Context, namespaceName, cl
 		return nil, err
 	}
 
+	if nil == resp.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances {
+		return c.bareInstanceNames(ctx, namespaceName, resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Instances)
+	}
+
 	results := make([]CIMInstanceWithName, len(resp.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances))
 	for idx, _ := range resp.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances {
 		results[idx] = &resp.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances[idx]
@@ -604,15 +544,40 @@ func (c *ClientCIMXML) EnumerateInstances(ctx context.Context, namespaceName, cl
 	return results, nil
 }
 
+// GetClass returns the class, see GetClassXML for the CIM-XML of the class.
+//
+// NOTE: GetClass and EnumerateClasses return the decoded classes instead of
+// the CIM-XML strings since the WBEMClient is added, this breaks the callers
+// of the old signatures, use GetClassXML if the CIM-XML is needed.
 func (c *ClientCIMXML) GetClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClass, error) {
+	inner, err := c.getClass(ctx, namespaceName, className, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+	if nil != err {
+		return nil, err
+	}
+	return decodeClass(inner)
+}
+
+// GetClassXML returns the class in the CIM-XML format as it is returned by
+// the server.
+func (c *ClientCIMXML) GetClassXML(ctx context.Context, namespaceName string, className string, localOnly bool,
 	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (string, error) {
+	inner, err := c.getClass(ctx, namespaceName, className, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+	if nil != err {
+		return "", err
+	}
+	return inner.String(), nil
+}
+
+func (c *ClientCIMXML) getClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClassInnerXml, error) {
 	if "" == namespaceName {
-		return "", WBEMException(CIM_ERR_INVALID_PARAMETER,
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
 			"namespace name is empty.")
 	}
 
 	if "" == className {
-		return "", WBEMException(CIM_ERR_INVALID_PARAMETER,
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
 			"class name is empty.")
 	}
 
@@ -707,14 +672,23 @@ func (c *ClientCIMXML) GetClass(ctx context.Context, namespaceName string, class
 		"CIMOperation": "MethodCall",
 		"CIMMethod":    "GetClass",
 		"CIMObject":    url.QueryEscape(namespaceName)}, req, resp); nil != err {
-		return "", err
+		return nil, err
 	}
 
-	return resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes[0].String(), nil
+	return &resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes[0], nil
+}
+
+// decodeClass decodes the class in the response.
+func decodeClass(inner *CimClassInnerXml) (*CimClass, error) {
+	class := &CimClass{}
+	if err := xml.Unmarshal([]byte(inner.String()), class); nil != err {
+		return nil, errors.New("class '" + inner.Name + "' is invalid, " + err.Error())
+	}
+	return class, nil
 }
 
 func (c *ClientCIMXML) EnumerateClasses(ctx context.Context, namespaceName string, className string, deepInheritance bool,
-	localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]string, error) {
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]CimClass, error) {
 	if "" == namespaceName {
 		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
 			"namespace name is empty.")
@@ -806,12 +780,16 @@ func (c *ClientCIMXML) EnumerateClasses(ctx context.Context, namespaceName strin
 		return nil, err
 	}
 
-	results := make([]string, len(resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes))
-	for idx, class := range resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes {
-		results[idx] = class.String()
+	results := make([]CimClass, 0, len(resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes))
+	for idx := range resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes {
+		class, err := decodeClass(&resp.Message.SimpleRsp.IMethodResponse.ReturnValue.Classes[idx])
+		if nil != err {
+			return nil, err
+		}
+		results = append(results, *class)
 	}
 	for _, name := range resp.Message.SimpleRsp.IMethodResponse.ReturnValue.ClassNames {
-		results = append(results, name.Name)
+		results = append(results, CimClass{Name: name.Name})
 	}
 	return results, nil
 }
@@ -1574,22 +1552,69 @@ func (c *ClientCIMXML) InvokeMethod(ctx context.Context, namespaceName string,
 			"namespace name is empty.")
 	}
 
-	if "" == instanceName.GetClassName() {
+	if nil == instanceName || "" == instanceName.GetClassName() {
 		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
 			"class name is empty.")
 	}
 
+	cimInstanceName, ok := instanceName.(*CimInstanceName)
+	if !ok {
+		var err error
+		if cimInstanceName, err = ParseInstanceName(instanceName.String()); nil != err {
+			return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"instance name '"+instanceName.String()+"' is invalid, "+err.Error())
+		}
+	}
+
 	names := SplitNamespaces(namespaceName)
 	namespaces := make([]CimNamespace, len(names))
 	for idx, name := range names {
 		namespaces[idx].Name = name
 	}
 
+	return c.invokeMethod(ctx, &CimLocalInstancePath{
+		LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
+		InstanceName:       *cimInstanceName,
+	}, nil, methodName, inParams)
+}
+
+// InvokeStaticMethod invokes the static method of the class.
+func (c *ClientCIMXML) InvokeStaticMethod(ctx context.Context, namespaceName string,
+	className string, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if "" == namespaceName {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"namespace name is empty.")
+	}
+
+	if "" == className {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+
+	names := SplitNamespaces(namespaceName)
+	namespaces := make([]CimNamespace, len(names))
+	for idx, name := range names {
+		namespaces[idx].Name = name
+	}
+
+	return c.invokeMethod(ctx, nil, &CimLocalClassPath{
+		NamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
+		ClassName:     CimClassName{Name: className},
+	}, methodName, inParams)
+}
+
+func (c *ClientCIMXML) invokeMethod(ctx context.Context, localInstancePath *CimLocalInstancePath,
+	localClassPath *CimLocalClassPath, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
 	var paramValues []CimParamValue
 	if len(inParams) > 0 {
 		paramValues = make([]CimParamValue, 0, len(inParams))
 		for _, paramValue := range inParams {
-			paramValues = append(paramValues, *paramValue.(*CimParamValue))
+			cimParamValue, ok := paramValue.(*CimParamValue)
+			if !ok || nil == cimParamValue {
+				return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+					fmt.Sprintf("parameter must be a *CimParamValue, actual is %T.", paramValue))
+			}
+			paramValues = append(paramValues, *cimParamValue)
 		}
 	}
 
@@ -1607,17 +1632,20 @@ func (c *ClientCIMXML) InvokeMethod(ctx context.Context, namespaceName string,
 	// 	})
 	// }
 
-	localInstancePath := CimLocalInstancePath{
-		LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
-		InstanceName:       *instanceName.(*CimInstanceName),
-	}
-
 	simpleReq := &CimSimpleReq{MethodCall: &CimMethodCall{
 		Name:              methodName,
-		LocalInstancePath: &localInstancePath,
+		LocalClassPath:    localClassPath,
+		LocalInstancePath: localInstancePath,
 		ParamValues:       paramValues,
 	}}
 
+	var objectName string
+	if nil != localInstancePath {
+		objectName = localInstancePath.String()
+	} else {
+		objectName = localClassPath.NamespacePath.String() + ":" + localClassPath.ClassName.Name
+	}
+
 	req := &CIM{
 		CimVersion: c.CimVersion,
 		DtdVersion: c.DtdVersion,
@@ -1660,7 +1688,7 @@ func (c *ClientCIMXML) InvokeMethod(ctx context.Context, namespaceName string,
 	if err := c.RoundTrip(ctx, "POST", map[string]string{"CIMProtocolVersion": c.ProtocolVersion,
 		"CIMOperation": "MethodCall",
 		"CIMMethod":    methodName,
-		"CIMObject":    url.QueryEscape(localInstancePath.String())}, req, resp); nil != err {
+		"CIMObject":    url.QueryEscape(objectName)}, req, resp); nil != err {
 		return nil, nil, err
 	}
 
@@ -1765,3 +1793,69 @@ func NewClientCIMXML(u *url.URL, insecure bool) (*ClientCIMXML, error) {
 	c.init(u, insecure)
 	return c, nil
 }
+
+// CloseEnumeration closes the enumeration context which is returned by the
+// Open and Pull operations before the end of the sequence.
+func (c *ClientCIMXML) CloseEnumeration(ctx context.Context, namespaceName, enumerationContext string) error {
+	if "" == namespaceName {
+		return WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"namespace name is empty.")
+	}
+	if "" == enumerationContext {
+		return WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"enumeration context is empty.")
+	}
+	_, err := c.intrinsicCall(ctx, namespaceName, "CloseEnumeration", []CimIParamValue{
+		{Name: "EnumerationContext", Value: &CimValue{Value: enumerationContext}},
+	})
+	return err
+}
+
+// pullInstanceNames reads the names of the instances by the
+// OpenEnumerateInstancePaths and the PullInstancePaths, at most
+// maxObjectCount names are returned by a call.
+func (c *ClientCIMXML) pullInstanceNames(ctx context.Context, namespaceName, className string, maxObjectCount int) ([]CIMInstanceName, error) {
+	count := &CimValue{Value: strconv.Itoa(maxObjectCount)}
+	resp, err := c.intrinsicCall(ctx, namespaceName, "OpenEnumerateInstancePaths", []CimIParamValue{
+		{Name: "ClassName", ClassName: &CimClassName{Name: className}},
+		{Name: "MaxObjectCount", Value: count},
+	})
+	var results []CIMInstanceName
+	for {
+		if nil != err {
+			return nil, err
+		}
+		if nil != resp.ReturnValue {
+			for idx := range resp.ReturnValue.InstancePaths {
+				results = append(results, &resp.ReturnValue.InstancePaths[idx].InstanceName)
+			}
+		}
+		enumerationContext, endOfSequence := enumerationResult(resp)
+		if endOfSequence || "" == enumerationContext {
+			return results, nil
+		}
+		resp, err = c.intrinsicCall(ctx, namespaceName, "PullInstancePaths", []CimIParamValue{
+			{Name: "EnumerationContext", Value: &CimValue{Value: enumerationContext}},
+			{Name: "MaxObjectCount", Value: count},
+		})
+	}
+}
+
+// enumerationResult returns the EnumerationContext and the EndOfSequence
+// of the response of the Open and Pull operations.
+func enumerationResult(resp *CimIMethodResponse) (string, bool) {
+	var enumerationContext string
+	var endOfSequence bool
+	for _, pv := range resp.ParamValues {
+		if nil == pv.Value {
+			continue
+		}
+		switch {
+		case strings.EqualFold("EnumerationContext", pv.Name):
+			enumerationContext = pv.Value.Value
+		case strings.EqualFold("EndOfSequence", pv.Name):
+			endOfSequence = strings.EqualFold("true", strings.TrimSpace(pv.Value.Value))
+		}
+	}
+	return enumerationContext, endOfSequence
+}
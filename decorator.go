@@ -0,0 +1,473 @@
+package gowbem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientCall is a call of WBEMClient which is passed through the decorators,
+// the decorators may change the namespace before the call is sent.
+type ClientCall struct {
+	// Name is the name of the WBEMClient method, such as "GetInstance".
+	Name      string
+	Namespace string
+	// ClassName is the class of the target, it is the class of the instance
+	// name for the instance operations and "" for EnumerateNamespaces.
+	ClassName string
+	// InstanceName is the target of the instance operations or nil.
+	InstanceName CIMInstanceName
+	// MethodName is the method of InvokeMethod and InvokeStaticMethod.
+	MethodName string
+	// Args is the other arguments of the call, the callbacks are excepted.
+	Args []interface{}
+}
+
+// IsReadOnly returns true if the operation doesn't change the server, the
+// method invocations are considered to change the server.
+func (op *ClientCall) IsReadOnly() bool {
+	return "InvokeMethod" != op.Name && "InvokeStaticMethod" != op.Name
+}
+
+// Key returns the key of the operation, the operations with the same key
+// return the same result.
+func (op *ClientCall) Key() string {
+	var buf strings.Builder
+	buf.WriteString(op.Name)
+	buf.WriteString("|")
+	buf.WriteString(canonicalNamespace(op.Namespace))
+	buf.WriteString("|")
+	buf.WriteString(strings.ToLower(op.ClassName))
+	buf.WriteString("|")
+	if nil != op.InstanceName {
+		buf.WriteString(InstanceNameKey(op.InstanceName))
+	}
+	buf.WriteString("|")
+	buf.WriteString(op.MethodName)
+	for _, arg := range op.Args {
+		buf.WriteString("|")
+		fmt.Fprint(&buf, arg)
+	}
+	return buf.String()
+}
+
+// MethodOutput is the result of InvokeMethod and InvokeStaticMethod which
+// is passed through the decorators.
+type MethodOutput struct {
+	ReturnValue Valuer
+	OutParams   []CIMParamValue
+}
+
+// Invoker sends the operation, the result is the first result of the
+// WBEMClient method, or *MethodOutput for the method invocations.
+type Invoker func(ctx context.Context, op *ClientCall) (interface{}, error)
+
+// Decorator wraps the call of the operation, it calls next to send the
+// operation or returns without the call.
+type Decorator func(ctx context.Context, op *ClientCall, next Invoker) (interface{}, error)
+
+// Decorate wraps the client with the decorators, the first decorator is
+// the outermost.
+func Decorate(c WBEMClient, decorators ...Decorator) WBEMClient {
+	return &decoratedClient{c: c, decorators: decorators}
+}
+
+type decoratedClient struct {
+	c          WBEMClient
+	decorators []Decorator
+}
+
+// CloseIdleConnections closes the idle connections of the client if it has
+// the CloseIdleConnections method, such as ClientCIMXML.
+func (d *decoratedClient) CloseIdleConnections() {
+	if closer, ok := d.c.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (d *decoratedClient) call(ctx context.Context, op *ClientCall, invoke Invoker) (interface{}, error) {
+	next := invoke
+	for idx := len(d.decorators) - 1; idx >= 0; idx-- {
+		decorator, inner := d.decorators[idx], next
+		next = func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return decorator(ctx, op, inner)
+		}
+	}
+	return next(ctx, op)
+}
+
+func instanceCall(name, namespaceName string, instanceName CIMInstanceName, args ...interface{}) *ClientCall {
+	op := &ClientCall{Name: name, Namespace: namespaceName, InstanceName: instanceName, Args: args}
+	if nil != instanceName {
+		op.ClassName = instanceName.GetClassName()
+	}
+	return op
+}
+
+// EnumerateNamespaces calls cb with (1, 1) if the result is returned by a
+// decorator without the call, such as a cache hit.
+func (d *decoratedClient) EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error) {
+	called := false
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateNamespaces", Args: []interface{}{nsList, timeout}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			called = true
+			return d.c.EnumerateNamespaces(ctx, nsList, timeout, cb)
+		})
+	if !called && nil == err && nil != cb {
+		cb(1, 1)
+	}
+	names, _ := result.([]string)
+	return names, err
+}
+
+func (d *decoratedClient) EnumerateClassNames(ctx context.Context, namespaceName, className string, deep bool) ([]string, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateClassNames", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{deep}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.EnumerateClassNames(ctx, op.Namespace, className, deep)
+		})
+	names, _ := result.([]string)
+	return names, err
+}
+
+func (d *decoratedClient) EnumerateClasses(ctx context.Context, namespaceName string, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]CimClass, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateClasses", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{deepInheritance, localOnly, includeQualifiers, includeClassOrigin}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.EnumerateClasses(ctx, op.Namespace, className, deepInheritance, localOnly, includeQualifiers, includeClassOrigin)
+		})
+	classes, _ := result.([]CimClass)
+	return classes, err
+}
+
+func (d *decoratedClient) GetClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClass, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "GetClass", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{localOnly, includeQualifiers, includeClassOrigin, propertyList}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.GetClass(ctx, op.Namespace, className, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	class, _ := result.(*CimClass)
+	return class, err
+}
+
+func (d *decoratedClient) EnumerateQualifierTypes(ctx context.Context, namespaceName string) ([]CimQualifierDeclaration, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateQualifierTypes", Namespace: namespaceName},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.EnumerateQualifierTypes(ctx, op.Namespace)
+		})
+	qualifiers, _ := result.([]CimQualifierDeclaration)
+	return qualifiers, err
+}
+
+func (d *decoratedClient) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateInstanceNames", Namespace: namespaceName, ClassName: className},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.EnumerateInstanceNames(ctx, op.Namespace, className)
+		})
+	names, _ := result.([]CIMInstanceName)
+	return names, err
+}
+
+func (d *decoratedClient) EnumerateInstances(ctx context.Context, namespaceName, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "EnumerateInstances", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{deepInheritance, localOnly, includeQualifiers, includeClassOrigin, propertyList}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.EnumerateInstances(ctx, op.Namespace, className, deepInheritance, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	instances, _ := result.([]CIMInstanceWithName)
+	return instances, err
+}
+
+func (d *decoratedClient) GetInstance(ctx context.Context, namespaceName, className string, keyBindings CIMKeyBindings, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	var instanceName CIMInstanceName
+	if keys, ok := keyBindings.(CimKeyBindings); ok {
+		instanceName = &CimInstanceName{ClassName: className, KeyBindings: keys}
+	}
+	op := &ClientCall{Name: "GetInstance", Namespace: namespaceName, ClassName: className, InstanceName: instanceName,
+		Args: []interface{}{localOnly, includeQualifiers, includeClassOrigin, propertyList}}
+	if nil == instanceName {
+		op.Args = append(op.Args, keyBindings)
+	}
+	result, err := d.call(ctx, op,
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.GetInstance(ctx, op.Namespace, className, keyBindings, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	instance, _ := result.(CIMInstance)
+	return instance, err
+}
+
+func (d *decoratedClient) GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName CIMInstanceName, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	result, err := d.call(ctx, instanceCall("GetInstanceByInstanceName", namespaceName, instanceName,
+		localOnly, includeQualifiers, includeClassOrigin, propertyList),
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.GetInstanceByInstanceName(ctx, op.Namespace, instanceName, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	instance, _ := result.(CIMInstance)
+	return instance, err
+}
+
+func (d *decoratedClient) AssociatorNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string) ([]CIMInstanceName, error) {
+	result, err := d.call(ctx, instanceCall("AssociatorNames", namespaceName, instanceName,
+		assocClass, resultClass, role, resultRole),
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.AssociatorNames(ctx, op.Namespace, instanceName, assocClass, resultClass, role, resultRole)
+		})
+	names, _ := result.([]CIMInstanceName)
+	return names, err
+}
+
+func (d *decoratedClient) AssociatorInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string, includeClassOrigin bool,
+	propertyList []string) ([]CIMInstanceWithName, error) {
+	result, err := d.call(ctx, instanceCall("AssociatorInstances", namespaceName, instanceName,
+		assocClass, resultClass, role, resultRole, includeClassOrigin, propertyList),
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.AssociatorInstances(ctx, op.Namespace, instanceName, assocClass, resultClass, role, resultRole, includeClassOrigin, propertyList)
+		})
+	instances, _ := result.([]CIMInstanceWithName)
+	return instances, err
+}
+
+func (d *decoratedClient) AssociatorClasses(ctx context.Context, namespaceName, className, assocClass, resultClass, role, resultRole string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "AssociatorClasses", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{assocClass, resultClass, role, resultRole, includeQualifiers, includeClassOrigin, propertyList}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.AssociatorClasses(ctx, op.Namespace, className, assocClass, resultClass, role, resultRole, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	classes, _ := result.([]string)
+	return classes, err
+}
+
+func (d *decoratedClient) ReferenceNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string) ([]CIMInstanceName, error) {
+	result, err := d.call(ctx, instanceCall("ReferenceNames", namespaceName, instanceName, resultClass, role),
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.ReferenceNames(ctx, op.Namespace, instanceName, resultClass, role)
+		})
+	names, _ := result.([]CIMInstanceName)
+	return names, err
+}
+
+func (d *decoratedClient) ReferenceInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string, includeClassOrigin bool, propertyList []string) ([]CIMInstance, error) {
+	result, err := d.call(ctx, instanceCall("ReferenceInstances", namespaceName, instanceName,
+		resultClass, role, includeClassOrigin, propertyList),
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.ReferenceInstances(ctx, op.Namespace, instanceName, resultClass, role, includeClassOrigin, propertyList)
+		})
+	instances, _ := result.([]CIMInstance)
+	return instances, err
+}
+
+func (d *decoratedClient) ReferenceClasses(ctx context.Context, namespaceName, className, resultClass, role string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	result, err := d.call(ctx, &ClientCall{Name: "ReferenceClasses", Namespace: namespaceName, ClassName: className,
+		Args: []interface{}{resultClass, role, includeQualifiers, includeClassOrigin, propertyList}},
+		func(ctx context.Context, op *ClientCall) (interface{}, error) {
+			return d.c.ReferenceClasses(ctx, op.Namespace, className, resultClass, role, includeQualifiers, includeClassOrigin, propertyList)
+		})
+	classes, _ := result.([]string)
+	return classes, err
+}
+
+func (d *decoratedClient) InvokeMethod(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	op := instanceCall("InvokeMethod", namespaceName, instanceName, inParams)
+	op.MethodName = methodName
+	result, err := d.call(ctx, op, func(ctx context.Context, op *ClientCall) (interface{}, error) {
+		returnValue, outParams, err := d.c.InvokeMethod(ctx, op.Namespace, instanceName, methodName, inParams)
+		return &MethodOutput{ReturnValue: returnValue, OutParams: outParams}, err
+	})
+	if output, ok := result.(*MethodOutput); ok && nil != output {
+		return output.ReturnValue, output.OutParams, err
+	}
+	return nil, nil, err
+}
+
+func (d *decoratedClient) InvokeStaticMethod(ctx context.Context, namespaceName string, className string,
+	methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	op := &ClientCall{Name: "InvokeStaticMethod", Namespace: namespaceName, ClassName: className,
+		MethodName: methodName, Args: []interface{}{inParams}}
+	result, err := d.call(ctx, op, func(ctx context.Context, op *ClientCall) (interface{}, error) {
+		returnValue, outParams, err := d.c.InvokeStaticMethod(ctx, op.Namespace, className, methodName, inParams)
+		return &MethodOutput{ReturnValue: returnValue, OutParams: outParams}, err
+	})
+	if output, ok := result.(*MethodOutput); ok && nil != output {
+		return output.ReturnValue, output.OutParams, err
+	}
+	return nil, nil, err
+}
+
+// DefaultNamespace returns the decorator which sends the operations with
+// the empty namespace to the namespace.
+func DefaultNamespace(namespaceName string) Decorator {
+	return func(ctx context.Context, op *ClientCall, next Invoker) (interface{}, error) {
+		if "" == op.Namespace && "EnumerateNamespaces" != op.Name {
+			op.Namespace = namespaceName
+		}
+		return next(ctx, op)
+	}
+}
+
+// ReadOnly returns the decorator which rejects the method invocations with
+// CIM_ERR_ACCESS_DENIED, the methods in allowedMethods (such as
+// "GetSupportedSizeRange") are still invoked.
+func ReadOnly(allowedMethods ...string) Decorator {
+	return func(ctx context.Context, op *ClientCall, next Invoker) (interface{}, error) {
+		if op.IsReadOnly() {
+			return next(ctx, op)
+		}
+		for _, name := range allowedMethods {
+			if strings.EqualFold(name, op.MethodName) {
+				return next(ctx, op)
+			}
+		}
+		return nil, WBEMException(CIM_ERR_ACCESS_DENIED,
+			"method '"+op.ClassName+"."+op.MethodName+"' is rejected by the read-only client")
+	}
+}
+
+// TraceEvent is the event of an operation which is passed to the callback
+// of Trace.
+type TraceEvent struct {
+	Call     *ClientCall
+	Start    time.Time
+	Duration time.Duration
+	// Count is the number of the returned elements if the result is a slice.
+	Count int
+	Err   error
+}
+
+// Trace returns the decorator which calls cb after every operation.
+func Trace(cb func(event *TraceEvent)) Decorator {
+	return func(ctx context.Context, op *ClientCall, next Invoker) (interface{}, error) {
+		start := time.Now()
+		result, err := next(ctx, op)
+		cb(&TraceEvent{Call: op, Start: start, Duration: time.Since(start), Count: resultCount(result), Err: err})
+		return result, err
+	}
+}
+
+func resultCount(result interface{}) int {
+	switch values := result.(type) {
+	case []string:
+		return len(values)
+	case []CIMInstanceName:
+		return len(values)
+	case []CIMInstanceWithName:
+		return len(values)
+	case []CIMInstance:
+		return len(values)
+	case []CimQualifierDeclaration:
+		return len(values)
+	case []CimClass:
+		return len(values)
+	case nil:
+		return 0
+	}
+	return 1
+}
+
+// OperationCache caches the results of the read-only operations for the
+// TTL, the errors aren't cached. The cached slices are shared by the
+// callers, so they must not be modified. A method invocation purges the
+// cache because it may change the server, the expired results are removed
+// when the results are added.
+type OperationCache struct {
+	// TTL is the time to live of the results, the results are kept until
+	// Purge if TTL is zero.
+	TTL time.Duration
+	// Operations is the names of the cached operations, all the read-only
+	// operations are cached if it is empty.
+	Operations []string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	swept   time.Time
+}
+
+type cacheEntry struct {
+	result  interface{}
+	expires time.Time
+}
+
+// NewOperationCache creates a cache, Decorate is the decorator of it.
+func NewOperationCache(ttl time.Duration, operations ...string) *OperationCache {
+	return &OperationCache{TTL: ttl, Operations: operations}
+}
+
+// Purge removes all the results in the cache.
+func (cache *OperationCache) Purge() {
+	cache.mu.Lock()
+	cache.entries = nil
+	cache.mu.Unlock()
+}
+
+func (cache *OperationCache) cached(op *ClientCall) bool {
+	if !op.IsReadOnly() {
+		return false
+	}
+	if 0 == len(cache.Operations) {
+		return true
+	}
+	for _, name := range cache.Operations {
+		if name == op.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Decorate is the Decorator of the cache.
+func (cache *OperationCache) Decorate(ctx context.Context, op *ClientCall, next Invoker) (interface{}, error) {
+	if !op.IsReadOnly() {
+		result, err := next(ctx, op)
+		cache.Purge()
+		return result, err
+	}
+	if !cache.cached(op) {
+		return next(ctx, op)
+	}
+
+	key := op.Key()
+	now := time.Now()
+	cache.mu.Lock()
+	entry, ok := cache.entries[key]
+	cache.mu.Unlock()
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry.result, nil
+	}
+
+	result, err := next(ctx, op)
+	if nil != err {
+		return result, err
+	}
+	entry = cacheEntry{result: result}
+	if cache.TTL > 0 {
+		entry.expires = now.Add(cache.TTL)
+	}
+	cache.mu.Lock()
+	if nil == cache.entries {
+		cache.entries = map[string]cacheEntry{}
+	}
+	cache.entries[key] = entry
+	if cache.TTL > 0 && now.Sub(cache.swept) >= cache.TTL {
+		cache.swept = now
+		for k, e := range cache.entries {
+			if !now.Before(e.expires) {
+				delete(cache.entries, k)
+			}
+		}
+	}
+	cache.mu.Unlock()
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package gowbem
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClient counts the calls, the other operations aren't implemented.
+type fakeClient struct {
+	WBEMClient
+	namespaces []string
+	calls      int
+}
+
+func (c *fakeClient) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error) {
+	c.calls++
+	c.namespaces = append(c.namespaces, namespaceName)
+	if "CIM_Missing" == className {
+		return nil, WBEMException(CIM_ERR_INVALID_CLASS, className)
+	}
+	return []CIMInstanceName{&CimInstanceName{ClassName: className}}, nil
+}
+
+func (c *fakeClient) GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName CIMInstanceName, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	c.calls++
+	return &CimInstance{ClassName: instanceName.GetClassName()}, nil
+}
+
+func (c *fakeClient) EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error) {
+	c.calls++
+	if nil != cb {
+		cb(2, 2)
+	}
+	return []string{"root/cimv2"}, nil
+}
+
+func (c *fakeClient) InvokeMethod(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	c.calls++
+	return &CimValue{Value: "0"}, nil, nil
+}
+
+func TestDecorate(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClient{}
+	cache := NewOperationCache(time.Hour)
+	var events []*TraceEvent
+	c := Decorate(fake, Trace(func(event *TraceEvent) {
+		events = append(events, event)
+	}), DefaultNamespace("root/cimv2"), ReadOnly("GetSupportedSizeRange"), cache.Decorate)
+
+	for idx := 0; idx < 2; idx++ {
+		names, err := c.EnumerateInstanceNames(ctx, "", "CIM_Disk")
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 1 != len(names) || "CIM_Disk" != names[0].GetClassName() {
+			t.Errorf("%#v", names)
+		}
+	}
+	if 1 != fake.calls || "root/cimv2" != fake.namespaces[0] {
+		t.Error(fake.calls, fake.namespaces)
+	}
+	if _, err := c.EnumerateInstanceNames(ctx, "root/interop", "CIM_Disk"); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != fake.calls || "root/interop" != fake.namespaces[1] {
+		t.Error(fake.calls, fake.namespaces)
+	}
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := c.EnumerateInstanceNames(ctx, "", "CIM_Missing")
+		if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_INVALID_CLASS != code {
+			t.Error(err)
+		}
+	}
+	if 4 != fake.calls {
+		t.Error("the errors are cached,", fake.calls)
+	}
+
+	disk := &CimInstanceName{ClassName: "CIM_Disk", KeyBindings: CimKeyBindings{
+		{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d1"}}}}
+	instance, err := c.GetInstanceByInstanceName(ctx, "", disk, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "CIM_Disk" != instance.GetClassName() || 5 != fake.calls {
+		t.Error(instance.GetClassName(), fake.calls)
+	}
+
+	_, _, err = c.InvokeMethod(ctx, "", disk, "Reset", nil)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_ACCESS_DENIED != code {
+		t.Error(err)
+	}
+	if 5 != fake.calls {
+		t.Error(fake.calls)
+	}
+	returnValue, _, err := c.InvokeMethod(ctx, "", disk, "getSupportedSizeRange", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "0" != returnValue.String() || 6 != fake.calls {
+		t.Error(returnValue, fake.calls)
+	}
+
+	// the method invocation purges the cache
+	if _, err := c.GetInstanceByInstanceName(ctx, "", disk, false, false, false, nil); nil != err {
+		t.Fatal(err)
+	}
+	if 7 != fake.calls {
+		t.Error(fake.calls)
+	}
+
+	if 9 != len(events) {
+		t.Fatal(len(events))
+	}
+	if event := events[0]; "EnumerateInstanceNames" != event.Call.Name || "root/cimv2" != event.Call.Namespace ||
+		1 != event.Count || nil != event.Err {
+		t.Errorf("%#v", event)
+	}
+	if event := events[6]; "InvokeMethod" != event.Call.Name || "Reset" != event.Call.MethodName || nil == event.Err {
+		t.Errorf("%#v", event)
+	}
+}
+
+func TestOperationCache(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClient{}
+	cache := NewOperationCache(50 * time.Millisecond)
+	c := Decorate(fake, cache.Decorate)
+
+	for idx := 0; idx < 2; idx++ {
+		done := 0
+		names, err := c.EnumerateNamespaces(ctx, nil, time.Second, func(total, n int) {
+			done = n
+		})
+		if nil != err || 1 != len(names) {
+			t.Fatal(names, err)
+		}
+		if 0 == done {
+			t.Error("cb isn't called at", idx)
+		}
+	}
+	if 1 != fake.calls {
+		t.Error(fake.calls)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "CIM_Disk"); nil != err {
+		t.Fatal(err)
+	}
+	cache.mu.Lock()
+	count := len(cache.entries)
+	cache.mu.Unlock()
+	if 1 != count {
+		t.Error("expired results aren't removed,", count)
+	}
+}
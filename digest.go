@@ -0,0 +1,162 @@
+package gowbem
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// digestAuth is the state of the HTTP Digest authentication (RFC 7616),
+// the challenge is kept so that the next requests are authorized without
+// the 401 round trip.
+type digestAuth struct {
+	mu        sync.Mutex
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        uint32
+}
+
+// parseDigestChallenge parses the Digest challenge in the WWW-Authenticate
+// header, it returns nil if it isn't a Digest challenge.
+func parseDigestChallenge(header string) *digestAuth {
+	header = strings.TrimSpace(header)
+	if len(header) < 7 || !strings.EqualFold("digest ", header[:7]) {
+		return nil
+	}
+	auth := &digestAuth{}
+	for _, field := range splitDigestFields(header[7:]) {
+		idx := strings.IndexByte(field, '=')
+		if idx < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(field[:idx]))
+		value := strings.Trim(strings.TrimSpace(field[idx+1:]), "\"")
+		switch name {
+		case "realm":
+			auth.realm = value
+		case "nonce":
+			auth.nonce = value
+		case "opaque":
+			auth.opaque = value
+		case "algorithm":
+			auth.algorithm = value
+		case "qop":
+			for _, qop := range strings.Split(value, ",") {
+				if "auth" == strings.TrimSpace(qop) {
+					auth.qop = "auth"
+				}
+			}
+		}
+	}
+	if "" == auth.nonce {
+		return nil
+	}
+	return auth
+}
+
+// splitDigestFields splits the fields by the commas which aren't quoted.
+func splitDigestFields(s string) []string {
+	var fields []string
+	quoted, start := false, 0
+	for idx := 0; idx < len(s); idx++ {
+		switch s[idx] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, s[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
+func (auth *digestAuth) newHash() (hash.Hash, error) {
+	switch strings.TrimSuffix(strings.ToUpper(auth.algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New(), nil
+	case "SHA-256":
+		return sha256.New(), nil
+	}
+	return nil, errors.New("digest algorithm '" + auth.algorithm + "' isn't supported")
+}
+
+// authorization returns the value of the Authorization header.
+func (auth *digestAuth) authorization(method, uri, username, password string) (string, error) {
+	h, err := auth.newHash()
+	if nil != err {
+		return "", err
+	}
+	sum := func(s string) string {
+		h.Reset()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	var bs [8]byte
+	if _, err := rand.Read(bs[:]); nil != err {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(bs[:])
+
+	auth.mu.Lock()
+	auth.nc++
+	nc := auth.nc
+	auth.mu.Unlock()
+	ncString := strconv.FormatUint(uint64(nc)+0x100000000, 16)[1:]
+
+	ha1 := sum(username + ":" + auth.realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(auth.algorithm), "-SESS") {
+		ha1 = sum(ha1 + ":" + auth.nonce + ":" + cnonce)
+	}
+	ha2 := sum(method + ":" + uri)
+
+	var response string
+	if "" == auth.qop {
+		response = sum(ha1 + ":" + auth.nonce + ":" + ha2)
+	} else {
+		response = sum(ha1 + ":" + auth.nonce + ":" + ncString + ":" + cnonce + ":" + auth.qop + ":" + ha2)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`Digest username="`)
+	buf.WriteString(username)
+	buf.WriteString(`", realm="`)
+	buf.WriteString(auth.realm)
+	buf.WriteString(`", nonce="`)
+	buf.WriteString(auth.nonce)
+	buf.WriteString(`", uri="`)
+	buf.WriteString(uri)
+	buf.WriteString(`", response="`)
+	buf.WriteString(response)
+	buf.WriteString(`"`)
+	if "" != auth.algorithm {
+		buf.WriteString(`, algorithm=`)
+		buf.WriteString(auth.algorithm)
+	}
+	if "" != auth.opaque {
+		buf.WriteString(`, opaque="`)
+		buf.WriteString(auth.opaque)
+		buf.WriteString(`"`)
+	}
+	if "" != auth.qop {
+		buf.WriteString(`, qop=`)
+		buf.WriteString(auth.qop)
+		buf.WriteString(`, nc=`)
+		buf.WriteString(ncString)
+		buf.WriteString(`, cnonce="`)
+		buf.WriteString(cnonce)
+		buf.WriteString(`"`)
+	}
+	return buf.String(), nil
+}
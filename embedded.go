@@ -0,0 +1,332 @@
+package gowbem
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The values of the EmbeddedObject attribute.
+const (
+	EmbeddedObjectInstance = "instance"
+	EmbeddedObjectObject   = "object"
+)
+
+// embeddedObjectAttr returns the EmbeddedObject attribute, the attribute
+// EMBEDDEDOBJECT which is sent by some old servers is accepted.
+func embeddedObjectAttr(start xml.StartElement) string {
+	for _, attr := range start.Attr {
+		if strings.EqualFold("EmbeddedObject", attr.Name.Local) {
+			return strings.ToLower(strings.TrimSpace(attr.Value))
+		}
+	}
+	return ""
+}
+
+func (self *CimProperty) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimProperty
+	if err := d.DecodeElement((*plain)(self), &start); nil != err {
+		return err
+	}
+	self.EmbeddedObject = embeddedObjectAttr(start)
+	return nil
+}
+
+func (self *CimPropertyArray) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimPropertyArray
+	if err := d.DecodeElement((*plain)(self), &start); nil != err {
+		return err
+	}
+	self.EmbeddedObject = embeddedObjectAttr(start)
+	return nil
+}
+
+func (paramValue *CimParamValue) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimParamValue
+	if err := d.DecodeElement((*plain)(paramValue), &start); nil != err {
+		return err
+	}
+	paramValue.EmbeddedObject = embeddedObjectAttr(start)
+	return nil
+}
+
+func (self *CimReturnValue) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimReturnValue
+	if err := d.DecodeElement((*plain)(self), &start); nil != err {
+		return err
+	}
+	self.EmbeddedObject = embeddedObjectAttr(start)
+	return nil
+}
+
+// EmbeddedKind returns "instance" or "object" if the element is marked by
+// the EmbeddedObject attribute or by the EmbeddedInstance or EmbeddedObject
+// qualifiers, it returns "" if the element isn't an embedded object.
+func EmbeddedKind(embeddedObject string, qualifiers []CimQualifier) string {
+	switch strings.ToLower(strings.TrimSpace(embeddedObject)) {
+	case EmbeddedObjectInstance:
+		return EmbeddedObjectInstance
+	case EmbeddedObjectObject:
+		return EmbeddedObjectObject
+	}
+	return embeddedKind(qualifiers)
+}
+
+// DecodeEmbeddedObject decodes the INSTANCE or the CLASS in the value, the
+// result is a *CimInstance or a *CimClass, nil is returned if the value is
+// empty. The embedded objects in the properties of the result are decoded
+// too, so the errors of them are returned here.
+func DecodeEmbeddedObject(s string) (interface{}, error) {
+	value, err := decodeEmbeddedObject(s)
+	if nil != err || nil == value {
+		return value, err
+	}
+	var properties []CimAnyProperty
+	switch v := value.(type) {
+	case *CimInstance:
+		properties = v.Properties
+	case *CimClass:
+		properties = v.Properties
+	}
+	for idx := range properties {
+		pr := properties[idx].Get()
+		if _, ok := pr.(*CimPropertyReference); ok || "" == embeddedKindOf(pr) {
+			continue
+		}
+		if _, err := GetEmbeddedValue(pr); nil != err {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func decodeEmbeddedObject(s string) (interface{}, error) {
+	text := strings.TrimSpace(s)
+	if "" == text {
+		return nil, nil
+	}
+
+	d := xml.NewDecoder(strings.NewReader(text))
+	for {
+		token, err := d.Token()
+		if nil != err {
+			return nil, errors.New("'" + abbreviate(text) + "' isn't a embedded object, " + err.Error())
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "INSTANCE":
+			instance := &CimInstance{}
+			if err := d.DecodeElement(instance, &start); nil != err {
+				return nil, errors.New("embedded instance is invalid, " + err.Error())
+			}
+			return instance, nil
+		case "CLASS":
+			class := &CimClass{}
+			if err := d.DecodeElement(class, &start); nil != err {
+				return nil, errors.New("embedded class is invalid, " + err.Error())
+			}
+			return class, nil
+		}
+		return nil, errors.New("'" + start.Name.Local + "' isn't a embedded object, INSTANCE or CLASS is excepted")
+	}
+}
+
+func abbreviate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
+
+func embeddedKindOf(pr CIMProperty) string {
+	switch p := pr.(type) {
+	case *CimProperty:
+		return EmbeddedKind(p.EmbeddedObject, p.Qualifiers)
+	case *CimPropertyArray:
+		return EmbeddedKind(p.EmbeddedObject, p.Qualifiers)
+	}
+	return ""
+}
+
+// decodeEmbeddedValue decodes the value and checks it by the kind, the
+// embedded instance must not be a class.
+func decodeEmbeddedValue(name, kind, s string) (interface{}, error) {
+	value, err := DecodeEmbeddedObject(s)
+	if nil != err {
+		return nil, errors.New("'" + name + "' is invalid, " + err.Error())
+	}
+	if class, ok := value.(*CimClass); ok && EmbeddedObjectInstance == kind {
+		return nil, errors.New("'" + name + "' is an embedded instance, but the value is the class '" + class.Name + "'")
+	}
+	return value, nil
+}
+
+// GetEmbeddedValue decodes the value of the property which is an embedded
+// object, the result is a *CimInstance, a *CimClass or nil for a scalar and
+// a []interface{} of them for an array, the empty values in the array are
+// nil.
+func GetEmbeddedValue(pr CIMProperty) (interface{}, error) {
+	kind := embeddedKindOf(pr)
+	if "" == kind {
+		return nil, errors.New("'" + pr.GetName() + "' isn't an embedded object")
+	}
+	switch p := pr.(type) {
+	case *CimProperty:
+		if nil == p.Value {
+			return nil, nil
+		}
+		return decodeEmbeddedValue(p.Name, kind, p.Value.Value)
+	case *CimPropertyArray:
+		return decodeEmbeddedArray(p.Name, kind, p.ValueArray)
+	}
+	return nil, errors.New("'" + pr.GetName() + "' isn't an embedded object")
+}
+
+func decodeEmbeddedArray(name, kind string, array *CimValueArray) (interface{}, error) {
+	if nil == array {
+		return nil, nil
+	}
+	values := make([]interface{}, len(array.Values))
+	for idx, v := range array.Values {
+		if nil == v.Value {
+			continue
+		}
+		value, err := decodeEmbeddedValue(fmt.Sprintf("%s[%d]", name, idx), kind, v.Value.Value)
+		if nil != err {
+			return nil, err
+		}
+		values[idx] = value
+	}
+	return values, nil
+}
+
+// GetEmbeddedParamValue is like GetEmbeddedValue, but for the parameter,
+// the EmbeddedInstance or EmbeddedObject qualifiers of the declaration of
+// the parameter are used if the attribute EmbeddedObject is missing.
+func GetEmbeddedParamValue(param *CimParamValue, qualifiers []CimQualifier) (interface{}, error) {
+	kind := EmbeddedKind(param.EmbeddedObject, qualifiers)
+	if "" == kind {
+		return nil, errors.New("'" + param.Name + "' isn't an embedded object")
+	}
+	switch {
+	case nil != param.Value:
+		return decodeEmbeddedValue(param.Name, kind, param.Value.Value)
+	case nil != param.ValueArray:
+		return decodeEmbeddedArray(param.Name, kind, param.ValueArray)
+	}
+	return nil, nil
+}
+
+// GetEmbeddedReturnValue decodes the return value which is an embedded
+// object.
+func GetEmbeddedReturnValue(returnValue *CimReturnValue, qualifiers []CimQualifier) (interface{}, error) {
+	kind := EmbeddedKind(returnValue.EmbeddedObject, qualifiers)
+	if "" == kind {
+		return nil, errors.New("return value isn't an embedded object")
+	}
+	if nil == returnValue.Value {
+		return nil, nil
+	}
+	return decodeEmbeddedValue("ReturnValue", kind, returnValue.Value.Value)
+}
+
+// EncodeEmbeddedObject encodes the *CimInstance, the *CimValueNamedInstance
+// or the *CimClass into the value of an embedded object, the kind of it is
+// returned too.
+func EncodeEmbeddedObject(value interface{}) (string, string, error) {
+	var v interface{}
+	kind := EmbeddedObjectInstance
+	switch o := value.(type) {
+	case *CimInstance:
+		v = o
+	case CimInstance:
+		v = &o
+	case *CimValueNamedInstance:
+		v = &o.Instance
+	case *CimClass:
+		v, kind = o, EmbeddedObjectObject
+	case CimClass:
+		v, kind = &o, EmbeddedObjectObject
+	default:
+		return "", "", errors.New("type '" + fmt.Sprintf("%T", value) + "' isn't a embedded object")
+	}
+	bs, err := xml.Marshal(v)
+	if nil != err {
+		return "", "", err
+	}
+	return string(bs), kind, nil
+}
+
+// NewEmbeddedProperty creates the property of the embedded object, the
+// value is encoded by EncodeEmbeddedObject, nil is the null value.
+func NewEmbeddedProperty(name string, value interface{}) (*CimProperty, error) {
+	pr := &CimProperty{Name: name, Type: "string", EmbeddedObject: EmbeddedObjectObject}
+	if isNilValue(value) {
+		return pr, nil
+	}
+	s, kind, err := EncodeEmbeddedObject(value)
+	if nil != err {
+		return nil, errors.New("'" + name + "' is invalid, " + err.Error())
+	}
+	pr.EmbeddedObject = kind
+	pr.Value = &CimValue{Value: s}
+	return pr, nil
+}
+
+// NewEmbeddedPropertyArray creates the array property of the embedded
+// objects, the kind is "instance" if all the values are instances.
+func NewEmbeddedPropertyArray(name string, values []interface{}) (*CimPropertyArray, error) {
+	array, kind, err := encodeEmbeddedArray(name, values)
+	if nil != err {
+		return nil, err
+	}
+	return &CimPropertyArray{Name: name, Type: "string", EmbeddedObject: kind, ValueArray: array}, nil
+}
+
+// NewEmbeddedParamValue creates the parameter of the embedded object, the
+// value may be a []interface{} for an array.
+func NewEmbeddedParamValue(name string, value interface{}) (*CimParamValue, error) {
+	param := &CimParamValue{Name: name, ParamType: "string", EmbeddedObject: EmbeddedObjectObject}
+	if isNilValue(value) {
+		return param, nil
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		array, kind, err := encodeEmbeddedArray(name, v)
+		if nil != err {
+			return nil, err
+		}
+		param.EmbeddedObject, param.ValueArray = kind, array
+		return param, nil
+	}
+	s, kind, err := EncodeEmbeddedObject(value)
+	if nil != err {
+		return nil, errors.New("'" + name + "' is invalid, " + err.Error())
+	}
+	param.EmbeddedObject, param.Value = kind, &CimValue{Value: s}
+	return param, nil
+}
+
+func encodeEmbeddedArray(name string, values []interface{}) (*CimValueArray, string, error) {
+	array := &CimValueArray{Values: make([]CimValueOrNull, len(values))}
+	kind := EmbeddedObjectInstance
+	for idx, value := range values {
+		if isNilValue(value) {
+			array.Values[idx].Null = &CimValueNull{}
+			continue
+		}
+		s, k, err := EncodeEmbeddedObject(value)
+		if nil != err {
+			return nil, "", errors.New("'" + fmt.Sprintf("%s[%d]", name, idx) + "' is invalid, " + err.Error())
+		}
+		if EmbeddedObjectObject == k {
+			kind = k
+		}
+		array.Values[idx].Value = &CimValue{Value: s}
+	}
+	return array, kind, nil
+}
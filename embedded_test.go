@@ -0,0 +1,278 @@
+package gowbem
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readResponse(t *testing.T, file string) *CIM {
+	bs, err := os.ReadFile(filepath.Join("testfiles", file))
+	if nil != err {
+		t.Fatal(err)
+	}
+	cim := &CIM{}
+	if err := xml.Unmarshal(bs, cim); nil != err {
+		t.Fatal(err)
+	}
+	return cim
+}
+
+func embeddedValue(t *testing.T, instance *CimInstance, name string) interface{} {
+	pr := instance.GetPropertyByName(name)
+	if nil == pr {
+		t.Fatal(name, "isn't found")
+	}
+	value, err := GetEmbeddedValue(pr)
+	if nil != err {
+		t.Fatal(name, err)
+	}
+	return value
+}
+
+func TestEmbeddedObjectGetInstance(t *testing.T) {
+	cim := readResponse(t, "EmbObjGetInstance.xml")
+	instance := &cim.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances[0].Instance
+
+	if class, ok := embeddedValue(t, instance, "ClassValueWithObjAttr").(*CimClass); !ok || "MyTestClass" != class.Name {
+		t.Errorf("%#v", class)
+	}
+	values := embeddedValue(t, instance, "ClassValueArrayWithObjAttr").([]interface{})
+	if 3 != len(values) || "MyTestClass" != values[1].(*CimClass).Name || nil != values[2] {
+		t.Errorf("%#v", values)
+	}
+
+	pr := instance.GetPropertyByName("InstValueWithInstAttr").(*CimProperty)
+	if EmbeddedObjectInstance != pr.EmbeddedObject {
+		t.Error("EMBEDDEDOBJECT isn't decoded")
+	}
+	if embedded, ok := embeddedValue(t, instance, "InstValueWithInstAttr").(*CimInstance); !ok || "TestCMPI_Instance" != embedded.ClassName {
+		t.Errorf("%#v", embedded)
+	}
+	values = embeddedValue(t, instance, "InstValueArrayWithInstAttr").([]interface{})
+	if 3 != len(values) || "TestCMPI_Instance" != values[0].(*CimInstance).ClassName || nil != values[2] {
+		t.Errorf("%#v", values)
+	}
+
+	for _, name := range []string{"UnValuedWithObjAttr", "UnValuedWithInstAttr"} {
+		if value := embeddedValue(t, instance, name); nil != value {
+			t.Error(name, value)
+		}
+	}
+	if _, err := GetEmbeddedValue(instance.GetPropertyByName("NormalStringProperty")); nil == err {
+		t.Error("error is excepted")
+	}
+}
+
+func TestEmbeddedObjectNegative(t *testing.T) {
+	for _, file := range []string{"EmbObjGetInstNegative.xml", "EmbObjGetInstNegative2.xml"} {
+		cim := readResponse(t, file)
+		instance := &cim.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances[0].Instance
+		_, err := GetEmbeddedValue(instance.GetPropertyByName("InstAttrWithClassValue"))
+		if nil == err || !strings.Contains(err.Error(), "is an embedded instance, but the value is the class 'MyTestClass'") {
+			t.Error(file, err)
+		}
+	}
+
+	for _, s := range []string{"abc", "<VALUE>1</VALUE>", "<INSTANCE CLASSNAME=\"a\"><PROPERTY"} {
+		if _, err := DecodeEmbeddedObject(s); nil == err {
+			t.Error(s, "error is excepted")
+		}
+	}
+}
+
+func TestEmbeddedObjectGetClass(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testfiles", "EmbObjGetClass.xml"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	text := string(bs)
+	text = text[strings.Index(text, "<CLASS "):strings.Index(text, "</IRETURNVALUE>")]
+	class := &CimClass{}
+	if err := xml.Unmarshal([]byte(text), class); nil != err {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		kind  string
+		count int
+	}{
+		{"EmbInstWithQualiAndValue", EmbeddedObjectInstance, 1},
+		{"EmbInstWithQuali", EmbeddedObjectInstance, 0},
+		{"EmbObjWithQualiAndValue", EmbeddedObjectObject, 1},
+		{"EmbInstAWithQualiAndValue", EmbeddedObjectInstance, 2},
+		{"EmbObjAWithQualiAndValue", EmbeddedObjectObject, 2},
+	} {
+		pr := findAnyProperty(class.Properties, test.name).Get()
+		if kind := embeddedKindOf(pr); test.kind != kind {
+			t.Error(test.name, kind)
+		}
+		value, err := GetEmbeddedValue(pr)
+		if nil != err {
+			t.Error(test.name, err)
+			continue
+		}
+		count := 0
+		if values, ok := value.([]interface{}); ok {
+			count = len(values)
+		} else if nil != value {
+			count = 1
+		}
+		if test.count != count {
+			t.Error(test.name, value)
+		}
+	}
+
+	method := findMethod(class, "MethodWithQuali")
+	if kind := embeddedKind(method.Qualifiers); EmbeddedObjectObject != kind {
+		t.Error(kind)
+	}
+	if decl := findParameter(method, "ParamAWithEmbInstQuali"); nil == decl || EmbeddedObjectInstance != embeddedKind(decl.qualifiers) {
+		t.Error(decl)
+	}
+}
+
+func TestEmbeddedObjectMethodResponse(t *testing.T) {
+	cim := readResponse(t, "EmbObjMethodRsp.xml")
+	rsp := cim.Message.SimpleRsp.MethodResponse
+
+	ret, err := GetEmbeddedReturnValue(rsp.ReturnValue, nil)
+	if instance, ok := ret.(*CimInstance); nil != err || !ok || "TestCMPI_Instance" != instance.ClassName {
+		t.Error(ret, err)
+	}
+
+	params := map[string]*CimParamValue{}
+	for idx := range rsp.ParamValues {
+		params[rsp.ParamValues[idx].Name] = &rsp.ParamValues[idx]
+	}
+	if value, err := GetEmbeddedParamValue(params["EmbInstAttrParamWithValue"], nil); nil != err || nil == value.(*CimInstance) {
+		t.Error(value, err)
+	}
+	if value, err := GetEmbeddedParamValue(params["EmbObjAttrParam"], nil); nil != err || nil != value {
+		t.Error(value, err)
+	}
+	value, err := GetEmbeddedParamValue(params["EmbInstAttrParamArrayWithValue"], nil)
+	if values, ok := value.([]interface{}); nil != err || !ok || 3 != len(values) || nil != values[0] || nil == values[2] {
+		t.Error(value, err)
+	}
+
+	method := &CimMethod{Name: "SampleMethod", Type: "string",
+		Qualifiers: []CimQualifier{{Name: "EmbeddedInstance", Type: "string", Value: &CimValue{Value: "TestCMPI_Instance"}}}}
+	var outParams []CIMParamValue
+	for _, p := range params {
+		outParams = append(outParams, p)
+	}
+	result, err := DecodeMethodResult(method, rsp.ReturnValue.Value, outParams)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := result.ReturnValue.(*CimInstance); !ok {
+		t.Errorf("%#v", result.ReturnValue)
+	}
+	if values, ok := result.OutParams["EmbInstAttrParamArrayWithValue"].([]interface{}); !ok || 3 != len(values) {
+		t.Errorf("%#v", result.OutParams["EmbInstAttrParamArrayWithValue"])
+	}
+}
+
+func TestNestedEmbeddedInstance(t *testing.T) {
+	cim := readResponse(t, "NestedEmbInst.xml")
+	instance := &cim.Message.SimpleRsp.IMethodResponse.ReturnValue.Instances[0]
+
+	job, ok := embeddedValue(t, instance, "SourceInstance").(*CimInstance)
+	if !ok || "LMI_StorageJob" != job.ClassName {
+		t.Fatalf("%#v", job)
+	}
+	if value := embeddedValue(t, job, "JobOutParameters"); nil != value {
+		t.Error(value)
+	}
+	params, ok := embeddedValue(t, job, "JobInParameters").(*CimInstance)
+	if !ok || "CIM_ManagedElement" != params.ClassName {
+		t.Fatalf("%#v", params)
+	}
+	if size := params.GetPropertyByName("Size").GetValue(); "10000000" != size {
+		t.Error(size)
+	}
+	extent := params.GetPropertyByName("Extent").(*CimPropertyReference)
+	if path := ObjectPathFromReference(extent.ValueReference); "CIM_StorageExtent" != path.ClassName || 4 != len(path.KeyBindings) {
+		t.Error(path)
+	}
+
+	// encode it again, the nested instance is escaped twice.
+	pr, err := NewEmbeddedProperty("SourceInstance", job)
+	if nil != err {
+		t.Fatal(err)
+	}
+	bs, err := xml.Marshal(pr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `EmbeddedObject="instance"`) || !strings.Contains(string(bs), "&amp;lt;INSTANCE") {
+		t.Error(string(bs))
+	}
+	decoded := &CimProperty{}
+	if err := xml.Unmarshal(bs, decoded); nil != err {
+		t.Fatal(err)
+	}
+	value, err := GetEmbeddedValue(decoded)
+	if nil != err {
+		t.Fatal(err)
+	}
+	inner, err := GetEmbeddedValue(value.(*CimInstance).GetPropertyByName("JobInParameters"))
+	if nil != err || "CIM_ManagedElement" != inner.(*CimInstance).ClassName {
+		t.Error(inner, err)
+	}
+}
+
+func TestEmbeddedObjectMarshal(t *testing.T) {
+	embedded := &CimInstance{ClassName: "Test_Setting", Properties: []CimAnyProperty{
+		{Property: &CimProperty{Name: "Name", Type: "string", Value: &CimValue{Value: "s1"}}}}}
+	class := &CimClass{Name: "Test_Class"}
+
+	type settings struct {
+		Name    string
+		Setting *CimInstance
+		Classes []*CimClass
+		Other   CIMInstance
+	}
+	instance, err := MarshalInstance("Test_Settings", &settings{Name: "a", Setting: embedded, Classes: []*CimClass{class, nil}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if pr := instance.GetPropertyByName("Setting").(*CimProperty); EmbeddedObjectInstance != pr.EmbeddedObject || nil == pr.Value {
+		t.Errorf("%#v", pr)
+	}
+	if pr := instance.GetPropertyByName("Classes").(*CimPropertyArray); EmbeddedObjectObject != pr.EmbeddedObject || 2 != len(pr.ValueArray.Values) {
+		t.Errorf("%#v", pr)
+	}
+	if pr := instance.GetPropertyByName("Other").(*CimProperty); nil != pr.Value {
+		t.Errorf("%#v", pr)
+	}
+
+	var s settings
+	if err := UnmarshalInstance(instance, &s); nil != err {
+		t.Fatal(err)
+	}
+	if nil == s.Setting || "s1" != s.Setting.GetPropertyByName("Name").GetValue() ||
+		2 != len(s.Classes) || "Test_Class" != s.Classes[0].Name || nil != s.Classes[1] || nil != s.Other {
+		t.Errorf("%#v", s)
+	}
+
+	params, err := MarshalParamValues(&struct {
+		Setting  CIMInstance
+		Settings []*CimInstance
+	}{Setting: embedded, Settings: []*CimInstance{embedded}})
+	if nil != err || 2 != len(params) {
+		t.Fatal(params, err)
+	}
+	if p := params[1].(*CimParamValue); EmbeddedObjectInstance != p.EmbeddedObject || 1 != len(p.ValueArray.Values) {
+		t.Errorf("%#v", p)
+	}
+
+	instance.Properties[1].Property.Value.Value = "<CLASS NAME=\"x\"/>"
+	if err := UnmarshalInstance(instance, &s); nil == err {
+		t.Error("error is excepted")
+	}
+}
@@ -104,3 +104,34 @@ func IsErrNotSupported(e error) bool {
 	}
 	return false
 }
+
+func (e *WbemError) Code() CIMStatusCode {
+	return e.code
+}
+
+func (e *WbemError) Message() string {
+	return e.msg
+}
+
+// GetCIMStatusCode returns the CIM status code carried by e, it returns false
+// when e isn't a CIM error.
+func GetCIMStatusCode(e error) (CIMStatusCode, bool) {
+	if we, ok := e.(*WbemError); ok {
+		return we.code, true
+	}
+	if fe, ok := e.(*FaultError); ok {
+		return GetCIMStatusCode(fe.err)
+	}
+	return 0, false
+}
+
+// IsErrUnavailable returns true if the class or the operation isn't
+// implemented by the server or nothing is found, such errors are usually
+// skipped while the server is explored.
+func IsErrUnavailable(e error) bool {
+	if IsEmptyResults(e) || IsErrNotSupported(e) {
+		return true
+	}
+	code, ok := GetCIMStatusCode(e)
+	return ok && (CIM_ERR_INVALID_CLASS == code || CIM_ERR_NOT_FOUND == code)
+}
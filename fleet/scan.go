@@ -0,0 +1,711 @@
+// Package fleet runs the same job against many CIMOMs concurrently, such as
+// the nightly inventory of the hypervisors and the storage arrays.
+package fleet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Target is a CIMOM which is scanned.
+type Target struct {
+	// Name identifies the target in the results, the host of URL is used
+	// if it is empty.
+	Name string
+	// URL is the url of the CIMOM, the userinfo in it is used if
+	// Credentials is empty.
+	URL string
+	// Credentials is the reference of the credentials which is resolved by
+	// Scanner.Credentials, such as the key in a vault.
+	Credentials string
+	Insecure    bool
+}
+
+// String returns the name of the target.
+func (t *Target) String() string {
+	if "" != t.Name {
+		return t.Name
+	}
+	if u, err := url.Parse(t.URL); nil == err && "" != u.Host {
+		return u.Host
+	}
+	return t.URL
+}
+
+// hostKey is the key of the per-host limit, the targets with the same host
+// and port share the limit.
+func (t *Target) hostKey() string {
+	if u, err := url.Parse(t.URL); nil == err && "" != u.Host {
+		return strings.ToLower(u.Host)
+	}
+	return strings.ToLower(t.URL)
+}
+
+// ClassQuery enumerates the instances of the class.
+type ClassQuery struct {
+	ClassName    string
+	PropertyList []string
+	// NamesOnly is true if only the instance names are enumerated.
+	NamesOnly bool
+}
+
+// AssociationQuery follows the association from every instance of
+// SourceClass, the empty fields match everything as the parameters of
+// AssociatorNames.
+type AssociationQuery struct {
+	SourceClass  string
+	AssocClass   string
+	ResultClass  string
+	Role         string
+	ResultRole   string
+	PropertyList []string
+	// NamesOnly is true if only the names of the associated instances are
+	// returned.
+	NamesOnly bool
+}
+
+// MethodCall invokes the method of every instance of the class, or the
+// static method of the class if Static is true. The methods aren't retried
+// because they may change the server.
+type MethodCall struct {
+	ClassName  string
+	MethodName string
+	InParams   []gowbem.CIMParamValue
+	Static     bool
+}
+
+// Job is the work which is run against every target. The instances of
+// SourceClass and the classes of MethodCall are taken from the results of
+// Classes if they are there, otherwise they are enumerated by name.
+type Job struct {
+	Namespace    string
+	Classes      []ClassQuery
+	Associations []AssociationQuery
+	Methods      []MethodCall
+}
+
+// ClassResult is the result of a ClassQuery.
+type ClassResult struct {
+	Query     *ClassQuery
+	Names     []gowbem.CIMInstanceName
+	Instances []gowbem.CIMInstanceWithName
+	Attempts  int
+	Err       error
+}
+
+// AssociationResult is the result of an AssociationQuery from a source
+// instance, Source is nil if the instances of SourceClass aren't found.
+type AssociationResult struct {
+	Query     *AssociationQuery
+	Source    gowbem.CIMInstanceName
+	Names     []gowbem.CIMInstanceName
+	Instances []gowbem.CIMInstanceWithName
+	Attempts  int
+	Err       error
+}
+
+// MethodResult is the result of a MethodCall, InstanceName is nil for the
+// static method.
+type MethodResult struct {
+	Call         *MethodCall
+	InstanceName gowbem.CIMInstanceName
+	ReturnValue  gowbem.Valuer
+	OutParams    []gowbem.CIMParamValue
+	Err          error
+}
+
+// HostResult is the result of a target.
+type HostResult struct {
+	Target       *Target
+	Start        time.Time
+	Duration     time.Duration
+	Classes      []ClassResult
+	Associations []AssociationResult
+	Methods      []MethodResult
+	// Err is set if the target is failed, such as the connection is
+	// refused, the authorization is failed or the deadline is exceeded,
+	// the results are partial then.
+	Err error
+}
+
+// Errors returns the errors of the queries and the calls, the CIMOM may
+// reject some of them while the others are succeeded.
+func (r *HostResult) Errors() []error {
+	var errs []error
+	for idx := range r.Classes {
+		if nil != r.Classes[idx].Err {
+			errs = append(errs, r.Classes[idx].Err)
+		}
+	}
+	for idx := range r.Associations {
+		if nil != r.Associations[idx].Err {
+			errs = append(errs, r.Associations[idx].Err)
+		}
+	}
+	for idx := range r.Methods {
+		if nil != r.Methods[idx].Err {
+			errs = append(errs, r.Methods[idx].Err)
+		}
+	}
+	return errs
+}
+
+// EventType is the type of Event.
+type EventType int
+
+const (
+	// HostStarted is sent before a target is scanned.
+	HostStarted EventType = iota
+	// RequestRetried is sent before a failed request is retried, Err is
+	// the error of the failed request.
+	RequestRetried
+	// HostFinished is sent after a target is scanned, Err is set if the
+	// target is failed.
+	HostFinished
+)
+
+func (t EventType) String() string {
+	switch t {
+	case HostStarted:
+		return "HostStarted"
+	case RequestRetried:
+		return "RequestRetried"
+	case HostFinished:
+		return "HostFinished"
+	}
+	return "EventType(" + fmt.Sprint(int(t)) + ")"
+}
+
+// Event is the progress of Scan, Done and Total are the numbers of the
+// targets, Failed is the number of the finished targets which are failed.
+type Event struct {
+	Type    EventType
+	Target  *Target
+	Err     error
+	Running int
+	Done    int
+	Failed  int
+	Total   int
+}
+
+// CredentialsFunc resolves the credentials reference of the target.
+type CredentialsFunc func(ctx context.Context, ref string) (*url.Userinfo, error)
+
+// DialFunc creates the client of the target, u is the url of the target
+// with the resolved credentials. The idle connections of the client are
+// closed after the target is finished if it has the CloseIdleConnections
+// method.
+type DialFunc func(ctx context.Context, target *Target, u *url.URL) (gowbem.WBEMClient, error)
+
+// DialCIMXML is the default DialFunc, it creates a gowbem.ClientCIMXML with
+// its own transport, so the connections of other targets aren't closed
+// with it.
+func DialCIMXML(ctx context.Context, target *Target, u *url.URL) (gowbem.WBEMClient, error) {
+	c, err := gowbem.NewClientCIMXML(u, target.Insecure)
+	if nil != err {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: target.Insecure}
+	c.Transport = transport
+	return c, nil
+}
+
+// closeIdleConnections closes the idle connections of the client.
+func closeIdleConnections(c gowbem.WBEMClient) {
+	if closer, ok := c.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// ErrNoCredentials is returned if a target has a credentials reference
+// but Scanner.Credentials is nil.
+var ErrNoCredentials = errors.New("credentials resolver is missing")
+
+// Scanner scans the targets, the zero value is usable.
+type Scanner struct {
+	// Concurrency is the max number of the targets scanned concurrently,
+	// the default is 16.
+	Concurrency int
+	// HostConcurrency is the max number of the concurrent requests to a
+	// host, the targets with the same host and port share it, the default
+	// is 2.
+	HostConcurrency int
+	// HostTimeout is the deadline of a target including the retries, 0 is
+	// unlimited.
+	HostTimeout time.Duration
+	// Retries is the max number of the retries of a request, the requests
+	// are retried only if they are failed by the transport, such as the
+	// connection is reset, the CIM errors aren't retried.
+	Retries int
+	// RetryDelay is the delay before the first retry, it is doubled for
+	// every retry, the default is 1 second.
+	RetryDelay time.Duration
+
+	Credentials CredentialsFunc
+	// Dial creates the clients, the default is DialCIMXML.
+	Dial DialFunc
+	// OnEvent receives the events if it isn't nil, it is never called
+	// concurrently.
+	OnEvent func(Event)
+}
+
+// Scan scans the targets with the job and sends the results to the
+// returned channel which is closed after all the targets are finished.
+// The caller must receive all the results, a result is sent for every
+// target even if ctx is canceled.
+func (s *Scanner) Scan(ctx context.Context, targets []Target, job *Job) <-chan *HostResult {
+	results := make(chan *HostResult)
+	sc := &scan{Scanner: s, job: job, total: len(targets), hosts: map[string]chan struct{}{}}
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 16
+	}
+
+	go func() {
+		defer close(results)
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for idx := range targets {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(target *Target) {
+				defer wg.Done()
+				result := sc.scanHost(ctx, target)
+				<-sem
+				results <- result
+			}(&targets[idx])
+		}
+		wg.Wait()
+	}()
+	return results
+}
+
+// ScanAll is Scan which collects the results, the results are in the
+// order of the targets.
+func (s *Scanner) ScanAll(ctx context.Context, targets []Target, job *Job) []*HostResult {
+	results := make([]*HostResult, 0, len(targets))
+	for result := range s.Scan(ctx, targets, job) {
+		results = append(results, result)
+	}
+	index := map[*Target]int{}
+	for idx := range targets {
+		index[&targets[idx]] = idx
+	}
+	sorted := make([]*HostResult, len(targets))
+	for _, result := range results {
+		sorted[index[result.Target]] = result
+	}
+	return sorted
+}
+
+type scan struct {
+	*Scanner
+	job *Job
+
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+	running int
+	done    int
+	failed  int
+	total   int
+}
+
+func (sc *scan) event(typ EventType, target *Target, err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	switch typ {
+	case HostStarted:
+		sc.running++
+	case HostFinished:
+		sc.running--
+		sc.done++
+		if nil != err {
+			sc.failed++
+		}
+	}
+	if nil != sc.OnEvent {
+		sc.OnEvent(Event{Type: typ, Target: target, Err: err,
+			Running: sc.running, Done: sc.done, Failed: sc.failed, Total: sc.total})
+	}
+}
+
+// hostSemaphore returns the semaphore of the per-host limit.
+func (sc *scan) hostSemaphore(target *Target) chan struct{} {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	key := target.hostKey()
+	sem := sc.hosts[key]
+	if nil == sem {
+		concurrency := sc.HostConcurrency
+		if concurrency <= 0 {
+			concurrency = 2
+		}
+		sem = make(chan struct{}, concurrency)
+		sc.hosts[key] = sem
+	}
+	return sem
+}
+
+func (sc *scan) dial(ctx context.Context, target *Target) (gowbem.WBEMClient, error) {
+	u, err := url.Parse(target.URL)
+	if nil != err {
+		return nil, err
+	}
+	if "" != target.Credentials {
+		if nil == sc.Credentials {
+			return nil, ErrNoCredentials
+		}
+		user, err := sc.Credentials(ctx, target.Credentials)
+		if nil != err {
+			return nil, err
+		}
+		u.User = user
+	}
+	dial := sc.Dial
+	if nil == dial {
+		dial = DialCIMXML
+	}
+	return dial(ctx, target, u)
+}
+
+func (sc *scan) scanHost(ctx context.Context, target *Target) *HostResult {
+	result := &HostResult{Target: target, Start: time.Now()}
+	sc.event(HostStarted, target, nil)
+	defer func() {
+		result.Duration = time.Since(result.Start)
+		sc.event(HostFinished, target, result.Err)
+	}()
+
+	var cancel context.CancelFunc
+	if sc.HostTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, sc.HostTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	if err := ctx.Err(); nil != err {
+		result.Err = err
+		return result
+	}
+	c, err := sc.dial(ctx, target)
+	if nil != err {
+		result.Err = err
+		return result
+	}
+	defer closeIdleConnections(c)
+
+	h := &hostScan{scan: sc, target: target, c: c, ctx: ctx, cancel: cancel,
+		sem: sc.hostSemaphore(target), result: result}
+	h.run()
+	if nil == result.Err && nil != ctx.Err() {
+		result.Err = ctx.Err()
+	}
+	return result
+}
+
+type hostScan struct {
+	*scan
+	target *Target
+	c      gowbem.WBEMClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	result *HostResult
+
+	mu      sync.Mutex
+	sources map[string][]gowbem.CIMInstanceName
+	errs    map[string]error
+}
+
+// isFatal returns true if the error isn't the error of the request, such
+// as the connection is refused, the other requests to the host are
+// cancelled then.
+func isFatal(err error) bool {
+	if _, ok := gowbem.GetCIMStatusCode(err); ok {
+		return false
+	}
+	switch err.(type) {
+	case *gowbem.FaultError, *gowbem.DecodeError:
+		return false
+	}
+	return true
+}
+
+// fail cancels the scan of the host.
+func (h *hostScan) fail(err error) {
+	h.mu.Lock()
+	if nil == h.result.Err {
+		h.result.Err = err
+	}
+	h.mu.Unlock()
+	h.cancel()
+}
+
+// acquire waits for the per-host limit, it returns false if the host is
+// cancelled.
+func (h *hostScan) acquire() bool {
+	select {
+	case h.sem <- struct{}{}:
+		return true
+	case <-h.ctx.Done():
+		return false
+	}
+}
+
+func (h *hostScan) release() {
+	<-h.sem
+}
+
+// do sends the request and retries it if it is failed by the transport,
+// the empty results aren't errors.
+func (h *hostScan) do(retry bool, fn func(ctx context.Context) error) (int, error) {
+	delay := h.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for attempts := 1; ; attempts++ {
+		if !h.acquire() {
+			return attempts - 1, h.ctx.Err()
+		}
+		err := fn(h.ctx)
+		h.release()
+		if nil == err || gowbem.IsEmptyResults(err) {
+			return attempts, nil
+		}
+		if !isFatal(err) {
+			return attempts, err
+		}
+		if nil != h.ctx.Err() {
+			return attempts, h.ctx.Err()
+		}
+		if !retry || attempts > h.Retries || gowbem.ErrUnauthorized == err {
+			h.fail(err)
+			return attempts, err
+		}
+
+		h.event(RequestRetried, h.target, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-h.ctx.Done():
+			timer.Stop()
+			return attempts, h.ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func (h *hostScan) run() {
+	job := h.job
+	namespaceName := job.Namespace
+
+	h.result.Classes = make([]ClassResult, len(job.Classes))
+	var wg sync.WaitGroup
+	for idx := range job.Classes {
+		wg.Add(1)
+		go func(res *ClassResult, query *ClassQuery) {
+			defer wg.Done()
+			res.Query = query
+			res.Attempts, res.Err = h.do(true, func(ctx context.Context) error {
+				var err error
+				if query.NamesOnly {
+					res.Names, err = h.c.EnumerateInstanceNames(ctx, namespaceName, query.ClassName)
+				} else {
+					res.Instances, err = h.c.EnumerateInstances(ctx, namespaceName, query.ClassName,
+						true, false, false, false, query.PropertyList)
+				}
+				return err
+			})
+		}(&h.result.Classes[idx], &job.Classes[idx])
+	}
+	wg.Wait()
+	if nil != h.ctx.Err() {
+		return
+	}
+
+	h.collectSources()
+	if nil != h.ctx.Err() {
+		return
+	}
+
+	type associationTask struct {
+		query  *AssociationQuery
+		source gowbem.CIMInstanceName
+		err    error
+	}
+	var associations []associationTask
+	for idx := range job.Associations {
+		query := &job.Associations[idx]
+		sources, err := h.source(query.SourceClass)
+		if nil != err || 0 == len(sources) {
+			associations = append(associations, associationTask{query: query, err: err})
+			continue
+		}
+		for _, source := range sources {
+			associations = append(associations, associationTask{query: query, source: source})
+		}
+	}
+
+	type methodTask struct {
+		call         *MethodCall
+		instanceName gowbem.CIMInstanceName
+		err          error
+	}
+	var methods []methodTask
+	for idx := range job.Methods {
+		call := &job.Methods[idx]
+		if call.Static {
+			methods = append(methods, methodTask{call: call})
+			continue
+		}
+		instanceNames, err := h.source(call.ClassName)
+		if nil != err {
+			methods = append(methods, methodTask{call: call, err: err})
+			continue
+		}
+		for _, instanceName := range instanceNames {
+			methods = append(methods, methodTask{call: call, instanceName: instanceName})
+		}
+	}
+
+	h.result.Associations = make([]AssociationResult, len(associations))
+	for idx := range associations {
+		task := associations[idx]
+		res := &h.result.Associations[idx]
+		res.Query, res.Source, res.Err = task.query, task.source, task.err
+		if nil == task.source {
+			continue
+		}
+		wg.Add(1)
+		go func(query *AssociationQuery) {
+			defer wg.Done()
+			res.Attempts, res.Err = h.do(true, func(ctx context.Context) error {
+				var err error
+				if query.NamesOnly {
+					res.Names, err = h.c.AssociatorNames(ctx, namespaceName, res.Source,
+						query.AssocClass, query.ResultClass, query.Role, query.ResultRole)
+				} else {
+					res.Instances, err = h.c.AssociatorInstances(ctx, namespaceName, res.Source,
+						query.AssocClass, query.ResultClass, query.Role, query.ResultRole, false, query.PropertyList)
+				}
+				return err
+			})
+		}(task.query)
+	}
+	wg.Wait()
+	if nil != h.ctx.Err() {
+		return
+	}
+
+	h.result.Methods = make([]MethodResult, len(methods))
+	for idx := range methods {
+		task := methods[idx]
+		res := &h.result.Methods[idx]
+		res.Call, res.InstanceName, res.Err = task.call, task.instanceName, task.err
+		if nil != task.err {
+			continue
+		}
+		wg.Add(1)
+		go func(call *MethodCall) {
+			defer wg.Done()
+			_, res.Err = h.do(false, func(ctx context.Context) error {
+				var err error
+				if call.Static {
+					res.ReturnValue, res.OutParams, err = h.c.InvokeStaticMethod(ctx, namespaceName,
+						call.ClassName, call.MethodName, call.InParams)
+				} else {
+					res.ReturnValue, res.OutParams, err = h.c.InvokeMethod(ctx, namespaceName,
+						res.InstanceName, call.MethodName, call.InParams)
+				}
+				return err
+			})
+		}(task.call)
+	}
+	wg.Wait()
+}
+
+// collectSources takes the instance names of the source classes from the
+// results of the class queries, the others are enumerated.
+func (h *hostScan) collectSources() {
+	h.sources = map[string][]gowbem.CIMInstanceName{}
+	h.errs = map[string]error{}
+	for idx := range h.result.Classes {
+		res := &h.result.Classes[idx]
+		key := strings.ToLower(res.Query.ClassName)
+		if nil != res.Err {
+			h.errs[key] = res.Err
+			continue
+		}
+		names := res.Names
+		if !res.Query.NamesOnly {
+			names = make([]gowbem.CIMInstanceName, 0, len(res.Instances))
+			for _, instance := range res.Instances {
+				names = append(names, instance.GetName())
+			}
+		}
+		h.sources[key] = names
+	}
+
+	var classNames []string
+	for _, query := range h.job.Associations {
+		classNames = append(classNames, query.SourceClass)
+	}
+	for _, call := range h.job.Methods {
+		if !call.Static {
+			classNames = append(classNames, call.ClassName)
+		}
+	}
+
+	pending := map[string]string{}
+	for _, className := range classNames {
+		key := strings.ToLower(className)
+		if _, ok := h.sources[key]; ok {
+			continue
+		}
+		if _, ok := h.errs[key]; ok {
+			continue
+		}
+		pending[key] = className
+	}
+
+	var wg sync.WaitGroup
+	for key, className := range pending {
+		wg.Add(1)
+		go func(className, key string) {
+			defer wg.Done()
+			var names []gowbem.CIMInstanceName
+			_, err := h.do(true, func(ctx context.Context) error {
+				var err error
+				names, err = h.c.EnumerateInstanceNames(ctx, h.job.Namespace, className)
+				return err
+			})
+			h.mu.Lock()
+			if nil != err {
+				h.errs[key] = err
+			} else {
+				h.sources[key] = names
+			}
+			h.mu.Unlock()
+		}(className, key)
+	}
+	wg.Wait()
+}
+
+func (h *hostScan) source(className string) ([]gowbem.CIMInstanceName, error) {
+	key := strings.ToLower(className)
+	if err, ok := h.errs[key]; ok {
+		return nil, err
+	}
+	return h.sources[key], nil
+}
@@ -0,0 +1,242 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const testNamespace = "root/cimv2"
+
+const testMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Association : boolean = false, Scope(association), Flavor(DisableOverride, ToSubclass);
+
+class Test_System {
+	[Key] string Name;
+};
+
+class Test_Disk {
+	[Key] string DeviceID;
+	uint64 Size;
+	uint32 Reset();
+};
+
+[Association]
+class Test_SystemDevice {
+	[Key] Test_System REF GroupComponent;
+	[Key] Test_Disk REF PartComponent;
+};
+
+instance of Test_System as $s1 { Name = "s1"; };
+instance of Test_Disk as $d1 { DeviceID = "d1"; Size = 1024; };
+instance of Test_Disk as $d2 { DeviceID = "d2"; Size = 2048; };
+
+instance of Test_SystemDevice { GroupComponent = $s1; PartComponent = $d1; };
+instance of Test_SystemDevice { GroupComponent = $s1; PartComponent = $d2; };
+`
+
+func TestScan(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF(testNamespace, testMOF); nil != err {
+		t.Fatal(err)
+	}
+	m.HandleMethod(testNamespace, "Test_Disk", "Reset", func(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error) {
+		return &gowbem.CimReturnValue{ParamType: "uint32", Value: &gowbem.CimValue{Value: "0"}}, nil, nil
+	})
+	m.InjectFault(wbemtest.Fault{Operation: "AssociatorNames", Times: 1, StatusCode: http.StatusServiceUnavailable})
+	hsrv := m.Start()
+	defer hsrv.Close()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var users []string
+	var events []Event
+	scanner := &Scanner{
+		HostConcurrency: 1,
+		Retries:         2,
+		RetryDelay:      time.Millisecond,
+		Credentials: func(ctx context.Context, ref string) (*url.Userinfo, error) {
+			if "vault:esx" != ref {
+				return nil, errors.New("credentials '" + ref + "' isn't found")
+			}
+			return url.UserPassword("root", "secret"), nil
+		},
+		Dial: func(ctx context.Context, target *Target, u *url.URL) (gowbem.WBEMClient, error) {
+			c, err := DialCIMXML(ctx, target, u)
+			if nil != err {
+				return nil, err
+			}
+			if hsrv.URL != target.URL {
+				return c, nil
+			}
+			mu.Lock()
+			users = append(users, u.User.String())
+			mu.Unlock()
+			return gowbem.Decorate(c, func(ctx context.Context, op *gowbem.ClientCall, next gowbem.Invoker) (interface{}, error) {
+				mu.Lock()
+				if running++; running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+				time.Sleep(time.Millisecond)
+				return next(ctx, op)
+			}), nil
+		},
+		OnEvent: func(event Event) {
+			events = append(events, event)
+		},
+	}
+
+	targets := []Target{
+		{Name: "a", URL: hsrv.URL, Credentials: "vault:esx"},
+		{Name: "b", URL: hsrv.URL},
+		{Name: "c", URL: hsrv.URL, Credentials: "vault:missing"},
+		{URL: "http://127.0.0.1:1"},
+	}
+	job := &Job{
+		Namespace: testNamespace,
+		Classes: []ClassQuery{
+			{ClassName: "Test_Disk", PropertyList: []string{"DeviceID", "Size"}},
+			{ClassName: "Test_Missing", NamesOnly: true},
+		},
+		Associations: []AssociationQuery{
+			{SourceClass: "Test_System", AssocClass: "Test_SystemDevice", ResultClass: "Test_Disk", NamesOnly: true},
+		},
+		Methods: []MethodCall{{ClassName: "Test_Disk", MethodName: "Reset"}},
+	}
+	results := scanner.ScanAll(context.Background(), targets, job)
+	if 4 != len(results) {
+		t.Fatal(len(results))
+	}
+
+	for _, result := range results[:2] {
+		if nil != result.Err {
+			t.Fatal(result.Target, result.Err)
+		}
+		if 2 != len(result.Classes) || 2 != len(result.Classes[0].Instances) {
+			t.Fatalf("%s %#v", result.Target, result.Classes)
+		}
+		if code, ok := gowbem.GetCIMStatusCode(result.Classes[1].Err); !ok || gowbem.CIM_ERR_INVALID_CLASS != code {
+			t.Error(result.Target, result.Classes[1].Err)
+		}
+		if errs := result.Errors(); 1 != len(errs) {
+			t.Error(result.Target, errs)
+		}
+		if 1 != len(result.Associations) || 2 != len(result.Associations[0].Names) ||
+			"Test_System" != result.Associations[0].Source.GetClassName() {
+			t.Errorf("%s %#v", result.Target, result.Associations)
+		}
+		if 2 != len(result.Methods) || nil != result.Methods[1].Err ||
+			"0" != result.Methods[1].ReturnValue.String() {
+			t.Errorf("%s %#v", result.Target, result.Methods)
+		}
+	}
+	if attempts := results[0].Associations[0].Attempts + results[1].Associations[0].Attempts; 3 != attempts {
+		t.Error("attempts is", attempts)
+	}
+	if nil == results[2].Err || nil != results[2].Classes {
+		t.Errorf("%#v", results[2])
+	}
+	if nil == results[3].Err || "127.0.0.1:1" != results[3].Target.String() {
+		t.Errorf("%#v", results[3])
+	}
+
+	if 1 != maxRunning {
+		t.Error("per-host concurrency is", maxRunning)
+	}
+	if 2 != len(users) || (users[0] != "root:secret" && users[1] != "root:secret") {
+		t.Error(users)
+	}
+
+	retried, finished := 0, 0
+	for _, event := range events {
+		switch event.Type {
+		case RequestRetried:
+			if hsrv.URL == event.Target.URL {
+				retried++
+			}
+		case HostFinished:
+			finished++
+		}
+	}
+	if last := events[len(events)-1]; 4 != finished || 4 != last.Done || 2 != last.Failed || 4 != last.Total || 0 != last.Running {
+		t.Errorf("%#v", last)
+	}
+	if 1 != retried {
+		t.Error("retried is", retried)
+	}
+}
+
+func TestScanTimeout(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF(testNamespace, testMOF); nil != err {
+		t.Fatal(err)
+	}
+	m.Latency = 300 * time.Millisecond
+	hsrv := m.Start()
+	defer hsrv.Close()
+
+	scanner := &Scanner{HostTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	results := scanner.ScanAll(context.Background(), []Target{{URL: hsrv.URL}},
+		&Job{Namespace: testNamespace, Classes: []ClassQuery{{ClassName: "Test_Disk"}}})
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Error(results[0].Err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Error("elapsed is", elapsed)
+	}
+}
+
+// idleClient counts the calls of CloseIdleConnections.
+type idleClient struct {
+	gowbem.WBEMClient
+	closed *int32
+}
+
+func (c *idleClient) CloseIdleConnections() {
+	atomic.AddInt32(c.closed, 1)
+}
+
+func TestScanClosesIdleConnections(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF(testNamespace, testMOF); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+
+	var closed int32
+	scanner := &Scanner{Dial: func(ctx context.Context, target *Target, u *url.URL) (gowbem.WBEMClient, error) {
+		c, err := DialCIMXML(ctx, target, u)
+		if nil != err {
+			return nil, err
+		}
+		return gowbem.Decorate(&idleClient{WBEMClient: c, closed: &closed}), nil
+	}}
+	results := scanner.ScanAll(context.Background(), []Target{{URL: hsrv.URL}, {URL: hsrv.URL}},
+		&Job{Namespace: testNamespace, Classes: []ClassQuery{{ClassName: "Test_Disk"}}})
+	for _, result := range results {
+		if nil != result.Err {
+			t.Fatal(result.Err)
+		}
+	}
+	if 2 != atomic.LoadInt32(&closed) {
+		t.Error("idle connections are closed", closed, "times")
+	}
+}
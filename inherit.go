@@ -0,0 +1,213 @@
+package gowbem
+
+import (
+	"errors"
+	"strings"
+)
+
+// InheritClass merges the features of the superclass into the class, the
+// inherited features are marked as propagated and the features of the
+// class override the inherited features with the same name. Only the
+// qualifiers with the ToSubclass flavor are inherited, an error is returned
+// if the class changes the value of a qualifier that isn't Overridable.
+func InheritClass(class, super *CimClass) error {
+	qualifiers, err := inheritQualifiers(class.Qualifiers, super.Qualifiers)
+	if nil != err {
+		return err
+	}
+	class.Qualifiers = qualifiers
+
+	var properties []CimAnyProperty
+	overridden := map[string]bool{}
+	for _, inherited := range super.Properties {
+		name := anyPropertyName(inherited)
+		local := findAnyProperty(class.Properties, name)
+		if nil == local {
+			properties = append(properties, propagateProperty(inherited))
+			continue
+		}
+		overridden[strings.ToLower(name)] = true
+		qualifiers, err := inheritQualifiers(anyPropertyQualifiers(*local), anyPropertyQualifiers(inherited))
+		if nil != err {
+			return err
+		}
+		switch {
+		case nil != local.Property:
+			local.Property.Qualifiers = qualifiers
+		case nil != local.PropertyArray:
+			local.PropertyArray.Qualifiers = qualifiers
+		case nil != local.PropertyReference:
+			local.PropertyReference.Qualifiers = qualifiers
+		}
+		properties = append(properties, *local)
+	}
+	for _, pr := range class.Properties {
+		if !overridden[strings.ToLower(anyPropertyName(pr))] {
+			properties = append(properties, pr)
+		}
+	}
+	class.Properties = properties
+
+	var methods []CimMethod
+	overridden = map[string]bool{}
+	for _, inherited := range super.Methods {
+		var local *CimMethod
+		for idx := range class.Methods {
+			if strings.EqualFold(class.Methods[idx].Name, inherited.Name) {
+				local = &class.Methods[idx]
+				break
+			}
+		}
+		if nil == local {
+			inherited.Propagated = true
+			inherited.Qualifiers = propagateQualifiers(inherited.Qualifiers)
+			methods = append(methods, inherited)
+			continue
+		}
+		overridden[strings.ToLower(local.Name)] = true
+		if local.Qualifiers, err = inheritQualifiers(local.Qualifiers, inherited.Qualifiers); nil != err {
+			return err
+		}
+		methods = append(methods, *local)
+	}
+	for _, method := range class.Methods {
+		if !overridden[strings.ToLower(method.Name)] {
+			methods = append(methods, method)
+		}
+	}
+	class.Methods = methods
+	return nil
+}
+
+func anyPropertyName(pr CimAnyProperty) string {
+	switch {
+	case nil != pr.Property:
+		return pr.Property.Name
+	case nil != pr.PropertyArray:
+		return pr.PropertyArray.Name
+	case nil != pr.PropertyReference:
+		return pr.PropertyReference.Name
+	}
+	return ""
+}
+
+func anyPropertyQualifiers(pr CimAnyProperty) []CimQualifier {
+	switch {
+	case nil != pr.Property:
+		return pr.Property.Qualifiers
+	case nil != pr.PropertyArray:
+		return pr.PropertyArray.Qualifiers
+	case nil != pr.PropertyReference:
+		return pr.PropertyReference.Qualifiers
+	}
+	return nil
+}
+
+func findAnyProperty(properties []CimAnyProperty, name string) *CimAnyProperty {
+	for idx := range properties {
+		if strings.EqualFold(anyPropertyName(properties[idx]), name) {
+			return &properties[idx]
+		}
+	}
+	return nil
+}
+
+// propagateProperty returns a copy of the inherited property.
+func propagateProperty(pr CimAnyProperty) CimAnyProperty {
+	switch {
+	case nil != pr.Property:
+		copied := *pr.Property
+		copied.Propagated = true
+		copied.Qualifiers = propagateQualifiers(copied.Qualifiers)
+		return CimAnyProperty{Property: &copied}
+	case nil != pr.PropertyArray:
+		copied := *pr.PropertyArray
+		copied.Propagated = true
+		copied.Qualifiers = propagateQualifiers(copied.Qualifiers)
+		return CimAnyProperty{PropertyArray: &copied}
+	case nil != pr.PropertyReference:
+		copied := *pr.PropertyReference
+		copied.Propagated = true
+		copied.Qualifiers = propagateQualifiers(copied.Qualifiers)
+		return CimAnyProperty{PropertyReference: &copied}
+	}
+	return pr
+}
+
+// propagateQualifiers returns the qualifiers that are propagated to the
+// subclasses.
+func propagateQualifiers(qualifiers []CimQualifier) []CimQualifier {
+	var results []CimQualifier
+	for _, q := range qualifiers {
+		if q.ToSubclass {
+			q.Propagated = true
+			results = append(results, q)
+		}
+	}
+	return results
+}
+
+// inheritQualifiers merges the propagated qualifiers into the local
+// qualifiers, a qualifier with the DisableOverride flavor can't be changed.
+func inheritQualifiers(local, inherited []CimQualifier) ([]CimQualifier, error) {
+	results := append(make([]CimQualifier, 0, len(local)+len(inherited)), local...)
+	for _, q := range propagateQualifiers(inherited) {
+		var found *CimQualifier
+		for idx := range local {
+			if strings.EqualFold(local[idx].Name, q.Name) {
+				found = &local[idx]
+				break
+			}
+		}
+		if nil == found {
+			results = append(results, q)
+			continue
+		}
+		if !q.Overridable && !sameQualifierValue(found, &q) {
+			return nil, errors.New("qualifier '" + q.Name + "' can't be overridden")
+		}
+	}
+	return results, nil
+}
+
+func sameQualifierValue(a, b *CimQualifier) bool {
+	if (nil == a.Value) != (nil == b.Value) || (nil == a.ValueArray) != (nil == b.ValueArray) {
+		return false
+	}
+	typ := a.Type
+	if "" == typ {
+		typ = b.Type
+	}
+	if nil != a.Value && !sameValue(typ, a.Value.Value, b.Value.Value) {
+		return false
+	}
+	if nil != a.ValueArray {
+		if len(a.ValueArray.Values) != len(b.ValueArray.Values) {
+			return false
+		}
+		for idx := range a.ValueArray.Values {
+			av, bv := a.ValueArray.Values[idx].Value, b.ValueArray.Values[idx].Value
+			if (nil == av) != (nil == bv) || (nil != av && !sameValue(typ, av.Value, bv.Value)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameValue compares the values of the type, such as TRUE and true or 10
+// and 0xA, the strings are compared if the values aren't parsed.
+func sameValue(typ, a, b string) bool {
+	if a == b {
+		return true
+	}
+	av, err := ParseValue(typ, a)
+	if nil != err {
+		return false
+	}
+	bv, err := ParseValue(typ, b)
+	if nil != err {
+		return false
+	}
+	return av == bv
+}
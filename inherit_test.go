@@ -0,0 +1,33 @@
+package gowbem
+
+import (
+	"testing"
+)
+
+func TestInheritQualifiers(t *testing.T) {
+	flavor := CimQualifierFlavor{ToSubclass: true}
+	inherited := []CimQualifier{
+		{CimQualifierFlavor: flavor, Name: "Key", Type: "boolean", Value: &CimValue{Value: "TRUE"}},
+		{CimQualifierFlavor: flavor, Name: "MaxLen", Type: "uint32", Value: &CimValue{Value: "0x10"}},
+		{CimQualifierFlavor: flavor, Name: "Units", Type: "string", Value: &CimValue{Value: "Bytes"}},
+	}
+	local := make([]CimQualifier, 2, 3)
+	local[0] = CimQualifier{Name: "key", Type: "boolean", Value: &CimValue{Value: "true"}}
+	local[1] = CimQualifier{Name: "MaxLen", Type: "uint32", Value: &CimValue{Value: "16"}}
+
+	results, err := inheritQualifiers(local, inherited)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(results) || "Units" != results[2].Name {
+		t.Errorf("%#v", results)
+	}
+	if spare := local[:3]; "" != spare[2].Name {
+		t.Error("qualifiers of the caller are changed,", spare[2].Name)
+	}
+
+	local[1].Value = &CimValue{Value: "32"}
+	if _, err := inheritQualifiers(local, inherited); nil == err {
+		t.Error("excepted is error, actual is ok")
+	}
+}
@@ -0,0 +1,349 @@
+package gowbem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MethodResult is the result of Invoke, the return value and the output
+// parameters are converted by the types declared in the method.
+type MethodResult struct {
+	Method      *CimMethod
+	ReturnValue interface{}
+	// OutParams is keyed by the names of the parameters in the method.
+	OutParams map[string]interface{}
+
+	returnValue Valuer
+	outParams   []CIMParamValue
+}
+
+// Get returns the output parameter, the case of the name is ignored.
+func (r *MethodResult) Get(name string) (interface{}, bool) {
+	for key, value := range r.OutParams {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Unmarshal copies the return value and the output parameters into the
+// struct which v points to, see UnmarshalParamValues.
+func (r *MethodResult) Unmarshal(v interface{}) error {
+	return UnmarshalParamValues(r.returnValue, r.outParams, v)
+}
+
+// Invoke invokes the method of the instance or the class by the path, the
+// class is fetched from the schema cache to look up the signature of the
+// method, the input values are converted by the declared types of the
+// parameters and validated before they are sent.
+//
+// The input values may be the values accepted by FormatValue, the slices of
+// them for the arrays, the *ObjectPath, the CIMInstanceName or the string
+// for the references and the *CimInstance for the embedded instances. The
+// static method is invoked if the path is a class path, the namespace of the
+// path is used if it isn't empty.
+func (c *ClientCIMXML) Invoke(ctx context.Context, namespaceName string, path *ObjectPath,
+	methodName string, in map[string]interface{}) (*MethodResult, error) {
+	if nil == path || "" == path.ClassName {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	if "" != path.Namespace {
+		namespaceName = path.Namespace
+	}
+
+	class, err := c.Schema().GetClass(ctx, namespaceName, path.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	method := findMethod(class, methodName)
+	if nil == method {
+		return nil, WBEMException(CIM_ERR_METHOD_NOT_FOUND,
+			"method '"+methodName+"' isn't found in the class '"+class.Name+"'.")
+	}
+
+	inParams, err := MakeParamValues(method, in)
+	if nil != err {
+		return nil, err
+	}
+	if err := ValidateParameters(method, inParams); nil != err {
+		return nil, err
+	}
+
+	var returnValue Valuer
+	var outParams []CIMParamValue
+	if path.IsClass() {
+		returnValue, outParams, err = c.InvokeStaticMethod(ctx, namespaceName, path.ClassName, method.Name, inParams)
+	} else {
+		returnValue, outParams, err = c.InvokeMethod(ctx, namespaceName, path.InstanceName(), method.Name, inParams)
+	}
+	if nil != err {
+		return nil, err
+	}
+	return DecodeMethodResult(method, returnValue, outParams)
+}
+
+func findMethod(class *CimClass, methodName string) *CimMethod {
+	for idx := range class.Methods {
+		if strings.EqualFold(class.Methods[idx].Name, methodName) {
+			return &class.Methods[idx]
+		}
+	}
+	return nil
+}
+
+func findParameter(method *CimMethod, name string) *fieldDecl {
+	for _, p := range method.Parameters {
+		if decl := parameterDecl(p); strings.EqualFold(decl.name, name) {
+			return &decl
+		}
+	}
+	return nil
+}
+
+// MakeParamValues converts the values into the parameters by the declared
+// types of the parameters in the method, the nil values are sent as the
+// null values.
+func MakeParamValues(method *CimMethod, in map[string]interface{}) ([]CIMParamValue, error) {
+	params := make([]CIMParamValue, 0, len(in))
+	for name, value := range in {
+		decl := findParameter(method, name)
+		if nil == decl {
+			return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"parameter '"+name+"' isn't found in the method '"+method.Name+"'.")
+		}
+		param, err := makeParamValue(*decl, value)
+		if nil != err {
+			return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"parameter '"+decl.name+"' is invalid, "+err.Error())
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+func makeParamValue(decl fieldDecl, value interface{}) (*CimParamValue, error) {
+	param := &CimParamValue{Name: decl.name, ParamType: decl.typ}
+	if nil == value {
+		return param, nil
+	}
+
+	embedded := embeddedKind(decl.qualifiers)
+	if decl.isRef {
+		if !decl.isArray {
+			path, err := toReference(value)
+			if nil != err {
+				return nil, err
+			}
+			param.ValueReference = path.ValueReference()
+			return param, nil
+		}
+		rv := reflect.ValueOf(value)
+		if reflect.Slice != rv.Kind() && reflect.Array != rv.Kind() {
+			return nil, errors.New("it is an array")
+		}
+		param.ValueRefArray = &CimValueRefArray{Values: make([]CimValueReferenceOrNull, rv.Len())}
+		for idx := 0; idx < rv.Len(); idx++ {
+			elem := rv.Index(idx).Interface()
+			if isNilValue(elem) {
+				param.ValueRefArray.Values[idx].Null = &CimValueNull{}
+				continue
+			}
+			path, err := toReference(elem)
+			if nil != err {
+				return nil, err
+			}
+			param.ValueRefArray.Values[idx].Value = path.ValueReference()
+		}
+		return param, nil
+	}
+
+	if !decl.isArray {
+		s, err := formatParamValue(decl.typ, embedded, value)
+		if nil != err {
+			return nil, err
+		}
+		param.EmbeddedObject = embedded
+		param.Value = &CimValue{Value: s}
+		return param, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if reflect.Slice != rv.Kind() && reflect.Array != rv.Kind() {
+		return nil, errors.New("it is an array")
+	}
+	param.EmbeddedObject = embedded
+	param.ValueArray = &CimValueArray{Values: make([]CimValueOrNull, rv.Len())}
+	for idx := 0; idx < rv.Len(); idx++ {
+		elem := rv.Index(idx).Interface()
+		if isNilValue(elem) {
+			param.ValueArray.Values[idx].Null = &CimValueNull{}
+			continue
+		}
+		s, err := formatParamValue(decl.typ, embedded, elem)
+		if nil != err {
+			return nil, err
+		}
+		param.ValueArray.Values[idx].Value = &CimValue{Value: s}
+	}
+	return param, nil
+}
+
+// embeddedKind returns "instance" if the parameter has the EmbeddedInstance
+// qualifier, "object" if it has the EmbeddedObject qualifier.
+func embeddedKind(qualifiers []CimQualifier) string {
+	for _, q := range qualifiers {
+		if strings.EqualFold("EmbeddedInstance", q.Name) {
+			return EmbeddedObjectInstance
+		}
+	}
+	if hasTrueQualifier(qualifiers, "EmbeddedObject") {
+		return EmbeddedObjectObject
+	}
+	return ""
+}
+
+func formatParamValue(typ, embedded string, value interface{}) (string, error) {
+	if "" != embedded {
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		s, kind, err := EncodeEmbeddedObject(value)
+		if nil != err {
+			return "", err
+		}
+		if EmbeddedObjectInstance == embedded && EmbeddedObjectInstance != kind {
+			return "", errors.New("it is an embedded instance, but the value is a class")
+		}
+		return s, nil
+	}
+	return FormatValue(typ, value)
+}
+
+func toReference(value interface{}) (*ObjectPath, error) {
+	switch v := value.(type) {
+	case *ObjectPath:
+		return v, nil
+	case ObjectPath:
+		return &v, nil
+	case *CimInstanceName:
+		path := &ObjectPath{}
+		path.setInstanceName(v)
+		return path, nil
+	case CIMInstanceName:
+		return ParseObjectPath(v.String())
+	case string:
+		return ParseObjectPath(v)
+	}
+	rv := reflect.ValueOf(value)
+	if isReferenceType(rv.Type()) {
+		if rv.IsNil() {
+			return nil, errors.New("reference is nil")
+		}
+		return toObjectPath(rv), nil
+	}
+	return nil, errors.New("type '" + fmt.Sprintf("%T", value) + "' isn't a reference")
+}
+
+func isNilValue(value interface{}) bool {
+	if nil == value {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	return reflect.Ptr == rv.Kind() && rv.IsNil()
+}
+
+// DecodeMethodResult converts the return value and the output parameters
+// by the types declared in the method, the type in PARAMTYPE is used if
+// the parameter isn't found in the method. The string is kept if it
+// couldn't be converted.
+func DecodeMethodResult(method *CimMethod, returnValue Valuer, outParams []CIMParamValue) (*MethodResult, error) {
+	result := &MethodResult{
+		Method:      method,
+		OutParams:   map[string]interface{}{},
+		returnValue: returnValue,
+		outParams:   outParams,
+	}
+
+	switch r := returnValue.(type) {
+	case *CimValue:
+		if nil != r {
+			value, err := parseParamValue("ReturnValue", method.Type, embeddedKind(method.Qualifiers), r.Value)
+			if nil != err {
+				return nil, err
+			}
+			result.ReturnValue = value
+		}
+	case *CimValueReference:
+		if nil != r {
+			result.ReturnValue = ObjectPathFromReference(r)
+		}
+	}
+
+	for _, param := range outParams {
+		p, ok := param.(*CimParamValue)
+		if !ok || nil == p {
+			continue
+		}
+		name, typ, embedded := p.Name, p.ParamType, p.EmbeddedObject
+		if decl := findParameter(method, p.Name); nil != decl {
+			name, typ = decl.name, decl.typ
+			embedded = EmbeddedKind(embedded, decl.qualifiers)
+		}
+		value, err := decodeParamValue(p, typ, embedded)
+		if nil != err {
+			return nil, err
+		}
+		result.OutParams[name] = value
+	}
+	return result, nil
+}
+
+func decodeParamValue(p *CimParamValue, typ, embedded string) (interface{}, error) {
+	switch {
+	case nil != p.Value:
+		return parseParamValue(p.Name, typ, embedded, p.Value.Value)
+	case nil != p.ValueArray:
+		if "" != embedded {
+			return decodeEmbeddedArray(p.Name, embedded, p.ValueArray)
+		}
+		values := make([]interface{}, len(p.ValueArray.Values))
+		for idx, v := range p.ValueArray.Values {
+			if nil != v.Value {
+				values[idx], _ = parseParamValue(p.Name, typ, "", v.Value.Value)
+			}
+		}
+		return values, nil
+	case nil != p.ValueReference, nil != p.ValueRefArray, nil != p.InstanceName:
+		return paramValue(p), nil
+	case nil != p.ClassName:
+		return &ObjectPath{ClassName: p.ClassName.Name}, nil
+	case nil != p.Instance:
+		return p.Instance, nil
+	case nil != p.ValueNamedInstance:
+		return p.ValueNamedInstance, nil
+	case nil != p.Class:
+		return p.Class, nil
+	}
+	return nil, nil
+}
+
+// parseParamValue converts the value by the type, the string is kept if
+// it couldn't be converted, but the invalid embedded object is an error.
+func parseParamValue(name, typ, embedded, s string) (interface{}, error) {
+	if "" != embedded {
+		return decodeEmbeddedValue(name, embedded, s)
+	}
+	if "" == typ {
+		return s, nil
+	}
+	value, err := ParseValue(typ, s)
+	if nil != err {
+		return s, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package gowbem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const invokeMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier In : boolean = true, Scope(parameter), Flavor(DisableOverride, ToSubclass);
+Qualifier Out : boolean = false, Scope(parameter), Flavor(DisableOverride, ToSubclass);
+Qualifier Required : boolean = false, Scope(property, reference, parameter, method), Flavor(DisableOverride, ToSubclass);
+Qualifier Static : boolean = false, Scope(property, method), Flavor(DisableOverride, ToSubclass);
+Qualifier EmbeddedInstance : string = null, Scope(property, method, parameter);
+
+class Test_Service {
+	[Key] string Name;
+	uint32 Resize([In, Required] uint64 Size, [In] boolean Quick, [In] Test_Service REF Target,
+		[In, Out] string Tags[], [In(false), Out] datetime Finished,
+		[In(false), Out, EmbeddedInstance("Test_Service")] string Result);
+	[Static] uint16 Create([In, Required] string Name, [In(false), Out] Test_Service REF Service);
+};
+`
+
+func TestInvoke(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/cimv2", invokeMOF); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := m.AddInstanceValues("root/cimv2", "Test_Service", map[string]interface{}{"Name": "s1"}); nil != err {
+		t.Fatal(err)
+	}
+
+	var received []CimParamValue
+	m.HandleMethod("root/cimv2", "Test_Service", "Resize", func(ctx context.Context, namespaceName string, objectName *CimInstanceName,
+		inParams []CimParamValue) (*CimReturnValue, []CimParamValue, error) {
+		received = inParams
+		result := `<INSTANCE CLASSNAME="Test_Service"><PROPERTY NAME="Name" TYPE="string"><VALUE>s2</VALUE></PROPERTY></INSTANCE>`
+		return &CimReturnValue{ParamType: "uint32", Value: &CimValue{Value: "0"}},
+			[]CimParamValue{
+				{Name: "Finished", ParamType: "datetime", Value: &CimValue{Value: "20261019120000.000000+000"}},
+				{Name: "Tags", ParamType: "string", ValueArray: &CimValueArray{Values: []CimValueOrNull{
+					{Value: &CimValue{Value: "a"}}, {Null: &CimValueNull{}}}}},
+				{Name: "Result", ParamType: "string", Value: &CimValue{Value: result}},
+			}, nil
+	})
+	m.HandleMethod("root/cimv2", "Test_Service", "Create", func(ctx context.Context, namespaceName string, objectName *CimInstanceName,
+		inParams []CimParamValue) (*CimReturnValue, []CimParamValue, error) {
+		if 0 != len(objectName.KeyBindings) || "Test_Service" != objectName.ClassName {
+			return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER, "isn't a static call")
+		}
+		path := &ObjectPath{ClassName: "Test_Service", KeyBindings: CimKeyBindings{
+			{Name: "Name", KeyValue: &CimKeyValue{ValueType: "string", Value: inParams[0].Value.Value}}}}
+		return &CimReturnValue{ParamType: "uint16", Value: &CimValue{Value: "7"}},
+			[]CimParamValue{{Name: "Service", ParamType: "reference", ValueReference: path.ValueReference()}}, nil
+	})
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	path, _ := ParseObjectPath(`Test_Service.Name="s1"`)
+	result, err := c.Invoke(ctx, "root/cimv2", path, "resize", map[string]interface{}{
+		"Size":   1024,
+		"Quick":  true,
+		"Target": `Test_Service.Name="s1"`,
+		"Tags":   []string{"x", "y"},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if uint32(0) != result.ReturnValue {
+		t.Errorf("%#v", result.ReturnValue)
+	}
+	params := map[string]CimParamValue{}
+	for _, p := range received {
+		params[p.Name] = p
+	}
+	if p := params["Size"]; "uint64" != p.ParamType || "1024" != p.Value.Value {
+		t.Errorf("%#v", p)
+	}
+	if p := params["Target"]; "reference" != p.ParamType || nil == p.ValueReference {
+		t.Errorf("%#v", p)
+	}
+	if p := params["Tags"]; nil == p.ValueArray || 2 != len(p.ValueArray.Values) {
+		t.Errorf("%#v", p)
+	}
+	if finished, ok := result.Get("finished"); !ok || 2026 != finished.(time.Time).Year() {
+		t.Errorf("%#v", finished)
+	}
+	if tags, _ := result.Get("Tags"); 2 != len(tags.([]interface{})) || "a" != tags.([]interface{})[0] || nil != tags.([]interface{})[1] {
+		t.Errorf("%#v", tags)
+	}
+	if instance, ok := result.OutParams["Result"].(*CimInstance); !ok || "Test_Service" != instance.ClassName {
+		t.Errorf("%#v", result.OutParams["Result"])
+	}
+
+	var out struct {
+		ReturnValue uint32
+		Tags        []string
+	}
+	if err := result.Unmarshal(&out); nil != err || 2 != len(out.Tags) {
+		t.Error(out, err)
+	}
+
+	result, err = c.Invoke(ctx, "root/cimv2", &ObjectPath{ClassName: "Test_Service"}, "Create",
+		map[string]interface{}{"Name": "s3"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if uint16(7) != result.ReturnValue {
+		t.Errorf("%#v", result.ReturnValue)
+	}
+	if service, ok := result.OutParams["Service"].(*ObjectPath); !ok || "s3" != service.KeyBindings[0].KeyValue.Value {
+		t.Errorf("%#v", result.OutParams["Service"])
+	}
+
+	m.ResetRequests()
+	_, err = c.Invoke(ctx, "root/cimv2", path, "Resize", map[string]interface{}{"Quick": true})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || 1 != len(errs.Field("Size")) {
+		t.Error(err)
+	}
+	_, err = c.Invoke(ctx, "root/cimv2", path, "Resize", map[string]interface{}{"Size": 1, "Quick": "yes"})
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_INVALID_PARAMETER != code {
+		t.Error(err)
+	}
+	_, err = c.Invoke(ctx, "root/cimv2", path, "Resize", map[string]interface{}{"Size": 1, "Unknown": 1})
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_INVALID_PARAMETER != code {
+		t.Error(err)
+	}
+	_, err = c.Invoke(ctx, "root/cimv2", path, "Erase", nil)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_METHOD_NOT_FOUND != code {
+		t.Error(err)
+	}
+	if 0 != len(m.Requests()) {
+		t.Error(m.Requests())
+	}
+}
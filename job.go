@@ -0,0 +1,290 @@
+package gowbem
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MethodJobStarted is the return value of the methods which are completed
+// asynchronously, the reference of the CIM_ConcreteJob is returned in the
+// output parameters.
+const MethodJobStarted = 4096
+
+// The values of CIM_ConcreteJob.JobState.
+const (
+	JobStateNew          uint16 = 2
+	JobStateStarting     uint16 = 3
+	JobStateRunning      uint16 = 4
+	JobStateSuspended    uint16 = 5
+	JobStateShuttingDown uint16 = 6
+	JobStateCompleted    uint16 = 7
+	JobStateTerminated   uint16 = 8
+	JobStateKilled       uint16 = 9
+	JobStateException    uint16 = 10
+)
+
+// JobStatus is the status of the CIM_ConcreteJob.
+type JobStatus struct {
+	InstanceID       string
+	Name             string
+	JobState         uint16
+	JobStatus        string
+	PercentComplete  uint16
+	ErrorCode        uint16
+	ErrorDescription string
+	Instance         CIMInstance `cim:"-"`
+}
+
+// IsFinished returns true if the job is completed, terminated, killed or
+// failed.
+func (s *JobStatus) IsFinished() bool {
+	switch s.JobState {
+	case JobStateCompleted, JobStateTerminated, JobStateKilled, JobStateException:
+		return true
+	}
+	return false
+}
+
+// IsSucceeded returns true if the job is completed without the error code.
+func (s *JobStatus) IsSucceeded() bool {
+	return JobStateCompleted == s.JobState && 0 == s.ErrorCode
+}
+
+// JobResult is the final outcome of the job.
+type JobResult struct {
+	Status *JobStatus
+	// Errors are the CIM_Error instances returned by GetErrors, they are
+	// fetched only if the job is failed.
+	Errors []*CimInstance
+	// AffectedElements are the elements associated with the job by the
+	// CIM_AffectedJobElement.
+	AffectedElements []CIMInstanceName
+	// Deleted is true if the job is deleted before it is finished, such as
+	// the job with DeleteOnCompletion, Status is the last known status.
+	Deleted bool
+}
+
+// JobError is returned by Wait if the job is failed.
+type JobError struct {
+	Status *JobStatus
+	Errors []*CimInstance
+}
+
+func (e *JobError) Error() string {
+	var buf strings.Builder
+	buf.WriteString("job '")
+	if "" != e.Status.Name {
+		buf.WriteString(e.Status.Name)
+	} else {
+		buf.WriteString(e.Status.InstanceID)
+	}
+	buf.WriteString("' is failed, JobState=")
+	buf.WriteString(strconv.FormatUint(uint64(e.Status.JobState), 10))
+	if 0 != e.Status.ErrorCode {
+		buf.WriteString(", ErrorCode=")
+		buf.WriteString(strconv.FormatUint(uint64(e.Status.ErrorCode), 10))
+	}
+	if "" != e.Status.ErrorDescription {
+		buf.WriteString(": ")
+		buf.WriteString(e.Status.ErrorDescription)
+	}
+	for _, instance := range e.Errors {
+		pr := instance.GetPropertyByName("Message")
+		if nil == pr {
+			continue
+		}
+		if message, ok := pr.GetValue().(string); ok && "" != message {
+			buf.WriteString("; ")
+			buf.WriteString(message)
+		}
+	}
+	return buf.String()
+}
+
+// Job tracks the CIM_ConcreteJob started by a method.
+type Job struct {
+	c         *ClientCIMXML
+	Namespace string
+	Name      CIMInstanceName
+
+	// PollInterval is the first interval of polling, it is doubled after
+	// every poll until MaxPollInterval, the defaults are 1s and 30s.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// OnProgress is called after every poll if it isn't nil.
+	OnProgress func(status *JobStatus)
+}
+
+// NewJob creates the tracker of the job instance.
+func (c *ClientCIMXML) NewJob(namespaceName string, jobName CIMInstanceName) *Job {
+	return &Job{c: c, Namespace: namespaceName, Name: jobName}
+}
+
+// JobFromResult returns the job if the method returned 4096 (Job Started)
+// and a reference of the job in the output parameters, the parameter with
+// the name "Job" is preferred.
+func (c *ClientCIMXML) JobFromResult(namespaceName string, result *MethodResult) (*Job, bool) {
+	return c.JobFromParams(namespaceName, result.returnValue, result.outParams)
+}
+
+// JobFromParams is like JobFromResult, but the results come from
+// InvokeMethod.
+func (c *ClientCIMXML) JobFromParams(namespaceName string, returnValue Valuer, outParams []CIMParamValue) (*Job, bool) {
+	if nil == returnValue || strconv.Itoa(MethodJobStarted) != strings.TrimSpace(returnValue.String()) {
+		return nil, false
+	}
+
+	var job *ObjectPath
+	for _, param := range outParams {
+		path, ok := paramValue(param).(*ObjectPath)
+		if !ok || path.IsClass() {
+			continue
+		}
+		if strings.EqualFold("Job", param.GetName()) {
+			job = path
+			break
+		}
+		if nil == job && strings.HasSuffix(strings.ToLower(path.ClassName), "job") {
+			job = path
+		}
+	}
+	if nil == job {
+		return nil, false
+	}
+	if "" != job.Namespace {
+		namespaceName = job.Namespace
+	}
+	return c.NewJob(namespaceName, job.InstanceName()), true
+}
+
+// Poll fetches the status of the job.
+func (job *Job) Poll(ctx context.Context) (*JobStatus, error) {
+	instance, err := job.c.GetInstanceByInstanceName(ctx, job.Namespace, job.Name, false, false, false, nil)
+	if nil != err {
+		return nil, err
+	}
+	status := &JobStatus{Instance: instance}
+	if err := UnmarshalInstance(instance, status); nil != err {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Wait polls the job with backoff until it is finished, the errors of the
+// job are fetched by GetErrors if it is failed and a *JobError is returned
+// with the result. The job is finished with the last known status if it
+// isn't found any more, see JobResult.Deleted. The result is returned with
+// the error too if the affected elements of the succeeded job can't be read.
+func (job *Job) Wait(ctx context.Context) (*JobResult, error) {
+	interval, maxInterval := job.PollInterval, job.MaxPollInterval
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	if maxInterval <= 0 {
+		maxInterval = 30 * time.Second
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+
+	var last *JobStatus
+	for {
+		status, err := job.Poll(ctx)
+		if nil != err {
+			if code, ok := GetCIMStatusCode(err); ok && CIM_ERR_NOT_FOUND == code && nil != last {
+				return &JobResult{Status: last, Deleted: true}, nil
+			}
+			return nil, err
+		}
+		last = status
+		if nil != job.OnProgress {
+			job.OnProgress(status)
+		}
+		if status.IsFinished() {
+			return job.finish(ctx, status)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func (job *Job) finish(ctx context.Context, status *JobStatus) (*JobResult, error) {
+	result := &JobResult{Status: status}
+	if !status.IsSucceeded() {
+		// the errors of the job are fetched first, the outcome of the job
+		// is kept even if the errors or the affected elements can't be read.
+		result.Errors, _ = job.GetErrors(ctx)
+		result.AffectedElements, _ = job.AffectedElements(ctx)
+		return result, &JobError{Status: status, Errors: result.Errors}
+	}
+
+	affected, err := job.AffectedElements(ctx)
+	result.AffectedElements = affected
+	if nil != err {
+		return result, err
+	}
+	return result, nil
+}
+
+// AffectedElements returns the elements associated with the job by the
+// CIM_AffectedJobElement, nil is returned if the class isn't implemented.
+func (job *Job) AffectedElements(ctx context.Context) ([]CIMInstanceName, error) {
+	names, err := job.c.AssociatorNames(ctx, job.Namespace, job.Name, "CIM_AffectedJobElement",
+		"", "AffectingElement", "AffectedElement")
+	if nil != err {
+		if IsErrUnavailable(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetErrors invokes the GetErrors method of the job, GetError is invoked
+// if GetErrors isn't found, nil is returned if both aren't supported.
+func (job *Job) GetErrors(ctx context.Context) ([]*CimInstance, error) {
+	for _, method := range []struct{ name, param string }{{"GetErrors", "Errors"}, {"GetError", "Error"}} {
+		_, outParams, err := job.c.InvokeMethod(ctx, job.Namespace, job.Name, method.name, nil)
+		if nil != err {
+			if code, ok := GetCIMStatusCode(err); ok &&
+				(CIM_ERR_METHOD_NOT_FOUND == code || CIM_ERR_METHOD_NOT_AVAILABLE == code || CIM_ERR_NOT_SUPPORTED == code) {
+				continue
+			}
+			return nil, err
+		}
+
+		var results []*CimInstance
+		for _, param := range outParams {
+			p, ok := param.(*CimParamValue)
+			if !ok || !strings.EqualFold(method.param, p.Name) {
+				continue
+			}
+			value, err := decodeParamValue(p, "string", EmbeddedObjectInstance)
+			if nil != err {
+				return nil, err
+			}
+			values, ok := value.([]interface{})
+			if !ok {
+				values = []interface{}{value}
+			}
+			for _, v := range values {
+				if instance, ok := v.(*CimInstance); ok {
+					results = append(results, instance)
+				}
+			}
+		}
+		return results, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,177 @@
+package gowbem_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const jobMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Association : boolean = false, Scope(association), Flavor(DisableOverride, ToSubclass);
+
+class Test_Volume {
+	[Key] string DeviceID;
+};
+
+class CIM_ConcreteJob {
+	[Key] string InstanceID;
+	string Name;
+	uint16 JobState;
+	uint16 PercentComplete;
+	uint16 ErrorCode;
+	string ErrorDescription;
+};
+
+[Association]
+class CIM_AffectedJobElement {
+	[Key] Test_Volume REF AffectedElement;
+	[Key] CIM_ConcreteJob REF AffectingElement;
+};
+`
+
+func TestJob(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/cimv2", jobMOF); nil != err {
+		t.Fatal(err)
+	}
+	setJob := func(id string, state, percent int) *CimInstanceName {
+		name, err := m.AddInstanceValues("root/cimv2", "CIM_ConcreteJob", map[string]interface{}{
+			"InstanceID": id, "Name": "job " + id, "JobState": uint16(state), "PercentComplete": uint16(percent)})
+		if nil != err {
+			t.Fatal(err)
+		}
+		return name
+	}
+	job1 := setJob("j1", 4, 0)
+	job2 := setJob("j2", 4, 0)
+	volume, err := m.AddInstanceValues("root/cimv2", "Test_Volume", map[string]interface{}{"DeviceID": "v1"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := m.AddInstanceValues("root/cimv2", "CIM_AffectedJobElement",
+		map[string]interface{}{"AffectedElement": volume, "AffectingElement": job1}); nil != err {
+		t.Fatal(err)
+	}
+
+	m.HandleMethod("root/cimv2", "Test_Volume", "Create", func(ctx context.Context, namespaceName string, objectName *CimInstanceName,
+		inParams []CimParamValue) (*CimReturnValue, []CimParamValue, error) {
+		job := job1
+		if 0 != len(inParams) {
+			job = job2
+		}
+		return &CimReturnValue{ParamType: "uint32", Value: &CimValue{Value: "4096"}},
+			[]CimParamValue{{Name: "Job", ParamType: "reference", ValueReference: &CimValueReference{InstanceName: job}}}, nil
+	})
+	m.HandleMethod("root/cimv2", "CIM_ConcreteJob", "GetErrors", func(ctx context.Context, namespaceName string, objectName *CimInstanceName,
+		inParams []CimParamValue) (*CimReturnValue, []CimParamValue, error) {
+		e := `<INSTANCE CLASSNAME="CIM_Error"><PROPERTY NAME="Message" TYPE="string"><VALUE>pool is full</VALUE></PROPERTY></INSTANCE>`
+		return &CimReturnValue{ParamType: "uint32", Value: &CimValue{Value: "0"}},
+			[]CimParamValue{{Name: "Errors", ParamType: "string", EmbeddedObject: "instance",
+				ValueArray: &CimValueArray{Values: []CimValueOrNull{{Value: &CimValue{Value: e}}}}}}, nil
+	})
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ret, outParams, err := c.InvokeStaticMethod(ctx, "root/cimv2", "Test_Volume", "Create", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	job, ok := c.JobFromParams("root/cimv2", ret, outParams)
+	if !ok {
+		t.Fatal(ret, outParams)
+	}
+	job.PollInterval = time.Millisecond
+	var progress []uint16
+	job.OnProgress = func(status *JobStatus) {
+		progress = append(progress, status.PercentComplete)
+		if 2 == len(progress) {
+			setJob("j1", 7, 100)
+		} else if !status.IsFinished() {
+			setJob("j1", 4, 50)
+		}
+	}
+	result, err := job.Wait(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(progress) || 50 != progress[1] || 100 != progress[2] || !result.Status.IsSucceeded() {
+		t.Error(progress, result.Status)
+	}
+	if 1 != len(result.AffectedElements) || `Test_Volume.DeviceID="v1"` != result.AffectedElements[0].String() {
+		t.Error(result.AffectedElements)
+	}
+
+	ret, outParams, err = c.InvokeStaticMethod(ctx, "root/cimv2", "Test_Volume", "Create",
+		[]CIMParamValue{&CimParamValue{Name: "Size", Value: &CimValue{Value: "1"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	job, ok = c.JobFromParams("root/cimv2", ret, outParams)
+	if !ok {
+		t.Fatal(ret, outParams)
+	}
+	setJob("j2", 10, 10)
+	result, err = job.Wait(ctx)
+	var jobErr *JobError
+	if !errors.As(err, &jobErr) || nil == result || 1 != len(result.Errors) || 0 != len(result.AffectedElements) {
+		t.Fatal(result, err)
+	}
+	if !strings.Contains(err.Error(), "pool is full") || !strings.Contains(err.Error(), "job j2") {
+		t.Error(err)
+	}
+
+	if _, ok := c.JobFromParams("root/cimv2", &CimValue{Value: "0"}, outParams); ok {
+		t.Error("job isn't started")
+	}
+
+	m.InjectFault(wbemtest.Fault{Operation: "AssociatorNames", Err: WBEMException(CIM_ERR_INVALID_CLASS, "CIM_AffectedJobElement")})
+	setJob("j2", 7, 100)
+	result, err = job.Wait(ctx)
+	if nil != err || 0 != len(result.AffectedElements) || result.Deleted {
+		t.Error(result, err)
+	}
+	m.ClearFaults()
+
+	m.InjectFault(wbemtest.Fault{Operation: "AssociatorNames", Err: WBEMException(CIM_ERR_ACCESS_DENIED, "CIM_AffectedJobElement")})
+	setJob("j2", 10, 10)
+	result, err = job.Wait(ctx)
+	if !errors.As(err, &jobErr) || nil == result || 1 != len(result.Errors) {
+		t.Error(result, err)
+	}
+	setJob("j2", 7, 100)
+	result, err = job.Wait(ctx)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_ACCESS_DENIED != code || nil == result || !result.Status.IsSucceeded() {
+		t.Error(result, err)
+	}
+	m.ClearFaults()
+
+	setJob("j2", 4, 10)
+	job.OnProgress = func(status *JobStatus) {
+		if err := m.DeleteInstance(ctx, "root/cimv2", job2); nil != err {
+			t.Error(err)
+		}
+	}
+	result, err = job.Wait(ctx)
+	if nil != err || !result.Deleted || 10 != result.Status.PercentComplete {
+		t.Fatal(result, err)
+	}
+	job.OnProgress = nil
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	setJob("j2", 4, 10)
+	if _, err := job.Wait(cancelled); nil == err {
+		t.Error("error is excepted")
+	}
+}
@@ -0,0 +1,1056 @@
+package gowbem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The JSON mapping is close to the DMTF CIM-RS JSON (DSP0211), but the
+// values keep their CIM types so that the objects are decoded back without
+// loss:
+//
+//	{"kind": "instance", "class": "CIM_Disk",
+//	 "properties": {
+//	   "DeviceID": {"type": "string", "value": "d1"},
+//	   "Size": {"type": "uint64", "value": 1024},
+//	   "Caps": {"type": "uint16", "array": true, "value": [1, null]},
+//	   "System": {"type": "reference", "value": {"namespace": "root/cimv2",
+//	       "class": "CIM_System", "keys": {"Name": "s1"}}},
+//	   "Setting": {"type": "string", "embedded": "instance",
+//	       "value": {"kind": "instance", "class": "CIM_Setting", ...}}}}
+//
+// The members of the objects are kept in the order of the XML. The numbers
+// are written as they are if they are the valid JSON numbers, the values
+// which couldn't be written as the JSON of their types are written as the
+// strings.
+//
+// The instances of DSP0211 are read too, their properties are the values
+// without the types and the paths are the uris of the resources:
+//
+//	{"kind": "instance", "class": "CIM_Disk",
+//	 "self": "/cimrs/namespaces/root%2Fcimv2/classes/CIM_Disk/instances/DeviceID=d1",
+//	 "properties": {"DeviceID": "d1", "Size": 1024, "Caps": [1, null]}}
+//
+// The types of such properties are guessed from the JSON values, see
+// decodeDSP0211Property.
+
+// jsonField is a member of jsonObject.
+type jsonField struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// jsonObject is a JSON object which keeps the order of the members.
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for idx, field := range o {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(field.Value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o *jsonObject) UnmarshalJSON(bs []byte) error {
+	d := json.NewDecoder(bytes.NewReader(bs))
+	token, err := d.Token()
+	if nil != err {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || '{' != delim {
+		return errors.New("'" + abbreviate(string(bs)) + "' isn't a JSON object")
+	}
+	*o = (*o)[:0]
+	for d.More() {
+		token, err := d.Token()
+		if nil != err {
+			return err
+		}
+		var value json.RawMessage
+		if err := d.Decode(&value); nil != err {
+			return err
+		}
+		*o = append(*o, jsonField{Name: token.(string), Value: value})
+	}
+	return nil
+}
+
+func (o *jsonObject) add(name string, value interface{}) error {
+	bs, err := json.Marshal(value)
+	if nil != err {
+		return errors.New("'" + name + "' is invalid, " + err.Error())
+	}
+	*o = append(*o, jsonField{Name: name, Value: bs})
+	return nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return 0 == len(raw) || "null" == string(bytes.TrimSpace(raw))
+}
+
+func isJSONNumber(s string) bool {
+	if "" == s || !('-' == s[0] || ('0' <= s[0] && s[0] <= '9')) {
+		return false
+	}
+	var n json.Number
+	return nil == json.Unmarshal([]byte(s), &n) && string(n) == s
+}
+
+// encodeJSONValue encodes the value of the CIM type.
+func encodeJSONValue(typ, s string) json.RawMessage {
+	switch strings.ToLower(typ) {
+	case "boolean":
+		switch {
+		case strings.EqualFold("true", s):
+			return json.RawMessage("true")
+		case strings.EqualFold("false", s):
+			return json.RawMessage("false")
+		}
+	case "uint8", "uint16", "uint32", "uint64", "sint8", "sint16", "sint32", "sint64", "real32", "real64", "numeric":
+		if isJSONNumber(s) {
+			return json.RawMessage(s)
+		}
+	}
+	bs, _ := json.Marshal(s)
+	return bs
+}
+
+// decodeJSONValue decodes the scalar value into the string.
+func decodeJSONValue(raw json.RawMessage) (string, error) {
+	text := string(bytes.TrimSpace(raw))
+	switch {
+	case "" == text:
+		return "", errors.New("value is empty")
+	case '"' == text[0]:
+		var s string
+		if err := json.Unmarshal(raw, &s); nil != err {
+			return "", err
+		}
+		return s, nil
+	case "true" == text, "false" == text, isJSONNumber(text):
+		return text, nil
+	}
+	return "", errors.New("'" + abbreviate(text) + "' isn't a scalar value")
+}
+
+// encodeJSONString encodes the value, the embedded object is encoded as a
+// JSON object if it is decoded successfully.
+func encodeJSONString(typ, embedded, s string) (json.RawMessage, error) {
+	if "" != embedded {
+		if value, err := decodeEmbeddedObject(s); nil == err && nil != value {
+			return json.Marshal(value)
+		}
+	}
+	return encodeJSONValue(typ, s), nil
+}
+
+func decodeJSONString(raw json.RawMessage) (string, error) {
+	if text := bytes.TrimSpace(raw); 0 != len(text) && '{' == text[0] {
+		var kind struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(text, &kind); nil != err {
+			return "", err
+		}
+		var value interface{}
+		switch kind.Kind {
+		case "instance":
+			value = &CimInstance{}
+		case "class":
+			value = &CimClass{}
+		default:
+			return "", errors.New("kind '" + kind.Kind + "' isn't a embedded object")
+		}
+		if err := json.Unmarshal(text, value); nil != err {
+			return "", err
+		}
+		s, _, err := EncodeEmbeddedObject(value)
+		return s, err
+	}
+	return decodeJSONValue(raw)
+}
+
+func encodeJSONArray(typ, embedded string, array *CimValueArray) (json.RawMessage, error) {
+	if nil == array {
+		return json.RawMessage("null"), nil
+	}
+	values := make([]json.RawMessage, len(array.Values))
+	for idx, v := range array.Values {
+		if nil == v.Value {
+			values[idx] = json.RawMessage("null")
+			continue
+		}
+		value, err := encodeJSONString(typ, embedded, v.Value.Value)
+		if nil != err {
+			return nil, err
+		}
+		values[idx] = value
+	}
+	return json.Marshal(values)
+}
+
+func decodeJSONArray(raw json.RawMessage) (*CimValueArray, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); nil != err {
+		return nil, err
+	}
+	array := &CimValueArray{Values: make([]CimValueOrNull, len(values))}
+	for idx, value := range values {
+		if isJSONNull(value) {
+			array.Values[idx].Null = &CimValueNull{}
+			continue
+		}
+		s, err := decodeJSONString(value)
+		if nil != err {
+			return nil, err
+		}
+		array.Values[idx].Value = &CimValue{Value: s}
+	}
+	return array, nil
+}
+
+func encodeJSONReference(ref *CimValueReference) (json.RawMessage, error) {
+	if nil == ref {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(ObjectPathFromReference(ref))
+}
+
+func decodeJSONReference(raw json.RawMessage) (*CimValueReference, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+	path := &ObjectPath{}
+	if err := json.Unmarshal(raw, path); nil != err {
+		return nil, err
+	}
+	return path.ValueReference(), nil
+}
+
+func encodeJSONRefArray(array *CimValueRefArray) (json.RawMessage, error) {
+	if nil == array {
+		return json.RawMessage("null"), nil
+	}
+	values := make([]json.RawMessage, len(array.Values))
+	for idx, v := range array.Values {
+		value, err := encodeJSONReference(v.Value)
+		if nil != err {
+			return nil, err
+		}
+		values[idx] = value
+	}
+	return json.Marshal(values)
+}
+
+func decodeJSONRefArray(raw json.RawMessage) (*CimValueRefArray, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); nil != err {
+		return nil, err
+	}
+	array := &CimValueRefArray{Values: make([]CimValueReferenceOrNull, len(values))}
+	for idx, value := range values {
+		ref, err := decodeJSONReference(value)
+		if nil != err {
+			return nil, err
+		}
+		if nil == ref {
+			array.Values[idx].Null = &CimValueNull{}
+		} else {
+			array.Values[idx].Value = ref
+		}
+	}
+	return array, nil
+}
+
+// MarshalJSON encodes the path as {"namespace": ..., "class": ..., "keys":
+// {...}}, the string keys are the JSON strings, the numeric and boolean
+// keys are the JSON numbers and booleans and the references are the paths.
+func (self *ObjectPath) MarshalJSON() ([]byte, error) {
+	var o jsonObject
+	for _, field := range []struct{ name, value string }{
+		{"scheme", self.Scheme}, {"host", self.Host}, {"port", self.Port}, {"namespace", self.Namespace},
+	} {
+		if "" != field.value {
+			o.add(field.name, field.value)
+		}
+	}
+	o.add("class", self.ClassName)
+	if 0 != len(self.KeyBindings) {
+		keys, err := encodeJSONKeys(self.KeyBindings)
+		if nil != err {
+			return nil, err
+		}
+		o = append(o, jsonField{Name: "keys", Value: keys})
+	}
+	return o.MarshalJSON()
+}
+
+func (self *ObjectPath) UnmarshalJSON(bs []byte) error {
+	if text := bytes.TrimSpace(bs); 0 != len(text) && '"' == text[0] {
+		// the uri of the resource in DSP0211, such as "self".
+		var uri string
+		if err := json.Unmarshal(text, &uri); nil != err {
+			return err
+		}
+		path, err := resourcePath(uri)
+		if nil != err {
+			return err
+		}
+		*self = *path
+		return nil
+	}
+	var o jsonObject
+	if err := o.UnmarshalJSON(bs); nil != err {
+		return err
+	}
+	*self = ObjectPath{}
+	for _, field := range o {
+		var err error
+		switch field.Name {
+		case "scheme":
+			err = json.Unmarshal(field.Value, &self.Scheme)
+		case "host":
+			err = json.Unmarshal(field.Value, &self.Host)
+		case "port":
+			err = json.Unmarshal(field.Value, &self.Port)
+		case "namespace":
+			err = json.Unmarshal(field.Value, &self.Namespace)
+		case "class":
+			err = json.Unmarshal(field.Value, &self.ClassName)
+		case "keys":
+			self.KeyBindings, err = decodeJSONKeys(field.Value)
+		}
+		if nil != err {
+			return errors.New("'" + field.Name + "' of the path is invalid, " + err.Error())
+		}
+	}
+	return nil
+}
+
+// jsonKey is the key value which couldn't be written as a JSON scalar.
+type jsonKey struct {
+	ValueType string `json:"valuetype,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Value     string `json:"value"`
+}
+
+func encodeJSONKeys(keyBindings CimKeyBindings) (json.RawMessage, error) {
+	var o jsonObject
+	for _, kb := range keyBindings {
+		if nil != kb.ValueReference {
+			value, err := encodeJSONReference(kb.ValueReference)
+			if nil != err {
+				return nil, err
+			}
+			o = append(o, jsonField{Name: kb.Name, Value: value})
+			continue
+		}
+		if nil == kb.KeyValue {
+			o = append(o, jsonField{Name: kb.Name, Value: json.RawMessage("null")})
+			continue
+		}
+
+		kv := kb.KeyValue
+		var value json.RawMessage
+		if "" == kv.Type {
+			switch kv.ValueType {
+			case "", "string":
+				value, _ = json.Marshal(kv.Value)
+			case "boolean":
+				if "true" == kv.Value || "false" == kv.Value {
+					value = json.RawMessage(kv.Value)
+				}
+			case "numeric":
+				if isJSONNumber(kv.Value) {
+					value = json.RawMessage(kv.Value)
+				}
+			}
+		}
+		if nil == value {
+			value, _ = json.Marshal(&jsonKey{ValueType: kv.ValueType, Type: kv.Type, Value: kv.Value})
+		}
+		o = append(o, jsonField{Name: kb.Name, Value: value})
+	}
+	return o.MarshalJSON()
+}
+
+func decodeJSONKeys(raw json.RawMessage) (CimKeyBindings, error) {
+	var o jsonObject
+	if err := o.UnmarshalJSON(raw); nil != err {
+		return nil, err
+	}
+	keyBindings := make(CimKeyBindings, 0, len(o))
+	for _, field := range o {
+		kb := CimKeyBinding{Name: field.Name}
+		text := bytes.TrimSpace(field.Value)
+		switch {
+		case isJSONNull(text):
+		case '{' == text[0]:
+			var probe map[string]json.RawMessage
+			if err := json.Unmarshal(text, &probe); nil != err {
+				return nil, err
+			}
+			if _, ok := probe["class"]; ok {
+				ref, err := decodeJSONReference(text)
+				if nil != err {
+					return nil, err
+				}
+				kb.ValueReference = ref
+				break
+			}
+			var key jsonKey
+			if err := json.Unmarshal(text, &key); nil != err {
+				return nil, err
+			}
+			kb.KeyValue = &CimKeyValue{ValueType: key.ValueType, Type: key.Type, Value: key.Value}
+		case '"' == text[0]:
+			kb.KeyValue = &CimKeyValue{ValueType: "string"}
+			if err := json.Unmarshal(text, &kb.KeyValue.Value); nil != err {
+				return nil, err
+			}
+		case "true" == string(text), "false" == string(text):
+			kb.KeyValue = &CimKeyValue{ValueType: "boolean", Value: string(text)}
+		case isJSONNumber(string(text)):
+			kb.KeyValue = &CimKeyValue{ValueType: "numeric", Value: string(text)}
+		default:
+			return nil, errors.New("key '" + field.Name + "' is invalid")
+		}
+		keyBindings = append(keyBindings, kb)
+	}
+	return keyBindings, nil
+}
+
+// MarshalJSON encodes the instance name as a path, see ObjectPath.
+func (self *CimInstanceName) MarshalJSON() ([]byte, error) {
+	path := &ObjectPath{}
+	path.setInstanceName(self)
+	return path.MarshalJSON()
+}
+
+func (self *CimInstanceName) UnmarshalJSON(bs []byte) error {
+	path := &ObjectPath{}
+	if err := path.UnmarshalJSON(bs); nil != err {
+		return err
+	}
+	*self = *path.InstanceName()
+	return nil
+}
+
+// jsonQualifier is the JSON of a qualifier, the flavors are written only if
+// they aren't the defaults.
+type jsonQualifier struct {
+	Type         string          `json:"type"`
+	Array        bool            `json:"array,omitempty"`
+	Value        json.RawMessage `json:"value"`
+	Propagated   bool            `json:"propagated,omitempty"`
+	Overridable  *bool           `json:"overridable,omitempty"`
+	ToSubclass   *bool           `json:"tosubclass,omitempty"`
+	ToInstance   bool            `json:"toinstance,omitempty"`
+	Translatable bool            `json:"translatable,omitempty"`
+	Lang         string          `json:"lang,omitempty"`
+}
+
+func encodeJSONQualifiers(qualifiers []CimQualifier) (json.RawMessage, error) {
+	var o jsonObject
+	for _, q := range qualifiers {
+		jq := jsonQualifier{Type: q.Type, Propagated: q.Propagated, ToInstance: q.ToInstance,
+			Translatable: q.Translatable, Lang: q.Lang, Value: json.RawMessage("null")}
+		if !q.Overridable {
+			jq.Overridable = new(bool)
+		}
+		if !q.ToSubclass {
+			jq.ToSubclass = new(bool)
+		}
+		switch {
+		case nil != q.Value:
+			jq.Value = encodeJSONValue(q.Type, q.Value.Value)
+		case nil != q.ValueArray:
+			jq.Array = true
+			value, err := encodeJSONArray(q.Type, "", q.ValueArray)
+			if nil != err {
+				return nil, err
+			}
+			jq.Value = value
+		}
+		if err := o.add(q.Name, &jq); nil != err {
+			return nil, err
+		}
+	}
+	return o.MarshalJSON()
+}
+
+func decodeJSONQualifiers(raw json.RawMessage) ([]CimQualifier, error) {
+	var o jsonObject
+	if err := o.UnmarshalJSON(raw); nil != err {
+		return nil, err
+	}
+	qualifiers := make([]CimQualifier, 0, len(o))
+	for _, field := range o {
+		var jq jsonQualifier
+		if err := json.Unmarshal(field.Value, &jq); nil != err {
+			return nil, errors.New("qualifier '" + field.Name + "' is invalid, " + err.Error())
+		}
+		q := CimQualifier{CimQualifierFlavor: defaultQualifierFlavor, Name: field.Name, Type: jq.Type,
+			Propagated: jq.Propagated, Lang: jq.Lang}
+		q.ToInstance, q.Translatable = jq.ToInstance, jq.Translatable
+		if nil != jq.Overridable {
+			q.Overridable = *jq.Overridable
+		}
+		if nil != jq.ToSubclass {
+			q.ToSubclass = *jq.ToSubclass
+		}
+		var err error
+		switch {
+		case jq.Array:
+			q.ValueArray, err = decodeJSONArray(jq.Value)
+		case !isJSONNull(jq.Value):
+			var s string
+			if s, err = decodeJSONValue(jq.Value); nil == err {
+				q.Value = &CimValue{Value: s}
+			}
+		}
+		if nil != err {
+			return nil, errors.New("qualifier '" + field.Name + "' is invalid, " + err.Error())
+		}
+		qualifiers = append(qualifiers, q)
+	}
+	return qualifiers, nil
+}
+
+// jsonProperty is the JSON of a property, a parameter declaration or a
+// method.
+type jsonProperty struct {
+	Type           string          `json:"type"`
+	Array          bool            `json:"array,omitempty"`
+	ArraySize      int             `json:"arraysize,omitempty"`
+	ReferenceClass string          `json:"referenceclass,omitempty"`
+	Embedded       string          `json:"embedded,omitempty"`
+	ClassOrigin    string          `json:"origin,omitempty"`
+	Propagated     bool            `json:"propagated,omitempty"`
+	Lang           string          `json:"lang,omitempty"`
+	Qualifiers     json.RawMessage `json:"qualifiers,omitempty"`
+	Value          json.RawMessage `json:"value,omitempty"`
+	Parameters     json.RawMessage `json:"parameters,omitempty"`
+}
+
+func encodeJSONProperties(properties []CimAnyProperty, withValue bool) (json.RawMessage, error) {
+	var o jsonObject
+	for _, pr := range properties {
+		var jp jsonProperty
+		var qualifiers []CimQualifier
+		var err error
+		switch {
+		case nil != pr.Property:
+			p := pr.Property
+			jp = jsonProperty{Type: p.Type, Embedded: p.EmbeddedObject, ClassOrigin: p.ClassOrigin, Propagated: p.Propagated, Lang: p.Lang}
+			qualifiers = p.Qualifiers
+			if withValue || nil != p.Value {
+				jp.Value = json.RawMessage("null")
+				if nil != p.Value {
+					jp.Value, err = encodeJSONString(p.Type, EmbeddedKind(p.EmbeddedObject, p.Qualifiers), p.Value.Value)
+				}
+			}
+		case nil != pr.PropertyArray:
+			p := pr.PropertyArray
+			jp = jsonProperty{Type: p.Type, Array: true, ArraySize: p.ArraySize, Embedded: p.EmbeddedObject,
+				ClassOrigin: p.ClassOrigin, Propagated: p.Propagated, Lang: p.Lang}
+			qualifiers = p.Qualifiers
+			if withValue || nil != p.ValueArray {
+				jp.Value, err = encodeJSONArray(p.Type, EmbeddedKind(p.EmbeddedObject, p.Qualifiers), p.ValueArray)
+			}
+		case nil != pr.PropertyReference:
+			p := pr.PropertyReference
+			jp = jsonProperty{Type: "reference", ReferenceClass: p.ReferenceClass, ClassOrigin: p.ClassOrigin, Propagated: p.Propagated}
+			qualifiers = p.Qualifiers
+			if withValue || nil != p.ValueReference {
+				jp.Value, err = encodeJSONReference(p.ValueReference)
+			}
+		default:
+			continue
+		}
+		if nil == err && 0 != len(qualifiers) {
+			jp.Qualifiers, err = encodeJSONQualifiers(qualifiers)
+		}
+		name := anyPropertyName(pr)
+		if nil != err {
+			return nil, errors.New("property '" + name + "' is invalid, " + err.Error())
+		}
+		if err := o.add(name, &jp); nil != err {
+			return nil, err
+		}
+	}
+	return o.MarshalJSON()
+}
+
+func decodeJSONProperties(raw json.RawMessage) ([]CimAnyProperty, error) {
+	var o jsonObject
+	if err := o.UnmarshalJSON(raw); nil != err {
+		return nil, err
+	}
+	properties := make([]CimAnyProperty, 0, len(o))
+	for _, field := range o {
+		if !isTypedJSONProperty(field.Value) {
+			pr, err := decodeDSP0211Property(field.Name, field.Value)
+			if nil != err {
+				return nil, errors.New("property '" + field.Name + "' is invalid, " + err.Error())
+			}
+			properties = append(properties, pr)
+			continue
+		}
+		var jp jsonProperty
+		if err := json.Unmarshal(field.Value, &jp); nil != err {
+			return nil, errors.New("property '" + field.Name + "' is invalid, " + err.Error())
+		}
+		var qualifiers []CimQualifier
+		var err error
+		if 0 != len(jp.Qualifiers) {
+			if qualifiers, err = decodeJSONQualifiers(jp.Qualifiers); nil != err {
+				return nil, errors.New("property '" + field.Name + "' is invalid, " + err.Error())
+			}
+		}
+
+		var pr CimAnyProperty
+		switch {
+		case "reference" == jp.Type:
+			pr.PropertyReference = &CimPropertyReference{Name: field.Name, ReferenceClass: jp.ReferenceClass,
+				ClassOrigin: jp.ClassOrigin, Propagated: jp.Propagated, Qualifiers: qualifiers}
+			pr.PropertyReference.ValueReference, err = decodeJSONReference(jp.Value)
+		case jp.Array:
+			pr.PropertyArray = &CimPropertyArray{Name: field.Name, Type: jp.Type, ArraySize: jp.ArraySize, ClassOrigin: jp.ClassOrigin,
+				Propagated: jp.Propagated, EmbeddedObject: jp.Embedded, Lang: jp.Lang, Qualifiers: qualifiers}
+			pr.PropertyArray.ValueArray, err = decodeJSONArray(jp.Value)
+		default:
+			pr.Property = &CimProperty{Name: field.Name, Type: jp.Type, ClassOrigin: jp.ClassOrigin,
+				Propagated: jp.Propagated, EmbeddedObject: jp.Embedded, Lang: jp.Lang, Qualifiers: qualifiers}
+			if !isJSONNull(jp.Value) {
+				var s string
+				if s, err = decodeJSONString(jp.Value); nil == err {
+					pr.Property.Value = &CimValue{Value: s}
+				}
+			}
+		}
+		if nil != err {
+			return nil, errors.New("property '" + field.Name + "' is invalid, " + err.Error())
+		}
+		properties = append(properties, pr)
+	}
+	return properties, nil
+}
+
+// isTypedJSONProperty returns true if the property is written with the
+// type, otherwise it is the value of DSP0211.
+func isTypedJSONProperty(raw json.RawMessage) bool {
+	if text := bytes.TrimSpace(raw); 0 == len(text) || '{' != text[0] {
+		return false
+	}
+	var typed struct {
+		Type *string `json:"type"`
+	}
+	return nil == json.Unmarshal(raw, &typed) && nil != typed.Type
+}
+
+// decodeDSP0211Property decodes the property written as the value of
+// DSP0211, the type is guessed from the JSON of the value: the strings,
+// the datetimes and the references are the strings, the integers are
+// sint64 or uint64, the other numbers are real64 and the objects are the
+// embedded objects.
+func decodeDSP0211Property(name string, raw json.RawMessage) (CimAnyProperty, error) {
+	text := bytes.TrimSpace(raw)
+	if 0 != len(text) && '[' == text[0] {
+		var values []json.RawMessage
+		if err := json.Unmarshal(text, &values); nil != err {
+			return CimAnyProperty{}, err
+		}
+		p := &CimPropertyArray{Name: name, Type: "string"}
+		for _, value := range values {
+			if !isJSONNull(value) {
+				p.Type, p.EmbeddedObject = dsp0211TypeOf(value)
+				break
+			}
+		}
+		var err error
+		p.ValueArray, err = decodeJSONArray(text)
+		return CimAnyProperty{PropertyArray: p}, err
+	}
+
+	p := &CimProperty{Name: name, Type: "string"}
+	if !isJSONNull(text) {
+		s, err := decodeJSONString(text)
+		if nil != err {
+			return CimAnyProperty{}, err
+		}
+		p.Type, p.EmbeddedObject = dsp0211TypeOf(text)
+		p.Value = &CimValue{Value: s}
+	}
+	return CimAnyProperty{Property: p}, nil
+}
+
+// dsp0211TypeOf returns the CIM type and the embedded object of the value.
+func dsp0211TypeOf(raw json.RawMessage) (string, string) {
+	text := string(bytes.TrimSpace(raw))
+	switch {
+	case strings.HasPrefix(text, "{"):
+		return "string", "object"
+	case "true" == text, "false" == text:
+		return "boolean", ""
+	case isJSONNumber(text):
+		if _, err := strconv.ParseInt(text, 10, 64); nil == err {
+			return "sint64", ""
+		}
+		if _, err := strconv.ParseUint(text, 10, 64); nil == err {
+			return "uint64", ""
+		}
+		return "real64", ""
+	}
+	return "string", ""
+}
+
+// MarshalJSON encodes the instance as {"kind": "instance", "class": ...,
+// "properties": {...}}.
+func (self *CimInstance) MarshalJSON() ([]byte, error) {
+	var o jsonObject
+	o.add("kind", "instance")
+	o.add("class", self.ClassName)
+	if "" != self.Lang {
+		o.add("lang", self.Lang)
+	}
+	if 0 != len(self.Qualifiers) {
+		qualifiers, err := encodeJSONQualifiers(self.Qualifiers)
+		if nil != err {
+			return nil, err
+		}
+		o = append(o, jsonField{Name: "qualifiers", Value: qualifiers})
+	}
+	properties, err := encodeJSONProperties(self.Properties, true)
+	if nil != err {
+		return nil, err
+	}
+	o = append(o, jsonField{Name: "properties", Value: properties})
+	return o.MarshalJSON()
+}
+
+func (self *CimInstance) UnmarshalJSON(bs []byte) error {
+	var o jsonObject
+	if err := o.UnmarshalJSON(bs); nil != err {
+		return err
+	}
+	*self = CimInstance{}
+	for _, field := range o {
+		var err error
+		switch field.Name {
+		case "kind":
+			var kind string
+			if err = json.Unmarshal(field.Value, &kind); nil == err && "instance" != kind {
+				err = errors.New("kind '" + kind + "' isn't a instance")
+			}
+		case "class":
+			err = json.Unmarshal(field.Value, &self.ClassName)
+		case "lang":
+			err = json.Unmarshal(field.Value, &self.Lang)
+		case "qualifiers":
+			self.Qualifiers, err = decodeJSONQualifiers(field.Value)
+		case "properties":
+			self.Properties, err = decodeJSONProperties(field.Value)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeJSONParameters(parameters []CimAnyParameter) (json.RawMessage, error) {
+	var o jsonObject
+	for _, p := range parameters {
+		decl := parameterDecl(p)
+		jp := jsonProperty{Type: decl.typ, Array: decl.isArray}
+		switch {
+		case nil != p.ParameterArray:
+			jp.ArraySize = p.ParameterArray.ArraySize
+		case nil != p.ParameterReference:
+			jp.ReferenceClass = p.ParameterReference.ReferenceClass
+		case nil != p.ParameterRefArray:
+			jp.ReferenceClass, jp.ArraySize = p.ParameterRefArray.ReferenceClass, p.ParameterRefArray.ArraySize
+		}
+		if 0 != len(decl.qualifiers) {
+			qualifiers, err := encodeJSONQualifiers(decl.qualifiers)
+			if nil != err {
+				return nil, errors.New("parameter '" + decl.name + "' is invalid, " + err.Error())
+			}
+			jp.Qualifiers = qualifiers
+		}
+		if err := o.add(decl.name, &jp); nil != err {
+			return nil, err
+		}
+	}
+	return o.MarshalJSON()
+}
+
+func decodeJSONParameters(raw json.RawMessage) ([]CimAnyParameter, error) {
+	var o jsonObject
+	if err := o.UnmarshalJSON(raw); nil != err {
+		return nil, err
+	}
+	parameters := make([]CimAnyParameter, 0, len(o))
+	for _, field := range o {
+		var jp jsonProperty
+		if err := json.Unmarshal(field.Value, &jp); nil != err {
+			return nil, errors.New("parameter '" + field.Name + "' is invalid, " + err.Error())
+		}
+		var qualifiers []CimQualifier
+		if 0 != len(jp.Qualifiers) {
+			var err error
+			if qualifiers, err = decodeJSONQualifiers(jp.Qualifiers); nil != err {
+				return nil, errors.New("parameter '" + field.Name + "' is invalid, " + err.Error())
+			}
+		}
+		var p CimAnyParameter
+		switch {
+		case "reference" == jp.Type && jp.Array:
+			p.ParameterRefArray = &CimParameterRefArray{Name: field.Name, ReferenceClass: jp.ReferenceClass, ArraySize: jp.ArraySize, Qualifiers: qualifiers}
+		case "reference" == jp.Type:
+			p.ParameterReference = &CimParameterReference{Name: field.Name, ReferenceClass: jp.ReferenceClass, Qualifiers: qualifiers}
+		case jp.Array:
+			p.ParameterArray = &CimParameterArray{Name: field.Name, Type: jp.Type, ArraySize: jp.ArraySize, Qualifiers: qualifiers}
+		default:
+			p.Parameter = &CimParameter{Name: field.Name, Type: jp.Type, Qualifiers: qualifiers}
+		}
+		parameters = append(parameters, p)
+	}
+	return parameters, nil
+}
+
+// MarshalJSON encodes the class as {"kind": "class", "name": ...,
+// "superclass": ..., "qualifiers": {...}, "properties": {...}, "methods":
+// {...}}, the properties without the default values have no "value".
+func (self *CimClass) MarshalJSON() ([]byte, error) {
+	var o jsonObject
+	o.add("kind", "class")
+	o.add("name", self.Name)
+	if "" != self.SuperClass {
+		o.add("superclass", self.SuperClass)
+	}
+	if 0 != len(self.Qualifiers) {
+		qualifiers, err := encodeJSONQualifiers(self.Qualifiers)
+		if nil != err {
+			return nil, err
+		}
+		o = append(o, jsonField{Name: "qualifiers", Value: qualifiers})
+	}
+	properties, err := encodeJSONProperties(self.Properties, false)
+	if nil != err {
+		return nil, err
+	}
+	o = append(o, jsonField{Name: "properties", Value: properties})
+
+	if 0 != len(self.Methods) {
+		var methods jsonObject
+		for _, m := range self.Methods {
+			jm := jsonProperty{Type: m.Type, ClassOrigin: m.ClassOrigin, Propagated: m.Propagated}
+			if 0 != len(m.Qualifiers) {
+				if jm.Qualifiers, err = encodeJSONQualifiers(m.Qualifiers); nil != err {
+					return nil, errors.New("method '" + m.Name + "' is invalid, " + err.Error())
+				}
+			}
+			if jm.Parameters, err = encodeJSONParameters(m.Parameters); nil != err {
+				return nil, errors.New("method '" + m.Name + "' is invalid, " + err.Error())
+			}
+			if err := methods.add(m.Name, &jm); nil != err {
+				return nil, err
+			}
+		}
+		if err := o.add("methods", methods); nil != err {
+			return nil, err
+		}
+	}
+	return o.MarshalJSON()
+}
+
+func (self *CimClass) UnmarshalJSON(bs []byte) error {
+	var o jsonObject
+	if err := o.UnmarshalJSON(bs); nil != err {
+		return err
+	}
+	*self = CimClass{}
+	for _, field := range o {
+		var err error
+		switch field.Name {
+		case "kind":
+			var kind string
+			if err = json.Unmarshal(field.Value, &kind); nil == err && "class" != kind {
+				err = errors.New("kind '" + kind + "' isn't a class")
+			}
+		case "name":
+			err = json.Unmarshal(field.Value, &self.Name)
+		case "superclass":
+			err = json.Unmarshal(field.Value, &self.SuperClass)
+		case "qualifiers":
+			self.Qualifiers, err = decodeJSONQualifiers(field.Value)
+		case "properties":
+			self.Properties, err = decodeJSONProperties(field.Value)
+		case "methods":
+			self.Methods, err = decodeJSONMethods(field.Value)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeJSONMethods(raw json.RawMessage) ([]CimMethod, error) {
+	var o jsonObject
+	if err := o.UnmarshalJSON(raw); nil != err {
+		return nil, err
+	}
+	methods := make([]CimMethod, 0, len(o))
+	for _, field := range o {
+		var jm jsonProperty
+		if err := json.Unmarshal(field.Value, &jm); nil != err {
+			return nil, errors.New("method '" + field.Name + "' is invalid, " + err.Error())
+		}
+		m := CimMethod{Name: field.Name, Type: jm.Type, ClassOrigin: jm.ClassOrigin, Propagated: jm.Propagated}
+		var err error
+		if 0 != len(jm.Qualifiers) {
+			m.Qualifiers, err = decodeJSONQualifiers(jm.Qualifiers)
+		}
+		if nil == err && 0 != len(jm.Parameters) {
+			m.Parameters, err = decodeJSONParameters(jm.Parameters)
+		}
+		if nil != err {
+			return nil, errors.New("method '" + field.Name + "' is invalid, " + err.Error())
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+// jsonParamValue is the JSON of a parameter value, form is the XML element
+// of the value if it isn't a VALUE, a VALUE.ARRAY, a VALUE.REFERENCE or a
+// VALUE.REFARRAY.
+type jsonParamValue struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type,omitempty"`
+	Embedded string          `json:"embedded,omitempty"`
+	Array    bool            `json:"array,omitempty"`
+	Form     string          `json:"form,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// MarshalJSON encodes the parameter value as {"name": ..., "type": ...,
+// "value": ...}, the references are the paths and the embedded objects
+// are the instances or the classes.
+func (paramValue *CimParamValue) MarshalJSON() ([]byte, error) {
+	jp := jsonParamValue{Name: paramValue.Name, Type: paramValue.ParamType, Embedded: paramValue.EmbeddedObject,
+		Value: json.RawMessage("null")}
+	embedded := EmbeddedKind(paramValue.EmbeddedObject, nil)
+	var err error
+	switch {
+	case nil != paramValue.Value:
+		jp.Value, err = encodeJSONString(paramValue.ParamType, embedded, paramValue.Value.Value)
+	case nil != paramValue.ValueArray:
+		jp.Array = true
+		jp.Value, err = encodeJSONArray(paramValue.ParamType, embedded, paramValue.ValueArray)
+	case nil != paramValue.ValueReference:
+		jp.Form = "reference"
+		jp.Value, err = encodeJSONReference(paramValue.ValueReference)
+	case nil != paramValue.ValueRefArray:
+		jp.Form, jp.Array = "reference", true
+		jp.Value, err = encodeJSONRefArray(paramValue.ValueRefArray)
+	case nil != paramValue.ClassName:
+		jp.Form = "classname"
+		jp.Value, err = json.Marshal(&ObjectPath{ClassName: paramValue.ClassName.Name})
+	case nil != paramValue.InstanceName:
+		jp.Form = "instancename"
+		jp.Value, err = json.Marshal(paramValue.InstanceName)
+	case nil != paramValue.Class:
+		jp.Form = "class"
+		jp.Value, err = json.Marshal(paramValue.Class)
+	case nil != paramValue.Instance:
+		jp.Form = "instance"
+		jp.Value, err = json.Marshal(paramValue.Instance)
+	case nil != paramValue.ValueNamedInstance:
+		jp.Form = "namedinstance"
+		jp.Value, err = json.Marshal(&struct {
+			Path     *CimInstanceName `json:"path"`
+			Instance *CimInstance     `json:"instance"`
+		}{&paramValue.ValueNamedInstance.InstanceName, &paramValue.ValueNamedInstance.Instance})
+	}
+	if nil != err {
+		return nil, errors.New("parameter '" + paramValue.Name + "' is invalid, " + err.Error())
+	}
+	return json.Marshal(&jp)
+}
+
+func (paramValue *CimParamValue) UnmarshalJSON(bs []byte) error {
+	var jp jsonParamValue
+	if err := json.Unmarshal(bs, &jp); nil != err {
+		return err
+	}
+	*paramValue = CimParamValue{Name: jp.Name, ParamType: jp.Type, EmbeddedObject: jp.Embedded}
+	if isJSONNull(jp.Value) {
+		return nil
+	}
+
+	var err error
+	switch jp.Form {
+	case "":
+		if jp.Array {
+			paramValue.ValueArray, err = decodeJSONArray(jp.Value)
+		} else {
+			var s string
+			if s, err = decodeJSONString(jp.Value); nil == err {
+				paramValue.Value = &CimValue{Value: s}
+			}
+		}
+	case "reference":
+		if jp.Array {
+			paramValue.ValueRefArray, err = decodeJSONRefArray(jp.Value)
+		} else {
+			paramValue.ValueReference, err = decodeJSONReference(jp.Value)
+		}
+	case "classname":
+		path := &ObjectPath{}
+		if err = json.Unmarshal(jp.Value, path); nil == err {
+			paramValue.ClassName = &CimClassName{Name: path.ClassName}
+		}
+	case "instancename":
+		paramValue.InstanceName = &CimInstanceName{}
+		err = json.Unmarshal(jp.Value, paramValue.InstanceName)
+	case "class":
+		paramValue.Class = &CimClass{}
+		err = json.Unmarshal(jp.Value, paramValue.Class)
+	case "instance":
+		paramValue.Instance = &CimInstance{}
+		err = json.Unmarshal(jp.Value, paramValue.Instance)
+	case "namedinstance":
+		paramValue.ValueNamedInstance = &CimValueNamedInstance{}
+		err = json.Unmarshal(jp.Value, &struct {
+			Path     *CimInstanceName `json:"path"`
+			Instance *CimInstance     `json:"instance"`
+		}{&paramValue.ValueNamedInstance.InstanceName, &paramValue.ValueNamedInstance.Instance})
+	default:
+		err = errors.New("form '" + jp.Form + "' is unknown")
+	}
+	if nil != err {
+		return errors.New("parameter '" + jp.Name + "' is invalid, " + err.Error())
+	}
+	return nil
+}
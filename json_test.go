@@ -0,0 +1,210 @@
+package gowbem
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// jsonRoundTrip encodes the value as JSON, decodes it into the empty value
+// and compares the XML of both.
+func jsonRoundTrip(t *testing.T, name string, value, empty interface{}) {
+	bs, err := json.Marshal(value)
+	if nil != err {
+		t.Error(name, err)
+		return
+	}
+	if err := json.Unmarshal(bs, empty); nil != err {
+		t.Error(name, err, string(bs))
+		return
+	}
+	excepted, _ := xml.Marshal(value)
+	actual, _ := xml.Marshal(empty)
+	// the booleans are written as true or false
+	if !strings.EqualFold(string(excepted), string(actual)) {
+		t.Errorf("%s\n%s\n%s\n%s", name, excepted, actual, bs)
+	}
+
+	again, err := json.Marshal(empty)
+	if nil != err {
+		t.Error(name, err)
+	} else if string(bs) != string(again) {
+		t.Errorf("%s\n%s\n%s", name, bs, again)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	files := []string{
+		"Bug3466280.xml",
+		"Bug3598613.xml",
+		"MethodRspWithReference.xml",
+		"SVCGetClass.xml",
+		"SVCMethodRsp.xml",
+		"ValueTypeEnumInstanceNames.xml",
+		"createInstance.xml",
+		"enumerateClasses.xml",
+	}
+	count := 0
+	for _, file := range files {
+		bs, err := os.ReadFile(filepath.Join("testfiles", file))
+		if nil != err {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(strings.NewReader(string(bs)))
+		for {
+			token, err := d.Token()
+			if io.EOF == err {
+				break
+			}
+			if nil != err {
+				t.Fatal(file, err)
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			var value, empty interface{}
+			switch start.Name.Local {
+			case "INSTANCE":
+				value, empty = &CimInstance{}, &CimInstance{}
+			case "CLASS":
+				value, empty = &CimClass{}, &CimClass{}
+			case "INSTANCENAME":
+				value, empty = &CimInstanceName{}, &CimInstanceName{}
+			case "PARAMVALUE":
+				value, empty = &CimParamValue{}, &CimParamValue{}
+			default:
+				continue
+			}
+			if err := d.DecodeElement(value, &start); nil != err {
+				t.Fatal(file, err)
+			}
+			jsonRoundTrip(t, file+" "+start.Name.Local, value, empty)
+			count++
+		}
+	}
+	if 0 == count {
+		t.Error("nothing is tested")
+	}
+}
+
+func TestJSONInstance(t *testing.T) {
+	instance := &CimInstance{
+		ClassName: "CIM_Disk",
+		Properties: []CimAnyProperty{
+			{Property: &CimProperty{Name: "DeviceID", Type: "string", Value: &CimValue{Value: "d1"}}},
+			{Property: &CimProperty{Name: "Size", Type: "uint64", Value: &CimValue{Value: "18446744073709551615"}}},
+			{Property: &CimProperty{Name: "Removable", Type: "boolean", Value: &CimValue{Value: "true"}}},
+			{Property: &CimProperty{Name: "Bad", Type: "uint32", Value: &CimValue{Value: "0x10"}}},
+			{Property: &CimProperty{Name: "Null", Type: "string"}},
+			{PropertyArray: &CimPropertyArray{Name: "Caps", Type: "uint16", ValueArray: &CimValueArray{
+				Values: []CimValueOrNull{{Value: &CimValue{Value: "1"}}, {Null: &CimValueNull{}}}}}},
+			{PropertyReference: &CimPropertyReference{Name: "System", ReferenceClass: "CIM_System",
+				ValueReference: (&ObjectPath{Namespace: "root/cimv2", ClassName: "CIM_System",
+					KeyBindings: CimKeyBindings{{Name: "Name", KeyValue: &CimKeyValue{ValueType: "string", Value: "s1"}}},
+				}).ValueReference()}},
+		},
+	}
+	setting, err := NewEmbeddedProperty("Setting", &CimInstance{ClassName: "CIM_Setting",
+		Properties: []CimAnyProperty{{Property: &CimProperty{Name: "ID", Type: "string", Value: &CimValue{Value: "a"}}}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	instance.Properties = append(instance.Properties, CimAnyProperty{Property: setting})
+
+	bs, err := json.Marshal(instance)
+	if nil != err {
+		t.Fatal(err)
+	}
+	s := string(bs)
+	for _, excepted := range []string{
+		`"kind":"instance","class":"CIM_Disk"`,
+		`"DeviceID":{"type":"string","value":"d1"}`,
+		`"Size":{"type":"uint64","value":18446744073709551615}`,
+		`"Removable":{"type":"boolean","value":true}`,
+		`"Bad":{"type":"uint32","value":"0x10"}`,
+		`"Null":{"type":"string","value":null}`,
+		`"Caps":{"type":"uint16","array":true,"value":[1,null]}`,
+		`"value":{"namespace":"root/cimv2","class":"CIM_System","keys":{"Name":"s1"}}`,
+		`"embedded":"instance","value":{"kind":"instance","class":"CIM_Setting"`,
+	} {
+		if !strings.Contains(s, excepted) {
+			t.Error(excepted, "isn't found in", s)
+		}
+	}
+
+	copied := &CimInstance{}
+	if err := json.Unmarshal(bs, copied); nil != err {
+		t.Fatal(err)
+	}
+	if v := copied.GetPropertyByName("Size").GetValue(); "18446744073709551615" != v {
+		t.Error(v)
+	}
+	embedded, err := GetEmbeddedValue(copied.GetPropertyByName("Setting"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if e, ok := embedded.(*CimInstance); !ok || "CIM_Setting" != e.ClassName {
+		t.Errorf("%#v", embedded)
+	}
+	jsonRoundTrip(t, "instance", instance, &CimInstance{})
+}
+
+func TestJSONInstanceName(t *testing.T) {
+	path, err := ParseObjectPath(`root/cimv2:CIM_Port.Id=7,Enabled=TRUE,Name="p1",System="root/cimv2:CIM_System.Name=\"s1\""`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	name := path.InstanceName()
+	bs, err := json.Marshal(name)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `"System":{"namespace":"root/cimv2","class":"CIM_System","keys":{"Name":"s1"}}`) {
+		t.Error(string(bs))
+	}
+
+	copied := &ObjectPath{}
+	if err := json.Unmarshal(bs, copied); nil != err {
+		t.Fatal(err)
+	}
+	if "CIM_Port" != copied.ClassName || 4 != len(copied.KeyBindings) {
+		t.Errorf("%#v", copied)
+	}
+	jsonRoundTrip(t, "instance name", name, &CimInstanceName{})
+
+	for _, s := range []string{`[]`, `{"class":"a","keys":[]}`, `{"class":1}`} {
+		if err := json.Unmarshal([]byte(s), &CimInstanceName{}); nil == err {
+			t.Error(s, "error is excepted")
+		}
+	}
+}
+
+func TestJSONParamValue(t *testing.T) {
+	embedded, err := NewEmbeddedParamValue("Errors", []interface{}{
+		&CimInstance{ClassName: "CIM_Error"}, nil})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, param := range []*CimParamValue{
+		{Name: "Count", ParamType: "uint32", Value: &CimValue{Value: "3"}},
+		{Name: "Empty", ParamType: "string"},
+		{Name: "Names", ParamType: "string", ValueArray: &CimValueArray{
+			Values: []CimValueOrNull{{Value: &CimValue{Value: "a"}}, {Null: &CimValueNull{}}}}},
+		{Name: "Class", ClassName: &CimClassName{Name: "CIM_Disk"}},
+		{Name: "Job", ParamType: "reference", ValueReference: (&ObjectPath{ClassName: "CIM_ConcreteJob",
+			KeyBindings: CimKeyBindings{{Name: "InstanceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "j1"}}},
+		}).ValueReference()},
+		embedded,
+	} {
+		jsonRoundTrip(t, param.Name, param, &CimParamValue{})
+	}
+
+	if err := json.Unmarshal([]byte(`{"name":"a","form":"unknown","value":1}`), &CimParamValue{}); nil == err {
+		t.Error("error is excepted")
+	}
+}
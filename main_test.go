@@ -249,7 +249,7 @@ func TestGetClass(t *testing.T) {
 		t.Error(e)
 		return
 	}
-	if 0 == len(class) {
+	if nil == class || 0 == len(class.Name) {
 		t.Error("class is emtpy")
 		return
 	}
@@ -0,0 +1,449 @@
+package gowbem
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The fields of the structs are mapped by the tag "cim", the format is
+//
+//	`cim:"Name,key,type=uint16"`
+//
+// Name is the name of the property or the parameter, the field name is used
+// if it is empty, "-" skips the field. The type is the CIM type of the value,
+// it is used when the value is encoded. The return value of a method is
+// mapped by the name "ReturnValue".
+//
+// The fields may be the strings, the booleans, the numbers, the types
+// derived from them (such as the enums generated by wbemgen), the pointers
+// to them for the null values, the slices of them for the arrays and the
+// pointers to ObjectPath or the types derived from ObjectPath for the
+// references, the *CimInstance, the *CimClass or the CIMInstance for the
+// embedded objects.
+
+var objectPathType = reflect.TypeOf(ObjectPath{})
+
+var embeddedTypes = []reflect.Type{
+	reflect.TypeOf(&CimInstance{}),
+	reflect.TypeOf(&CimClass{}),
+	reflect.TypeOf((*CIMInstance)(nil)).Elem(),
+}
+
+func isEmbeddedType(t reflect.Type) bool {
+	for _, embedded := range embeddedTypes {
+		if embedded == t {
+			return true
+		}
+	}
+	return false
+}
+
+func embeddedValues(fv reflect.Value) []interface{} {
+	values := make([]interface{}, fv.Len())
+	for idx := range values {
+		values[idx] = fv.Index(idx).Interface()
+	}
+	return values
+}
+
+type cimField struct {
+	name  string
+	typ   string
+	isKey bool
+	index int
+}
+
+func cimFields(t reflect.Type) []cimField {
+	var fields []cimField
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if "" != f.PkgPath {
+			continue
+		}
+		tag := f.Tag.Get("cim")
+		if "-" == tag {
+			continue
+		}
+		field := cimField{name: f.Name, index: idx}
+		for pos, s := range strings.Split(tag, ",") {
+			switch {
+			case 0 == pos:
+				if "" != s {
+					field.name = s
+				}
+			case "key" == s:
+				field.isKey = true
+			case strings.HasPrefix(s, "type="):
+				field.typ = strings.TrimPrefix(s, "type=")
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if reflect.Ptr != rv.Kind() || rv.IsNil() || reflect.Struct != rv.Elem().Kind() {
+		return reflect.Value{}, errors.New("value must be a pointer to a struct, actual is " + fmt.Sprintf("%T", v))
+	}
+	return rv.Elem(), nil
+}
+
+func isReferenceType(t reflect.Type) bool {
+	return reflect.Ptr == t.Kind() && reflect.Struct == t.Elem().Kind() && t.Elem().ConvertibleTo(objectPathType)
+}
+
+// UnmarshalInstance copies the properties of the instance into the fields
+// of the struct which v points to, the names of the properties are
+// compared without the case.
+func UnmarshalInstance(instance CIMInstance, v interface{}) error {
+	rv, err := structValue(v)
+	if nil != err {
+		return err
+	}
+	for _, field := range cimFields(rv.Type()) {
+		var pr CIMProperty
+		for idx := 0; idx < instance.GetPropertyCount(); idx++ {
+			if p := instance.GetPropertyByIndex(idx); strings.EqualFold(p.GetName(), field.name) {
+				pr = p
+				break
+			}
+		}
+		if nil == pr {
+			continue
+		}
+
+		var value interface{}
+		switch p := pr.(type) {
+		case *CimPropertyReference:
+			if nil != p.ValueReference {
+				value = ObjectPathFromReference(p.ValueReference)
+			}
+		default:
+			value = pr.GetValue()
+		}
+		if err := setFieldValue(rv.Field(field.index), value); nil != err {
+			return errors.New("property '" + field.name + "' is invalid, " + err.Error())
+		}
+	}
+	return nil
+}
+
+// MarshalInstance creates an instance of the class from the fields of the
+// struct which v points to, the nil pointers are encoded as the null values.
+func MarshalInstance(className string, v interface{}) (*CimInstance, error) {
+	rv, err := structValue(v)
+	if nil != err {
+		return nil, err
+	}
+	instance := &CimInstance{ClassName: className}
+	for _, field := range cimFields(rv.Type()) {
+		fv := rv.Field(field.index)
+		var pr CimAnyProperty
+		switch {
+		case isEmbeddedType(fv.Type()):
+			if pr.Property, err = NewEmbeddedProperty(field.name, fv.Interface()); nil != err {
+				return nil, err
+			}
+		case reflect.Slice == fv.Kind() && isEmbeddedType(fv.Type().Elem()):
+			if fv.IsNil() {
+				pr.PropertyArray = &CimPropertyArray{Name: field.name, Type: "string", EmbeddedObject: EmbeddedObjectObject}
+			} else if pr.PropertyArray, err = NewEmbeddedPropertyArray(field.name, embeddedValues(fv)); nil != err {
+				return nil, err
+			}
+		case isReferenceType(fv.Type()):
+			pr.PropertyReference = &CimPropertyReference{Name: field.name}
+			if !fv.IsNil() {
+				pr.PropertyReference.ValueReference = toObjectPath(fv).ValueReference()
+			}
+		case reflect.Slice == fv.Kind():
+			if isReferenceType(fv.Type().Elem()) {
+				return nil, errors.New("property '" + field.name + "' is invalid, array of references isn't supported")
+			}
+			array, err := toValueArray(fv)
+			if nil != err {
+				return nil, errors.New("property '" + field.name + "' is invalid, " + err.Error())
+			}
+			pr.PropertyArray = &CimPropertyArray{Name: field.name, Type: field.typ, ValueArray: array}
+		default:
+			value, err := toValue(fv)
+			if nil != err {
+				return nil, errors.New("property '" + field.name + "' is invalid, " + err.Error())
+			}
+			pr.Property = &CimProperty{Name: field.name, Type: field.typ, Value: value}
+		}
+		instance.Properties = append(instance.Properties, pr)
+	}
+	return instance, nil
+}
+
+// MarshalParamValues converts the fields of the struct which v points to
+// into the parameters, the nil pointers and the nil slices are omitted.
+func MarshalParamValues(v interface{}) ([]CIMParamValue, error) {
+	rv, err := structValue(v)
+	if nil != err {
+		return nil, err
+	}
+	var params []CIMParamValue
+	for _, field := range cimFields(rv.Type()) {
+		fv := rv.Field(field.index)
+		if (reflect.Ptr == fv.Kind() || reflect.Slice == fv.Kind() || reflect.Interface == fv.Kind()) && fv.IsNil() {
+			continue
+		}
+		param := &CimParamValue{Name: field.name, ParamType: field.typ}
+		switch {
+		case isEmbeddedType(fv.Type()):
+			if param, err = NewEmbeddedParamValue(field.name, fv.Interface()); nil != err {
+				return nil, err
+			}
+		case reflect.Slice == fv.Kind() && isEmbeddedType(fv.Type().Elem()):
+			if param, err = NewEmbeddedParamValue(field.name, embeddedValues(fv)); nil != err {
+				return nil, err
+			}
+		case isReferenceType(fv.Type()):
+			param.ParamType = "reference"
+			param.ValueReference = toObjectPath(fv).ValueReference()
+		case reflect.Slice == fv.Kind() && isReferenceType(fv.Type().Elem()):
+			param.ParamType = "reference"
+			param.ValueRefArray = &CimValueRefArray{}
+			for idx := 0; idx < fv.Len(); idx++ {
+				elem := fv.Index(idx)
+				if elem.IsNil() {
+					param.ValueRefArray.Values = append(param.ValueRefArray.Values, CimValueReferenceOrNull{Null: &CimValueNull{}})
+				} else {
+					param.ValueRefArray.Values = append(param.ValueRefArray.Values, CimValueReferenceOrNull{Value: toObjectPath(elem).ValueReference()})
+				}
+			}
+		case reflect.Slice == fv.Kind():
+			if param.ValueArray, err = toValueArray(fv); nil != err {
+				return nil, errors.New("parameter '" + field.name + "' is invalid, " + err.Error())
+			}
+		default:
+			if param.Value, err = toValue(fv); nil != err {
+				return nil, errors.New("parameter '" + field.name + "' is invalid, " + err.Error())
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// UnmarshalParamValues copies the return value and the output parameters
+// into the fields of the struct which v points to, the return value is
+// copied into the field with the name "ReturnValue".
+func UnmarshalParamValues(returnValue Valuer, params []CIMParamValue, v interface{}) error {
+	rv, err := structValue(v)
+	if nil != err {
+		return err
+	}
+	for _, field := range cimFields(rv.Type()) {
+		var value interface{}
+		found := false
+		if strings.EqualFold("ReturnValue", field.name) && nil != returnValue {
+			switch r := returnValue.(type) {
+			case *CimValue:
+				found, value = nil != r, r.Value
+			case *CimValueReference:
+				found, value = nil != r, ObjectPathFromReference(r)
+			}
+		}
+		for _, param := range params {
+			if !found && strings.EqualFold(param.GetName(), field.name) {
+				found, value = true, paramValue(param)
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := setFieldValue(rv.Field(field.index), value); nil != err {
+			return errors.New("parameter '" + field.name + "' is invalid, " + err.Error())
+		}
+	}
+	return nil
+}
+
+func paramValue(param CIMParamValue) interface{} {
+	p, ok := param.(*CimParamValue)
+	if !ok {
+		if value := param.GetValue(); nil != value {
+			return value.String()
+		}
+		return nil
+	}
+	switch {
+	case nil != p.Value:
+		return p.Value.Value
+	case nil != p.ValueArray:
+		return p.ValueArray.GetValue()
+	case nil != p.ValueReference:
+		return ObjectPathFromReference(p.ValueReference)
+	case nil != p.ValueRefArray:
+		values := make([]interface{}, len(p.ValueRefArray.Values))
+		for idx, ref := range p.ValueRefArray.Values {
+			if nil != ref.Value {
+				values[idx] = ObjectPathFromReference(ref.Value)
+			}
+		}
+		return values
+	case nil != p.InstanceName:
+		return &ObjectPath{ClassName: p.InstanceName.ClassName, KeyBindings: p.InstanceName.KeyBindings}
+	}
+	return nil
+}
+
+func toObjectPath(fv reflect.Value) *ObjectPath {
+	return fv.Convert(reflect.PtrTo(objectPathType)).Interface().(*ObjectPath)
+}
+
+func toValueArray(fv reflect.Value) (*CimValueArray, error) {
+	if fv.IsNil() {
+		return nil, nil
+	}
+	array := &CimValueArray{Values: make([]CimValueOrNull, fv.Len())}
+	for idx := 0; idx < fv.Len(); idx++ {
+		value, err := toValue(fv.Index(idx))
+		if nil != err {
+			return nil, err
+		}
+		if nil == value {
+			array.Values[idx].Null = &CimValueNull{}
+		} else {
+			array.Values[idx].Value = value
+		}
+	}
+	return array, nil
+}
+
+// toValue formats the value, it returns nil for the nil pointers.
+func toValue(fv reflect.Value) (*CimValue, error) {
+	if reflect.Ptr == fv.Kind() {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return &CimValue{Value: fv.String()}, nil
+	case reflect.Bool:
+		return &CimValue{Value: strconv.FormatBool(fv.Bool())}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &CimValue{Value: strconv.FormatInt(fv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &CimValue{Value: strconv.FormatUint(fv.Uint(), 10)}, nil
+	case reflect.Float32:
+		return &CimValue{Value: strconv.FormatFloat(fv.Float(), 'g', -1, 32)}, nil
+	case reflect.Float64:
+		return &CimValue{Value: strconv.FormatFloat(fv.Float(), 'g', -1, 64)}, nil
+	}
+	return nil, errors.New("type '" + fv.Type().String() + "' isn't supported")
+}
+
+// setFieldValue sets the field by the value, the value is a string, an
+// *ObjectPath, a []interface{} or nil.
+func setFieldValue(fv reflect.Value, value interface{}) error {
+	if nil == value {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+
+	if isEmbeddedType(fv.Type()) {
+		if s, ok := value.(string); ok {
+			v, err := DecodeEmbeddedObject(s)
+			if nil != err {
+				return err
+			}
+			if nil == v {
+				fv.Set(reflect.Zero(fv.Type()))
+				return nil
+			}
+			value = v
+		}
+		v := reflect.ValueOf(value)
+		if !v.Type().AssignableTo(fv.Type()) {
+			return errors.New("type '" + v.Type().String() + "' isn't a " + fv.Type().String())
+		}
+		fv.Set(v)
+		return nil
+	}
+
+	if isReferenceType(fv.Type()) {
+		path, ok := value.(*ObjectPath)
+		if !ok {
+			var err error
+			if path, err = ParseObjectPath(fmt.Sprint(value)); nil != err {
+				return err
+			}
+		}
+		fv.Set(reflect.ValueOf(path).Convert(fv.Type()))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setFieldValue(elem.Elem(), value); nil != err {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case reflect.Slice:
+		values, ok := value.([]interface{})
+		if !ok {
+			return errors.New("'" + fmt.Sprint(value) + "' isn't an array")
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for idx, v := range values {
+			if err := setFieldValue(slice.Index(idx), v); nil != err {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+
+	s := strings.TrimSpace(fmt.Sprint(value))
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(fmt.Sprint(value))
+	case reflect.Bool:
+		switch {
+		case strings.EqualFold("true", s):
+			fv.SetBool(true)
+		case strings.EqualFold("false", s):
+			fv.SetBool(false)
+		default:
+			return errors.New("'" + s + "' isn't a boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if nil != err {
+			if i, err = strconv.ParseInt(s, 0, fv.Type().Bits()); nil != err {
+				return err
+			}
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if nil != err {
+			if u, err = strconv.ParseUint(s, 0, fv.Type().Bits()); nil != err {
+				return err
+			}
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if nil != err {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.New("type '" + fv.Type().String() + "' isn't supported")
+	}
+	return nil
+}
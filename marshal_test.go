@@ -0,0 +1,82 @@
+package gowbem
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testStatus uint16
+
+type testDisk struct {
+	DeviceID string       `cim:"DeviceID,key,type=string"`
+	Size     *uint64      `cim:",type=uint64"`
+	Status   []testStatus `cim:"OperationalStatus,type=uint16"`
+	Enabled  bool         `cim:"Enabled,type=boolean"`
+	System   *ObjectPath  `cim:"System"`
+	Ignored  string       `cim:"-"`
+}
+
+func TestMarshalInstance(t *testing.T) {
+	size := uint64(1024)
+	system, _ := ParseObjectPath(`root/cimv2:Test_System.Name="s1"`)
+	disk := &testDisk{DeviceID: "d1", Size: &size, Status: []testStatus{2, 3}, Enabled: true, System: system, Ignored: "x"}
+
+	instance, err := MarshalInstance("Test_Disk", disk)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 5 != len(instance.Properties) || "uint64" != instance.GetPropertyByName("Size").(*CimProperty).Type {
+		t.Fatal(instance.String())
+	}
+
+	var actual testDisk
+	if err := UnmarshalInstance(instance, &actual); nil != err {
+		t.Fatal(err)
+	}
+	disk.Ignored = ""
+	if !reflect.DeepEqual(disk, &actual) {
+		t.Errorf("excepted is %#v, actual is %#v", disk, &actual)
+	}
+
+	instance.Properties[1].Property.Value = nil
+	if err := UnmarshalInstance(instance, &actual); nil != err || nil != actual.Size {
+		t.Error(actual.Size, err)
+	}
+	instance.Properties[3].Property.Value = &CimValue{Value: "yes"}
+	if err := UnmarshalInstance(instance, &actual); nil == err {
+		t.Error("error is excepted")
+	}
+	if err := UnmarshalInstance(instance, actual); nil == err {
+		t.Error("error is excepted")
+	}
+}
+
+func TestMarshalParamValues(t *testing.T) {
+	job, _ := ParseObjectPath(`Test_Job.InstanceID="j1"`)
+	in := &struct {
+		RequestedState testStatus `cim:"RequestedState,type=uint16"`
+		Timeout        *string    `cim:"TimeoutPeriod,type=datetime"`
+		Jobs           []*ObjectPath
+	}{RequestedState: 3, Jobs: []*ObjectPath{job}}
+	params, err := MarshalParamValues(in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(params) || "uint16" != params[0].GetParamType() || "reference" != params[1].GetParamType() {
+		t.Fatal(params)
+	}
+
+	out := &struct {
+		ReturnValue uint32 `cim:"ReturnValue"`
+		Job         *ObjectPath
+		Jobs        []*ObjectPath
+	}{}
+	err = UnmarshalParamValues(&CimValue{Value: "4096"}, []CIMParamValue{
+		&CimParamValue{Name: "Job", ValueReference: job.ValueReference()}, params[1]}, out)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4096 != out.ReturnValue || `Test_Job.InstanceID="j1"` != out.Job.String() || 1 != len(out.Jobs) {
+		t.Errorf("%#v", out)
+	}
+}
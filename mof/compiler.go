@@ -0,0 +1,191 @@
+// Package mof implements a compiler front end for the Managed Object Format
+// (DSP0221), it reads the qualifier declarations, the classes and the
+// instances of MOF files into the structures of the gowbem package.
+//
+//	c := mof.NewCompiler()
+//	if err := c.ParseFile("CIM_Min25.mof"); err != nil {
+//		...
+//	}
+//	for _, ns := range c.Namespaces() {
+//		fmt.Println(ns.Name, len(ns.Classes), len(ns.Instances))
+//	}
+package mof
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// DefaultNamespace is the namespace of the declarations before the first
+// #pragma namespace.
+const DefaultNamespace = "root/cimv2"
+
+// Instance is an instance declaration, Alias is the name after "as $" or
+// empty.
+type Instance struct {
+	Alias    string
+	Name     *gowbem.CimInstanceName
+	Instance gowbem.CimInstance
+}
+
+// Namespace holds the declarations of a namespace in the order they are
+// declared.
+type Namespace struct {
+	Name       string
+	Qualifiers []gowbem.CimQualifierDeclaration
+	Classes    []gowbem.CimClass
+	Instances  []Instance
+}
+
+// Qualifier returns the qualifier declaration with the name or nil.
+func (ns *Namespace) Qualifier(name string) *gowbem.CimQualifierDeclaration {
+	for idx := range ns.Qualifiers {
+		if strings.EqualFold(ns.Qualifiers[idx].Name, name) {
+			return &ns.Qualifiers[idx]
+		}
+	}
+	return nil
+}
+
+// Class returns the class with the name or nil.
+func (ns *Namespace) Class(name string) *gowbem.CimClass {
+	for idx := range ns.Classes {
+		if strings.EqualFold(ns.Classes[idx].Name, name) {
+			return &ns.Classes[idx]
+		}
+	}
+	return nil
+}
+
+// Compiler compiles MOF files, the declarations of all files it has parsed
+// are kept, so a file can use the classes of the files parsed before it.
+type Compiler struct {
+	// IncludePaths are searched for the files of #pragma include after the
+	// directory of the including file.
+	IncludePaths []string
+
+	// Strict reports an error when a superclass or the class of an
+	// instance isn't declared, otherwise the class is used as is and the
+	// types of the instance's properties are guessed from the values.
+	Strict bool
+
+	// ReadFile reads the MOF files, ioutil.ReadFile is used if it is nil.
+	ReadFile func(filename string) ([]byte, error)
+
+	namespaces []*Namespace
+	aliases    map[string]*gowbem.CimInstanceName
+	including  []string
+}
+
+func NewCompiler() *Compiler {
+	return &Compiler{aliases: map[string]*gowbem.CimInstanceName{}}
+}
+
+// Namespaces returns the compiled namespaces in the order they are created.
+func (c *Compiler) Namespaces() []*Namespace {
+	return c.namespaces
+}
+
+// Namespace returns the compiled namespace or nil.
+func (c *Compiler) Namespace(name string) *Namespace {
+	key := namespaceKey(name)
+	for _, ns := range c.namespaces {
+		if namespaceKey(ns.Name) == key {
+			return ns
+		}
+	}
+	return nil
+}
+
+func namespaceKey(name string) string {
+	return strings.ToLower(strings.Trim(strings.Replace(name, "\\", "/", -1), "/"))
+}
+
+func (c *Compiler) namespace(name string) *Namespace {
+	if ns := c.Namespace(name); nil != ns {
+		return ns
+	}
+	ns := &Namespace{Name: strings.Trim(strings.Replace(name, "\\", "/", -1), "/")}
+	c.namespaces = append(c.namespaces, ns)
+	return ns
+}
+
+func (c *Compiler) readFile(filename string) ([]byte, error) {
+	if nil != c.ReadFile {
+		return c.ReadFile(filename)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// ParseFile compiles the MOF file into the namespaces of the compiler.
+func (c *Compiler) ParseFile(filename string) error {
+	bs, err := c.readFile(filename)
+	if nil != err {
+		return err
+	}
+	return c.Parse(filename, string(bs))
+}
+
+// Parse compiles the MOF source, filename is used by the errors and to
+// resolve the relative paths of #pragma include.
+func (c *Compiler) Parse(filename, src string) error {
+	return c.parse(filename, src, DefaultNamespace)
+}
+
+// parse compiles the MOF source, the declarations are in the namespace
+// until a #pragma namespace changes it.
+func (c *Compiler) parse(filename, src, namespace string) error {
+	if nil == c.aliases {
+		c.aliases = map[string]*gowbem.CimInstanceName{}
+	}
+	for _, name := range c.including {
+		if name == filename {
+			return &Error{Position: Position{Filename: filename, Line: 1, Column: 1},
+				Message: "file includes itself recursively"}
+		}
+	}
+	c.including = append(c.including, filename)
+	defer func() {
+		c.including = c.including[:len(c.including)-1]
+	}()
+
+	p := &parser{
+		compiler:  c,
+		lexer:     newLexer(filename, src),
+		filename:  filename,
+		namespace: namespace,
+	}
+	return p.parse()
+}
+
+// findInclude returns the path of the included file.
+func (c *Compiler) findInclude(from, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	candidates := []string{filepath.Join(filepath.Dir(from), name)}
+	for _, dir := range c.IncludePaths {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	if nil == c.ReadFile {
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); nil == err {
+				return candidate
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// ParseFile compiles a MOF file with a new compiler.
+func ParseFile(filename string) (*Compiler, error) {
+	c := NewCompiler()
+	if err := c.ParseFile(filename); nil != err {
+		return nil, err
+	}
+	return c, nil
+}
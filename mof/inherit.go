@@ -0,0 +1,14 @@
+package mof
+
+import (
+	"github.com/runner-mei/gowbem"
+)
+
+// inherit merges the features of the superclass into the class, see
+// gowbem.InheritClass.
+func inherit(class, super *gowbem.CimClass, pos Position) error {
+	if err := gowbem.InheritClass(class, super); nil != err {
+		return &Error{Position: pos, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package mof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenAlias
+	tokenString
+	tokenChar
+	tokenInteger
+	tokenReal
+	tokenPragma
+	tokenPunct
+)
+
+func (kind tokenKind) String() string {
+	switch kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenIdentifier:
+		return "identifier"
+	case tokenAlias:
+		return "alias"
+	case tokenString:
+		return "string"
+	case tokenChar:
+		return "char"
+	case tokenInteger:
+		return "integer"
+	case tokenReal:
+		return "real"
+	case tokenPragma:
+		return "#pragma"
+	}
+	return "punctuation"
+}
+
+// Position is a location in a MOF file, Line and Column start at 1.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (pos Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+}
+
+// Error is a syntax or semantic error of a MOF file.
+type Error struct {
+	Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Position.String() + ": " + e.Message
+}
+
+type token struct {
+	kind tokenKind
+	pos  Position
+
+	// text is the identifier, the punctuation, the decoded string or
+	// the literal of the number.
+	text string
+}
+
+func (tok token) String() string {
+	switch tok.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(tok.text)
+	case tokenChar:
+		return "'" + tok.text + "'"
+	}
+	return "'" + tok.text + "'"
+}
+
+// is returns true if the token is the punctuation or the keyword, the
+// keywords of MOF are case insensitive.
+func (tok token) is(s string) bool {
+	switch tok.kind {
+	case tokenPunct:
+		return tok.text == s
+	case tokenIdentifier:
+		return strings.EqualFold(tok.text, s)
+	}
+	return false
+}
+
+type lexer struct {
+	filename string
+	src      string
+	offset   int
+	line     int
+	column   int
+}
+
+func newLexer(filename, src string) *lexer {
+	// skip the byte order mark
+	src = strings.TrimPrefix(src, "\ufeff")
+	return &lexer{filename: filename, src: src, line: 1, column: 1}
+}
+
+func (l *lexer) pos() Position {
+	return Position{Filename: l.filename, Line: l.line, Column: l.column}
+}
+
+func (l *lexer) errorf(pos Position, format string, args ...interface{}) error {
+	return &Error{Position: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) peekRune(n int) rune {
+	if l.offset+n >= len(l.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.offset+n:])
+	return r
+}
+
+func (l *lexer) nextRune() rune {
+	if l.offset >= len(l.src) {
+		return -1
+	}
+	r, size := utf8.DecodeRuneInString(l.src[l.offset:])
+	l.offset += size
+	if '\n' == r {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for {
+		r := l.peekRune(0)
+		switch {
+		case -1 == r:
+			return nil
+		case unicode.IsSpace(r):
+			l.nextRune()
+		case '/' == r && '/' == l.peekRune(1):
+			for r := l.peekRune(0); -1 != r && '\n' != r; r = l.peekRune(0) {
+				l.nextRune()
+			}
+		case '/' == r && '*' == l.peekRune(1):
+			pos := l.pos()
+			l.nextRune()
+			l.nextRune()
+			for {
+				r := l.nextRune()
+				if -1 == r {
+					return l.errorf(pos, "comment isn't terminated")
+				}
+				if '*' == r && '/' == l.peekRune(0) {
+					l.nextRune()
+					break
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func isIdentifierStart(r rune) bool {
+	return '_' == r || unicode.IsLetter(r)
+}
+
+func isIdentifierChar(r rune) bool {
+	return '_' == r || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); nil != err {
+		return token{}, err
+	}
+
+	pos := l.pos()
+	r := l.peekRune(0)
+	switch {
+	case -1 == r:
+		return token{kind: tokenEOF, pos: pos}, nil
+	case isIdentifierStart(r):
+		start := l.offset
+		for isIdentifierChar(l.peekRune(0)) {
+			l.nextRune()
+		}
+		return token{kind: tokenIdentifier, pos: pos, text: l.src[start:l.offset]}, nil
+	case '$' == r:
+		l.nextRune()
+		start := l.offset
+		for isIdentifierChar(l.peekRune(0)) {
+			l.nextRune()
+		}
+		if start == l.offset {
+			return token{}, l.errorf(pos, "alias name is missing after '$'")
+		}
+		return token{kind: tokenAlias, pos: pos, text: l.src[start:l.offset]}, nil
+	case '#' == r:
+		l.nextRune()
+		start := l.offset
+		for isIdentifierChar(l.peekRune(0)) {
+			l.nextRune()
+		}
+		if !strings.EqualFold("pragma", l.src[start:l.offset]) {
+			return token{}, l.errorf(pos, "'#%s' is unsupported, only #pragma is allowed", l.src[start:l.offset])
+		}
+		return token{kind: tokenPragma, pos: pos, text: "#pragma"}, nil
+	case '"' == r:
+		s, err := l.quoted('"')
+		if nil != err {
+			return token{}, err
+		}
+		return token{kind: tokenString, pos: pos, text: s}, nil
+	case '\'' == r:
+		s, err := l.quoted('\'')
+		if nil != err {
+			return token{}, err
+		}
+		if 1 != utf8.RuneCountInString(s) {
+			return token{}, l.errorf(pos, "char literal must contain exactly one character")
+		}
+		return token{kind: tokenChar, pos: pos, text: s}, nil
+	case unicode.IsDigit(r) || (('-' == r || '+' == r || '.' == r) && unicode.IsDigit(l.peekRune(1))):
+		return l.number(pos)
+	}
+
+	l.nextRune()
+	switch r {
+	case '{', '}', '[', ']', '(', ')', ';', ',', ':', '=', '.':
+		return token{kind: tokenPunct, pos: pos, text: string(r)}, nil
+	}
+	return token{}, l.errorf(pos, "unexpected character %q", r)
+}
+
+// quoted reads a string or char literal, the escape sequences of MOF are
+// decoded.
+func (l *lexer) quoted(quote rune) (string, error) {
+	pos := l.pos()
+	l.nextRune()
+
+	var buf strings.Builder
+	for {
+		r := l.nextRune()
+		switch r {
+		case -1, '\n':
+			return "", l.errorf(pos, "literal isn't terminated")
+		case quote:
+			return buf.String(), nil
+		case '\\':
+			escapePos := l.pos()
+			e := l.nextRune()
+			switch e {
+			case 'b':
+				buf.WriteByte('\b')
+			case 't':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'r':
+				buf.WriteByte('\r')
+			case '"', '\'', '\\':
+				buf.WriteRune(e)
+			case 'x', 'X':
+				start := l.offset
+				for i := 0; i < 4 && isHexDigit(l.peekRune(0)); i++ {
+					l.nextRune()
+				}
+				if start == l.offset {
+					return "", l.errorf(escapePos, "hex digits are missing in the escape sequence")
+				}
+				v, _ := strconv.ParseUint(l.src[start:l.offset], 16, 32)
+				buf.WriteRune(rune(v))
+			default:
+				return "", l.errorf(escapePos, "unknown escape sequence '\\%c'", e)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func isHexDigit(r rune) bool {
+	return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+}
+
+// number reads an integer or a real literal, the integers are converted to
+// decimal, e.g. 0x1F, 017 and 101b.
+func (l *lexer) number(pos Position) (token, error) {
+	start := l.offset
+	if r := l.peekRune(0); '-' == r || '+' == r {
+		l.nextRune()
+	}
+	for r := l.peekRune(0); isHexDigit(r) || 'x' == r || 'X' == r || '.' == r ||
+		(('+' == r || '-' == r) && ('e' == l.peekRune(-1) || 'E' == l.peekRune(-1))); r = l.peekRune(0) {
+		l.nextRune()
+	}
+	if r := l.peekRune(0); isIdentifierChar(r) {
+		return token{}, l.errorf(pos, "invalid number '%s%c'", l.src[start:l.offset], r)
+	}
+
+	literal := l.src[start:l.offset]
+	sign, digits := "", literal
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if "+" == sign {
+		sign = ""
+	}
+
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
+		base, digits = 16, digits[2:]
+	case strings.HasSuffix(digits, "b") || strings.HasSuffix(digits, "B"):
+		if strings.Trim(digits[:len(digits)-1], "01") == "" && len(digits) > 1 {
+			base, digits = 2, digits[:len(digits)-1]
+		}
+	case strings.ContainsAny(digits, ".eE"):
+		if _, err := strconv.ParseFloat(literal, 64); nil != err {
+			return token{}, l.errorf(pos, "invalid real number '%s'", literal)
+		}
+		return token{kind: tokenReal, pos: pos, text: literal}, nil
+	case len(digits) > 1 && strings.HasPrefix(digits, "0"):
+		base = 8
+	}
+
+	if "-" == sign {
+		v, err := strconv.ParseInt(sign+digits, base, 64)
+		if nil != err {
+			return token{}, l.errorf(pos, "invalid integer '%s'", literal)
+		}
+		return token{kind: tokenInteger, pos: pos, text: strconv.FormatInt(v, 10)}, nil
+	}
+	v, err := strconv.ParseUint(digits, base, 64)
+	if nil != err {
+		return token{}, l.errorf(pos, "invalid integer '%s'", literal)
+	}
+	return token{kind: tokenInteger, pos: pos, text: strconv.FormatUint(v, 10)}, nil
+}
@@ -0,0 +1,266 @@
+package mof
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/gowbem"
+)
+
+func TestLexer(t *testing.T) {
+	l := newLexer("test.mof", `class A_b { 0x1F 017 101b -12 1.5e3 "a\"\x41" 'c' $al #pragma ; } // comment
+/* comment */ [`)
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if tokenEOF == tok.kind {
+			break
+		}
+		tokens = append(tokens, tok)
+	}
+
+	expected := []struct {
+		kind tokenKind
+		text string
+	}{
+		{tokenIdentifier, "class"},
+		{tokenIdentifier, "A_b"},
+		{tokenPunct, "{"},
+		{tokenInteger, "31"},
+		{tokenInteger, "15"},
+		{tokenInteger, "5"},
+		{tokenInteger, "-12"},
+		{tokenReal, "1.5e3"},
+		{tokenString, `a"A`},
+		{tokenChar, "c"},
+		{tokenAlias, "al"},
+		{tokenPragma, "#pragma"},
+		{tokenPunct, ";"},
+		{tokenPunct, "}"},
+		{tokenPunct, "["},
+	}
+	if len(expected) != len(tokens) {
+		t.Fatal(tokens)
+	}
+	for idx, tok := range tokens {
+		if expected[idx].kind != tok.kind || expected[idx].text != tok.text {
+			t.Errorf("tokens[%d]: excepted is %v %q, actual is %v %q", idx,
+				expected[idx].kind, expected[idx].text, tok.kind, tok.text)
+		}
+	}
+	if last := tokens[len(tokens)-1].pos; 2 != last.Line || 15 != last.Column {
+		t.Error(last)
+	}
+}
+
+func TestParseTestFiles(t *testing.T) {
+	c := NewCompiler()
+	c.Strict = true
+	for _, filename := range []string{"CIM_Min25.mof", "ACLTest.mof", "testsuite.mof", "stringArray.mof", "wqlTest.mof"} {
+		if err := c.ParseFile("../testfiles/" + filename); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	ns := c.Namespace(DefaultNamespace)
+	if nil == ns {
+		t.Fatal("namespace isn't found")
+	}
+
+	description := ns.Qualifier("Description")
+	if nil == description || "string" != description.Type || !description.Translatable ||
+		!description.Overridable || !description.ToSubclass {
+		t.Error(description)
+	}
+	if key := ns.Qualifier("Key"); nil == key || key.Overridable || "false" != key.Value.Value {
+		t.Error(key)
+	}
+
+	system := ns.Class("EXP_BionicComputerSystem")
+	if nil == system || "CIM_ComputerSystem" != system.SuperClass {
+		t.Fatal(system)
+	}
+	found := false
+	for _, pr := range system.Properties {
+		if nil != pr.Property && "Name" == pr.Property.Name {
+			found = true
+			if !pr.Property.Propagated || !hasQualifier(pr.Property.Qualifiers, "Key") {
+				t.Error(pr.Property)
+			}
+		}
+	}
+	if !found {
+		t.Error("property Name isn't inherited")
+	}
+	if hasQualifier(system.Qualifiers, "Abstract") {
+		t.Error("Abstract is restricted")
+	}
+
+	component := ns.Class("CIM_SystemComponent")
+	if nil == component || !hasQualifier(component.Qualifiers, "Association") {
+		t.Fatal(component)
+	}
+
+	var names []string
+	for _, instance := range ns.Instances {
+		if nil == instance.Name {
+			t.Fatal(instance.Instance.ClassName, "has no name")
+		}
+		names = append(names, instance.Name.ClassName)
+	}
+	if 20 != len(names) {
+		t.Error(names)
+	}
+
+	aclInstance := ns.Instances[2].Instance
+	if "CIM_SystemComponent" != aclInstance.ClassName {
+		t.Fatal(aclInstance.ClassName)
+	}
+	pr := aclInstance.GetPropertyByName("PartComponent")
+	if nil == pr {
+		t.Fatal("PartComponent is missing")
+	}
+	ref, ok := pr.GetValue().(*gowbem.CimInstanceName)
+	if !ok || "EXP_BionicComputerSystem" != ref.ClassName || 2 != len(ref.KeyBindings) {
+		t.Error(pr.GetValue())
+	}
+
+	var simple *Instance
+	for idx := range ns.Instances {
+		if "simple" == ns.Instances[idx].Instance.ClassName {
+			simple = &ns.Instances[idx]
+		}
+	}
+	if nil == simple || "numeric" != simple.Name.KeyBindings[0].KeyValue.ValueType {
+		t.Fatal(simple)
+	}
+	env := simple.Instance.GetPropertyByName("env")
+	if values, ok := env.GetValue().([]interface{}); !ok || 3 != len(values) || "cad2" != values[1] {
+		t.Error(env.GetValue())
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	c := NewCompiler()
+	for _, filename := range []string{"remote.mof", "indicationTest.mof"} {
+		if err := c.ParseFile("../testfiles/" + filename); nil != err {
+			t.Fatal(err)
+		}
+	}
+	ns := c.Namespace(DefaultNamespace)
+	if 3 != len(ns.Classes) || 0 == len(ns.Instances) {
+		t.Fatal(len(ns.Classes), len(ns.Instances))
+	}
+	pr := ns.Instances[0].Instance.Properties[3].PropertyArray
+	if nil == pr || "ProviderTypes" != pr.Name || "uint64" != pr.Type {
+		t.Error(pr)
+	}
+
+	c = NewCompiler()
+	c.Strict = true
+	if err := c.ParseFile("../testfiles/remote.mof"); nil == err ||
+		!strings.Contains(err.Error(), "class 'OpenWBEM_RemoteProviderRegistration' isn't declared") {
+		t.Error(err)
+	}
+}
+
+func TestPragmaAndAlias(t *testing.T) {
+	files := map[string]string{
+		"main.mof": `
+#pragma include("classes.mof")
+#pragma namespace("root/test")
+#pragma include("classes.mof")
+
+instance of Test_Host as $h1 { Name = "h1"; };
+instance of Test_Disk as $d1 { ID = 1; };
+instance of Test_HostDisk { Host = $h1; Disk = $d1; };
+`,
+		"classes.mof": `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Association : boolean = false, Scope(association), Flavor(DisableOverride, ToSubclass);
+
+class Test_Host { [Key] string Name; };
+class Test_Disk { [Key] uint32 ID; };
+[Association] class Test_HostDisk {
+	[Key] Test_Host REF Host;
+	[Key] Test_Disk REF Disk;
+};
+`,
+	}
+	c := NewCompiler()
+	c.Strict = true
+	c.ReadFile = func(filename string) ([]byte, error) {
+		if s, ok := files[strings.TrimPrefix(filename, "mof/")]; ok {
+			return []byte(s), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	if err := c.ParseFile("mof/main.mof"); nil != err {
+		t.Fatal(err)
+	}
+
+	if 2 != len(c.Namespaces()) {
+		t.Fatal(c.Namespaces())
+	}
+	if ns := c.Namespace(DefaultNamespace); 3 != len(ns.Classes) || 0 != len(ns.Instances) {
+		t.Error(ns)
+	}
+	ns := c.Namespace("root/test")
+	if nil == ns || 3 != len(ns.Classes) || 3 != len(ns.Instances) {
+		t.Fatal(ns)
+	}
+	if "h1" != ns.Instances[0].Alias {
+		t.Error(ns.Instances[0].Alias)
+	}
+
+	assoc := ns.Instances[2]
+	if nil == assoc.Name || 2 != len(assoc.Name.KeyBindings) {
+		t.Fatal(assoc.Name)
+	}
+	disk := assoc.Name.KeyBindings[1].ValueReference
+	if nil == disk || nil == disk.InstanceName || "Test_Disk" != disk.InstanceName.ClassName ||
+		"1" != disk.InstanceName.KeyBindings[0].KeyValue.Value {
+		t.Error(disk)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		src     string
+		line    int
+		column  int
+		message string
+	}{
+		{"class A {\n\tstring\n};", 3, 1, "name of the property is expected"},
+		{"class A {\n\tuint8 p = 256;\n};", 2, 12, "out of the range of uint8"},
+		{"class A {\n\tboolean p = \"x\";\n};", 2, 14, "string value can't be assigned to boolean"},
+		{"class A : B {\n};", 1, 11, "superclass 'B' isn't declared"},
+		{"class A {};\nclass A {};", 2, 7, "class 'A' is already declared"},
+		{"instance of A {};", 1, 13, "class 'A' isn't declared"},
+		{"class B { [key] string k; };\nclass A { [key] B REF r; };\ninstance of A { r = $x; };", 3, 21, "alias '$x' isn't defined"},
+		{"class A {\n\tstring p = \"abc;\n};", 2, 13, "literal isn't terminated"},
+		{"\n  #include", 2, 3, "only #pragma is allowed"},
+		{"class A { string p; };\ninstance of A {\n\tq = 1;\n};", 3, 2, "property 'q' isn't declared"},
+		{"qualifier Q : boolean, Scope(foo);", 1, 30, "scope 'foo' is unknown"},
+	} {
+		c := NewCompiler()
+		c.Strict = true
+		err := c.Parse("test.mof", test.src)
+		if nil == err {
+			t.Errorf("%q: error is excepted", test.src)
+			continue
+		}
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q: %T %v", test.src, err, err)
+			continue
+		}
+		if test.line != e.Line || test.column != e.Column || !strings.Contains(e.Message, test.message) {
+			t.Errorf("%q: excepted is %d:%d %s, actual is %v", test.src, test.line, test.column, test.message, err)
+		}
+	}
+}
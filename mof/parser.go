@@ -0,0 +1,1330 @@
+package mof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// dataTypes are the intrinsic data types of MOF.
+var dataTypes = map[string]bool{
+	"uint8": true, "sint8": true, "uint16": true, "sint16": true,
+	"uint32": true, "sint32": true, "uint64": true, "sint64": true,
+	"real32": true, "real64": true, "char16": true, "string": true,
+	"boolean": true, "datetime": true,
+}
+
+type literalKind int
+
+const (
+	literalNull literalKind = iota
+	literalBoolean
+	literalInteger
+	literalReal
+	literalString
+	literalChar
+	literalAlias
+)
+
+func (kind literalKind) String() string {
+	switch kind {
+	case literalNull:
+		return "null"
+	case literalBoolean:
+		return "boolean"
+	case literalInteger:
+		return "integer"
+	case literalReal:
+		return "real"
+	case literalString:
+		return "string"
+	case literalChar:
+		return "char"
+	}
+	return "alias"
+}
+
+type literal struct {
+	pos  Position
+	kind literalKind
+	text string
+}
+
+// initializer is the value of a qualifier, a property or a parameter.
+type initializer struct {
+	pos     Position
+	isArray bool
+	values  []literal
+}
+
+// qualifierValue is a qualifier of a qualifier list before its type is
+// resolved by the qualifier declaration.
+type qualifierValue struct {
+	pos     Position
+	name    string
+	value   *initializer
+	flavors []token
+}
+
+type parser struct {
+	compiler  *Compiler
+	lexer     *lexer
+	filename  string
+	namespace string
+
+	tok token
+}
+
+func (p *parser) errorf(pos Position, format string, args ...interface{}) error {
+	return &Error{Position: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	if nil != err {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) expect(s string) error {
+	if !p.tok.is(s) {
+		return p.errorf(p.tok.pos, "'%s' is expected, but got %s", s, p.tok)
+	}
+	return p.next()
+}
+
+func (p *parser) identifier(what string) (string, error) {
+	if tokenIdentifier != p.tok.kind {
+		return "", p.errorf(p.tok.pos, "%s is expected, but got %s", what, p.tok)
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *parser) parse() error {
+	if err := p.next(); nil != err {
+		return err
+	}
+	for tokenEOF != p.tok.kind {
+		if err := p.production(); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) production() error {
+	if tokenPragma == p.tok.kind {
+		return p.pragma()
+	}
+	if p.tok.is("qualifier") {
+		return p.qualifierDeclaration()
+	}
+
+	var qualifiers []qualifierValue
+	if p.tok.is("[") {
+		var err error
+		if qualifiers, err = p.qualifierList(); nil != err {
+			return err
+		}
+	}
+	switch {
+	case p.tok.is("class"):
+		return p.classDeclaration(qualifiers)
+	case p.tok.is("instance"):
+		return p.instanceDeclaration(qualifiers)
+	}
+	return p.errorf(p.tok.pos, "'class', 'instance of', 'qualifier' or '#pragma' is expected, but got %s", p.tok)
+}
+
+// pragma parses '#pragma name("value")', include and namespace are
+// supported and the others are ignored.
+func (p *parser) pragma() error {
+	pos := p.tok.pos
+	if err := p.next(); nil != err {
+		return err
+	}
+	name, err := p.identifier("name of the pragma")
+	if nil != err {
+		return err
+	}
+	if err := p.expect("("); nil != err {
+		return err
+	}
+	if tokenString != p.tok.kind {
+		return p.errorf(p.tok.pos, "string is expected, but got %s", p.tok)
+	}
+	value := p.tok.text
+	if err := p.next(); nil != err {
+		return err
+	}
+	if err := p.expect(")"); nil != err {
+		return err
+	}
+
+	switch strings.ToLower(name) {
+	case "include":
+		filename := p.compiler.findInclude(p.filename, value)
+		bs, err := p.compiler.readFile(filename)
+		if nil != err {
+			return p.errorf(pos, "include '%s' fail, %v", value, err)
+		}
+		return p.compiler.parse(filename, string(bs), p.namespace)
+	case "namespace":
+		if "" == strings.Trim(value, "/\\") {
+			return p.errorf(pos, "namespace is empty")
+		}
+		p.namespace = value
+	}
+	return nil
+}
+
+func (p *parser) currentNamespace() *Namespace {
+	return p.compiler.namespace(p.namespace)
+}
+
+// qualifierDeclaration parses
+//
+//	Qualifier Name : type[] = value, Scope(...), Flavor(...);
+func (p *parser) qualifierDeclaration() error {
+	pos := p.tok.pos
+	if err := p.next(); nil != err {
+		return err
+	}
+	name, err := p.identifier("name of the qualifier")
+	if nil != err {
+		return err
+	}
+	if err := p.expect(":"); nil != err {
+		return err
+	}
+
+	typPos := p.tok.pos
+	typ, err := p.identifier("data type")
+	if nil != err {
+		return err
+	}
+	if !dataTypes[strings.ToLower(typ)] {
+		return p.errorf(typPos, "'%s' isn't a data type", typ)
+	}
+	decl := gowbem.CimQualifierDeclaration{
+		Name:  name,
+		Type:  strings.ToLower(typ),
+		Scope: &gowbem.CimScope{},
+	}
+	decl.Overridable = true
+	decl.ToSubclass = true
+
+	if p.tok.is("[") {
+		decl.IsArray = true
+		if decl.ArraySize, err = p.arraySize(); nil != err {
+			return err
+		}
+	}
+
+	if p.tok.is("=") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		value, err := p.initializer()
+		if nil != err {
+			return err
+		}
+		if decl.Value, decl.ValueArray, err = p.value(decl.Type, decl.IsArray, value); nil != err {
+			return err
+		}
+	}
+
+	if err := p.expect(","); nil != err {
+		return err
+	}
+	if err := p.scope(decl.Scope); nil != err {
+		return err
+	}
+	if p.tok.is(",") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		if !p.tok.is("flavor") {
+			return p.errorf(p.tok.pos, "'flavor' is expected, but got %s", p.tok)
+		}
+		if err := p.next(); nil != err {
+			return err
+		}
+		if err := p.expect("("); nil != err {
+			return err
+		}
+		for {
+			if err := applyFlavor(&decl.CimQualifierFlavor, p.tok); nil != err {
+				return err
+			}
+			if err := p.next(); nil != err {
+				return err
+			}
+			if !p.tok.is(",") {
+				break
+			}
+			if err := p.next(); nil != err {
+				return err
+			}
+		}
+		if err := p.expect(")"); nil != err {
+			return err
+		}
+	}
+	if err := p.expect(";"); nil != err {
+		return err
+	}
+
+	ns := p.currentNamespace()
+	if old := ns.Qualifier(name); nil != old {
+		if !p.compiler.Strict {
+			*old = decl
+			return nil
+		}
+		return p.errorf(pos, "qualifier '%s' is already declared", name)
+	}
+	ns.Qualifiers = append(ns.Qualifiers, decl)
+	return nil
+}
+
+func (p *parser) scope(scope *gowbem.CimScope) error {
+	if !p.tok.is("scope") {
+		return p.errorf(p.tok.pos, "'scope' is expected, but got %s", p.tok)
+	}
+	if err := p.next(); nil != err {
+		return err
+	}
+	if err := p.expect("("); nil != err {
+		return err
+	}
+	for {
+		pos := p.tok.pos
+		name, err := p.identifier("scope")
+		if nil != err {
+			return err
+		}
+		switch strings.ToLower(name) {
+		case "class":
+			scope.Class = true
+		case "association":
+			scope.Association = true
+		case "indication":
+			scope.Indication = true
+		case "property":
+			scope.Property = true
+		case "reference":
+			scope.Reference = true
+		case "method":
+			scope.Method = true
+		case "parameter":
+			scope.Parameter = true
+		case "qualifier", "schema", "instance":
+		case "any":
+			*scope = gowbem.CimScope{Class: true, Association: true, Indication: true,
+				Property: true, Reference: true, Method: true, Parameter: true}
+		default:
+			return p.errorf(pos, "scope '%s' is unknown", name)
+		}
+		if !p.tok.is(",") {
+			break
+		}
+		if err := p.next(); nil != err {
+			return err
+		}
+	}
+	return p.expect(")")
+}
+
+func applyFlavor(flavor *gowbem.CimQualifierFlavor, tok token) error {
+	if tokenIdentifier != tok.kind {
+		return &Error{Position: tok.pos, Message: "flavor is expected, but got " + tok.String()}
+	}
+	switch strings.ToLower(tok.text) {
+	case "enableoverride":
+		flavor.Overridable = true
+	case "disableoverride":
+		flavor.Overridable = false
+	case "tosubclass":
+		flavor.ToSubclass = true
+	case "restricted":
+		flavor.ToSubclass = false
+	case "toinstance":
+		flavor.ToInstance = true
+	case "translatable":
+		flavor.Translatable = true
+	default:
+		return &Error{Position: tok.pos, Message: "flavor '" + tok.text + "' is unknown"}
+	}
+	return nil
+}
+
+// arraySize parses '[]' or '[size]'.
+func (p *parser) arraySize() (int, error) {
+	if err := p.expect("["); nil != err {
+		return 0, err
+	}
+	size := 0
+	if tokenInteger == p.tok.kind {
+		n, err := strconv.Atoi(p.tok.text)
+		if nil != err || n <= 0 {
+			return 0, p.errorf(p.tok.pos, "size of the array is invalid")
+		}
+		size = n
+		if err := p.next(); nil != err {
+			return 0, err
+		}
+	}
+	return size, p.expect("]")
+}
+
+// qualifierList parses '[Name, Name(value), Name{value, value}: flavor]'.
+func (p *parser) qualifierList() ([]qualifierValue, error) {
+	if err := p.expect("["); nil != err {
+		return nil, err
+	}
+	var qualifiers []qualifierValue
+	for {
+		q := qualifierValue{pos: p.tok.pos}
+		var err error
+		if q.name, err = p.identifier("name of the qualifier"); nil != err {
+			return nil, err
+		}
+		switch {
+		case p.tok.is("("):
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+			if q.value, err = p.initializer(); nil != err {
+				return nil, err
+			}
+			if err := p.expect(")"); nil != err {
+				return nil, err
+			}
+		case p.tok.is("{"):
+			if q.value, err = p.initializer(); nil != err {
+				return nil, err
+			}
+		}
+		if p.tok.is(":") {
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+			for tokenIdentifier == p.tok.kind {
+				q.flavors = append(q.flavors, p.tok)
+				if err := p.next(); nil != err {
+					return nil, err
+				}
+			}
+		}
+		qualifiers = append(qualifiers, q)
+
+		if !p.tok.is(",") {
+			break
+		}
+		if err := p.next(); nil != err {
+			return nil, err
+		}
+	}
+	return qualifiers, p.expect("]")
+}
+
+// initializer parses a constant, an alias or an array of them, the
+// adjacent strings are concatenated.
+func (p *parser) initializer() (*initializer, error) {
+	init := &initializer{pos: p.tok.pos}
+	if !p.tok.is("{") {
+		value, err := p.literal()
+		if nil != err {
+			return nil, err
+		}
+		init.values = []literal{value}
+		return init, nil
+	}
+
+	init.isArray = true
+	if err := p.next(); nil != err {
+		return nil, err
+	}
+	if p.tok.is("}") {
+		return init, p.next()
+	}
+	for {
+		value, err := p.literal()
+		if nil != err {
+			return nil, err
+		}
+		init.values = append(init.values, value)
+		if !p.tok.is(",") {
+			break
+		}
+		if err := p.next(); nil != err {
+			return nil, err
+		}
+	}
+	return init, p.expect("}")
+}
+
+func (p *parser) literal() (literal, error) {
+	value := literal{pos: p.tok.pos, text: p.tok.text}
+	switch p.tok.kind {
+	case tokenString:
+		value.kind = literalString
+		for {
+			if err := p.next(); nil != err {
+				return value, err
+			}
+			if tokenString != p.tok.kind {
+				return value, nil
+			}
+			value.text += p.tok.text
+		}
+	case tokenChar:
+		value.kind = literalChar
+	case tokenInteger:
+		value.kind = literalInteger
+	case tokenReal:
+		value.kind = literalReal
+	case tokenAlias:
+		value.kind = literalAlias
+	case tokenIdentifier:
+		switch strings.ToLower(p.tok.text) {
+		case "true", "false":
+			value.kind = literalBoolean
+			value.text = strings.ToLower(p.tok.text)
+		case "null":
+			value.kind = literalNull
+		default:
+			return value, p.errorf(p.tok.pos, "value is expected, but got %s", p.tok)
+		}
+	default:
+		return value, p.errorf(p.tok.pos, "value is expected, but got %s", p.tok)
+	}
+	return value, p.next()
+}
+
+// guessType returns the type of the literal for the values without a
+// declared type.
+func guessType(value literal) string {
+	switch value.kind {
+	case literalBoolean:
+		return "boolean"
+	case literalInteger:
+		if strings.HasPrefix(value.text, "-") {
+			return "sint64"
+		}
+		return "uint64"
+	case literalReal:
+		return "real64"
+	case literalChar:
+		return "char16"
+	}
+	return "string"
+}
+
+// checkLiteral checks that the literal is a value of the type.
+func checkLiteral(typ string, value literal) error {
+	if literalNull == value.kind {
+		return nil
+	}
+	mismatch := func() error {
+		return &Error{Position: value.pos,
+			Message: fmt.Sprintf("%s value can't be assigned to %s", value.kind, typ)}
+	}
+	bits := 0
+	switch typ {
+	case "string", "datetime":
+		if literalString != value.kind && literalChar != value.kind {
+			return mismatch()
+		}
+		return nil
+	case "char16":
+		if literalChar != value.kind &&
+			!(literalString == value.kind && 1 == len([]rune(value.text))) {
+			return mismatch()
+		}
+		return nil
+	case "boolean":
+		if literalBoolean != value.kind {
+			return mismatch()
+		}
+		return nil
+	case "real32", "real64":
+		if literalReal != value.kind && literalInteger != value.kind {
+			return mismatch()
+		}
+		return nil
+	case "uint8", "sint8":
+		bits = 8
+	case "uint16", "sint16":
+		bits = 16
+	case "uint32", "sint32":
+		bits = 32
+	case "uint64", "sint64":
+		bits = 64
+	default:
+		return nil
+	}
+
+	if literalInteger != value.kind {
+		return mismatch()
+	}
+	var err error
+	if strings.HasPrefix(typ, "u") {
+		_, err = strconv.ParseUint(value.text, 10, bits)
+	} else {
+		_, err = strconv.ParseInt(value.text, 10, bits)
+	}
+	if nil != err {
+		return &Error{Position: value.pos,
+			Message: fmt.Sprintf("value %s is out of the range of %s", value.text, typ)}
+	}
+	return nil
+}
+
+// value converts the initializer into the value of the type.
+func (p *parser) value(typ string, isArray bool, init *initializer) (*gowbem.CimValue, *gowbem.CimValueArray, error) {
+	if isArray != init.isArray {
+		if !isArray {
+			return nil, nil, p.errorf(init.pos, "array value can't be assigned to a %s", typ)
+		}
+		if 1 != len(init.values) || literalNull != init.values[0].kind {
+			return nil, nil, p.errorf(init.pos, "%s array requires a value like '{...}'", typ)
+		}
+		return nil, nil, nil
+	}
+
+	for _, value := range init.values {
+		if literalAlias == value.kind {
+			return nil, nil, p.errorf(value.pos, "alias can't be assigned to %s", typ)
+		}
+		if err := checkLiteral(typ, value); nil != err {
+			return nil, nil, err
+		}
+	}
+
+	if !isArray {
+		if literalNull == init.values[0].kind {
+			return nil, nil, nil
+		}
+		return &gowbem.CimValue{Value: init.values[0].text}, nil, nil
+	}
+	array := &gowbem.CimValueArray{}
+	for _, value := range init.values {
+		if literalNull == value.kind {
+			array.Values = append(array.Values, gowbem.CimValueOrNull{Null: &gowbem.CimValueNull{}})
+		} else {
+			array.Values = append(array.Values, gowbem.CimValueOrNull{Value: &gowbem.CimValue{Value: value.text}})
+		}
+	}
+	return nil, array, nil
+}
+
+// qualifiers resolves the types and the flavors of the qualifiers with
+// their declarations, a qualifier without declaration and value is a
+// boolean qualifier.
+func (p *parser) qualifiers(values []qualifierValue) ([]gowbem.CimQualifier, error) {
+	ns := p.currentNamespace()
+	var results []gowbem.CimQualifier
+	for _, q := range values {
+		for _, old := range results {
+			if strings.EqualFold(old.Name, q.name) {
+				return nil, p.errorf(q.pos, "qualifier '%s' is duplicated", q.name)
+			}
+		}
+
+		qualifier := gowbem.CimQualifier{Name: q.name}
+		qualifier.Overridable = true
+		qualifier.ToSubclass = true
+
+		isArray := false
+		if decl := ns.Qualifier(q.name); nil != decl {
+			qualifier.Name = decl.Name
+			qualifier.Type = decl.Type
+			qualifier.CimQualifierFlavor = decl.CimQualifierFlavor
+			isArray = decl.IsArray
+		} else if nil == q.value {
+			qualifier.Type = "boolean"
+		} else {
+			isArray = q.value.isArray
+			for _, value := range q.value.values {
+				if literalNull != value.kind {
+					qualifier.Type = guessType(value)
+					break
+				}
+			}
+			if "" == qualifier.Type {
+				qualifier.Type = "string"
+			}
+		}
+
+		if nil == q.value {
+			if "boolean" == qualifier.Type && !isArray {
+				qualifier.Value = &gowbem.CimValue{Value: "true"}
+			}
+		} else {
+			var err error
+			qualifier.Value, qualifier.ValueArray, err = p.value(qualifier.Type, isArray, q.value)
+			if nil != err {
+				return nil, err
+			}
+		}
+
+		for _, flavor := range q.flavors {
+			if err := applyFlavor(&qualifier.CimQualifierFlavor, flavor); nil != err {
+				return nil, err
+			}
+		}
+		results = append(results, qualifier)
+	}
+	return results, nil
+}
+
+// classDeclaration parses
+//
+//	class Name [as $Alias] [: SuperClass] { features };
+func (p *parser) classDeclaration(qualifierValues []qualifierValue) error {
+	if err := p.next(); nil != err {
+		return err
+	}
+	namePos := p.tok.pos
+	name, err := p.identifier("name of the class")
+	if nil != err {
+		return err
+	}
+	if p.tok.is("as") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		if tokenAlias != p.tok.kind {
+			return p.errorf(p.tok.pos, "alias is expected, but got %s", p.tok)
+		}
+		if err := p.next(); nil != err {
+			return err
+		}
+	}
+
+	class := gowbem.CimClass{Name: name}
+	superPos := p.tok.pos
+	if p.tok.is(":") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		superPos = p.tok.pos
+		if class.SuperClass, err = p.identifier("name of the superclass"); nil != err {
+			return err
+		}
+	}
+	if class.Qualifiers, err = p.qualifiers(qualifierValues); nil != err {
+		return err
+	}
+
+	if err := p.expect("{"); nil != err {
+		return err
+	}
+	for !p.tok.is("}") {
+		if err := p.classFeature(&class); nil != err {
+			return err
+		}
+	}
+	if err := p.next(); nil != err {
+		return err
+	}
+	if err := p.expect(";"); nil != err {
+		return err
+	}
+
+	ns := p.currentNamespace()
+	if nil != ns.Class(name) {
+		return p.errorf(namePos, "class '%s' is already declared in '%s'", name, ns.Name)
+	}
+	if "" != class.SuperClass {
+		super := ns.Class(class.SuperClass)
+		if nil == super {
+			if p.compiler.Strict {
+				return p.errorf(superPos, "superclass '%s' isn't declared in '%s'", class.SuperClass, ns.Name)
+			}
+		} else {
+			class.SuperClass = super.Name
+			if err := inherit(&class, super, namePos); nil != err {
+				return err
+			}
+		}
+	}
+	ns.Classes = append(ns.Classes, class)
+	return nil
+}
+
+// classFeature parses a property, a reference or a method.
+func (p *parser) classFeature(class *gowbem.CimClass) error {
+	var qualifierValues []qualifierValue
+	if p.tok.is("[") {
+		var err error
+		if qualifierValues, err = p.qualifierList(); nil != err {
+			return err
+		}
+	}
+	qualifiers, err := p.qualifiers(qualifierValues)
+	if nil != err {
+		return err
+	}
+
+	typPos := p.tok.pos
+	typ, err := p.identifier("data type")
+	if nil != err {
+		return err
+	}
+	isRef := false
+	if p.tok.is("ref") {
+		isRef = true
+		if err := p.next(); nil != err {
+			return err
+		}
+	} else if !dataTypes[strings.ToLower(typ)] {
+		return p.errorf(typPos, "'%s' isn't a data type", typ)
+	} else {
+		typ = strings.ToLower(typ)
+	}
+
+	namePos := p.tok.pos
+	name, err := p.identifier("name of the property")
+	if nil != err {
+		return err
+	}
+	for _, pr := range class.Properties {
+		if strings.EqualFold(propertyName(pr), name) {
+			return p.errorf(namePos, "property '%s' is duplicated", name)
+		}
+	}
+
+	if p.tok.is("(") {
+		for _, method := range class.Methods {
+			if strings.EqualFold(method.Name, name) {
+				return p.errorf(namePos, "method '%s' is duplicated", name)
+			}
+		}
+		if isRef {
+			return p.errorf(typPos, "method '%s' can't return a reference", name)
+		}
+		method := gowbem.CimMethod{Name: name, Type: typ, ClassOrigin: class.Name, Qualifiers: qualifiers}
+		if method.Parameters, err = p.parameters(); nil != err {
+			return err
+		}
+		class.Methods = append(class.Methods, method)
+		return p.expect(";")
+	}
+
+	isArray, arraySize := false, 0
+	if p.tok.is("[") {
+		if isRef {
+			return p.errorf(p.tok.pos, "reference property can't be an array")
+		}
+		isArray = true
+		if arraySize, err = p.arraySize(); nil != err {
+			return err
+		}
+	}
+
+	var init *initializer
+	if p.tok.is("=") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		if init, err = p.initializer(); nil != err {
+			return err
+		}
+	}
+	if err := p.expect(";"); nil != err {
+		return err
+	}
+
+	if isRef {
+		pr := &gowbem.CimPropertyReference{Name: name, ReferenceClass: typ, ClassOrigin: class.Name, Qualifiers: qualifiers}
+		if nil != init {
+			if pr.ValueReference, err = p.reference(init); nil != err {
+				return err
+			}
+		}
+		class.Properties = append(class.Properties, gowbem.CimAnyProperty{PropertyReference: pr})
+		return nil
+	}
+	if isArray {
+		pr := &gowbem.CimPropertyArray{Name: name, Type: typ, ArraySize: arraySize, ClassOrigin: class.Name, Qualifiers: qualifiers}
+		if nil != init {
+			if _, pr.ValueArray, err = p.value(typ, true, init); nil != err {
+				return err
+			}
+		}
+		class.Properties = append(class.Properties, gowbem.CimAnyProperty{PropertyArray: pr})
+		return nil
+	}
+	pr := &gowbem.CimProperty{Name: name, Type: typ, ClassOrigin: class.Name, Qualifiers: qualifiers}
+	if nil != init {
+		if pr.Value, _, err = p.value(typ, false, init); nil != err {
+			return err
+		}
+	}
+	class.Properties = append(class.Properties, gowbem.CimAnyProperty{Property: pr})
+	return nil
+}
+
+// parameters parses '([qualifiers] type [REF] name[], ...)'.
+func (p *parser) parameters() ([]gowbem.CimAnyParameter, error) {
+	if err := p.expect("("); nil != err {
+		return nil, err
+	}
+	var results []gowbem.CimAnyParameter
+	for !p.tok.is(")") {
+		if 0 != len(results) {
+			if err := p.expect(","); nil != err {
+				return nil, err
+			}
+		}
+
+		var qualifierValues []qualifierValue
+		if p.tok.is("[") {
+			var err error
+			if qualifierValues, err = p.qualifierList(); nil != err {
+				return nil, err
+			}
+		}
+		qualifiers, err := p.qualifiers(qualifierValues)
+		if nil != err {
+			return nil, err
+		}
+
+		typPos := p.tok.pos
+		typ, err := p.identifier("data type")
+		if nil != err {
+			return nil, err
+		}
+		isRef := false
+		if p.tok.is("ref") {
+			isRef = true
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+		} else if !dataTypes[strings.ToLower(typ)] {
+			return nil, p.errorf(typPos, "'%s' isn't a data type", typ)
+		} else {
+			typ = strings.ToLower(typ)
+		}
+		name, err := p.identifier("name of the parameter")
+		if nil != err {
+			return nil, err
+		}
+		isArray, arraySize := false, 0
+		if p.tok.is("[") {
+			isArray = true
+			if arraySize, err = p.arraySize(); nil != err {
+				return nil, err
+			}
+		}
+		// the default values of the parameters aren't a part of CIM-XML
+		if p.tok.is("=") {
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+			if _, err := p.initializer(); nil != err {
+				return nil, err
+			}
+		}
+
+		switch {
+		case isRef && isArray:
+			results = append(results, gowbem.CimAnyParameter{ParameterRefArray: &gowbem.CimParameterRefArray{
+				Name: name, ReferenceClass: typ, ArraySize: arraySize, Qualifiers: qualifiers}})
+		case isRef:
+			results = append(results, gowbem.CimAnyParameter{ParameterReference: &gowbem.CimParameterReference{
+				Name: name, ReferenceClass: typ, Qualifiers: qualifiers}})
+		case isArray:
+			results = append(results, gowbem.CimAnyParameter{ParameterArray: &gowbem.CimParameterArray{
+				Name: name, Type: typ, ArraySize: arraySize, Qualifiers: qualifiers}})
+		default:
+			results = append(results, gowbem.CimAnyParameter{Parameter: &gowbem.CimParameter{
+				Name: name, Type: typ, Qualifiers: qualifiers}})
+		}
+	}
+	return results, p.next()
+}
+
+// reference converts an alias or a string object path into a reference.
+func (p *parser) reference(init *initializer) (*gowbem.CimValueReference, error) {
+	if init.isArray || 1 != len(init.values) {
+		return nil, p.errorf(init.pos, "reference requires an alias or an object path")
+	}
+	value := init.values[0]
+	switch value.kind {
+	case literalNull:
+		return nil, nil
+	case literalAlias:
+		name, ok := p.compiler.aliases[strings.ToLower(value.text)]
+		if !ok {
+			return nil, p.errorf(value.pos, "alias '$%s' isn't defined", value.text)
+		}
+		copied := *name
+		return &gowbem.CimValueReference{InstanceName: &copied}, nil
+	case literalString:
+		ref, err := parseObjectPath(value.text)
+		if nil != err {
+			return nil, p.errorf(value.pos, "object path '%s' is invalid, %v", value.text, err)
+		}
+		return ref, nil
+	}
+	return nil, p.errorf(value.pos, "%s value can't be assigned to a reference", value.kind)
+}
+
+// parseObjectPath parses '[//host/][namespace:]ClassName.key=value,...'.
+func parseObjectPath(s string) (*gowbem.CimValueReference, error) {
+	path := s
+	if strings.HasPrefix(path, "//") {
+		idx := strings.Index(path[2:], "/")
+		if idx < 0 {
+			return nil, fmt.Errorf("namespace is missing")
+		}
+		path = path[2+idx+1:]
+	}
+
+	namespace := ""
+	if idx := strings.IndexAny(path, ":."); idx >= 0 && ':' == path[idx] {
+		namespace, path = path[:idx], path[idx+1:]
+	}
+	name, err := gowbem.ParseInstanceName(path)
+	if nil != err {
+		return nil, err
+	}
+	if "" == name.ClassName {
+		return nil, fmt.Errorf("class name is missing")
+	}
+	if "" == namespace {
+		return &gowbem.CimValueReference{InstanceName: name}, nil
+	}
+	return &gowbem.CimValueReference{LocalInstancePath: &gowbem.CimLocalInstancePath{
+		LocalNamespacePath: gowbem.CimLocalNamespacePath{Namespaces: gowbem.ToCimNamespace(namespace)},
+		InstanceName:       *name,
+	}}, nil
+}
+
+// instanceDeclaration parses
+//
+//	instance of ClassName [as $Alias] { Name = value; ... };
+func (p *parser) instanceDeclaration(qualifierValues []qualifierValue) error {
+	pos := p.tok.pos
+	if err := p.next(); nil != err {
+		return err
+	}
+	if err := p.expect("of"); nil != err {
+		return err
+	}
+	classPos := p.tok.pos
+	className, err := p.identifier("name of the class")
+	if nil != err {
+		return err
+	}
+
+	alias := ""
+	aliasPos := p.tok.pos
+	if p.tok.is("as") {
+		if err := p.next(); nil != err {
+			return err
+		}
+		aliasPos = p.tok.pos
+		if tokenAlias != p.tok.kind {
+			return p.errorf(p.tok.pos, "alias is expected, but got %s", p.tok)
+		}
+		alias = p.tok.text
+		if err := p.next(); nil != err {
+			return err
+		}
+	}
+
+	ns := p.currentNamespace()
+	class := ns.Class(className)
+	if nil == class {
+		if p.compiler.Strict {
+			return p.errorf(classPos, "class '%s' isn't declared in '%s'", className, ns.Name)
+		}
+	} else {
+		className = class.Name
+	}
+
+	instance := gowbem.CimInstance{ClassName: className}
+	if instance.Qualifiers, err = p.qualifiers(qualifierValues); nil != err {
+		return err
+	}
+	if nil != class {
+		for _, pr := range class.Properties {
+			instance.Properties = append(instance.Properties, instanceProperty(pr))
+		}
+	}
+
+	if err := p.expect("{"); nil != err {
+		return err
+	}
+	var keys []string
+	assigned := map[string]bool{}
+	for !p.tok.is("}") {
+		var qualifierValues []qualifierValue
+		if p.tok.is("[") {
+			if qualifierValues, err = p.qualifierList(); nil != err {
+				return err
+			}
+		}
+		qualifiers, err := p.qualifiers(qualifierValues)
+		if nil != err {
+			return err
+		}
+
+		namePos := p.tok.pos
+		name, err := p.identifier("name of the property")
+		if nil != err {
+			return err
+		}
+		if assigned[strings.ToLower(name)] {
+			return p.errorf(namePos, "property '%s' is duplicated", name)
+		}
+		assigned[strings.ToLower(name)] = true
+		if err := p.expect("="); nil != err {
+			return err
+		}
+		init, err := p.initializer()
+		if nil != err {
+			return err
+		}
+		if err := p.expect(";"); nil != err {
+			return err
+		}
+		if hasQualifier(qualifiers, "key") {
+			keys = append(keys, name)
+		}
+
+		idx := -1
+		for i, pr := range instance.Properties {
+			if strings.EqualFold(propertyName(pr), name) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			if nil != class && p.compiler.Strict {
+				return p.errorf(namePos, "property '%s' isn't declared in class '%s'", name, className)
+			}
+			pr, err := p.guessProperty(name, init)
+			if nil != err {
+				return err
+			}
+			instance.Properties = append(instance.Properties, pr)
+			idx = len(instance.Properties) - 1
+		}
+		if err := p.assign(&instance.Properties[idx], init); nil != err {
+			return err
+		}
+	}
+	if err := p.next(); nil != err {
+		return err
+	}
+	if err := p.expect(";"); nil != err {
+		return err
+	}
+
+	if nil != class {
+		for _, pr := range class.Properties {
+			if hasQualifier(propertyQualifiers(pr), "key") {
+				keys = append(keys, propertyName(pr))
+			}
+		}
+	}
+	name, err := instanceName(&instance, keys)
+	if nil != err {
+		return p.errorf(pos, "%v", err)
+	}
+	if "" != alias {
+		if nil == name {
+			return p.errorf(aliasPos, "instance of '%s' has no key, it can't have an alias", className)
+		}
+		if _, ok := p.compiler.aliases[strings.ToLower(alias)]; ok {
+			return p.errorf(aliasPos, "alias '$%s' is already defined", alias)
+		}
+		p.compiler.aliases[strings.ToLower(alias)] = name
+	}
+	ns.Instances = append(ns.Instances, Instance{Alias: alias, Name: name, Instance: instance})
+	return nil
+}
+
+// guessProperty returns a property without declaration, the type is
+// guessed from the value.
+func (p *parser) guessProperty(name string, init *initializer) (gowbem.CimAnyProperty, error) {
+	typ := ""
+	for _, value := range init.values {
+		switch value.kind {
+		case literalNull:
+			continue
+		case literalAlias:
+			return gowbem.CimAnyProperty{PropertyReference: &gowbem.CimPropertyReference{Name: name}}, nil
+		}
+		typ = guessType(value)
+		break
+	}
+	if "" == typ {
+		typ = "string"
+	}
+	if init.isArray {
+		return gowbem.CimAnyProperty{PropertyArray: &gowbem.CimPropertyArray{Name: name, Type: typ}}, nil
+	}
+	return gowbem.CimAnyProperty{Property: &gowbem.CimProperty{Name: name, Type: typ}}, nil
+}
+
+// assign sets the value of the instance's property.
+func (p *parser) assign(pr *gowbem.CimAnyProperty, init *initializer) error {
+	var err error
+	switch {
+	case nil != pr.PropertyReference:
+		pr.PropertyReference.ValueReference, err = p.reference(init)
+		if nil == err && "" == pr.PropertyReference.ReferenceClass && nil != pr.PropertyReference.ValueReference {
+			if name := referenceName(pr.PropertyReference.ValueReference); nil != name {
+				pr.PropertyReference.ReferenceClass = name.ClassName
+			}
+		}
+	case nil != pr.PropertyArray:
+		_, pr.PropertyArray.ValueArray, err = p.value(pr.PropertyArray.Type, true, init)
+	case nil != pr.Property:
+		pr.Property.Value, _, err = p.value(pr.Property.Type, false, init)
+	}
+	return err
+}
+
+// instanceProperty returns the property of the class for an instance, the
+// qualifiers are dropped and the default value is kept.
+func instanceProperty(pr gowbem.CimAnyProperty) gowbem.CimAnyProperty {
+	switch {
+	case nil != pr.Property:
+		return gowbem.CimAnyProperty{Property: &gowbem.CimProperty{
+			Name:           pr.Property.Name,
+			Type:           pr.Property.Type,
+			EmbeddedObject: pr.Property.EmbeddedObject,
+			Value:          pr.Property.Value,
+		}}
+	case nil != pr.PropertyArray:
+		return gowbem.CimAnyProperty{PropertyArray: &gowbem.CimPropertyArray{
+			Name:           pr.PropertyArray.Name,
+			Type:           pr.PropertyArray.Type,
+			ArraySize:      pr.PropertyArray.ArraySize,
+			EmbeddedObject: pr.PropertyArray.EmbeddedObject,
+			ValueArray:     pr.PropertyArray.ValueArray,
+		}}
+	case nil != pr.PropertyReference:
+		return gowbem.CimAnyProperty{PropertyReference: &gowbem.CimPropertyReference{
+			Name:           pr.PropertyReference.Name,
+			ReferenceClass: pr.PropertyReference.ReferenceClass,
+			ValueReference: pr.PropertyReference.ValueReference,
+		}}
+	}
+	return pr
+}
+
+// instanceName returns the name of the instance, it is nil if the
+// instance hasn't a key.
+func instanceName(instance *gowbem.CimInstance, keys []string) (*gowbem.CimInstanceName, error) {
+	if 0 == len(keys) {
+		return nil, nil
+	}
+	name := &gowbem.CimInstanceName{ClassName: instance.ClassName}
+	for _, pr := range instance.Properties {
+		prName := propertyName(pr)
+		isKey := false
+		for _, key := range keys {
+			if strings.EqualFold(key, prName) {
+				isKey = true
+				break
+			}
+		}
+		if !isKey {
+			continue
+		}
+
+		switch {
+		case nil != pr.Property:
+			if nil == pr.Property.Value {
+				return nil, fmt.Errorf("key '%s' of the instance of '%s' is null", prName, instance.ClassName)
+			}
+			name.KeyBindings = append(name.KeyBindings, gowbem.CimKeyBinding{
+				Name: prName,
+				KeyValue: &gowbem.CimKeyValue{
+					ValueType: valueType(pr.Property.Type),
+					Type:      pr.Property.Type,
+					Value:     pr.Property.Value.Value,
+				},
+			})
+		case nil != pr.PropertyReference:
+			if nil == pr.PropertyReference.ValueReference {
+				return nil, fmt.Errorf("key '%s' of the instance of '%s' is null", prName, instance.ClassName)
+			}
+			name.KeyBindings = append(name.KeyBindings, gowbem.CimKeyBinding{
+				Name:           prName,
+				ValueReference: pr.PropertyReference.ValueReference,
+			})
+		default:
+			return nil, fmt.Errorf("key '%s' of the instance of '%s' is an array", prName, instance.ClassName)
+		}
+	}
+	return name, nil
+}
+
+func valueType(typ string) string {
+	switch typ {
+	case "boolean":
+		return "boolean"
+	case "string", "char16", "datetime":
+		return "string"
+	}
+	return "numeric"
+}
+
+func referenceName(ref *gowbem.CimValueReference) *gowbem.CimInstanceName {
+	switch {
+	case nil != ref.InstanceName:
+		return ref.InstanceName
+	case nil != ref.LocalInstancePath:
+		return &ref.LocalInstancePath.InstanceName
+	case nil != ref.InstancePath:
+		return &ref.InstancePath.InstanceName
+	}
+	return nil
+}
+
+func propertyName(pr gowbem.CimAnyProperty) string {
+	switch {
+	case nil != pr.Property:
+		return pr.Property.Name
+	case nil != pr.PropertyArray:
+		return pr.PropertyArray.Name
+	case nil != pr.PropertyReference:
+		return pr.PropertyReference.Name
+	}
+	return ""
+}
+
+func propertyQualifiers(pr gowbem.CimAnyProperty) []gowbem.CimQualifier {
+	switch {
+	case nil != pr.Property:
+		return pr.Property.Qualifiers
+	case nil != pr.PropertyArray:
+		return pr.PropertyArray.Qualifiers
+	case nil != pr.PropertyReference:
+		return pr.PropertyReference.Qualifiers
+	}
+	return nil
+}
+
+func hasQualifier(qualifiers []gowbem.CimQualifier, name string) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, name) {
+			return nil == q.Value || !strings.EqualFold("false", q.Value.Value)
+		}
+	}
+	return false
+}
@@ -0,0 +1,474 @@
+package mof
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Writer writes the qualifier declarations, the classes and the instances in
+// MOF, the output can be compiled by the Compiler.
+//
+//	w := mof.NewWriter(os.Stdout)
+//	w.Qualifiers = qualifiers
+//	w.WriteClass(&class)
+type Writer struct {
+	// Qualifiers are the qualifier declarations, the flavors of a
+	// qualifier are written only if they differ from its declaration, and
+	// they are never written if the qualifier isn't declared.
+	Qualifiers []gowbem.CimQualifierDeclaration
+
+	// Propagated writes the inherited properties, methods and qualifiers
+	// of the classes too, they are skipped by default because the compiler
+	// inherits them from the superclass.
+	Propagated bool
+
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (mw *Writer) print(args ...string) {
+	if nil != mw.err {
+		return
+	}
+	for _, s := range args {
+		if _, err := io.WriteString(mw.w, s); nil != err {
+			mw.err = err
+			return
+		}
+	}
+}
+
+// WritePragma writes '#pragma name ("value")'.
+func (mw *Writer) WritePragma(name, value string) error {
+	mw.print("#pragma ", name, " (", quoteString(value), ")\n")
+	return mw.err
+}
+
+// WriteQualifierDeclaration writes
+//
+//	Qualifier Name : type = value, Scope(...), Flavor(...);
+func (mw *Writer) WriteQualifierDeclaration(decl *gowbem.CimQualifierDeclaration) error {
+	mw.print("Qualifier ", decl.Name, " : ", decl.Type)
+	if decl.IsArray {
+		mw.print(arraySuffix(decl.ArraySize))
+	}
+	if nil != decl.Value || nil != decl.ValueArray {
+		mw.print(" = ", formatValue(decl.Type, decl.Value, decl.ValueArray))
+	}
+	mw.print(",\n    Scope(", formatScope(decl.Scope), ")")
+	mw.print(",\n    Flavor(", strings.Join(flavorNames(decl.CimQualifierFlavor, nil), ", "), ");\n\n")
+	return mw.err
+}
+
+// WriteClass writes the class declaration.
+func (mw *Writer) WriteClass(class *gowbem.CimClass) error {
+	mw.qualifierList("", class.Qualifiers, nil)
+	mw.print("class ", class.Name)
+	if "" != class.SuperClass {
+		mw.print(" : ", class.SuperClass)
+	}
+	mw.print("\n{\n")
+
+	for _, pr := range class.Properties {
+		switch {
+		case nil != pr.Property:
+			if pr.Property.Propagated && !mw.Propagated {
+				continue
+			}
+			mw.qualifierList("    ", pr.Property.Qualifiers, embeddedObjectQualifier(pr.Property.EmbeddedObject, pr.Property.Qualifiers))
+			mw.print("    ", pr.Property.Type, " ", pr.Property.Name)
+			if nil != pr.Property.Value {
+				mw.print(" = ", formatValue(pr.Property.Type, pr.Property.Value, nil))
+			}
+		case nil != pr.PropertyArray:
+			if pr.PropertyArray.Propagated && !mw.Propagated {
+				continue
+			}
+			mw.qualifierList("    ", pr.PropertyArray.Qualifiers, embeddedObjectQualifier(pr.PropertyArray.EmbeddedObject, pr.PropertyArray.Qualifiers))
+			mw.print("    ", pr.PropertyArray.Type, " ", pr.PropertyArray.Name, arraySuffix(pr.PropertyArray.ArraySize))
+			if nil != pr.PropertyArray.ValueArray {
+				mw.print(" = ", formatValue(pr.PropertyArray.Type, nil, pr.PropertyArray.ValueArray))
+			}
+		case nil != pr.PropertyReference:
+			if pr.PropertyReference.Propagated && !mw.Propagated {
+				continue
+			}
+			mw.qualifierList("    ", pr.PropertyReference.Qualifiers, nil)
+			mw.print("    ", referenceClass(pr.PropertyReference.ReferenceClass), " REF ", pr.PropertyReference.Name)
+			if nil != pr.PropertyReference.ValueReference {
+				mw.print(" = ", quoteString(objectPath(pr.PropertyReference.ValueReference)))
+			}
+		default:
+			continue
+		}
+		mw.print(";\n")
+	}
+
+	for _, method := range class.Methods {
+		if method.Propagated && !mw.Propagated {
+			continue
+		}
+		mw.print("\n")
+		mw.qualifierList("    ", method.Qualifiers, nil)
+		typ := method.Type
+		if "" == typ {
+			typ = "uint32"
+		}
+		mw.print("    ", typ, " ", method.Name, "(")
+		for idx, param := range method.Parameters {
+			if 0 != idx {
+				mw.print(",")
+			}
+			mw.print("\n")
+			mw.parameter(&param)
+		}
+		mw.print(");\n")
+	}
+	mw.print("};\n\n")
+	return mw.err
+}
+
+func (mw *Writer) parameter(param *gowbem.CimAnyParameter) {
+	var qualifiers []gowbem.CimQualifier
+	var declaration string
+	switch {
+	case nil != param.Parameter:
+		qualifiers = param.Parameter.Qualifiers
+		declaration = param.Parameter.Type + " " + param.Parameter.Name
+	case nil != param.ParameterArray:
+		qualifiers = param.ParameterArray.Qualifiers
+		declaration = param.ParameterArray.Type + " " + param.ParameterArray.Name + arraySuffix(param.ParameterArray.ArraySize)
+	case nil != param.ParameterReference:
+		qualifiers = param.ParameterReference.Qualifiers
+		declaration = referenceClass(param.ParameterReference.ReferenceClass) + " REF " + param.ParameterReference.Name
+	case nil != param.ParameterRefArray:
+		qualifiers = param.ParameterRefArray.Qualifiers
+		declaration = referenceClass(param.ParameterRefArray.ReferenceClass) + " REF " + param.ParameterRefArray.Name +
+			arraySuffix(param.ParameterRefArray.ArraySize)
+	default:
+		return
+	}
+	mw.print("        ")
+	if items := mw.formatQualifiers(qualifiers, nil); 0 != len(items) {
+		mw.print("[", strings.Join(items, ", "), "] ")
+	}
+	mw.print(declaration)
+}
+
+// WriteInstance writes the instance declaration, the embedded objects are
+// written in MOF as string values.
+func (mw *Writer) WriteInstance(instance *gowbem.CimInstance) error {
+	mw.qualifierList("", instance.Qualifiers, nil)
+	mw.print("instance of ", instance.ClassName, "\n{\n")
+	for _, pr := range instance.Properties {
+		switch {
+		case nil != pr.Property:
+			mw.print("    ", pr.Property.Name, " = ",
+				mw.formatPropertyValue(pr.Property.Type, pr.Property.EmbeddedObject, pr.Property.Value, nil), ";\n")
+		case nil != pr.PropertyArray:
+			mw.print("    ", pr.PropertyArray.Name, " = ",
+				mw.formatPropertyValue(pr.PropertyArray.Type, pr.PropertyArray.EmbeddedObject, nil, pr.PropertyArray.ValueArray), ";\n")
+		case nil != pr.PropertyReference:
+			value := "null"
+			if nil != pr.PropertyReference.ValueReference {
+				value = quoteString(objectPath(pr.PropertyReference.ValueReference))
+			}
+			mw.print("    ", pr.PropertyReference.Name, " = ", value, ";\n")
+		}
+	}
+	mw.print("};\n\n")
+	return mw.err
+}
+
+// formatPropertyValue formats the value of the instance's property, the
+// embedded objects are converted from CIM-XML to MOF.
+func (mw *Writer) formatPropertyValue(typ, embeddedObject string, value *gowbem.CimValue, array *gowbem.CimValueArray) string {
+	if "" == embeddedObject {
+		return formatValue(typ, value, array)
+	}
+	if nil != value {
+		return quoteString(mw.embeddedObject(value.Value))
+	}
+	if nil == array {
+		return "null"
+	}
+	values := make([]string, 0, len(array.Values))
+	for _, v := range array.Values {
+		if nil == v.Value {
+			values = append(values, "null")
+		} else {
+			values = append(values, quoteString(mw.embeddedObject(v.Value.Value)))
+		}
+	}
+	return "{" + strings.Join(values, ", ") + "}"
+}
+
+// embeddedObject converts the embedded object from CIM-XML to MOF, the
+// value is returned as is if it isn't a CIM-XML class or instance.
+func (mw *Writer) embeddedObject(s string) string {
+	s = strings.TrimSpace(s)
+	if "" == s {
+		return s
+	}
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	for {
+		token, err := decoder.Token()
+		if nil != err {
+			return s
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var buf bytes.Buffer
+		sub := &Writer{Qualifiers: mw.Qualifiers, Propagated: true, w: &buf}
+		switch start.Name.Local {
+		case "INSTANCE":
+			var instance gowbem.CimInstance
+			if err := decoder.DecodeElement(&instance, &start); nil != err {
+				return s
+			}
+			sub.WriteInstance(&instance)
+		case "CLASS":
+			var class gowbem.CimClass
+			if err := decoder.DecodeElement(&class, &start); nil != err {
+				return s
+			}
+			sub.WriteClass(&class)
+		default:
+			return s
+		}
+		return strings.TrimSpace(buf.String())
+	}
+}
+
+// qualifierList writes the qualifiers in '[...]' on a line, the extra
+// qualifier is appended if it isn't nil.
+func (mw *Writer) qualifierList(indent string, qualifiers []gowbem.CimQualifier, extra *gowbem.CimQualifier) {
+	if items := mw.formatQualifiers(qualifiers, extra); 0 != len(items) {
+		mw.print(indent, "[", strings.Join(items, ",\n"+indent+" "), "]\n")
+	}
+}
+
+func (mw *Writer) formatQualifiers(qualifiers []gowbem.CimQualifier, extra *gowbem.CimQualifier) []string {
+	items := make([]string, 0, len(qualifiers)+1)
+	for idx := range qualifiers {
+		if qualifiers[idx].Propagated && !mw.Propagated {
+			continue
+		}
+		items = append(items, mw.formatQualifier(&qualifiers[idx]))
+	}
+	if nil != extra {
+		items = append(items, mw.formatQualifier(extra))
+	}
+	return items
+}
+
+func (mw *Writer) formatQualifier(q *gowbem.CimQualifier) string {
+	var decl *gowbem.CimQualifierDeclaration
+	for idx := range mw.Qualifiers {
+		if strings.EqualFold(mw.Qualifiers[idx].Name, q.Name) {
+			decl = &mw.Qualifiers[idx]
+			break
+		}
+	}
+
+	s := q.Name
+	switch {
+	case nil != q.ValueArray:
+		s += " " + formatValue(q.Type, nil, q.ValueArray)
+	case nil != q.Value:
+		if !("boolean" == q.Type && strings.EqualFold("true", strings.TrimSpace(q.Value.Value))) {
+			s += "(" + formatValue(q.Type, q.Value, nil) + ")"
+		}
+	case "boolean" != q.Type:
+		s += "(null)"
+	}
+	if nil != decl {
+		if flavors := flavorNames(q.CimQualifierFlavor, &decl.CimQualifierFlavor); 0 != len(flavors) {
+			s += " : " + strings.Join(flavors, " ")
+		}
+	}
+	return s
+}
+
+// flavorNames returns the names of the flavors, only the flavors that
+// differ from the declared flavors are returned if declared isn't nil.
+func flavorNames(flavor gowbem.CimQualifierFlavor, declared *gowbem.CimQualifierFlavor) []string {
+	var names []string
+	if nil == declared || declared.Overridable != flavor.Overridable {
+		if flavor.Overridable {
+			names = append(names, "EnableOverride")
+		} else {
+			names = append(names, "DisableOverride")
+		}
+	}
+	if nil == declared || declared.ToSubclass != flavor.ToSubclass {
+		if flavor.ToSubclass {
+			names = append(names, "ToSubclass")
+		} else {
+			names = append(names, "Restricted")
+		}
+	}
+	if flavor.Translatable && (nil == declared || !declared.Translatable) {
+		names = append(names, "Translatable")
+	}
+	if flavor.ToInstance && (nil == declared || !declared.ToInstance) {
+		names = append(names, "ToInstance")
+	}
+	return names
+}
+
+func formatScope(scope *gowbem.CimScope) string {
+	if nil == scope {
+		return "any"
+	}
+	var names []string
+	for _, item := range []struct {
+		name string
+		set  bool
+	}{
+		{"class", scope.Class},
+		{"association", scope.Association},
+		{"indication", scope.Indication},
+		{"property", scope.Property},
+		{"reference", scope.Reference},
+		{"method", scope.Method},
+		{"parameter", scope.Parameter},
+	} {
+		if item.set {
+			names = append(names, item.name)
+		}
+	}
+	if 0 == len(names) || 7 == len(names) {
+		return "any"
+	}
+	return strings.Join(names, ", ")
+}
+
+// embeddedObjectQualifier returns the EmbeddedObject qualifier for a
+// property that has the EmbeddedObject attribute but not the qualifier.
+func embeddedObjectQualifier(embeddedObject string, qualifiers []gowbem.CimQualifier) *gowbem.CimQualifier {
+	if "" == embeddedObject {
+		return nil
+	}
+	for _, q := range qualifiers {
+		if strings.EqualFold("EmbeddedObject", q.Name) || strings.EqualFold("EmbeddedInstance", q.Name) {
+			return nil
+		}
+	}
+	return &gowbem.CimQualifier{Name: "EmbeddedObject", Type: "boolean", Value: &gowbem.CimValue{Value: "true"}}
+}
+
+func arraySuffix(size int) string {
+	if size > 0 {
+		return fmt.Sprintf("[%d]", size)
+	}
+	return "[]"
+}
+
+func referenceClass(className string) string {
+	if "" == className {
+		return "object"
+	}
+	return className
+}
+
+// objectPath returns the reference as a string object path.
+func objectPath(ref *gowbem.CimValueReference) string {
+	if nil != ref.InstancePath {
+		return "//" + ref.InstancePath.String()
+	}
+	if nil != ref.ClassPath {
+		return "//" + ref.ClassPath.String()
+	}
+	return ref.String()
+}
+
+// formatValue formats the scalar value or the array in MOF.
+func formatValue(typ string, value *gowbem.CimValue, array *gowbem.CimValueArray) string {
+	if nil != array {
+		values := make([]string, 0, len(array.Values))
+		for _, v := range array.Values {
+			if nil == v.Value {
+				values = append(values, "null")
+			} else {
+				values = append(values, formatScalar(typ, v.Value.Value))
+			}
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	}
+	if nil == value {
+		return "null"
+	}
+	return formatScalar(typ, value.Value)
+}
+
+func formatScalar(typ, s string) string {
+	switch strings.ToLower(typ) {
+	case "boolean":
+		// the invalid values are written as null, they aren't false.
+		switch s = strings.TrimSpace(s); {
+		case strings.EqualFold("true", s):
+			return "true"
+		case strings.EqualFold("false", s):
+			return "false"
+		}
+		return "null"
+	case "uint8", "sint8", "uint16", "sint16", "uint32", "sint32", "uint64", "sint64", "real32", "real64":
+		if s = strings.TrimSpace(s); "" != s {
+			return s
+		}
+		return "null"
+	case "char16":
+		if 1 == len([]rune(s)) {
+			return "'" + escape(s, '\'') + "'"
+		}
+	}
+	return quoteString(s)
+}
+
+func quoteString(s string) string {
+	return `"` + escape(s, '"') + `"`
+}
+
+// escape escapes the special characters of a string or char literal.
+func escape(s string, quote rune) string {
+	var buf strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case quote:
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		default:
+			if r < 0x20 || 0x7f == r {
+				fmt.Fprintf(&buf, `\x%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,160 @@
+package mof
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/gowbem"
+)
+
+func writeNamespace(t *testing.T, ns *Namespace) string {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Qualifiers = ns.Qualifiers
+	for idx := range ns.Qualifiers {
+		if err := w.WriteQualifierDeclaration(&ns.Qualifiers[idx]); nil != err {
+			t.Fatal(err)
+		}
+	}
+	for idx := range ns.Classes {
+		if err := w.WriteClass(&ns.Classes[idx]); nil != err {
+			t.Fatal(err)
+		}
+	}
+	for idx := range ns.Instances {
+		if err := w.WriteInstance(&ns.Instances[idx].Instance); nil != err {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	c := NewCompiler()
+	c.Strict = true
+	for _, filename := range []string{"CIM_Min25.mof", "ACLTest.mof", "testsuite.mof", "stringArray.mof", "wqlTest.mof"} {
+		if err := c.ParseFile("../testfiles/" + filename); nil != err {
+			t.Fatal(err)
+		}
+	}
+	ns := c.Namespace(DefaultNamespace)
+	src := writeNamespace(t, ns)
+
+	c2 := NewCompiler()
+	c2.Strict = true
+	if err := c2.Parse("written.mof", src); nil != err {
+		t.Fatal(err, "\r\n", src)
+	}
+	ns2 := c2.Namespace(DefaultNamespace)
+
+	if !reflect.DeepEqual(ns.Qualifiers, ns2.Qualifiers) {
+		t.Error("qualifiers are different")
+	}
+	if len(ns.Classes) != len(ns2.Classes) {
+		t.Fatal(len(ns.Classes), len(ns2.Classes))
+	}
+	for idx := range ns.Classes {
+		if !reflect.DeepEqual(ns.Classes[idx], ns2.Classes[idx]) {
+			t.Errorf("class %s is different", ns.Classes[idx].Name)
+		}
+	}
+	if len(ns.Instances) != len(ns2.Instances) {
+		t.Fatal(len(ns.Instances), len(ns2.Instances))
+	}
+	for idx := range ns.Instances {
+		if !reflect.DeepEqual(ns.Instances[idx], ns2.Instances[idx]) {
+			t.Errorf("instance %s is different", ns.Instances[idx].Name)
+		}
+	}
+
+	if src2 := writeNamespace(t, ns2); src != src2 {
+		t.Error("output isn't stable")
+	}
+}
+
+func TestWriteQualifierDeclaration(t *testing.T) {
+	var buf bytes.Buffer
+	decl := &gowbem.CimQualifierDeclaration{
+		Name:       "ValueMap",
+		Type:       "string",
+		IsArray:    true,
+		Scope:      &gowbem.CimScope{Property: true, Method: true, Parameter: true},
+		ValueArray: &gowbem.CimValueArray{Values: []gowbem.CimValueOrNull{{Value: &gowbem.CimValue{Value: "1"}}, {Null: &gowbem.CimValueNull{}}}},
+	}
+	decl.ToSubclass = true
+	decl.Translatable = true
+	if err := NewWriter(&buf).WriteQualifierDeclaration(decl); nil != err {
+		t.Fatal(err)
+	}
+	excepted := "Qualifier ValueMap : string[] = {\"1\", null},\n    Scope(property, method, parameter),\n    Flavor(DisableOverride, ToSubclass, Translatable);\n\n"
+	if excepted != buf.String() {
+		t.Errorf("excepted is %q, actual is %q", excepted, buf.String())
+	}
+}
+
+func TestWriteEscape(t *testing.T) {
+	s := "a\"b\\c\nd\te'\x01"
+	class := &gowbem.CimClass{Name: "Test_Escape", Properties: []gowbem.CimAnyProperty{
+		{Property: &gowbem.CimProperty{Name: "S", Type: "string", Value: &gowbem.CimValue{Value: s}}},
+		{Property: &gowbem.CimProperty{Name: "C", Type: "char16", Value: &gowbem.CimValue{Value: "'"}}},
+		{PropertyArray: &gowbem.CimPropertyArray{Name: "A", Type: "uint8", ArraySize: 2,
+			ValueArray: &gowbem.CimValueArray{Values: []gowbem.CimValueOrNull{{Value: &gowbem.CimValue{Value: "1"}}, {Value: &gowbem.CimValue{Value: "2"}}}}}},
+		{PropertyArray: &gowbem.CimPropertyArray{Name: "B", Type: "boolean",
+			ValueArray: &gowbem.CimValueArray{Values: []gowbem.CimValueOrNull{{Value: &gowbem.CimValue{Value: "TRUE"}},
+				{Value: &gowbem.CimValue{Value: "False"}}, {Value: &gowbem.CimValue{Value: "yes"}}, {Value: &gowbem.CimValue{Value: ""}}}}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WriteClass(class); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `string S = "a\"b\\c\nd\te'\x0001";`) ||
+		!strings.Contains(buf.String(), `char16 C = '\'';`) ||
+		!strings.Contains(buf.String(), `uint8 A[2] = {1, 2};`) ||
+		!strings.Contains(buf.String(), `boolean B[] = {true, false, null, null};`) {
+		t.Error(buf.String())
+	}
+
+	c := NewCompiler()
+	if err := c.Parse("escape.mof", buf.String()); nil != err {
+		t.Fatal(err)
+	}
+	parsed := c.Namespace(DefaultNamespace).Class("Test_Escape")
+	if nil == parsed || s != parsed.Properties[0].Property.Value.Value || "'" != parsed.Properties[1].Property.Value.Value {
+		t.Error(parsed)
+	}
+}
+
+func TestWriteEmbeddedObject(t *testing.T) {
+	bs, err := ioutil.ReadFile("../testfiles/EmbObjGetInstance.xml")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var cim gowbem.CIM
+	if err := xml.Unmarshal(bs, &cim); nil != err {
+		t.Fatal(err)
+	}
+	instance := &cim.Message.SimpleRsp.IMethodResponse.ReturnValue.ValueNamedInstances[0].Instance
+	instance.Properties = append(instance.Properties, gowbem.CimAnyProperty{Property: &gowbem.CimProperty{
+		Name: "Embedded", Type: "string", EmbeddedObject: "instance",
+		Value: &gowbem.CimValue{Value: `<INSTANCE CLASSNAME="Test_Embedded"><PROPERTY NAME="S" TYPE="string"><VALUE>a"b</VALUE></PROPERTY></INSTANCE>`}}})
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WriteInstance(instance); nil != err {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `ClassValueWithObjAttr = "class MyTestClass\n{\n    string KeyProp;\n};";`) ||
+		!strings.Contains(out, `Embedded = "instance of Test_Embedded\n{\n    S = \"a\\\"b\";\n};";`) {
+		t.Error(out)
+	}
+
+	c := NewCompiler()
+	if err := c.Parse("embedded.mof", out); nil != err {
+		t.Fatal(err, "\r\n", out)
+	}
+}
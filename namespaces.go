@@ -0,0 +1,305 @@
+package gowbem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// InteropNamespaces are the well-known names of the interop namespace.
+var InteropNamespaces = []string{"interop",
+	"root/interop",
+	"root/PG_InterOp",
+	"interop/root"}
+
+// NamespaceClasses are the classes which list the namespaces, the instances
+// of __Namespace are the child namespaces of the probed namespace.
+var NamespaceClasses = []string{"CIM_Namespace",
+	"__Namespace",
+	"PG_NameSpace"}
+
+// DiscoveredNamespace is a namespace found by DiscoverNamespaces.
+type DiscoveredNamespace struct {
+	Name string
+	// SourceClass is the class it is found from, such as CIM_Namespace or
+	// CIM_RegisteredProfile.
+	SourceClass string
+	// InteropNamespace is the namespace where SourceClass is enumerated.
+	InteropNamespace string
+}
+
+// ProbeError is the error of enumerating the class in the namespace.
+type ProbeError struct {
+	Namespace string
+	ClassName string
+	Err       error
+}
+
+func (e *ProbeError) Error() string {
+	return "probe " + e.ClassName + " in '" + e.Namespace + "': " + e.Err.Error()
+}
+
+// ProbeErrors is returned by DiscoverNamespaces when no namespace is found.
+type ProbeErrors []*ProbeError
+
+func (errs ProbeErrors) Error() string {
+	if 0 == len(errs) {
+		return "namespaces aren't found."
+	}
+	var buf strings.Builder
+	buf.WriteString("namespaces aren't found:")
+	for _, e := range errs {
+		buf.WriteString("\r\n\t")
+		buf.WriteString(e.Error())
+	}
+	return buf.String()
+}
+
+// NamespaceEventType is the type of NamespaceEvent.
+type NamespaceEventType int
+
+const (
+	// ProbeStarted is sent before a class is enumerated in a namespace.
+	ProbeStarted NamespaceEventType = iota
+	// ProbeFinished is sent after a class is enumerated, Err is set if it
+	// is failed.
+	ProbeFinished
+	// NamespaceFound is sent when a new namespace is found.
+	NamespaceFound
+)
+
+func (t NamespaceEventType) String() string {
+	switch t {
+	case ProbeStarted:
+		return "ProbeStarted"
+	case ProbeFinished:
+		return "ProbeFinished"
+	case NamespaceFound:
+		return "NamespaceFound"
+	}
+	return "NamespaceEventType(" + fmt.Sprint(int(t)) + ")"
+}
+
+// NamespaceEvent is the progress of DiscoverNamespaces, Done and Total are
+// the numbers of the probes.
+type NamespaceEvent struct {
+	Type      NamespaceEventType
+	Namespace string
+	ClassName string
+	// Found is set for NamespaceFound.
+	Found *DiscoveredNamespace
+	// Err is set for a failed ProbeFinished, the empty results and the
+	// unsupported classes aren't errors.
+	Err   error
+	Done  int
+	Total int
+}
+
+// NamespaceDiscoveryOptions are the options of DiscoverNamespaces.
+type NamespaceDiscoveryOptions struct {
+	// InteropNamespaces are the namespaces which are probed, the default
+	// is the interop namespaces of the quirks and InteropNamespaces.
+	InteropNamespaces []string
+	// Timeout is the timeout of every probe, the default is 10 seconds.
+	Timeout time.Duration
+	// OnEvent receives the events if it isn't nil.
+	OnEvent func(NamespaceEvent)
+}
+
+// NamespaceDiscovery is the result of DiscoverNamespaces.
+type NamespaceDiscovery struct {
+	Namespaces []DiscoveredNamespace
+	Errors     []*ProbeError
+}
+
+// Names returns the names of the namespaces.
+func (d *NamespaceDiscovery) Names() []string {
+	names := make([]string, 0, len(d.Namespaces))
+	for _, ns := range d.Namespaces {
+		names = append(names, ns.Name)
+	}
+	return names
+}
+
+type namespaceDiscoverer struct {
+	c       *ClientCIMXML
+	opts    *NamespaceDiscoveryOptions
+	timeout time.Duration
+	result  *NamespaceDiscovery
+	found   map[string]bool
+	done    int
+	total   int
+	// succeeded is the number of the probes which the server answered.
+	succeeded int
+}
+
+// DiscoverNamespaces finds the namespaces from the instances of
+// NamespaceClasses and the central instances of CIM_RegisteredProfile in
+// the interop namespaces, PG_ProviderCapabilities is used if nothing is
+// found. The namespaces of the quirks are added with the SourceClass
+// "Quirks". The errors of the probes are returned in the result, the error
+// is a ProbeErrors if no namespace is found.
+func (c *ClientCIMXML) DiscoverNamespaces(ctx context.Context, opts *NamespaceDiscoveryOptions) (*NamespaceDiscovery, error) {
+	if nil == opts {
+		opts = &NamespaceDiscoveryOptions{}
+	} else {
+		copied := *opts
+		opts = &copied
+	}
+	if 0 == len(opts.InteropNamespaces) {
+		opts.InteropNamespaces = c.interopNamespaces()
+	}
+	var interops []string
+	seen := map[string]bool{}
+	for _, ns := range opts.InteropNamespaces {
+		if key := strings.ToLower(strings.Trim(ns, "/")); !seen[key] {
+			seen[key] = true
+			interops = append(interops, ns)
+		}
+	}
+	d := &namespaceDiscoverer{
+		c:       c,
+		opts:    opts,
+		timeout: opts.Timeout,
+		result:  &NamespaceDiscovery{},
+		found:   map[string]bool{},
+		total:   len(interops) * (len(NamespaceClasses) + 1),
+	}
+	if 0 == d.timeout {
+		d.timeout = 10 * time.Second
+	}
+
+	for _, ns := range interops {
+		for _, className := range NamespaceClasses {
+			d.probe(ctx, ns, className, d.namespaceInstances)
+		}
+		d.probe(ctx, ns, "CIM_RegisteredProfile", d.registeredProfiles)
+	}
+	if 0 == len(d.result.Namespaces) {
+		d.total += len(interops)
+		for _, ns := range interops {
+			d.probe(ctx, ns, "PG_ProviderCapabilities", d.providerCapabilities)
+		}
+	}
+	// the unpublished namespaces are added only if the server is reachable.
+	if 0 != d.succeeded {
+		for _, ns := range c.Quirks().Namespaces {
+			d.add(ns, "Quirks", "")
+		}
+	}
+
+	if 0 == len(d.result.Namespaces) {
+		return d.result, ProbeErrors(d.result.Errors)
+	}
+	return d.result, nil
+}
+
+func (d *namespaceDiscoverer) emit(event NamespaceEvent) {
+	if nil != d.opts.OnEvent {
+		event.Done = d.done
+		event.Total = d.total
+		d.opts.OnEvent(event)
+	}
+}
+
+func (d *namespaceDiscoverer) probe(ctx context.Context, ns, className string,
+	fn func(ctx context.Context, ns, className string) error) {
+	d.emit(NamespaceEvent{Type: ProbeStarted, Namespace: ns, ClassName: className})
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	err := fn(timeoutCtx, ns, className)
+	cancel()
+	if nil != err && (IsErrNotSupported(err) || IsEmptyResults(err)) {
+		err = nil
+	}
+	if nil != err {
+		d.result.Errors = append(d.result.Errors, &ProbeError{Namespace: ns, ClassName: className, Err: err})
+	} else {
+		d.succeeded++
+	}
+
+	d.done++
+	d.emit(NamespaceEvent{Type: ProbeFinished, Namespace: ns, ClassName: className, Err: err})
+}
+
+func (d *namespaceDiscoverer) add(name, className, interop string) {
+	name = strings.Trim(strings.Replace(strings.TrimSpace(name), "\\", "/", -1), "/")
+	if "" == name {
+		return
+	}
+	key := strings.ToLower(name)
+	if d.found[key] {
+		return
+	}
+	d.found[key] = true
+	found := DiscoveredNamespace{Name: name, SourceClass: className, InteropNamespace: interop}
+	d.result.Namespaces = append(d.result.Namespaces, found)
+	d.emit(NamespaceEvent{Type: NamespaceFound, Namespace: interop, ClassName: className, Found: &found})
+}
+
+func (d *namespaceDiscoverer) namespaceInstances(ctx context.Context, ns, className string) error {
+	instances, err := d.c.EnumerateInstances(ctx, ns, className, true, false, false, false, nil)
+	if nil != err {
+		return err
+	}
+	for _, instance := range instances {
+		pr := instance.GetInstance().GetPropertyByName("Name")
+		if nil == pr || nil == pr.GetValue() {
+			continue
+		}
+		name := fmt.Sprint(pr.GetValue())
+		if "__Namespace" == className && !strings.ContainsAny(name, `/\`) {
+			name = ns + "/" + name
+		}
+		d.add(name, className, ns)
+	}
+	return nil
+}
+
+// registeredProfiles adds the interop namespace and the namespaces of the
+// central instances of the profiles.
+func (d *namespaceDiscoverer) registeredProfiles(ctx context.Context, ns, className string) error {
+	names, err := d.c.EnumerateInstanceNames(ctx, ns, className)
+	if nil != err {
+		return err
+	}
+	if 0 == len(names) {
+		return nil
+	}
+	d.add(ns, className, ns)
+
+	assocNames, err := d.c.EnumerateInstanceNames(ctx, ns, "CIM_ElementConformsToProfile")
+	if nil != err {
+		if code, ok := GetCIMStatusCode(err); ok && CIM_ERR_INVALID_CLASS == code {
+			return nil
+		}
+		return err
+	}
+	for _, assocName := range assocNames {
+		keyBindings := assocName.GetKeyBindings()
+		for idx := 0; idx < keyBindings.Len(); idx++ {
+			kb, ok := keyBindings.Get(idx).(*CimKeyBinding)
+			if !ok || nil == kb.ValueReference || !strings.EqualFold("ManagedElement", kb.Name) {
+				continue
+			}
+			if path := ObjectPathFromReference(kb.ValueReference); nil != path && "" != path.Namespace {
+				d.add(path.Namespace, className, ns)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *namespaceDiscoverer) providerCapabilities(ctx context.Context, ns, className string) error {
+	instances, err := d.c.EnumerateInstances(ctx, ns, className, true, false, false, false, []string{"Namespaces"})
+	if nil != err {
+		return err
+	}
+	for _, instance := range instances {
+		for _, name := range StringsWith(instance.GetInstance(), "Namespaces", nil) {
+			d.add(name, className, ns)
+		}
+	}
+	return nil
+}
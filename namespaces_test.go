@@ -0,0 +1,94 @@
+package gowbem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+func TestDiscoverNamespaces(t *testing.T) {
+	m := wbemtest.New()
+	m.AddNamespace("root/cimv2")
+	m.AddNamespace("root/vendor")
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var events []NamespaceEvent
+	result, err := c.DiscoverNamespaces(context.Background(), &NamespaceDiscoveryOptions{
+		InteropNamespaces: []string{"interop", "root/interop", "root/Interop"},
+		OnEvent: func(event NamespaceEvent) {
+			events = append(events, event)
+		}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	found := map[string]DiscoveredNamespace{}
+	for _, ns := range result.Namespaces {
+		found[ns.Name] = ns
+	}
+	if ns := found["root/vendor"]; "CIM_Namespace" != ns.SourceClass || "root/interop" != ns.InteropNamespace {
+		t.Error(result.Namespaces)
+	}
+	if 3 != len(found) {
+		t.Error(result.Namespaces)
+	}
+
+	invalidNamespace := false
+	for _, e := range result.Errors {
+		if code, ok := GetCIMStatusCode(e.Err); ok && CIM_ERR_INVALID_NAMESPACE == code && "interop" == e.Namespace {
+			invalidNamespace = true
+		}
+	}
+	if !invalidNamespace {
+		t.Error(result.Errors)
+	}
+
+	last := events[len(events)-1]
+	if ProbeFinished != last.Type || 8 != last.Total || last.Done != last.Total {
+		t.Errorf("%#v", last)
+	}
+	namespaceFound := 0
+	for _, event := range events {
+		if NamespaceFound == event.Type {
+			namespaceFound++
+		}
+	}
+	if 3 != namespaceFound {
+		t.Error(events)
+	}
+
+	opts := &NamespaceDiscoveryOptions{}
+	if _, err = c.DiscoverNamespaces(context.Background(), opts); nil != err {
+		t.Error(err)
+	}
+	if nil != opts.InteropNamespaces {
+		t.Error("options are changed,", opts.InteropNamespaces)
+	}
+
+	m.Quirks.NamespaceClass = ""
+	result, err = c.DiscoverNamespaces(context.Background(), &NamespaceDiscoveryOptions{
+		InteropNamespaces: []string{"interop"}})
+	if _, ok := err.(ProbeErrors); !ok || 0 == len(result.Errors) {
+		t.Error(err)
+	}
+
+	namespaces, err := c.EnumerateNamespaces(context.Background(), []string{"interop"}, time.Second, nil)
+	if nil != err || 0 != len(namespaces) {
+		t.Error(namespaces, err)
+	}
+
+	// the namespaces of the quirks aren't added if the server isn't reachable
+	hsrv.Close()
+	c.SetQuirks(QuirksFor(VendorESXi))
+	result, err = c.DiscoverNamespaces(context.Background(), &NamespaceDiscoveryOptions{Timeout: time.Second})
+	if _, ok := err.(ProbeErrors); !ok || 0 != len(result.Namespaces) {
+		t.Error(result.Namespaces, err)
+	}
+}
@@ -0,0 +1,612 @@
+package gowbem
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ObjectPath is a CIM object path (DSP0207) of a class or an instance, it
+// implements CIMObjectPath. A class path has no KeyBindings.
+//
+//	https://host:5989/root/cimv2:CIM_ComputerSystem.CreationClassName="CIM_ComputerSystem",Name="x"
+//	//host/root/cimv2:CIM_ComputerSystem.Name="x"
+//	root/cimv2:CIM_ComputerSystem
+//
+// The key value of a reference is the object path of the referenced
+// instance in a quoted string:
+//
+//	CIM_SystemDevice.GroupComponent="root/cimv2:CIM_System.Name=\"s\"",PartComponent="CIM_Disk.DeviceID=\"d\""
+//
+// A reference to a class is written as '(reference)"CIM_Disk"' and a string
+// that looks like an instance path as '(string)"..."'.
+type ObjectPath struct {
+	Scheme      string
+	Host        string
+	Port        string
+	Namespace   string
+	ClassName   string
+	KeyBindings CimKeyBindings
+}
+
+// ParseObjectPath parses the object path, the forms with a scheme, the WMI
+// forms '//host/namespace:...' and '\\host\namespace:...', and the local
+// paths are accepted.
+func ParseObjectPath(s string) (*ObjectPath, error) {
+	p := &objectPathParser{s: s}
+	path, err := p.objectPath()
+	if nil != err {
+		return nil, err
+	}
+	if p.pos != len(s) {
+		return nil, p.errorf("unexpected character")
+	}
+	return path, nil
+}
+
+func (self *ObjectPath) GetHost() string {
+	return self.Host
+}
+
+func (self *ObjectPath) GetKey(name string) CIMValuedElement {
+	for idx := range self.KeyBindings {
+		if strings.EqualFold(self.KeyBindings[idx].Name, name) {
+			return &self.KeyBindings[idx]
+		}
+	}
+	return nil
+}
+
+func (self *ObjectPath) GetKeys() map[string]CIMValuedElement {
+	keys := make(map[string]CIMValuedElement, len(self.KeyBindings))
+	for idx := range self.KeyBindings {
+		keys[self.KeyBindings[idx].Name] = &self.KeyBindings[idx]
+	}
+	return keys
+}
+
+func (self *ObjectPath) GetNamespace() string {
+	return self.Namespace
+}
+
+func (self *ObjectPath) GetObjectName() string {
+	return self.ClassName
+}
+
+func (self *ObjectPath) GetPort() string {
+	return self.Port
+}
+
+func (self *ObjectPath) GetScheme() string {
+	return self.Scheme
+}
+
+// IsClass returns true if the path is a class path.
+func (self *ObjectPath) IsClass() bool {
+	return 0 == len(self.KeyBindings)
+}
+
+// InstanceName returns the instance name of the path, a single key without
+// name is returned in KeyValue or ValueReference.
+func (self *ObjectPath) InstanceName() *CimInstanceName {
+	if 1 == len(self.KeyBindings) && "" == self.KeyBindings[0].Name {
+		return &CimInstanceName{ClassName: self.ClassName,
+			KeyValue:       self.KeyBindings[0].KeyValue,
+			ValueReference: self.KeyBindings[0].ValueReference}
+	}
+	return &CimInstanceName{ClassName: self.ClassName, KeyBindings: self.KeyBindings}
+}
+
+func (self *ObjectPath) hostAndPort() string {
+	if "" == self.Port {
+		return self.Host
+	}
+	return net.JoinHostPort(self.Host, self.Port)
+}
+
+// ValueReference converts the path into a VALUE.REFERENCE, the scheme is
+// dropped.
+func (self *ObjectPath) ValueReference() *CimValueReference {
+	namespaces := ToCimNamespace(self.Namespace)
+	if self.IsClass() {
+		switch {
+		case "" != self.Host:
+			return &CimValueReference{ClassPath: &CimClassPath{
+				NamespacePath: CimNamespacePath{Host: CimHost{Value: self.hostAndPort()},
+					LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces}},
+				ClassName: CimClassName{Name: self.ClassName}}}
+		case "" != self.Namespace:
+			return &CimValueReference{LocalClassPath: &CimLocalClassPath{
+				NamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
+				ClassName:     CimClassName{Name: self.ClassName}}}
+		}
+		return &CimValueReference{ClassName: &CimClassName{Name: self.ClassName}}
+	}
+
+	switch {
+	case "" != self.Host:
+		return &CimValueReference{InstancePath: &CimInstancePath{
+			NamespacePath: CimNamespacePath{Host: CimHost{Value: self.hostAndPort()},
+				LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces}},
+			InstanceName: *self.InstanceName()}}
+	case "" != self.Namespace:
+		return &CimValueReference{LocalInstancePath: &CimLocalInstancePath{
+			LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
+			InstanceName:       *self.InstanceName()}}
+	}
+	return &CimValueReference{InstanceName: self.InstanceName()}
+}
+
+// ObjectPathFromReference converts a VALUE.REFERENCE into a path, it
+// returns nil if the reference is empty.
+func ObjectPathFromReference(ref *CimValueReference) *ObjectPath {
+	path := &ObjectPath{}
+	switch {
+	case nil != ref.ClassPath:
+		path.Host, path.Port = splitHostPort(ref.ClassPath.NamespacePath.Host.Value)
+		path.Namespace = ref.ClassPath.NamespacePath.LocalNamespacePath.String()
+		path.ClassName = ref.ClassPath.ClassName.Name
+	case nil != ref.LocalClassPath:
+		path.Namespace = ref.LocalClassPath.NamespacePath.String()
+		path.ClassName = ref.LocalClassPath.ClassName.Name
+	case nil != ref.ClassName:
+		path.ClassName = ref.ClassName.Name
+	case nil != ref.InstancePath:
+		path.Host, path.Port = splitHostPort(ref.InstancePath.NamespacePath.Host.Value)
+		path.Namespace = ref.InstancePath.NamespacePath.LocalNamespacePath.String()
+		path.setInstanceName(&ref.InstancePath.InstanceName)
+	case nil != ref.LocalInstancePath:
+		path.Namespace = ref.LocalInstancePath.LocalNamespacePath.String()
+		path.setInstanceName(&ref.LocalInstancePath.InstanceName)
+	case nil != ref.InstanceName:
+		path.setInstanceName(ref.InstanceName)
+	default:
+		return nil
+	}
+	return path
+}
+
+func (self *ObjectPath) setInstanceName(name *CimInstanceName) {
+	self.ClassName = name.ClassName
+	self.KeyBindings = CimKeyBindings(name.KeyBindings)
+	if 0 == len(self.KeyBindings) {
+		if nil != name.KeyValue {
+			self.KeyBindings = CimKeyBindings{{KeyValue: name.KeyValue}}
+		} else if nil != name.ValueReference {
+			self.KeyBindings = CimKeyBindings{{ValueReference: name.ValueReference}}
+		}
+	}
+}
+
+// splitHostPort splits 'host:port', the port is empty if it is missing.
+func splitHostPort(s string) (string, string) {
+	if host, port, err := net.SplitHostPort(s); nil == err {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), ""
+}
+
+func (self *ObjectPath) String() string {
+	var buf strings.Builder
+	self.ToString(&buf)
+	return buf.String()
+}
+
+func (self *ObjectPath) ToString(buf *strings.Builder) {
+	if "" != self.Host {
+		if "" != self.Scheme {
+			buf.WriteString(self.Scheme)
+			buf.WriteString(":")
+		}
+		buf.WriteString("//")
+		buf.WriteString(self.hostAndPort())
+		buf.WriteString("/")
+	}
+	if "" != self.Namespace {
+		buf.WriteString(strings.Trim(strings.Replace(self.Namespace, "\\", "/", -1), "/"))
+		buf.WriteString(":")
+	}
+	buf.WriteString(self.ClassName)
+	if !self.IsClass() {
+		buf.WriteString(".")
+		formatKeyBindings(buf, self.KeyBindings)
+	}
+}
+
+func formatKeyBindings(buf *strings.Builder, keyBindings []CimKeyBinding) {
+	for idx := range keyBindings {
+		if idx > 0 {
+			buf.WriteString(",")
+		}
+		if "" != keyBindings[idx].Name {
+			buf.WriteString(keyBindings[idx].Name)
+			buf.WriteString("=")
+		}
+		formatKeyBindingValue(buf, &keyBindings[idx])
+	}
+}
+
+// formatKeyBindingValue writes the key value, the value is written in the
+// form that keyBindingValue parses back to the same value: a reference to a
+// class and a string that looks like an instance path are typed.
+func formatKeyBindingValue(buf *strings.Builder, kb *CimKeyBinding) {
+	if nil != kb.ValueReference {
+		path := ObjectPathFromReference(kb.ValueReference)
+		if nil == path {
+			buf.WriteString(`""`)
+			return
+		}
+		if path.IsClass() {
+			buf.WriteString("(reference)")
+		}
+		writeQuoted(buf, path.String())
+		return
+	}
+	if nil == kb.KeyValue {
+		buf.WriteString(`""`)
+		return
+	}
+
+	kv := kb.KeyValue
+	switch valueType := keyValueType(kv); valueType {
+	case "boolean", "numeric":
+		if "" != kv.Type {
+			buf.WriteString("(")
+			buf.WriteString(kv.Type)
+			buf.WriteString(")")
+		}
+		buf.WriteString(strings.TrimSpace(kv.Value))
+	default:
+		if "" != kv.Type && "string" != kv.Type {
+			buf.WriteString("(")
+			buf.WriteString(kv.Type)
+			buf.WriteString(")")
+		} else if isInstancePath(kv.Value) {
+			buf.WriteString("(string)")
+		}
+		writeQuoted(buf, kv.Value)
+	}
+}
+
+// isInstancePath returns true if the string is parsed as a reference when
+// it is an untyped key value.
+func isInstancePath(s string) bool {
+	path, err := ParseObjectPath(s)
+	return nil == err && !path.IsClass()
+}
+
+// keyValueType returns the VALUETYPE of the key value, it is derived from
+// TYPE if VALUETYPE is missing.
+func keyValueType(kv *CimKeyValue) string {
+	if "" != kv.ValueType {
+		return strings.ToLower(kv.ValueType)
+	}
+	return valueTypeOf(kv.Type)
+}
+
+// valueTypeOf returns the VALUETYPE of the CIM type.
+func valueTypeOf(typ string) string {
+	switch strings.ToLower(typ) {
+	case "boolean":
+		return "boolean"
+	case "uint8", "sint8", "uint16", "sint16", "uint32", "sint32", "uint64", "sint64", "real32", "real64":
+		return "numeric"
+	}
+	return "string"
+}
+
+func writeQuoted(buf *strings.Builder, s string) {
+	buf.WriteString(`"`)
+	for _, c := range s {
+		if '"' == c || '\\' == c {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(c)
+	}
+	buf.WriteString(`"`)
+}
+
+type objectPathParser struct {
+	s   string
+	pos int
+}
+
+func (p *objectPathParser) errorf(message string) error {
+	return errors.New("invalid object path - `" + p.s + "` at " + strconv.Itoa(p.pos) + ": " + message)
+}
+
+func (p *objectPathParser) objectPath() (*ObjectPath, error) {
+	path := &ObjectPath{}
+
+	// scheme
+	if idx := strings.Index(p.s, "://"); idx > 0 && isScheme(p.s[:idx]) {
+		path.Scheme = p.s[:idx]
+		p.pos = idx + 1
+	}
+
+	// host and port
+	rest := p.s[p.pos:]
+	if strings.HasPrefix(rest, "//") || strings.HasPrefix(rest, `\\`) {
+		p.pos += 2
+		end := strings.IndexAny(p.s[p.pos:], `/\`)
+		if end < 0 {
+			return nil, p.errorf("namespace is missing")
+		}
+		authority := p.s[p.pos : p.pos+end]
+		if idx := strings.LastIndex(authority, "@"); idx >= 0 {
+			authority = authority[idx+1:]
+		}
+		if "" == authority {
+			return nil, p.errorf("host is missing")
+		}
+		path.Host, path.Port = splitHostPort(authority)
+		p.pos += end + 1
+	} else if "" != path.Scheme {
+		return nil, p.errorf("host is missing")
+	}
+
+	// namespace, it ends with the ':' before the class name
+	rest = p.s[p.pos:]
+	if end := strings.IndexAny(rest, `:."=,`); end >= 0 && ':' == rest[end] {
+		path.Namespace = strings.Trim(strings.Replace(rest[:end], "\\", "/", -1), "/")
+		p.pos += end + 1
+	}
+
+	className := p.name()
+	if "" == className {
+		return nil, p.errorf("class name is missing")
+	}
+	path.ClassName = className
+	if p.pos == len(p.s) || '.' != p.s[p.pos] {
+		return path, nil
+	}
+	p.pos++
+
+	if kb, ok := p.unnamedKeyBinding(); ok {
+		path.KeyBindings = CimKeyBindings{kb}
+		return path, nil
+	}
+	keyBindings, err := p.keyBindings()
+	if nil != err {
+		return nil, err
+	}
+	path.KeyBindings = keyBindings
+	return path, nil
+}
+
+func isScheme(s string) bool {
+	for idx, c := range s {
+		if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+			(idx > 0 && (('0' <= c && c <= '9') || '+' == c || '-' == c || '.' == c))) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *objectPathParser) name() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !('_' == c || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c >= 0x80) {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// unnamedKeyBinding reads the single key without name, such as
+// 'CIM_Class."value"', the position isn't moved if it isn't found.
+func (p *objectPathParser) unnamedKeyBinding() (CimKeyBinding, bool) {
+	start := p.pos
+	if "" != p.name() && p.pos < len(p.s) && '=' == p.s[p.pos] {
+		p.pos = start
+		return CimKeyBinding{}, false
+	}
+	p.pos = start
+	kb, err := p.keyBindingValue()
+	if nil != err || p.pos != len(p.s) ||
+		(nil != kb.KeyValue && '"' != p.s[start] && '\'' != p.s[start] &&
+			'(' != p.s[start] && "string" == kb.KeyValue.ValueType) {
+		p.pos = start
+		return CimKeyBinding{}, false
+	}
+	return kb, true
+}
+
+func (p *objectPathParser) keyBindings() (CimKeyBindings, error) {
+	var keyBindings CimKeyBindings
+	for {
+		name := p.name()
+		if "" == name {
+			return nil, p.errorf("key name is missing")
+		}
+		if p.pos == len(p.s) || '=' != p.s[p.pos] {
+			return nil, p.errorf("'=' is missing")
+		}
+		p.pos++
+
+		kb, err := p.keyBindingValue()
+		if nil != err {
+			return nil, err
+		}
+		kb.Name = name
+		keyBindings = append(keyBindings, kb)
+
+		if p.pos == len(p.s) || ',' != p.s[p.pos] {
+			return keyBindings, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *objectPathParser) keyBindingValue() (CimKeyBinding, error) {
+	if p.pos == len(p.s) {
+		return CimKeyBinding{}, p.errorf("key value is missing")
+	}
+
+	typ := ""
+	if '(' == p.s[p.pos] {
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			return CimKeyBinding{}, p.errorf("')' is missing")
+		}
+		typ = strings.TrimSpace(p.s[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+		if p.pos == len(p.s) {
+			return CimKeyBinding{}, p.errorf("key value is missing")
+		}
+	}
+
+	switch p.s[p.pos] {
+	case '"':
+		value, err := p.quoted('"')
+		if nil != err {
+			return CimKeyBinding{}, err
+		}
+		if "" == typ {
+			// a reference is the object path of an instance in a string
+			if ref, err := ParseObjectPath(value); nil == err && !ref.IsClass() {
+				return CimKeyBinding{ValueReference: ref.ValueReference()}, nil
+			}
+		} else if "reference" == strings.ToLower(typ) {
+			ref, err := ParseObjectPath(value)
+			if nil != err {
+				return CimKeyBinding{}, err
+			}
+			return CimKeyBinding{ValueReference: ref.ValueReference()}, nil
+		}
+		if "" == typ {
+			return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: "string", Value: value}}, nil
+		}
+		return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: valueTypeOf(typ), Type: typ, Value: value}}, nil
+	case '\'':
+		value, err := p.quoted('\'')
+		if nil != err {
+			return CimKeyBinding{}, err
+		}
+		if "" == typ {
+			typ = "char16"
+		}
+		return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: "string", Type: typ, Value: value}}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && ',' != p.s[p.pos] {
+		p.pos++
+	}
+	value := strings.TrimSpace(p.s[start:p.pos])
+	if "" == value {
+		return CimKeyBinding{}, p.errorf("key value is missing")
+	}
+	if "" != typ {
+		switch lower := strings.ToLower(typ); lower {
+		case "boolean", "numeric":
+			// the old format, such as '(numeric)5', is typed by VALUETYPE
+			return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: lower, Value: value}}, nil
+		}
+		return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: valueTypeOf(typ), Type: typ, Value: value}}, nil
+	}
+
+	valueType := "string"
+	if strings.EqualFold("true", value) || strings.EqualFold("false", value) {
+		valueType = "boolean"
+	} else if _, ok := parseNumber(value); ok {
+		valueType = "numeric"
+	}
+	return CimKeyBinding{KeyValue: &CimKeyValue{ValueType: valueType, Value: value}}, nil
+}
+
+// parseNumber returns the number in decimal, the integers are decimal or
+// hexadecimal with the 0x prefix, the octal and the underscores of Go
+// aren't accepted.
+func parseNumber(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 || "" == digits {
+		return "", false
+	}
+	negative := strings.HasPrefix(s, "-")
+
+	if 2 < len(digits) && ('x' == digits[1] || 'X' == digits[1]) && '0' == digits[0] {
+		u, err := strconv.ParseUint(digits[2:], 16, 64)
+		if nil != err {
+			return "", false
+		}
+		if !negative {
+			return strconv.FormatUint(u, 10), true
+		}
+		if u > 1<<63 {
+			return "", false
+		}
+		return strconv.FormatInt(-int64(u-1)-1, 10), true
+	}
+
+	isInteger := true
+	for _, c := range digits {
+		switch {
+		case '0' <= c && c <= '9':
+		case '.' == c || 'e' == c || 'E' == c || '+' == c || '-' == c:
+			isInteger = false
+		default:
+			return "", false
+		}
+	}
+	if isInteger {
+		if i, err := strconv.ParseInt(s, 10, 64); nil == err {
+			return strconv.FormatInt(i, 10), true
+		}
+		if u, err := strconv.ParseUint(strings.TrimPrefix(s, "+"), 10, 64); nil == err {
+			return strconv.FormatUint(u, 10), true
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if nil != err {
+		return "", false
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+// quoted reads a quoted string, a backslash escapes the quote and the
+// backslash. The paths of the old versions are accepted too, they are
+// written without escapes and a double quote is escaped by a single quote,
+// so a backslash before the other characters is kept and a single quote
+// before a double quote escapes it unless the double quote is followed by
+// ',' or the end of the path.
+func (p *objectPathParser) quoted(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var buf strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return buf.String(), nil
+		case '\\':
+			if p.pos == len(p.s) {
+				p.pos = start
+				return "", p.errorf("escape sequence isn't terminated")
+			}
+			if next := p.s[p.pos]; quote == next || '\\' == next {
+				buf.WriteByte(next)
+				p.pos++
+			} else {
+				buf.WriteByte(c)
+			}
+		case '\'':
+			if '"' == quote && p.pos+1 < len(p.s) && '"' == p.s[p.pos] && ',' != p.s[p.pos+1] {
+				buf.WriteByte('"')
+				p.pos++
+			} else {
+				buf.WriteByte(c)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	p.pos = start
+	return "", p.errorf("quote isn't terminated")
+}
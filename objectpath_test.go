@@ -0,0 +1,122 @@
+package gowbem
+
+import (
+	"testing"
+)
+
+func TestParseObjectPath(t *testing.T) {
+	for _, test := range []struct {
+		s         string
+		scheme    string
+		host      string
+		port      string
+		namespace string
+		className string
+		keys      map[string]string
+		formatted string
+	}{
+		{s: `https://host:5989/root/cimv2:CIM_ComputerSystem.Name="x"`,
+			scheme: "https", host: "host", port: "5989", namespace: "root/cimv2", className: "CIM_ComputerSystem",
+			keys: map[string]string{"Name": "x"}},
+		{s: `//host/root/cimv2:Class.Key="v"`,
+			host: "host", namespace: "root/cimv2", className: "Class", keys: map[string]string{"Key": "v"}},
+		{s: `\\host\root\cimv2:Class.Key="v"`,
+			host: "host", namespace: "root/cimv2", className: "Class", keys: map[string]string{"Key": "v"},
+			formatted: `//host/root/cimv2:Class.Key="v"`},
+		{s: `http://user@[fe80::1]:5988/root/interop:CIM_Namespace`,
+			scheme: "http", host: "fe80::1", port: "5988", namespace: "root/interop", className: "CIM_Namespace",
+			formatted: `http://[fe80::1]:5988/root/interop:CIM_Namespace`},
+		{s: `root/cimv2:CIM_Disk`, namespace: "root/cimv2", className: "CIM_Disk"},
+		{s: `CIM_Disk.DeviceID="a\"b\\c",Size=10,Removable=true,Letter=(char16)'c'`,
+			className: "CIM_Disk", keys: map[string]string{"DeviceID": `a"b\c`, "Size": "10", "Removable": "true", "Letter": "c"},
+			formatted: `CIM_Disk.DeviceID="a\"b\\c",Size=10,Removable=true,Letter=(char16)"c"`},
+		{s: `CIM_Setting.ID=(uint32)5`, className: "CIM_Setting", keys: map[string]string{"ID": "5"}},
+		{s: `CIM_Computer.Name=mycomputer`, className: "CIM_Computer", keys: map[string]string{"Name": "mycomputer"},
+			formatted: `CIM_Computer.Name="mycomputer"`},
+		{s: `CIM_Setting.ID=010,Mask=0x1F,Scale=-1.5e3,Code=1_000,Level=inf`, className: "CIM_Setting",
+			keys:      map[string]string{"ID": "010", "Mask": "0x1F", "Scale": "-1.5e3", "Code": "1_000", "Level": "inf"},
+			formatted: `CIM_Setting.ID=010,Mask=0x1F,Scale=-1.5e3,Code="1_000",Level="inf"`},
+
+		// the paths of the old versions
+		{s: `CIM_Setting.ID=(numeric)5,Enabled=(boolean)true`, className: "CIM_Setting",
+			keys: map[string]string{"ID": "5", "Enabled": "true"}, formatted: `CIM_Setting.ID=5,Enabled=true`},
+		{s: `Win32_Share.Path="C:\dir\a'"b",Name="it's"`, className: "Win32_Share",
+			keys:      map[string]string{"Path": `C:\dir\a"b`, "Name": "it's"},
+			formatted: `Win32_Share.Path="C:\\dir\\a\"b",Name="it's"`},
+	} {
+		path, err := ParseObjectPath(test.s)
+		if nil != err {
+			t.Error(test.s, err)
+			continue
+		}
+		if test.scheme != path.GetScheme() || test.host != path.GetHost() || test.port != path.GetPort() ||
+			test.namespace != path.GetNamespace() || test.className != path.GetObjectName() {
+			t.Errorf("%s: %#v", test.s, path)
+		}
+		if len(test.keys) != len(path.GetKeys()) {
+			t.Errorf("%s: keys is %v", test.s, path.GetKeys())
+		}
+		for name, value := range test.keys {
+			if key := path.GetKey(name); nil == key || value != key.GetValue() {
+				t.Errorf("%s: key %s is %v", test.s, name, key)
+			}
+		}
+		formatted := test.formatted
+		if "" == formatted {
+			formatted = test.s
+		}
+		if formatted != path.String() {
+			t.Errorf("excepted is %s, actual is %s", formatted, path.String())
+		}
+	}
+}
+
+func TestParseObjectPathReference(t *testing.T) {
+	s := `//host/root/cimv2:CIM_SystemDevice.GroupComponent="root/cimv2:CIM_System.CreationClassName=\"CIM_System\",Name=\"s\\\"1\"",PartComponent="CIM_Disk.DeviceID=\"d\""`
+	path, err := ParseObjectPath(s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s != path.String() {
+		t.Errorf("excepted is %s, actual is %s", s, path.String())
+	}
+
+	group, ok := path.GetKey("GroupComponent").GetValue().(*CimValueReference)
+	if !ok || nil == group.LocalInstancePath {
+		t.Fatal(path.GetKey("GroupComponent").GetValue())
+	}
+	if "root/cimv2" != group.LocalInstancePath.LocalNamespacePath.String() ||
+		"CIM_System" != group.LocalInstancePath.InstanceName.ClassName ||
+		`s"1` != group.LocalInstancePath.InstanceName.KeyBindings[1].KeyValue.Value {
+		t.Error(group.LocalInstancePath)
+	}
+	part, ok := path.GetKey("PartComponent").GetValue().(*CimValueReference)
+	if !ok || nil == part.InstanceName || "CIM_Disk" != part.InstanceName.ClassName {
+		t.Fatal(path.GetKey("PartComponent").GetValue())
+	}
+
+	ref := path.ValueReference()
+	if nil == ref.InstancePath || "host" != ref.InstancePath.NamespacePath.Host.Value {
+		t.Fatal(ref)
+	}
+	if back := ObjectPathFromReference(ref); s != back.String() {
+		t.Errorf("excepted is %s, actual is %s", s, back.String())
+	}
+}
+
+func TestParseObjectPathErrors(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`https://`,
+		`http:root/cimv2:CIM_Disk`,
+		`CIM_Disk.`,
+		`CIM_Disk.DeviceID`,
+		`CIM_Disk.DeviceID="a`,
+		`CIM_Disk.DeviceID=(uint32`,
+		`CIM_Disk.DeviceID="a"x`,
+	} {
+		if _, err := ParseObjectPath(s); nil == err {
+			t.Errorf("%s: error is excepted", s)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package gowbem
+
+import (
+	"errors"
+	"strings"
+)
+
+// Operation is a decoded SIMPLEREQ, it is either a intrinsic method call
+// (IMETHODCALL) or a extrinsic method call (METHODCALL).
+type Operation struct {
+	Name        string
+	Namespace   string
+	Intrinsic   bool
+	Correlators []CimCorrelator
+
+	// IParamValues is the parameters of the intrinsic method call.
+	IParamValues []CimIParamValue
+
+	// ObjectName is the target of the extrinsic method call, it only
+	// contains the class name when the method is static.
+	ObjectName  *CimInstanceName
+	ParamValues []CimParamValue
+}
+
+// IsStatic returns true when the extrinsic method is invoked on a class.
+func (op *Operation) IsStatic() bool {
+	return nil != op.ObjectName &&
+		0 == len(op.ObjectName.KeyBindings) &&
+		nil == op.ObjectName.KeyValue &&
+		nil == op.ObjectName.ValueReference
+}
+
+// IParam returns the intrinsic parameter with the given name, the name is
+// case-insensitive.
+func (op *Operation) IParam(name string) *CimIParamValue {
+	for idx := range op.IParamValues {
+		if strings.EqualFold(op.IParamValues[idx].Name, name) {
+			return &op.IParamValues[idx]
+		}
+	}
+	return nil
+}
+
+// Param returns the extrinsic parameter with the given name, the name is
+// case-insensitive.
+func (op *Operation) Param(name string) *CimParamValue {
+	for idx := range op.ParamValues {
+		if strings.EqualFold(op.ParamValues[idx].Name, name) {
+			return &op.ParamValues[idx]
+		}
+	}
+	return nil
+}
+
+func (op *Operation) BoolParam(name string, defaultValue bool) (bool, error) {
+	pv := op.IParam(name)
+	if nil == pv || nil == pv.Value {
+		return defaultValue, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(pv.Value.Value)) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return defaultValue, WBEMException(CIM_ERR_INVALID_PARAMETER,
+		"'"+name+"' isn't a boolean - '"+pv.Value.Value+"'")
+}
+
+func (op *Operation) StringParam(name string) string {
+	pv := op.IParam(name)
+	if nil == pv || nil == pv.Value {
+		return ""
+	}
+	return pv.Value.Value
+}
+
+func (op *Operation) ClassNameParam(name string) string {
+	pv := op.IParam(name)
+	if nil == pv {
+		return ""
+	}
+	if nil != pv.ClassName {
+		return pv.ClassName.Name
+	}
+	if nil != pv.InstanceName {
+		return pv.InstanceName.ClassName
+	}
+	return ""
+}
+
+func (op *Operation) InstanceNameParam(name string) *CimInstanceName {
+	pv := op.IParam(name)
+	if nil == pv {
+		return nil
+	}
+	if nil != pv.InstanceName {
+		return pv.InstanceName
+	}
+	if nil != pv.ClassName {
+		return &CimInstanceName{ClassName: pv.ClassName.Name}
+	}
+	if nil != pv.ValueNamedInstance {
+		return &pv.ValueNamedInstance.InstanceName
+	}
+	return nil
+}
+
+// PropertyListParam returns nil if the PropertyList parameter is missing or
+// null, that is means all properties.
+func (op *Operation) PropertyListParam() []string {
+	pv := op.IParam("PropertyList")
+	if nil == pv || nil == pv.ValueArray {
+		return nil
+	}
+	results := make([]string, 0, len(pv.ValueArray.Values))
+	for _, v := range pv.ValueArray.Values {
+		if nil != v.Value {
+			results = append(results, v.Value.Value)
+		}
+	}
+	return results
+}
+
+func (op *Operation) String() string {
+	if op.Intrinsic {
+		return op.Namespace + ":" + op.Name
+	}
+	if nil == op.ObjectName {
+		return op.Namespace + ":" + op.Name
+	}
+	return op.Namespace + ":" + op.ObjectName.String() + "." + op.Name
+}
+
+func toOperation(req *CimSimpleReq) (Operation, error) {
+	if nil != req.IMethodCall {
+		return Operation{
+			Name:         req.IMethodCall.Name,
+			Namespace:    req.IMethodCall.LocalNamespacePath.String(),
+			Intrinsic:    true,
+			Correlators:  req.Correlators,
+			IParamValues: req.IMethodCall.ParamValues,
+		}, nil
+	}
+
+	if nil != req.MethodCall {
+		op := Operation{
+			Name:        req.MethodCall.Name,
+			Correlators: req.Correlators,
+			ParamValues: req.MethodCall.ParamValues,
+		}
+		if nil != req.MethodCall.LocalInstancePath {
+			op.Namespace = req.MethodCall.LocalInstancePath.LocalNamespacePath.String()
+			op.ObjectName = &req.MethodCall.LocalInstancePath.InstanceName
+		} else if nil != req.MethodCall.LocalClassPath {
+			op.Namespace = req.MethodCall.LocalClassPath.NamespacePath.String()
+			op.ObjectName = &CimInstanceName{ClassName: req.MethodCall.LocalClassPath.ClassName.Name}
+		} else {
+			return op, errors.New("CIM.MESSAGE.SIMPLEREQ.METHODCALL hasn't LOCALCLASSPATH or LOCALINSTANCEPATH.")
+		}
+		return op, nil
+	}
+	return Operation{}, errors.New("CIM.MESSAGE.SIMPLEREQ hasn't METHODCALL or IMETHODCALL.")
+}
+
+// ParseOperations returns all operations of a request message, it returns
+// more than one operation for a MULTIREQ.
+func ParseOperations(cim *CIM) ([]Operation, error) {
+	if nil == cim.Message {
+		return nil, messageNotExists
+	}
+	if nil != cim.Message.SimpleReq {
+		op, err := toOperation(cim.Message.SimpleReq)
+		if nil != err {
+			return nil, err
+		}
+		return []Operation{op}, nil
+	}
+	if nil != cim.Message.MultiReq {
+		results := make([]Operation, 0, len(cim.Message.MultiReq.SimpleReqs))
+		for idx := range cim.Message.MultiReq.SimpleReqs {
+			op, err := toOperation(&cim.Message.MultiReq.SimpleReqs[idx])
+			if nil != err {
+				return nil, err
+			}
+			results = append(results, op)
+		}
+		return results, nil
+	}
+	return nil, errors.New("CIM.MESSAGE hasn't SIMPLEREQ or MULTIREQ.")
+}
@@ -0,0 +1,473 @@
+package gowbem
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The vendors recognized by Probe.
+const (
+	VendorPegasus = "OpenPegasus"
+	VendorSFCB    = "SFCB"
+	VendorESXi    = "VMware ESXi"
+	VendorWMI     = "WMI-CIMOM"
+)
+
+// The values of CIM_ObjectManagerCommunicationMechanism.FunctionalProfilesSupported.
+const (
+	ProfileBasicRead            = 2
+	ProfileBasicWrite           = 3
+	ProfileSchemaManipulation   = 4
+	ProfileInstanceManipulation = 5
+	ProfileAssociationTraversal = 6
+	ProfileQueryExecution       = 7
+	ProfileQualifierDeclaration = 8
+	ProfileIndications          = 9
+)
+
+// ProbeQueryLanguages are the query languages which are tested by Probe if
+// QueryLanguageSupported isn't published.
+var ProbeQueryLanguages = []string{"DMTF:CQL", "CQL", "WQL"}
+
+// probeMaxObjectCounts are the MaxObjectCount tested by Probe, from the
+// largest to the smallest.
+var probeMaxObjectCounts = []int{10000, 1000, 100}
+
+// Capabilities is the identity and the capabilities of the server which
+// are found by Probe.
+type Capabilities struct {
+	// Vendor is one of the Vendor constants or the name of the product
+	// published by the server, it is empty if CIM_ObjectManager isn't found.
+	Vendor  string
+	Version string
+
+	// InteropNamespace is the namespace where CIM_ObjectManager is found.
+	InteropNamespace string
+	ObjectManager    CIMInstanceWithName
+	// CommunicationMechanism is the CIM-XML mechanism of the object
+	// manager, it is nil if it isn't found.
+	CommunicationMechanism CIMInstanceWithName
+
+	// FunctionalProfiles are the FunctionalProfilesSupported, such as
+	// ProfileBasicRead.
+	FunctionalProfiles []int
+	// QueryLanguages are the query languages, they are the values of
+	// QueryLanguageSupported if it is published, otherwise the languages
+	// in ProbeQueryLanguages which ExecQuery accepts.
+	QueryLanguages     []string
+	MultipleOperations bool
+
+	// PullOperations is true if OpenEnumerateInstancePaths is accepted,
+	// MaxObjectCount is the largest MaxObjectCount accepted by it.
+	PullOperations bool
+	MaxObjectCount int
+
+	// Operations is keyed by the names of the tested intrinsic
+	// operations, the value is false if the operation isn't supported.
+	Operations map[string]bool
+}
+
+// HasProfile returns true if the functional profile is supported.
+func (caps *Capabilities) HasProfile(profile int) bool {
+	for _, p := range caps.FunctionalProfiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// Supports returns true if the operation is supported, the operations
+// which aren't tested are considered to be supported.
+func (caps *Capabilities) Supports(operation string) bool {
+	if supported, ok := caps.Operations[operation]; ok {
+		return supported
+	}
+	return true
+}
+
+// SupportsQueryLanguage returns true if the query language is supported,
+// the case is ignored.
+func (caps *Capabilities) SupportsQueryLanguage(queryLanguage string) bool {
+	for _, lang := range caps.QueryLanguages {
+		if strings.EqualFold(lang, queryLanguage) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssociationTraversal returns true if the associations may be followed
+// by AssociatorNames and the others.
+func (caps *Capabilities) AssociationTraversal() bool {
+	if 0 != len(caps.FunctionalProfiles) && !caps.HasProfile(ProfileAssociationTraversal) {
+		return false
+	}
+	return caps.Supports("AssociatorNames")
+}
+
+// Capabilities returns the result of the last Probe, it is nil if Probe
+// isn't called.
+func (c *ClientCIMXML) Capabilities() *Capabilities {
+	c.capabilitiesMu.Lock()
+	defer c.capabilitiesMu.Unlock()
+	return c.capabilities
+}
+
+// Probe finds what the server is, the vendor and the version are taken from
+// CIM_ObjectManager in the interop namespaces, the functional profiles, the
+// query languages and the multiple operations support are taken from
+// CIM_ObjectManagerCommunicationMechanism, and the operations are tested by
+// the calls on CIM_ObjectManager. The result is kept by the client, see
+// Capabilities, and the quirks of the vendor are selected unless they are
+// set by SetQuirks. EnumerateInstanceNames reads the names by the pull
+// operations with the MaxObjectCount if they are found.
+//
+// Probe only returns an error if the server isn't reachable, the
+// authorization is failed or ctx is done, the capabilities which can't be
+// found are left empty.
+func (c *ClientCIMXML) Probe(ctx context.Context) (*Capabilities, error) {
+	caps := &Capabilities{Operations: map[string]bool{}}
+
+	for _, ns := range c.interopNamespaces() {
+		instances, err := c.EnumerateInstances(ctx, ns, "CIM_ObjectManager", true, false, false, false, nil)
+		if nil != err {
+			if err := probeFatal(ctx, err); nil != err {
+				return nil, err
+			}
+			continue
+		}
+		if 0 == len(instances) {
+			continue
+		}
+		caps.InteropNamespace = ns
+		caps.ObjectManager = instances[0]
+		break
+	}
+
+	if nil != caps.ObjectManager {
+		caps.Vendor, caps.Version = objectManagerVendor(caps.ObjectManager)
+		c.selectQuirks(caps.Vendor)
+
+		mechanisms, err := c.EnumerateInstances(ctx, caps.InteropNamespace, "CIM_ObjectManagerCommunicationMechanism",
+			true, false, false, false, nil)
+		if err := probeFatal(ctx, err); nil != err {
+			return nil, err
+		}
+		for _, mechanism := range mechanisms {
+			// 2 is "CIM-XML"
+			if nil == caps.CommunicationMechanism || "2" == propertyString(mechanism.GetInstance(), "CommunicationMechanism") {
+				caps.CommunicationMechanism = mechanism
+			}
+		}
+	}
+
+	if nil != caps.CommunicationMechanism {
+		instance := caps.CommunicationMechanism.GetInstance()
+		caps.FunctionalProfiles = propertyInts(instance, "FunctionalProfilesSupported")
+		caps.MultipleOperations = strings.EqualFold("true", propertyString(instance, "MultipleOperationsSupported"))
+		languages, err := c.queryLanguageNames(ctx, caps.InteropNamespace, instance)
+		if nil != err {
+			return nil, err
+		}
+		caps.QueryLanguages = languages
+	}
+
+	if err := c.probeOperations(ctx, caps); nil != err {
+		return nil, err
+	}
+
+	c.capabilitiesMu.Lock()
+	c.capabilities = caps
+	c.capabilitiesMu.Unlock()
+	return caps, nil
+}
+
+// probeFatal returns the error if the probe can't continue.
+func probeFatal(ctx context.Context, err error) error {
+	if nil == err {
+		return nil
+	}
+	if nil != ctx.Err() {
+		return ctx.Err()
+	}
+	if ErrUnauthorized == err {
+		return err
+	}
+	if _, ok := err.(*url.Error); ok {
+		return err
+	}
+	return nil
+}
+
+// probeSupported returns true if the error isn't the error of an
+// unsupported operation, the other CIM errors mean the operation is
+// supported but the arguments are rejected.
+func probeSupported(err error) bool {
+	if nil == err || IsEmptyResults(err) {
+		return true
+	}
+	if code, ok := GetCIMStatusCode(err); ok {
+		return CIM_ERR_NOT_SUPPORTED != code
+	}
+	return false
+}
+
+func (c *ClientCIMXML) probeOperations(ctx context.Context, caps *Capabilities) error {
+	ns := caps.InteropNamespace
+	if "" == ns {
+		return nil
+	}
+
+	test := func(name string, err error) error {
+		if err := probeFatal(ctx, err); nil != err {
+			return err
+		}
+		caps.Operations[name] = probeSupported(err)
+		return nil
+	}
+
+	_, err := c.EnumerateClassNames(ctx, ns, "CIM_ObjectManager", false)
+	if err := test("EnumerateClassNames", err); nil != err {
+		return err
+	}
+	_, err = c.GetClass(ctx, ns, "CIM_ObjectManager", true, false, false, nil)
+	if err := test("GetClass", err); nil != err {
+		return err
+	}
+	_, err = c.EnumerateQualifierTypes(ctx, ns)
+	if err := test("EnumerateQualifiers", err); nil != err {
+		return err
+	}
+	// EnumerateInstances is tested by the lookup of CIM_ObjectManager.
+	caps.Operations["EnumerateInstances"] = nil != caps.ObjectManager
+	if nil != caps.ObjectManager {
+		name := caps.ObjectManager.GetName()
+		_, err = c.GetInstanceByInstanceName(ctx, ns, name, false, false, false, nil)
+		if err := test("GetInstance", err); nil != err {
+			return err
+		}
+		_, err = c.AssociatorNames(ctx, ns, name, "", "", "", "")
+		if err := test("AssociatorNames", err); nil != err {
+			return err
+		}
+		_, err = c.ReferenceNames(ctx, ns, name, "", "")
+		if err := test("ReferenceNames", err); nil != err {
+			return err
+		}
+	}
+
+	// the pull operations are tested with MaxObjectCount=0 which returns
+	// nothing, the limit is tested only if they are supported.
+	err = c.probeOpen(ctx, ns, 0)
+	if err := probeFatal(ctx, err); nil != err {
+		return err
+	}
+	caps.PullOperations = probeSupported(err)
+	for _, maxObjectCount := range probeMaxObjectCounts {
+		if !caps.PullOperations {
+			break
+		}
+		err := c.probeOpen(ctx, ns, maxObjectCount)
+		if err := probeFatal(ctx, err); nil != err {
+			return err
+		}
+		if code, ok := GetCIMStatusCode(err); ok && CIM_ERR_SERVER_LIMITS_EXCEEDED == code {
+			continue
+		}
+		if probeSupported(err) {
+			caps.MaxObjectCount = maxObjectCount
+		}
+		break
+	}
+	caps.Operations["OpenEnumerateInstancePaths"] = caps.PullOperations
+	return nil
+}
+
+// probeOpen opens the enumeration of the names of CIM_ObjectManager, the
+// enumeration context is closed if the enumeration isn't finished.
+func (c *ClientCIMXML) probeOpen(ctx context.Context, ns string, maxObjectCount int) error {
+	resp, err := c.intrinsicCall(ctx, ns, "OpenEnumerateInstancePaths", []CimIParamValue{
+		{Name: "ClassName", ClassName: &CimClassName{Name: "CIM_ObjectManager"}},
+		{Name: "MaxObjectCount", Value: &CimValue{Value: strconv.Itoa(maxObjectCount)}},
+	})
+	if nil != err {
+		return err
+	}
+	enumerationContext, endOfSequence := enumerationResult(resp)
+	if endOfSequence || "" == enumerationContext {
+		return nil
+	}
+	if err := c.CloseEnumeration(ctx, ns, enumerationContext); nil != err {
+		return probeFatal(ctx, err)
+	}
+	return nil
+}
+
+// queryLanguageNames translates QueryLanguageSupported by the value map of
+// the class, the query languages in ProbeQueryLanguages are tested by
+// ExecQuery if it isn't published. The error is returned only if the probe
+// can't continue, see probeFatal.
+func (c *ClientCIMXML) queryLanguageNames(ctx context.Context, ns string, instance CIMInstance) ([]string, error) {
+	values := propertyInts(instance, "QueryLanguageSupported")
+	if 0 == len(values) {
+		var languages []string
+		for _, lang := range ProbeQueryLanguages {
+			_, err := c.intrinsicCall(ctx, ns, "ExecQuery", []CimIParamValue{
+				{Name: "QueryLanguage", Value: &CimValue{Value: lang}},
+				{Name: "Query", Value: &CimValue{Value: "SELECT * FROM CIM_ObjectManager"}},
+			})
+			if err := probeFatal(ctx, err); nil != err {
+				return nil, err
+			}
+			if nil == err || IsEmptyResults(err) {
+				languages = append(languages, lang)
+			}
+		}
+		return languages, nil
+	}
+
+	var metadata *PropertyMetadata
+	class, err := c.Schema().GetClass(ctx, ns, "CIM_ObjectManagerCommunicationMechanism")
+	if nil == err {
+		metadata, _ = GetPropertyMetadata(class, "QueryLanguageSupported")
+	} else if err := probeFatal(ctx, err); nil != err {
+		return nil, err
+	}
+	languages := make([]string, 0, len(values))
+	for _, value := range values {
+		name := "QueryLanguage(" + strconv.Itoa(value) + ")"
+		if nil != metadata && nil != metadata.ValueMap {
+			if text, ok := metadata.ValueMap.Lookup(value); ok {
+				name = text
+			}
+		}
+		languages = append(languages, name)
+	}
+	return languages, nil
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// objectManagerVendor returns the vendor and the version from the class
+// name, the ElementName, the Name and the Description of CIM_ObjectManager.
+func objectManagerVendor(om CIMInstanceWithName) (string, string) {
+	instance := om.GetInstance()
+	className := instance.GetClassName()
+	description := propertyString(instance, "Description")
+	text := strings.ToLower(className + " " + propertyString(instance, "ElementName") + " " +
+		propertyString(instance, "Name") + " " + description)
+
+	vendor := ""
+	switch {
+	case strings.Contains(text, "vmware") || strings.HasPrefix(strings.ToLower(className), "vmware_"):
+		vendor = VendorESXi
+	case strings.Contains(text, "pegasus") || strings.HasPrefix(strings.ToLower(className), "pg_"):
+		vendor = VendorPegasus
+	case strings.Contains(text, "sfcb") || strings.Contains(text, "small footprint"):
+		vendor = VendorSFCB
+	case strings.Contains(text, "wmi") || strings.Contains(text, "microsoft"):
+		vendor = VendorWMI
+	default:
+		vendor = propertyString(instance, "ElementName")
+		if "" == vendor {
+			vendor = propertyString(instance, "Name")
+		}
+	}
+	return vendor, versionPattern.FindString(description)
+}
+
+func propertyString(instance CIMInstance, name string) string {
+	if nil == instance {
+		return ""
+	}
+	pr := instance.GetPropertyByName(name)
+	if nil == pr || nil == pr.GetValue() {
+		return ""
+	}
+	return fmt.Sprint(pr.GetValue())
+}
+
+func propertyInts(instance CIMInstance, name string) []int {
+	if nil == instance {
+		return nil
+	}
+	pr := instance.GetPropertyByName(name)
+	if nil == pr || nil == pr.GetValue() {
+		return nil
+	}
+	var values []interface{}
+	switch vv := pr.GetValue().(type) {
+	case []interface{}:
+		values = vv
+	case []string:
+		for _, v := range vv {
+			values = append(values, v)
+		}
+	default:
+		values = []interface{}{vv}
+	}
+	var results []int
+	for _, v := range values {
+		if nil == v {
+			continue
+		}
+		if i, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(v))); nil == err {
+			results = append(results, i)
+		}
+	}
+	return results
+}
+
+// intrinsicCall invokes the intrinsic method which hasn't a method in the
+// client, the response is returned if it isn't an error.
+func (c *ClientCIMXML) intrinsicCall(ctx context.Context, namespaceName, name string, paramValues []CimIParamValue) (*CimIMethodResponse, error) {
+	names := SplitNamespaces(namespaceName)
+	namespaces := make([]CimNamespace, len(names))
+	for idx, name := range names {
+		namespaces[idx].Name = name
+	}
+
+	req := &CIM{
+		CimVersion: c.CimVersion,
+		DtdVersion: c.DtdVersion,
+		Message: &CimMessage{
+			Id:              c.generateId(),
+			ProtocolVersion: c.ProtocolVersion,
+			SimpleReq: &CimSimpleReq{IMethodCall: &CimIMethodCall{
+				Name:               name,
+				LocalNamespacePath: CimLocalNamespacePath{Namespaces: namespaces},
+				ParamValues:        paramValues,
+			}},
+		},
+	}
+
+	resp := &CIM{hasFault: func(cim *CIM) error {
+		if nil == cim.Message {
+			return messageNotExists
+		}
+		if nil == cim.Message.SimpleRsp {
+			return simpleReqNotExists
+		}
+		if nil == cim.Message.SimpleRsp.IMethodResponse {
+			return imethodResponseNotExists
+		}
+		if nil != cim.Message.SimpleRsp.IMethodResponse.Error {
+			e := cim.Message.SimpleRsp.IMethodResponse.Error
+			return WBEMException(CIMStatusCode(e.Code), e.Description)
+		}
+		return nil
+	}}
+
+	if err := c.RoundTrip(ctx, "POST", map[string]string{"CIMProtocolVersion": c.ProtocolVersion,
+		"CIMOperation": "MethodCall",
+		"CIMMethod":    name,
+		"CIMObject":    url.QueryEscape(namespaceName)}, req, resp); nil != err {
+		return nil, err
+	}
+	return resp.Message.SimpleRsp.IMethodResponse, nil
+}
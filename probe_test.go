@@ -0,0 +1,278 @@
+package gowbem_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const interopMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier ValueMap : string[], Scope(property, method, parameter);
+Qualifier Values : string[], Scope(property, method, parameter), Flavor(Translatable);
+
+class CIM_ObjectManager {
+	[Key] string CreationClassName;
+	[Key] string Name;
+	string ElementName;
+	string Description;
+};
+
+class PG_ObjectManager : CIM_ObjectManager {
+};
+
+class CIM_ObjectManagerCommunicationMechanism {
+	[Key] string CreationClassName;
+	[Key] string Name;
+	[ValueMap {"0", "1", "2", "3"}, Values {"Unknown", "Other", "CIM-XML", "SM-CLP"}]
+	uint16 CommunicationMechanism;
+	uint16 FunctionalProfilesSupported[];
+	[ValueMap {"2", "3"}, Values {"DMTF:CQL", "WQL"}]
+	uint16 QueryLanguageSupported[];
+	boolean MultipleOperationsSupported;
+};
+`
+
+// wqlProvider accepts the WQL queries only.
+type wqlProvider struct{}
+
+func (wqlProvider) ExecQuery(ctx context.Context, namespaceName, queryLanguage, query string) ([]CimValueObjectWithPath, error) {
+	if "WQL" != queryLanguage {
+		return nil, WBEMException(CIM_ERR_QUERY_LANGUAGE_NOT_SUPPORTED, queryLanguage)
+	}
+	return nil, nil
+}
+
+func TestProbe(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/PG_InterOp", interopMOF+`
+instance of PG_ObjectManager {
+	CreationClassName = "PG_ObjectManager";
+	Name = "PG:1";
+	ElementName = "Pegasus";
+	Description = "Pegasus OpenPegasus Version 2.14.1";
+};
+
+instance of CIM_ObjectManagerCommunicationMechanism {
+	CreationClassName = "PG_CIMXMLCommunicationMechanism";
+	Name = "PG:1+http";
+	CommunicationMechanism = 2;
+	FunctionalProfilesSupported = {2, 3, 5, 6, 7};
+	QueryLanguageSupported = {2};
+	MultipleOperationsSupported = true;
+};`); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if nil != c.Capabilities() {
+		t.Error("capabilities isn't nil")
+	}
+	caps, err := c.Probe(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if VendorPegasus != caps.Vendor || "2.14.1" != caps.Version || "root/PG_InterOp" != caps.InteropNamespace {
+		t.Errorf("%#v", caps)
+	}
+	if 5 != len(caps.FunctionalProfiles) || !caps.HasProfile(ProfileAssociationTraversal) ||
+		caps.HasProfile(ProfileIndications) || !caps.MultipleOperations {
+		t.Errorf("%#v", caps)
+	}
+	if 1 != len(caps.QueryLanguages) || !caps.SupportsQueryLanguage("dmtf:cql") {
+		t.Error(caps.QueryLanguages)
+	}
+	if !caps.Supports("GetClass") || !caps.Supports("GetInstance") || !caps.AssociationTraversal() {
+		t.Errorf("%#v", caps.Operations)
+	}
+	if caps.PullOperations || 0 != caps.MaxObjectCount || caps.Supports("OpenEnumerateInstancePaths") {
+		t.Errorf("%#v", caps)
+	}
+	if caps != c.Capabilities() {
+		t.Error("capabilities isn't kept")
+	}
+	if QuirksFor(VendorPegasus) != c.Quirks() {
+		t.Error("quirks isn't selected,", c.Quirks().Name)
+	}
+
+	m = wbemtest.New()
+	if err := m.LoadMOF("root/interop", interopMOF+`
+instance of CIM_ObjectManager {
+	CreationClassName = "CIM_ObjectManager";
+	Name = "sfcb:1";
+	ElementName = "sfcb";
+	Description = "Small Footprint CIM Broker 1.4.9";
+};
+
+instance of CIM_ObjectManagerCommunicationMechanism {
+	CreationClassName = "CIM_ObjectManagerCommunicationMechanism";
+	Name = "sfcb:1+http";
+	CommunicationMechanism = 2;
+	FunctionalProfilesSupported = {2, 3};
+};`); nil != err {
+		t.Fatal(err)
+	}
+	m.Server.RegisterQueryProvider("root/interop", wqlProvider{})
+	m.InjectFault(wbemtest.Fault{Operation: "AssociatorNames", Err: WBEMException(CIM_ERR_NOT_SUPPORTED, "AssociatorNames")})
+	hsrv2 := m.Start()
+	defer hsrv2.Close()
+	c, err = wbemtest.NewClient(hsrv2)
+	if nil != err {
+		t.Fatal(err)
+	}
+	caps, err = c.Probe(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if VendorSFCB != caps.Vendor || "1.4.9" != caps.Version || caps.MultipleOperations {
+		t.Errorf("%#v", caps)
+	}
+	if 1 != len(caps.QueryLanguages) || "WQL" != caps.QueryLanguages[0] {
+		t.Error(caps.QueryLanguages)
+	}
+	if caps.Supports("AssociatorNames") || caps.AssociationTraversal() || !caps.Supports("ReferenceNames") {
+		t.Errorf("%#v", caps.Operations)
+	}
+	if VendorSFCB != c.Quirks().Name {
+		t.Error("quirks isn't selected,", c.Quirks().Name)
+	}
+	m.InjectFault(wbemtest.Fault{Operation: "ExecQuery", StatusCode: http.StatusUnauthorized})
+	if _, err := c.Probe(ctx); ErrUnauthorized != err {
+		t.Error("excepted is ErrUnauthorized, actual is", err)
+	}
+	m.ClearFaults()
+
+	m = wbemtest.New()
+	m.AddNamespace("root/cimv2")
+	hsrv3 := m.Start()
+	defer hsrv3.Close()
+	c, err = wbemtest.NewClient(hsrv3)
+	if nil != err {
+		t.Fatal(err)
+	}
+	explicit := &Quirks{Name: "explicit", InteropNamespaces: []string{"root/vendor"}}
+	c.SetQuirks(explicit)
+	caps, err = c.Probe(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "" != caps.Vendor || nil != caps.ObjectManager || 0 != len(caps.Operations) {
+		t.Errorf("%#v", caps)
+	}
+	if explicit != c.Quirks() {
+		t.Error("explicit quirks is changed,", c.Quirks().Name)
+	}
+}
+
+const openEnumerationResponse = `<?xml version="1.0" encoding="utf-8" ?>
+<CIM CIMVERSION="2.0" DTDVERSION="2.0"><MESSAGE ID="1" PROTOCOLVERSION="1.0"><SIMPLERSP>
+<IMETHODRESPONSE NAME="OpenEnumerateInstancePaths"><IRETURNVALUE>
+<INSTANCEPATH><NAMESPACEPATH><HOST>localhost</HOST><LOCALNAMESPACEPATH><NAMESPACE NAME="root"/><NAMESPACE NAME="interop"/></LOCALNAMESPACEPATH></NAMESPACEPATH>
+<INSTANCENAME CLASSNAME="CIM_ObjectManager"><KEYBINDING NAME="Name"><KEYVALUE VALUETYPE="string">sfcb:1</KEYVALUE></KEYBINDING></INSTANCENAME></INSTANCEPATH>
+</IRETURNVALUE>
+<PARAMVALUE NAME="EnumerationContext" PARAMTYPE="string"><VALUE>context1</VALUE></PARAMVALUE>
+<PARAMVALUE NAME="EndOfSequence" PARAMTYPE="boolean"><VALUE>FALSE</VALUE></PARAMVALUE>
+</IMETHODRESPONSE></SIMPLERSP></MESSAGE></CIM>`
+
+const pullEnumerationResponse = `<?xml version="1.0" encoding="utf-8" ?>
+<CIM CIMVERSION="2.0" DTDVERSION="2.0"><MESSAGE ID="1" PROTOCOLVERSION="1.0"><SIMPLERSP>
+<IMETHODRESPONSE NAME="PullInstancePaths"><IRETURNVALUE>
+<INSTANCEPATH><NAMESPACEPATH><HOST>localhost</HOST><LOCALNAMESPACEPATH><NAMESPACE NAME="root"/><NAMESPACE NAME="interop"/></LOCALNAMESPACEPATH></NAMESPACEPATH>
+<INSTANCENAME CLASSNAME="CIM_ObjectManager"><KEYBINDING NAME="Name"><KEYVALUE VALUETYPE="string">sfcb:2</KEYVALUE></KEYBINDING></INSTANCENAME></INSTANCEPATH>
+</IRETURNVALUE>
+<PARAMVALUE NAME="EnumerationContext" PARAMTYPE="string"><VALUE>context1</VALUE></PARAMVALUE>
+<PARAMVALUE NAME="EndOfSequence" PARAMTYPE="boolean"><VALUE>TRUE</VALUE></PARAMVALUE>
+</IMETHODRESPONSE></SIMPLERSP></MESSAGE></CIM>`
+
+const closeEnumerationResponse = `<?xml version="1.0" encoding="utf-8" ?>
+<CIM CIMVERSION="2.0" DTDVERSION="2.0"><MESSAGE ID="1" PROTOCOLVERSION="1.0"><SIMPLERSP>
+<IMETHODRESPONSE NAME="CloseEnumeration"></IMETHODRESPONSE></SIMPLERSP></MESSAGE></CIM>`
+
+func TestProbePullOperations(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/interop", interopMOF+`
+instance of CIM_ObjectManager {
+	CreationClassName = "CIM_ObjectManager";
+	Name = "sfcb:1";
+	Description = "Small Footprint CIM Broker 1.4.9";
+};`); nil != err {
+		t.Fatal(err)
+	}
+	m.InjectFault(wbemtest.Fault{Operation: "OpenEnumerateInstancePaths", Body: openEnumerationResponse})
+	m.InjectFault(wbemtest.Fault{Operation: "CloseEnumeration", Body: closeEnumerationResponse})
+	m.InjectFault(wbemtest.Fault{Operation: "PullInstancePaths", Body: pullEnumerationResponse})
+
+	var mu sync.Mutex
+	var methods, bodies []string
+	hsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		mu.Lock()
+		methods = append(methods, r.Header.Get("CIMMethod"))
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		m.ServeHTTP(w, r)
+	}))
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	caps, err := c.Probe(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !caps.PullOperations || 10000 != caps.MaxObjectCount || !caps.Supports("OpenEnumerateInstancePaths") {
+		t.Errorf("%#v", caps)
+	}
+
+	mu.Lock()
+	opened, closed := 0, 0
+	for _, method := range methods {
+		switch method {
+		case "OpenEnumerateInstancePaths":
+			opened++
+		case "CloseEnumeration":
+			closed++
+		}
+	}
+	probed := len(methods)
+	mu.Unlock()
+	if 2 != opened || opened != closed {
+		t.Errorf("excepted is %d closed, actual is %d closed", opened, closed)
+	}
+
+	names, err := c.EnumerateInstanceNames(ctx, "root/interop", "CIM_ObjectManager")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) || `CIM_ObjectManager.Name="sfcb:2"` != names[1].String() {
+		t.Error(names)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	methods, bodies = methods[probed:], bodies[probed:]
+	if 2 != len(methods) || "OpenEnumerateInstancePaths" != methods[0] || "PullInstancePaths" != methods[1] {
+		t.Fatal(methods)
+	}
+	for idx, body := range bodies {
+		if !strings.Contains(body, `NAME="MaxObjectCount"><VALUE>10000</VALUE>`) {
+			t.Errorf("MaxObjectCount isn't sent by %s, %s", methods[idx], body)
+		}
+	}
+}
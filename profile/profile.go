@@ -0,0 +1,326 @@
+// Package profile discovers the management profiles (DSP1033) implemented
+// by a CIMOM, such as the SMI-S Array or the DMTF Computer System profile.
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Organizations are the values of CIM_RegisteredProfile.RegisteredOrganization.
+var Organizations = map[int]string{
+	1:  "Other",
+	2:  "DMTF",
+	3:  "CompTIA",
+	4:  "Consortium for Service Innovation",
+	5:  "FAST",
+	6:  "GGF",
+	7:  "INTAP",
+	8:  "itSMF",
+	9:  "NAC",
+	10: "Northwest Energy Efficiency Alliance",
+	11: "SNIA",
+	12: "TM Forum",
+	13: "The Open Group",
+	14: "ANSI",
+	15: "IEEE",
+	16: "IETF",
+	17: "INCITS",
+	18: "ISO",
+	19: "W3C",
+	20: "OGF",
+	21: "The Green Grid",
+}
+
+const (
+	// DirectionDMTF is the direction of CIM_ReferencedProfile in DSP1033,
+	// Dependent is the referencing profile and Antecedent is the subprofile.
+	DirectionDMTF = "dmtf"
+	// DirectionSNIA is the direction used by SMI-S, Antecedent is the
+	// referencing profile and Dependent is the subprofile.
+	DirectionSNIA = "snia"
+)
+
+// Client is the part of gowbem.ClientCIMXML used by Discover.
+type Client interface {
+	EnumerateInstances(ctx context.Context, namespaceName, className string, deepInheritance bool,
+		localOnly bool, includeQualifiers bool, includeClassOrigin bool, propertyList []string) ([]gowbem.CIMInstanceWithName, error)
+	ReferenceNames(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName,
+		resultClass, role string) ([]gowbem.CIMInstanceName, error)
+}
+
+// Options of Discover.
+type Options struct {
+	// Namespace is the interop namespace, gowbem.InteropNamespaces are
+	// tried if it is empty.
+	Namespace string
+	// ReferenceDirection is DirectionDMTF or DirectionSNIA, if it is empty
+	// DirectionSNIA is used when both profiles are registered by SNIA.
+	ReferenceDirection string
+}
+
+// Profile is an instance of CIM_RegisteredProfile.
+type Profile struct {
+	Path         *gowbem.CimInstanceName
+	InstanceID   string
+	Organization string
+	Name         string
+	Version      string
+	// CentralInstances are the instances conform to the profile through
+	// CIM_ElementConformsToProfile, the namespace is the interop namespace
+	// if the reference hasn't a namespace.
+	CentralInstances []*gowbem.ObjectPath
+	// Subprofiles are the profiles referenced by CIM_ReferencedProfile or
+	// CIM_SubProfileRequiresProfile.
+	Subprofiles []*Profile
+	Instance    gowbem.CIMInstance
+
+	referenced bool
+}
+
+func (p *Profile) String() string {
+	return p.Organization + ":" + p.Name + ":" + p.Version
+}
+
+// Tree is the result of Discover.
+type Tree struct {
+	Namespace string
+	// Profiles are all of the profiles, sorted by the organization, the
+	// name and the version.
+	Profiles []*Profile
+	// Roots are the profiles which aren't a subprofile of others.
+	Roots []*Profile
+}
+
+// Find returns the profiles of the organization and the name, the case is
+// ignored.
+func (t *Tree) Find(organization, name string) []*Profile {
+	var results []*Profile
+	for _, p := range t.Profiles {
+		if strings.EqualFold(organization, p.Organization) && strings.EqualFold(name, p.Name) {
+			results = append(results, p)
+		}
+	}
+	return results
+}
+
+// Discover enumerates CIM_RegisteredProfile in the interop namespace and
+// builds the tree of the profiles.
+func Discover(ctx context.Context, c Client, opts Options) (*Tree, error) {
+	namespaces := gowbem.InteropNamespaces
+	if "" != opts.Namespace {
+		namespaces = []string{opts.Namespace}
+	}
+
+	var instances []gowbem.CIMInstanceWithName
+	var lastErr error
+	tree := &Tree{}
+	for _, ns := range namespaces {
+		results, err := c.EnumerateInstances(ctx, ns, "CIM_RegisteredProfile", true, false, false, false, nil)
+		if nil != err {
+			if gowbem.IsEmptyResults(err) {
+				tree.Namespace = ns
+				break
+			}
+			lastErr = err
+			continue
+		}
+		tree.Namespace = ns
+		instances = results
+		break
+	}
+	if "" == tree.Namespace {
+		if nil == lastErr {
+			lastErr = gowbem.WBEMException(gowbem.CIM_ERR_INVALID_NAMESPACE, "interop namespace isn't found.")
+		}
+		return nil, lastErr
+	}
+
+	profiles := map[string]*Profile{}
+	for _, instance := range instances {
+		p, err := newProfile(instance)
+		if nil != err {
+			return nil, err
+		}
+		profiles[p.Path.Key()] = p
+		tree.Profiles = append(tree.Profiles, p)
+	}
+	sort.SliceStable(tree.Profiles, func(i, j int) bool {
+		a, b := tree.Profiles[i], tree.Profiles[j]
+		if a.Organization != b.Organization {
+			return a.Organization < b.Organization
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	for _, p := range tree.Profiles {
+		if err := centralInstances(ctx, c, tree.Namespace, p); nil != err {
+			return nil, err
+		}
+		if err := subprofiles(ctx, c, tree.Namespace, p, profiles, opts.ReferenceDirection); nil != err {
+			return nil, err
+		}
+	}
+	for _, p := range tree.Profiles {
+		if !p.referenced {
+			tree.Roots = append(tree.Roots, p)
+		}
+	}
+	return tree, nil
+}
+
+func newProfile(instance gowbem.CIMInstanceWithName) (*Profile, error) {
+	path, err := gowbem.AsCimInstanceName(instance.GetName())
+	if nil != err {
+		return nil, err
+	}
+	p := &Profile{Path: path, Instance: instance.GetInstance()}
+	p.InstanceID = stringValue(p.Instance, "InstanceID")
+	p.Name = stringValue(p.Instance, "RegisteredName")
+	p.Version = stringValue(p.Instance, "RegisteredVersion")
+	p.Organization = Organization(stringValue(p.Instance, "RegisteredOrganization"),
+		stringValue(p.Instance, "OtherRegisteredOrganization"))
+	return p, nil
+}
+
+// Organization decodes the value of RegisteredOrganization, other is the
+// value of OtherRegisteredOrganization.
+func Organization(value, other string) string {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if nil != err {
+		return value
+	}
+	if 1 == code && "" != other {
+		return other
+	}
+	if s, ok := Organizations[code]; ok {
+		return s
+	}
+	return value
+}
+
+func stringValue(instance gowbem.CIMInstance, name string) string {
+	pr := instance.GetPropertyByName(name)
+	if nil == pr {
+		return ""
+	}
+	value := pr.GetValue()
+	if nil == value {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func centralInstances(ctx context.Context, c Client, ns string, p *Profile) error {
+	assocNames, err := c.ReferenceNames(ctx, ns, p.Path, "CIM_ElementConformsToProfile", "ConformantStandard")
+	if nil != err {
+		if gowbem.IsErrUnavailable(err) {
+			return nil
+		}
+		return err
+	}
+	for _, instanceName := range assocNames {
+		assocName, err := gowbem.AsCimInstanceName(instanceName)
+		if nil != err {
+			return err
+		}
+		for _, kb := range assocName.KeyBindings {
+			if !strings.EqualFold("ManagedElement", kb.Name) || nil == kb.ValueReference {
+				continue
+			}
+			path := gowbem.ObjectPathFromReference(kb.ValueReference)
+			if nil == path || path.IsClass() {
+				continue
+			}
+			if "" == path.Namespace {
+				path.Namespace = ns
+			}
+			p.CentralInstances = append(p.CentralInstances, path)
+		}
+	}
+	return nil
+}
+
+func subprofiles(ctx context.Context, c Client, ns string, p *Profile, profiles map[string]*Profile, direction string) error {
+	for _, assocClass := range []string{"CIM_ReferencedProfile", "CIM_SubProfileRequiresProfile"} {
+		assocNames, err := c.ReferenceNames(ctx, ns, p.Path, assocClass, "")
+		if nil != err {
+			if gowbem.IsErrUnavailable(err) {
+				continue
+			}
+			return err
+		}
+		for _, instanceName := range assocNames {
+			assocName, err := gowbem.AsCimInstanceName(instanceName)
+			if nil != err {
+				return err
+			}
+			var antecedent, dependent *Profile
+			for _, kb := range assocName.KeyBindings {
+				if nil == kb.ValueReference {
+					continue
+				}
+				path := gowbem.ObjectPathFromReference(kb.ValueReference)
+				if nil == path || path.IsClass() {
+					continue
+				}
+				switch {
+				case strings.EqualFold("Antecedent", kb.Name):
+					antecedent = profiles[path.InstanceName().Key()]
+				case strings.EqualFold("Dependent", kb.Name):
+					dependent = profiles[path.InstanceName().Key()]
+				}
+			}
+			if nil == antecedent || nil == dependent {
+				continue
+			}
+
+			parent, child := dependent, antecedent
+			if strings.EqualFold("CIM_SubProfileRequiresProfile", assocClass) ||
+				DirectionSNIA == direction ||
+				("" == direction && "SNIA" == antecedent.Organization && "SNIA" == dependent.Organization) {
+				parent, child = antecedent, dependent
+			}
+			if parent == p {
+				addSubprofile(parent, child)
+			}
+		}
+	}
+	return nil
+}
+
+// addSubprofile adds the child to the parent, it is ignored if the parent
+// is already a subprofile of the child.
+func addSubprofile(parent, child *Profile) {
+	if parent == child || contains(child, parent, map[*Profile]bool{}) {
+		return
+	}
+	for _, sub := range parent.Subprofiles {
+		if sub == child {
+			return
+		}
+	}
+	parent.Subprofiles = append(parent.Subprofiles, child)
+	child.referenced = true
+}
+
+func contains(p, target *Profile, visited map[*Profile]bool) bool {
+	if visited[p] {
+		return false
+	}
+	visited[p] = true
+	for _, sub := range p.Subprofiles {
+		if sub == target || contains(sub, target, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package profile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const interopMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Association : boolean = false, Scope(association), Flavor(DisableOverride, ToSubclass);
+
+class CIM_ManagedElement {
+};
+
+class CIM_RegisteredProfile : CIM_ManagedElement {
+	[Key] string InstanceID;
+	uint16 RegisteredOrganization;
+	string OtherRegisteredOrganization;
+	string RegisteredName;
+	string RegisteredVersion;
+};
+
+class CIM_RegisteredSubProfile : CIM_RegisteredProfile {
+};
+
+[Association]
+class CIM_ReferencedProfile {
+	[Key] CIM_RegisteredProfile REF Antecedent;
+	[Key] CIM_RegisteredProfile REF Dependent;
+};
+
+[Association]
+class CIM_ElementConformsToProfile {
+	[Key] CIM_RegisteredProfile REF ConformantStandard;
+	[Key] CIM_ManagedElement REF ManagedElement;
+};
+
+instance of CIM_RegisteredProfile as $cs {
+	InstanceID = "cs";
+	RegisteredOrganization = 2;
+	RegisteredName = "Computer System";
+	RegisteredVersion = "1.0.0";
+};
+
+instance of CIM_RegisteredProfile as $cpu {
+	InstanceID = "cpu";
+	RegisteredOrganization = 2;
+	RegisteredName = "CPU";
+	RegisteredVersion = "1.0.0";
+};
+
+instance of CIM_RegisteredProfile as $array {
+	InstanceID = "array";
+	RegisteredOrganization = 11;
+	RegisteredName = "Array";
+	RegisteredVersion = "1.5.0";
+};
+
+instance of CIM_RegisteredSubProfile as $ddl {
+	InstanceID = "ddl";
+	RegisteredOrganization = 11;
+	RegisteredName = "Disk Drive Lite";
+	RegisteredVersion = "1.5.0";
+};
+
+instance of CIM_RegisteredProfile {
+	InstanceID = "vendor";
+	RegisteredOrganization = 1;
+	OtherRegisteredOrganization = "Vendor";
+	RegisteredName = "Vendor Extension";
+	RegisteredVersion = "2.0";
+};
+
+instance of CIM_ReferencedProfile { Antecedent = $cpu; Dependent = $cs; };
+instance of CIM_ReferencedProfile { Antecedent = $array; Dependent = $ddl; };
+instance of CIM_ElementConformsToProfile {
+	ConformantStandard = $cs;
+	ManagedElement = "root/cimv2:Test_Computer.Name=\"c1\"";
+};
+`
+
+func TestDiscover(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/interop", interopMOF); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	tree, err := Discover(context.Background(), c, Options{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "root/interop" != tree.Namespace || 5 != len(tree.Profiles) {
+		t.Fatal(tree.Namespace, tree.Profiles)
+	}
+	if 3 != len(tree.Roots) {
+		t.Error(tree.Roots)
+	}
+
+	cs := tree.Find("dmtf", "computer system")
+	if 1 != len(cs) || "DMTF:Computer System:1.0.0" != cs[0].String() {
+		t.Fatal(cs)
+	}
+	if 1 != len(cs[0].Subprofiles) || "CPU" != cs[0].Subprofiles[0].Name {
+		t.Error(cs[0].Subprofiles)
+	}
+	if 1 != len(cs[0].CentralInstances) || "root/cimv2:Test_Computer.Name=\"c1\"" != cs[0].CentralInstances[0].String() {
+		t.Error(cs[0].CentralInstances)
+	}
+
+	array := tree.Find("SNIA", "Array")
+	if 1 != len(array) || 1 != len(array[0].Subprofiles) || "ddl" != array[0].Subprofiles[0].InstanceID {
+		t.Fatal(array)
+	}
+
+	if vendor := tree.Find("Vendor", "Vendor Extension"); 1 != len(vendor) {
+		t.Error(tree.Profiles)
+	}
+
+	tree, err = Discover(context.Background(), c, Options{Namespace: "root/interop", ReferenceDirection: DirectionDMTF})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if array := tree.Find("SNIA", "Array"); 1 != len(array) || 0 != len(array[0].Subprofiles) {
+		t.Error(array)
+	}
+}
+
+func TestDiscoverNamespace(t *testing.T) {
+	m := wbemtest.New()
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	tree, err := Discover(context.Background(), c, Options{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "root/interop" != tree.Namespace || 0 != len(tree.Profiles) {
+		t.Error(tree.Namespace, tree.Profiles)
+	}
+
+	if _, err := Discover(context.Background(), c, Options{Namespace: "vendor/interop"}); nil == err {
+		t.Error("error is excepted")
+	} else if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_INVALID_NAMESPACE != code {
+		t.Error(err)
+	}
+}
+
+func TestOrganization(t *testing.T) {
+	for _, test := range []struct {
+		value, other, excepted string
+	}{
+		{"2", "", "DMTF"},
+		{"11", "", "SNIA"},
+		{"1", "Acme", "Acme"},
+		{"1", "", "Other"},
+		{"32768", "", "32768"},
+	} {
+		if actual := Organization(test.value, test.other); test.excepted != actual {
+			t.Errorf("%s: excepted is %s, actual is %s", test.value, test.excepted, actual)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package gowbem
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Quirks adjusts the requests and the tolerance of the responses to the
+// bugs of a server. The quirks are selected by Probe from the vendor of
+// CIM_ObjectManager unless they are set by Client.SetQuirks.
+type Quirks struct {
+	// Name is the name of the profile, such as VendorPegasus.
+	Name string
+
+	// ContentType is the Content-Type of the requests. The client sends
+	// application/xml and retries the first request with text/xml if it
+	// is empty.
+	ContentType string
+
+	// OmitLocalOnly are the classes which LocalOnly=true isn't sent for by
+	// GetInstance and EnumerateInstances, LocalOnly=false is always sent.
+	OmitLocalOnly []string
+
+	// BareInstances accepts INSTANCE instead of VALUE.NAMEDINSTANCE in
+	// the response of EnumerateInstances, the instance names are built
+	// from the key properties of the class.
+	BareInstances bool
+
+	// InteropNamespaces are probed before the well-known
+	// InteropNamespaces.
+	InteropNamespaces []string
+
+	// Namespaces are the namespaces which are served but aren't
+	// published, they are added to the result of DiscoverNamespaces.
+	Namespaces []string
+}
+
+// DefaultQuirks are the quirks of the unknown servers.
+var DefaultQuirks = &Quirks{}
+
+// QuirkProfiles are the quirks of the vendors returned by Probe.
+var QuirkProfiles = map[string]*Quirks{
+	VendorPegasus: {
+		Name:              VendorPegasus,
+		InteropNamespaces: []string{"root/PG_InterOp", "root/interop", "root/PG_Internal"},
+	},
+	VendorSFCB: {
+		Name: VendorSFCB,
+		// the classes of the interop provider of sfcb.
+		OmitLocalOnly: []string{"CIM_ObjectManager", "CIM_ObjectManagerCommunicationMechanism",
+			"CIM_Namespace", "CIM_IndicationFilter", "CIM_IndicationSubscription", "CIM_ListenerDestinationCIMXML"},
+		InteropNamespaces: []string{"root/interop"},
+	},
+	VendorESXi: {
+		Name:              VendorESXi,
+		InteropNamespaces: []string{"root/interop"},
+		Namespaces:        []string{"root/interop", "root/cimv2", "vmware/esxv2"},
+	},
+	VendorWMI: {
+		Name:              VendorWMI,
+		ContentType:       `text/xml; charset="utf-8"`,
+		BareInstances:     true,
+		InteropNamespaces: []string{"root/interop", "interop"},
+	},
+}
+
+// QuirksFor returns the quirks of the vendor, DefaultQuirks is returned if
+// the vendor is unknown.
+func QuirksFor(vendor string) *Quirks {
+	for name, quirks := range QuirkProfiles {
+		if strings.EqualFold(name, vendor) {
+			return quirks
+		}
+	}
+	return DefaultQuirks
+}
+
+// omitLocalOnly returns true if LocalOnly isn't sent for the class.
+func (q *Quirks) omitLocalOnly(className string) bool {
+	for _, name := range q.OmitLocalOnly {
+		if strings.EqualFold(name, className) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutParamValue removes the parameter from the parameters.
+func withoutParamValue(paramValues []CimIParamValue, name string) []CimIParamValue {
+	results := paramValues[:0]
+	for _, pv := range paramValues {
+		if !strings.EqualFold(pv.Name, name) {
+			results = append(results, pv)
+		}
+	}
+	return results
+}
+
+type quirksValue struct {
+	quirks   *Quirks
+	explicit bool
+}
+
+// Quirks returns the quirks of the client, DefaultQuirks is returned if
+// they are neither set nor selected by Probe.
+func (c *Client) Quirks() *Quirks {
+	if v, ok := c.quirks.Load().(quirksValue); ok && nil != v.quirks {
+		return v.quirks
+	}
+	return DefaultQuirks
+}
+
+// SetQuirks sets the quirks explicitly, Probe doesn't change them then.
+// The quirks are selected by Probe again if quirks is nil.
+func (c *Client) SetQuirks(quirks *Quirks) {
+	c.quirks.Store(quirksValue{quirks: quirks, explicit: nil != quirks})
+}
+
+// selectQuirks sets the quirks of the vendor if they aren't set explicitly.
+func (c *Client) selectQuirks(vendor string) {
+	if v, ok := c.quirks.Load().(quirksValue); ok && v.explicit {
+		return
+	}
+	c.quirks.Store(quirksValue{quirks: QuirksFor(vendor)})
+}
+
+// interopNamespaces returns the interop namespaces of the quirks and
+// InteropNamespaces.
+func (c *Client) interopNamespaces() []string {
+	quirks := c.Quirks()
+	if 0 == len(quirks.InteropNamespaces) {
+		return InteropNamespaces
+	}
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, list := range [][]string{quirks.InteropNamespaces, InteropNamespaces} {
+		for _, ns := range list {
+			if key := strings.ToLower(strings.Trim(ns, "/")); !seen[key] {
+				seen[key] = true
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	return namespaces
+}
+
+// headerError returns the error in the CIMError and PGErrorDetail headers,
+// the detail of Pegasus is "CIM_ERR_xxx: description" which is returned as
+// a WBEMException.
+func headerError(status, cimError, errorDetail string) error {
+	if detail, err := url.QueryUnescape(errorDetail); nil == err {
+		errorDetail = detail
+	}
+	for code, name := range CIMStatusCodes {
+		if prefix := name + ":"; 0 != code && strings.HasPrefix(errorDetail, prefix) {
+			return WBEMException(CIMStatusCode(code), strings.TrimSpace(strings.TrimPrefix(errorDetail, prefix)))
+		}
+	}
+	if "" == cimError {
+		if "" != errorDetail {
+			return errors.New(errorDetail)
+		}
+		return errors.New(status)
+	}
+	if "" != errorDetail {
+		return errors.New(cimError + ": " + errorDetail)
+	}
+	return errors.New(cimError)
+}
+
+// bareInstanceNames builds the names of the instances from the key
+// properties of the classes, see Quirks.BareInstances.
+func (c *ClientCIMXML) bareInstanceNames(ctx context.Context, namespaceName string, instances []CimInstance) ([]CIMInstanceWithName, error) {
+	results := make([]CIMInstanceWithName, 0, len(instances))
+	for idx := range instances {
+		instance := &instances[idx]
+		keys, err := c.Schema().KeyProperties(ctx, namespaceName, instance.ClassName)
+		if nil != err {
+			return nil, err
+		}
+		if 0 == len(keys) {
+			return nil, WBEMException(CIM_ERR_INVALID_CLASS,
+				"keys of the class '"+instance.ClassName+"' aren't found.")
+		}
+		named := &CimValueNamedInstance{Instance: *instance}
+		named.InstanceName.ClassName = instance.ClassName
+		for _, key := range keys {
+			pr := findAnyProperty(instance.Properties, key)
+			if nil == pr {
+				return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+					"key property '"+key+"' of the class '"+instance.ClassName+"' is missing.")
+			}
+			switch {
+			case nil != pr.Property:
+				value := ""
+				if nil != pr.Property.Value {
+					value = pr.Property.Value.Value
+				}
+				named.InstanceName.KeyBindings = append(named.InstanceName.KeyBindings, CimKeyBinding{
+					Name:     pr.Property.Name,
+					KeyValue: &CimKeyValue{ValueType: keyValueTypeOf(pr.Property.Type), Value: value},
+				})
+			case nil != pr.PropertyReference:
+				named.InstanceName.KeyBindings = append(named.InstanceName.KeyBindings, CimKeyBinding{
+					Name:           pr.PropertyReference.Name,
+					ValueReference: pr.PropertyReference.ValueReference,
+				})
+			default:
+				return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+					"key property '"+key+"' of the class '"+instance.ClassName+"' is an array.")
+			}
+		}
+		results = append(results, named)
+	}
+	return results, nil
+}
+
+// keyValueTypeOf returns the VALUETYPE of the KEYVALUE for the CIM type.
+func keyValueTypeOf(typ string) string {
+	switch strings.ToLower(typ) {
+	case "boolean":
+		return "boolean"
+	case "string", "char16", "datetime", "":
+		return "string"
+	}
+	return "numeric"
+}
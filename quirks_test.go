@@ -0,0 +1,205 @@
+package gowbem_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestQuirks(t *testing.T) {
+	// the recordings are synthetic, see testfiles/quirks/README.md
+	sfcb := &Quirks{Name: VendorSFCB, OmitLocalOnly: []string{"Test_Disk"}}
+	disk := &CimInstanceName{ClassName: "Test_Disk", KeyBindings: CimKeyBindings{
+		{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d1"}}}}
+
+	for _, test := range []struct {
+		name      string
+		recording string
+		quirks    *Quirks
+		check     func(t *testing.T, ctx context.Context, c *ClientCIMXML)
+	}{
+		{name: "pegasus", recording: "pegasus.json", quirks: QuirksFor(VendorPegasus),
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				names, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "Test_Disk")
+				if nil != err {
+					t.Fatal(err)
+				}
+				if 2 != len(names) {
+					t.Error(names)
+				}
+				_, err = c.EnumerateInstanceNames(ctx, "root/cimv2", "Test_Missing")
+				if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_INVALID_CLASS != code {
+					t.Error("want CIM_ERR_INVALID_CLASS, got", err)
+				}
+			}},
+		{name: "sfcb", recording: "sfcb.json", quirks: sfcb,
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				for _, localOnly := range []bool{true, false} {
+					instances, err := c.EnumerateInstances(ctx, "root/cimv2", "Test_Disk", true, localOnly, false, false, nil)
+					if nil != err {
+						t.Fatal(err)
+					}
+					if 2 != len(instances) {
+						t.Error(instances)
+					}
+					instance, err := c.GetInstanceByInstanceName(ctx, "root/cimv2", disk, localOnly, false, false, nil)
+					if nil != err {
+						t.Fatal(err)
+					}
+					if "d1" != propertyValue(instance, "DeviceID") {
+						t.Errorf("%#v", instance)
+					}
+				}
+			}},
+		{name: "sfcb with LocalOnly", recording: "sfcb.json", quirks: DefaultQuirks,
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				_, err := c.EnumerateInstances(ctx, "root/cimv2", "Test_Disk", true, true, false, false, nil)
+				if !IsErrNotSupported(err) {
+					t.Error("want CIM_ERR_NOT_SUPPORTED, got", err)
+				}
+				_, err = c.GetInstanceByInstanceName(ctx, "root/cimv2", disk, true, false, false, nil)
+				if !IsErrNotSupported(err) {
+					t.Error("want CIM_ERR_NOT_SUPPORTED, got", err)
+				}
+			}},
+		{name: "esxi", recording: "esxi.json", quirks: QuirksFor(VendorESXi),
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				var first string
+				result, err := c.DiscoverNamespaces(ctx, &NamespaceDiscoveryOptions{OnEvent: func(event NamespaceEvent) {
+					if "" == first {
+						first = event.Namespace
+					}
+				}})
+				if nil != err {
+					t.Fatal(err)
+				}
+				if "root/interop" != first {
+					t.Error("first probed namespace is", first)
+				}
+				found := map[string]string{}
+				for _, ns := range result.Namespaces {
+					found[ns.Name] = ns.SourceClass
+				}
+				if 3 != len(found) || "CIM_Namespace" != found["root/cimv2"] || "Quirks" != found["vmware/esxv2"] {
+					t.Error(found)
+				}
+			}},
+		{name: "wmi", recording: "wmi.json", quirks: QuirksFor(VendorWMI),
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				instances, err := c.EnumerateInstances(ctx, "root/cimv2", "Test_Disk", true, false, false, false, nil)
+				if nil != err {
+					t.Fatal(err)
+				}
+				if 2 != len(instances) {
+					t.Fatal(instances)
+				}
+				name := instances[0].GetName()
+				if "Test_Disk" != name.GetClassName() || "d1" != name.GetKeyBindings().Get(0).GetValue() {
+					t.Errorf("%#v", name)
+				}
+				if "2048" != propertyValue(instances[1].GetInstance(), "Size") {
+					t.Errorf("%#v", instances[1])
+				}
+			}},
+		{name: "wmi without bare instances", recording: "wmi.json", quirks: DefaultQuirks,
+			check: func(t *testing.T, ctx context.Context, c *ClientCIMXML) {
+				_, err := c.EnumerateInstances(ctx, "root/cimv2", "Test_Disk", true, false, false, false, nil)
+				if !IsEmptyResults(err) {
+					t.Error("want empty results, got", err)
+				}
+			}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recording, err := LoadRecordingFile("testfiles/quirks/synthetic-" + test.recording)
+			if nil != err {
+				t.Fatal(err)
+			}
+			c := replayClient(t, recording, MatchStrict)
+			replayer := c.Transport
+			contentTypes := map[string]bool{}
+			c.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				contentTypes[req.Header.Get("Content-Type")] = true
+				return replayer.RoundTrip(req)
+			})
+			c.SetQuirks(test.quirks)
+			if test.quirks != c.Quirks() {
+				t.Fatal("quirks isn't set")
+			}
+
+			test.check(t, context.Background(), c)
+
+			if "" != test.quirks.ContentType && (1 != len(contentTypes) || !contentTypes[test.quirks.ContentType]) {
+				t.Error("content types are", contentTypes)
+			}
+		})
+	}
+
+	if DefaultQuirks != QuirksFor("unknown") {
+		t.Error("want default quirks")
+	}
+}
+
+func TestProbeSelectsQuirks(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/interop", interopMOF+`
+instance of CIM_ObjectManager {
+	CreationClassName = "CIM_ObjectManager";
+	Name = "sfcb:1";
+	Description = "Small Footprint CIM Broker 1.4.9";
+};`); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.Probe(ctx); nil != err {
+		t.Fatal(err)
+	}
+	if QuirksFor(VendorSFCB) != c.Quirks() {
+		t.Fatal("quirks isn't selected,", c.Quirks().Name)
+	}
+
+	for _, test := range []struct {
+		className string
+		localOnly string
+	}{
+		{className: "CIM_ObjectManager", localOnly: ""},
+		{className: "CIM_ObjectManagerCommunicationMechanism", localOnly: ""},
+		{className: "PG_ObjectManager", localOnly: "true"},
+	} {
+		m.ResetRequests()
+		_, err := c.EnumerateInstances(ctx, "root/interop", test.className, true, true, false, false, nil)
+		if nil != err && !IsEmptyResults(err) {
+			t.Fatal(err)
+		}
+		requests := m.Requests()
+		if 1 != len(requests) {
+			t.Fatal(requests)
+		}
+		if localOnly := requests[0].StringParam("LocalOnly"); !strings.EqualFold(test.localOnly, localOnly) {
+			t.Errorf("%s: excepted is %q, actual is %q", test.className, test.localOnly, localOnly)
+		}
+	}
+}
+
+func propertyValue(instance CIMInstance, name string) interface{} {
+	pr := instance.GetPropertyByName(name)
+	if nil == pr {
+		return nil
+	}
+	return pr.GetValue()
+}
@@ -0,0 +1,371 @@
+package gowbem
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RecordingVersion is the version of the recording format.
+const RecordingVersion = 1
+
+// RecordedOperation identifies an operation of a recorded request, Params
+// holds the XML of every parameter, so the matching doesn't depend on the
+// order of the parameters.
+type RecordedOperation struct {
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	ClassName  string            `json:"class_name,omitempty"`
+	ObjectName string            `json:"object_name,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+type RecordedResponse struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Interaction is a recorded request/response pair.
+type Interaction struct {
+	Operations []RecordedOperation `json:"operations"`
+	Request    RecordedRequest     `json:"request"`
+	Response   RecordedResponse    `json:"response"`
+}
+
+// Recording is a captured session, it is saved as JSON.
+type Recording struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+func LoadRecording(r io.Reader) (*Recording, error) {
+	var recording Recording
+	if err := json.NewDecoder(r).Decode(&recording); nil != err {
+		return nil, err
+	}
+	if recording.Version > RecordingVersion {
+		return nil, errors.New("version of the recording is unsupported.")
+	}
+	return &recording, nil
+}
+
+func LoadRecordingFile(filename string) (*Recording, error) {
+	f, err := os.Open(filename)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadRecording(f)
+}
+
+func (recording *Recording) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(recording)
+}
+
+func (recording *Recording) SaveFile(filename string) error {
+	var buf bytes.Buffer
+	if err := recording.Save(&buf); nil != err {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// recordOperations decodes the request body into the recorded operations,
+// it returns nil if the body isn't a CIM operation request.
+func recordOperations(body []byte) []RecordedOperation {
+	var cim CIM
+	if err := xml.Unmarshal(body, &cim); nil != err {
+		return nil
+	}
+	operations, err := ParseOperations(&cim)
+	if nil != err {
+		return nil
+	}
+
+	results := make([]RecordedOperation, 0, len(operations))
+	for _, op := range operations {
+		recorded := RecordedOperation{
+			Name:      op.Name,
+			Namespace: strings.Trim(strings.Replace(op.Namespace, "\\", "/", -1), "/"),
+			Params:    map[string]string{},
+		}
+		if nil != op.ObjectName {
+			recorded.ClassName = op.ObjectName.ClassName
+			recorded.ObjectName = op.ObjectName.String()
+		} else {
+			for _, name := range []string{"ClassName", "InstanceName", "ObjectName"} {
+				if recorded.ClassName = op.ClassNameParam(name); "" != recorded.ClassName {
+					break
+				}
+			}
+			for _, name := range []string{"InstanceName", "ObjectName"} {
+				if instanceName := op.InstanceNameParam(name); nil != instanceName {
+					recorded.ObjectName = instanceName.String()
+					break
+				}
+			}
+		}
+		for _, param := range op.IParamValues {
+			if bs, err := xml.Marshal(param); nil == err {
+				recorded.Params[strings.ToLower(param.Name)] = string(bs)
+			}
+		}
+		for _, param := range op.ParamValues {
+			if bs, err := xml.Marshal(param); nil == err {
+				recorded.Params[strings.ToLower(param.Name)] = string(bs)
+			}
+		}
+		results = append(results, recorded)
+	}
+	return results
+}
+
+// recordedHeaders returns the headers without the credentials.
+func recordedHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for key, values := range header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Authorization", "Cookie", "Set-Cookie", "Www-Authenticate", "Content-Length", "Date":
+			continue
+		}
+		if 0 != len(values) {
+			headers[http.CanonicalHeaderKey(key)] = values[0]
+		}
+	}
+	return headers
+}
+
+// Recorder is a http.RoundTripper that records the requests and their
+// responses, set it as the Transport of the client:
+//
+//	recorder := gowbem.NewRecorder(c.Transport)
+//	c.Transport = recorder
+//	... // call the client
+//	recorder.Recording().SaveFile("session.json")
+type Recorder struct {
+	transport http.RoundTripper
+
+	mu        sync.Mutex
+	recording Recording
+}
+
+// NewRecorder returns a Recorder that sends the requests with transport,
+// http.DefaultTransport is used if transport is nil.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if nil == transport {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport, recording: Recording{Version: RecordingVersion}}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if nil != req.Body {
+		bs, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if nil != err {
+			return nil, err
+		}
+		reqBody = bs
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if nil != err {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if nil != err {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Operations: recordOperations(reqBody),
+		Request: RecordedRequest{
+			Method:  req.Method,
+			Headers: recordedHeaders(req.Header),
+			Body:    string(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    recordedHeaders(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.recording.Interactions = append(r.recording.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Recording returns a copy of the recorded session.
+func (r *Recorder) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Recording{
+		Version:      r.recording.Version,
+		Interactions: append([]Interaction(nil), r.recording.Interactions...),
+	}
+}
+
+// MatchMode is how the Replayer matches the requests with the recording.
+type MatchMode int
+
+const (
+	// MatchStrict requires the same operations, namespaces, object names
+	// and parameters. The recorded responses of the same request are
+	// served in turn.
+	MatchStrict MatchMode = iota
+
+	// MatchFuzzy requires the same operations, namespaces and target
+	// classes, the interaction that has the most equal parameters wins.
+	MatchFuzzy
+)
+
+// Replayer is a http.RoundTripper that serves the recorded responses
+// without a server.
+type Replayer struct {
+	Mode MatchMode
+
+	mu        sync.Mutex
+	recording *Recording
+	served    []int
+}
+
+func NewReplayer(recording *Recording, mode MatchMode) *Replayer {
+	return &Replayer{
+		Mode:      mode,
+		recording: recording,
+		served:    make([]int, len(recording.Interactions)),
+	}
+}
+
+func NewReplayerFromFile(filename string, mode MatchMode) (*Replayer, error) {
+	recording, err := LoadRecordingFile(filename)
+	if nil != err {
+		return nil, err
+	}
+	return NewReplayer(recording, mode), nil
+}
+
+// score returns how well the recorded operations match the request, it
+// returns -1 if they don't match.
+func (r *Replayer) score(recorded, requested []RecordedOperation) int {
+	if len(recorded) != len(requested) {
+		return -1
+	}
+
+	total := 0
+	for idx := range recorded {
+		a, b := &recorded[idx], &requested[idx]
+		if !strings.EqualFold(a.Name, b.Name) || !strings.EqualFold(a.Namespace, b.Namespace) {
+			return -1
+		}
+
+		if MatchStrict == r.Mode {
+			if a.ObjectName != b.ObjectName || len(a.Params) != len(b.Params) {
+				return -1
+			}
+			for name, value := range a.Params {
+				if b.Params[name] != value {
+					return -1
+				}
+			}
+			continue
+		}
+
+		if !strings.EqualFold(a.ClassName, b.ClassName) {
+			return -1
+		}
+		if a.ObjectName == b.ObjectName {
+			total++
+		}
+		for name, value := range a.Params {
+			if b.Params[name] == value {
+				total++
+			}
+		}
+	}
+	return total
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if nil != req.Body {
+		bs, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if nil != err {
+			return nil, err
+		}
+		reqBody = bs
+	}
+
+	requested := recordOperations(reqBody)
+	if nil == requested {
+		return nil, errors.New("replay: request isn't a CIM operation request.")
+	}
+
+	r.mu.Lock()
+	found, foundScore := -1, -1
+	for idx := range r.recording.Interactions {
+		score := r.score(r.recording.Interactions[idx].Operations, requested)
+		if score < 0 {
+			continue
+		}
+		// the interactions that have been served less win the tie, so
+		// the responses of the same request are served in order.
+		if score > foundScore || (score == foundScore && r.served[idx] < r.served[found]) {
+			found, foundScore = idx, score
+		}
+	}
+	if found >= 0 {
+		r.served[found]++
+	}
+	r.mu.Unlock()
+
+	if found < 0 {
+		var names []string
+		for _, op := range requested {
+			names = append(names, op.Name+"("+op.Namespace+")")
+		}
+		return nil, errors.New("replay: no recorded response matches " + strings.Join(names, ", ") + ".")
+	}
+
+	recorded := &r.recording.Interactions[found].Response
+	resp := &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+	for key, value := range recorded.Headers {
+		resp.Header.Set(key, value)
+	}
+	return resp, nil
+}
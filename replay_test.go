@@ -0,0 +1,122 @@
+package gowbem_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+func recordSession(t *testing.T) *Recording {
+	m := wbemtest.New()
+	m.AddClass("root/cimv2", &CimClass{Name: "Test_Disk",
+		Properties: []CimAnyProperty{{Property: &CimProperty{Name: "DeviceID", Type: "string",
+			Qualifiers: []CimQualifier{{Name: "Key", Type: "boolean", Value: &CimValue{Value: "true"}}}}},
+			{Property: &CimProperty{Name: "Size", Type: "uint64"}}}})
+	for _, id := range []string{"d1", "d2"} {
+		if _, err := m.AddInstanceValues("root/cimv2", "Test_Disk",
+			map[string]interface{}{"DeviceID": id, "Size": uint64(512)}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	recorder := NewRecorder(c.Transport)
+	c.Transport = recorder
+
+	ctx := context.Background()
+	names, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "Test_Disk")
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := c.GetInstanceByInstanceName(ctx, "root/cimv2", name, false, false, false, nil); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.Recording().Save(&buf); nil != err {
+		t.Fatal(err)
+	}
+	recording, err := LoadRecording(&buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return recording
+}
+
+func replayClient(t *testing.T, recording *Recording, mode MatchMode) *ClientCIMXML {
+	c, err := NewClientCIMXML(&url.URL{Scheme: "http", Host: "replay.invalid:5988", Path: "/cimom"}, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	c.Transport = NewReplayer(recording, mode)
+	return c
+}
+
+func TestReplayStrict(t *testing.T) {
+	recording := recordSession(t)
+	if 3 != len(recording.Interactions) {
+		t.Fatal("want 3 interactions, got", len(recording.Interactions))
+	}
+	if op := recording.Interactions[1].Operations[0]; "GetInstance" != op.Name ||
+		"root/cimv2" != op.Namespace || "Test_Disk" != op.ClassName {
+		t.Error(op)
+	}
+
+	c := replayClient(t, recording, MatchStrict)
+	ctx := context.Background()
+
+	names, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "Test_Disk")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) {
+		t.Fatal(names)
+	}
+	instance, err := c.GetInstanceByInstanceName(ctx, "root/cimv2", names[1], false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "d2" != instance.GetPropertyByName("DeviceID").GetValue() {
+		t.Error(instance)
+	}
+
+	_, err = c.GetInstanceByInstanceName(ctx, "root/cimv2", names[1], false, false, false, []string{"Size"})
+	if nil == err || !strings.Contains(err.Error(), "no recorded response") {
+		t.Error("want no recorded response, got", err)
+	}
+	_, err = c.EnumerateInstanceNames(ctx, "root/other", "Test_Disk")
+	if nil == err || !strings.Contains(err.Error(), "no recorded response") {
+		t.Error("want no recorded response, got", err)
+	}
+}
+
+func TestReplayFuzzy(t *testing.T) {
+	c := replayClient(t, recordSession(t), MatchFuzzy)
+	ctx := context.Background()
+
+	name, _ := ParseInstanceName(`Test_Disk.DeviceID="d2"`)
+	instance, err := c.GetInstanceByInstanceName(ctx, "root/cimv2", name, true, false, false, []string{"Size"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "d2" != instance.GetPropertyByName("DeviceID").GetValue() {
+		t.Error("want the closest instance, got", instance)
+	}
+
+	_, err = c.EnumerateInstanceNames(ctx, "root/cimv2", "Test_Other")
+	if nil == err {
+		t.Error("the class should be matched")
+	}
+}
@@ -0,0 +1,396 @@
+package gowbem
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrSchemaStale is returned by SchemaCache.Load if the cache is saved from
+// a different server, the cache is discarded.
+var ErrSchemaStale = errors.New("schema cache is saved from a different server")
+
+// SchemaCache caches the classes of the namespaces, the classes are loaded
+// lazily and the inherited features are merged into the classes, so a
+// class is fetched only once from the server.
+type SchemaCache struct {
+	c *ClientCIMXML
+
+	mu         sync.Mutex
+	identity   string
+	namespaces map[string]*namespaceSchema
+}
+
+type namespaceSchema struct {
+	classes    map[string]*CimClass
+	subclasses map[string][]string
+}
+
+// NewSchemaCache creates a schema cache of the client, ClientCIMXML.Schema
+// returns the cache shared by the client.
+func NewSchemaCache(c *ClientCIMXML) *SchemaCache {
+	return &SchemaCache{c: c, namespaces: map[string]*namespaceSchema{}}
+}
+
+// Schema returns the schema cache of the client.
+func (c *ClientCIMXML) Schema() *SchemaCache {
+	c.schemaOnce.Do(func() {
+		c.schema = NewSchemaCache(c)
+	})
+	return c.schema
+}
+
+func schemaKey(name string) string {
+	return strings.ToLower(strings.Trim(name, "/"))
+}
+
+func (s *SchemaCache) namespace(namespaceName string) *namespaceSchema {
+	key := schemaKey(namespaceName)
+	ns := s.namespaces[key]
+	if nil == ns {
+		ns = &namespaceSchema{classes: map[string]*CimClass{}, subclasses: map[string][]string{}}
+		s.namespaces[key] = ns
+	}
+	return ns
+}
+
+func (s *SchemaCache) cachedClass(namespaceName, className string) *CimClass {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.namespace(namespaceName).classes[strings.ToLower(className)]
+}
+
+// Invalidate removes the classes of the namespace, all of the namespaces
+// are removed if namespaceName is empty.
+func (s *SchemaCache) Invalidate(namespaceName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if "" == namespaceName {
+		s.namespaces = map[string]*namespaceSchema{}
+		return
+	}
+	delete(s.namespaces, schemaKey(namespaceName))
+}
+
+// GetClass returns the class with the inherited properties, methods and
+// qualifiers, the returned class is shared and must not be modified.
+func (s *SchemaCache) GetClass(ctx context.Context, namespaceName, className string) (*CimClass, error) {
+	return s.getClass(ctx, namespaceName, className, map[string]bool{})
+}
+
+func (s *SchemaCache) getClass(ctx context.Context, namespaceName, className string, visiting map[string]bool) (*CimClass, error) {
+	if class := s.cachedClass(namespaceName, className); nil != class {
+		return class, nil
+	}
+
+	key := strings.ToLower(className)
+	if visiting[key] {
+		return nil, errors.New("class '" + className + "' is a superclass of itself")
+	}
+	visiting[key] = true
+
+	got, err := s.c.GetClass(ctx, namespaceName, className, true, true, true, nil)
+	if nil != err {
+		return nil, err
+	}
+	class := *got
+	localClass(&class)
+
+	if "" != class.SuperClass {
+		super, err := s.getClass(ctx, namespaceName, class.SuperClass, visiting)
+		if nil != err {
+			return nil, err
+		}
+		if err := InheritClass(&class, super); nil != err {
+			return nil, errors.New("class '" + className + "' is invalid, " + err.Error())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := s.namespace(namespaceName)
+	if exists := ns.classes[key]; nil != exists {
+		return exists, nil
+	}
+	ns.classes[key] = &class
+	return &class, nil
+}
+
+// localClass removes the propagated features since some servers ignore
+// LocalOnly, and sets the class origin of the local features.
+func localClass(class *CimClass) {
+	qualifiers := class.Qualifiers[:0]
+	for _, q := range class.Qualifiers {
+		if !q.Propagated {
+			qualifiers = append(qualifiers, q)
+		}
+	}
+	class.Qualifiers = qualifiers
+
+	properties := class.Properties[:0]
+	for _, pr := range class.Properties {
+		switch {
+		case nil != pr.Property:
+			if pr.Property.Propagated {
+				continue
+			}
+			if "" == pr.Property.ClassOrigin {
+				pr.Property.ClassOrigin = class.Name
+			}
+		case nil != pr.PropertyArray:
+			if pr.PropertyArray.Propagated {
+				continue
+			}
+			if "" == pr.PropertyArray.ClassOrigin {
+				pr.PropertyArray.ClassOrigin = class.Name
+			}
+		case nil != pr.PropertyReference:
+			if pr.PropertyReference.Propagated {
+				continue
+			}
+			if "" == pr.PropertyReference.ClassOrigin {
+				pr.PropertyReference.ClassOrigin = class.Name
+			}
+		default:
+			continue
+		}
+		properties = append(properties, pr)
+	}
+	class.Properties = properties
+
+	methods := class.Methods[:0]
+	for _, method := range class.Methods {
+		if method.Propagated {
+			continue
+		}
+		if "" == method.ClassOrigin {
+			method.ClassOrigin = class.Name
+		}
+		methods = append(methods, method)
+	}
+	class.Methods = methods
+}
+
+// SuperClasses returns the superclass chain of the class, the direct
+// superclass is the first.
+func (s *SchemaCache) SuperClasses(ctx context.Context, namespaceName, className string) ([]string, error) {
+	var names []string
+	for {
+		class, err := s.GetClass(ctx, namespaceName, className)
+		if nil != err {
+			return nil, err
+		}
+		if "" == class.SuperClass {
+			return names, nil
+		}
+		names = append(names, class.SuperClass)
+		className = class.SuperClass
+	}
+}
+
+// IsSubclassOf returns true if the class is the superClass or is derived
+// from the superClass.
+func (s *SchemaCache) IsSubclassOf(ctx context.Context, namespaceName, className, superClass string) (bool, error) {
+	if strings.EqualFold(className, superClass) {
+		return true, nil
+	}
+	names, err := s.SuperClasses(ctx, namespaceName, className)
+	if nil != err {
+		return false, err
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, superClass) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Subclasses returns the names of the subclasses of the class, the direct
+// subclasses are returned if deep is false, the root classes are returned
+// if className is empty.
+func (s *SchemaCache) Subclasses(ctx context.Context, namespaceName, className string, deep bool) ([]string, error) {
+	key := strings.ToLower(className) + "|" + fmt.Sprint(deep)
+	s.mu.Lock()
+	names, ok := s.namespace(namespaceName).subclasses[key]
+	s.mu.Unlock()
+	if ok {
+		return names, nil
+	}
+
+	names, err := s.c.EnumerateClassNames(ctx, namespaceName, className, deep)
+	if nil != err {
+		if !IsEmptyResults(err) {
+			return nil, err
+		}
+		names = []string{}
+	}
+
+	s.mu.Lock()
+	s.namespace(namespaceName).subclasses[key] = names
+	s.mu.Unlock()
+	return names, nil
+}
+
+// KeyProperties returns the names of the properties with the Key qualifier.
+func (s *SchemaCache) KeyProperties(ctx context.Context, namespaceName, className string) ([]string, error) {
+	class, err := s.GetClass(ctx, namespaceName, className)
+	if nil != err {
+		return nil, err
+	}
+	var names []string
+	for _, pr := range class.Properties {
+		for _, q := range anyPropertyQualifiers(pr) {
+			if strings.EqualFold("Key", q.Name) && (nil == q.Value || strings.EqualFold("true", strings.TrimSpace(q.Value.Value))) {
+				names = append(names, anyPropertyName(pr))
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// Identity returns the identity of the server, it is the host of the url
+// and the name and the description of CIM_ObjectManager if it is found in
+// the interop namespaces.
+func (s *SchemaCache) Identity(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	identity := s.identity
+	s.mu.Unlock()
+	if "" != identity {
+		return identity, nil
+	}
+
+	identity = strings.ToLower(s.c.u.Host)
+	for _, ns := range s.c.interopNamespaces() {
+		instances, err := s.c.EnumerateInstances(ctx, ns, "CIM_ObjectManager", true, false, false, false, []string{"Name", "Description"})
+		if nil != err {
+			if ctx.Err() != nil {
+				return "", err
+			}
+			continue
+		}
+		if 0 == len(instances) {
+			continue
+		}
+		for _, name := range []string{"Name", "Description"} {
+			if pr := instances[0].GetInstance().GetPropertyByName(name); nil != pr && nil != pr.GetValue() {
+				identity += "|" + fmt.Sprint(pr.GetValue())
+			}
+		}
+		break
+	}
+
+	s.mu.Lock()
+	s.identity = identity
+	s.mu.Unlock()
+	return identity, nil
+}
+
+type schemaFile struct {
+	Identity   string                     `json:"identity"`
+	Namespaces map[string]schemaNamespace `json:"namespaces"`
+}
+
+type schemaNamespace struct {
+	Classes    []string            `json:"classes"`
+	Subclasses map[string][]string `json:"subclasses,omitempty"`
+}
+
+// Save writes the cache as json, the classes are encoded as CIM-XML.
+func (s *SchemaCache) Save(ctx context.Context, w io.Writer) error {
+	identity, err := s.Identity(ctx)
+	if nil != err {
+		return err
+	}
+
+	file := schemaFile{Identity: identity, Namespaces: map[string]schemaNamespace{}}
+	s.mu.Lock()
+	for name, ns := range s.namespaces {
+		saved := schemaNamespace{Subclasses: ns.subclasses}
+		for _, class := range ns.classes {
+			saved.Classes = append(saved.Classes, class.String())
+		}
+		file.Namespaces[name] = saved
+	}
+	bs, err := json.Marshal(&file)
+	s.mu.Unlock()
+	if nil != err {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+// Load reads the cache written by Save, ErrSchemaStale is returned and
+// nothing is loaded if the identity of the server is changed.
+func (s *SchemaCache) Load(ctx context.Context, r io.Reader) error {
+	var file schemaFile
+	if err := json.NewDecoder(r).Decode(&file); nil != err {
+		return err
+	}
+	identity, err := s.Identity(ctx)
+	if nil != err {
+		return err
+	}
+	if identity != file.Identity {
+		return ErrSchemaStale
+	}
+
+	namespaces := map[string]*namespaceSchema{}
+	for name, saved := range file.Namespaces {
+		ns := &namespaceSchema{classes: map[string]*CimClass{}, subclasses: saved.Subclasses}
+		if nil == ns.subclasses {
+			ns.subclasses = map[string][]string{}
+		}
+		for _, txt := range saved.Classes {
+			class := &CimClass{}
+			if err := xml.Unmarshal([]byte(txt), class); nil != err {
+				return err
+			}
+			ns.classes[strings.ToLower(class.Name)] = class
+		}
+		namespaces[name] = ns
+	}
+
+	s.mu.Lock()
+	for name, ns := range namespaces {
+		s.namespaces[name] = ns
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// SaveFile writes the cache to the file.
+func (s *SchemaCache) SaveFile(ctx context.Context, filename string) error {
+	out, err := os.Create(filename)
+	if nil != err {
+		return err
+	}
+	if err := s.Save(ctx, out); nil != err {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// LoadFile reads the cache from the file, it is ignored if the file isn't
+// exists, ErrSchemaStale is returned if the file is saved from a
+// different server.
+func (s *SchemaCache) LoadFile(ctx context.Context, filename string) error {
+	in, err := os.Open(filename)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+	return s.Load(ctx, in)
+}
@@ -0,0 +1,114 @@
+package gowbem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const schemaMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Abstract : boolean = false, Scope(class), Flavor(Restricted);
+Qualifier Description : string = null, Scope(any), Flavor(Translatable);
+
+[Abstract, Description("element")]
+class Test_Element {
+	[Key] string InstanceID;
+	[Description("caption")] string Caption;
+};
+
+class Test_Device : Test_Element {
+	[Description("device caption")] string Caption;
+	uint64 Size;
+};
+
+class Test_Disk : Test_Device {
+};
+`
+
+func TestSchemaCache(t *testing.T) {
+	m := wbemtest.New()
+	if err := m.LoadMOF("root/cimv2", schemaMOF); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	schema := c.Schema()
+	if schema != c.Schema() {
+		t.Error("schema isn't shared")
+	}
+
+	m.ResetRequests()
+	class, err := schema.GetClass(ctx, "root/cimv2", "Test_Disk")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(class.Properties) {
+		t.Fatal(class.String())
+	}
+	for _, q := range class.Qualifiers {
+		if "Abstract" == q.Name {
+			t.Error("restricted qualifier is inherited")
+		}
+	}
+	caption := class.Properties[0].Property
+	if "Caption" == class.Properties[1].Property.Name {
+		caption = class.Properties[1].Property
+	}
+	if "Test_Device" != caption.ClassOrigin || !caption.Propagated || "device caption" != caption.Qualifiers[0].Value.Value {
+		t.Errorf("%#v", caption)
+	}
+	if 3 != len(m.Requests()) {
+		t.Error(m.Requests())
+	}
+
+	m.ResetRequests()
+	if keys, err := schema.KeyProperties(ctx, "root/cimv2", "test_disk"); nil != err || 1 != len(keys) || "InstanceID" != keys[0] {
+		t.Error(keys, err)
+	}
+	if ok, err := schema.IsSubclassOf(ctx, "root/cimv2", "Test_Disk", "test_element"); nil != err || !ok {
+		t.Error(ok, err)
+	}
+	if ok, err := schema.IsSubclassOf(ctx, "root/cimv2", "Test_Element", "Test_Disk"); nil != err || ok {
+		t.Error(ok, err)
+	}
+	if 0 != len(m.Requests()) {
+		t.Error(m.Requests())
+	}
+	if names, err := schema.Subclasses(ctx, "root/cimv2", "Test_Element", true); nil != err || 2 != len(names) {
+		t.Error(names, err)
+	}
+	if names, err := schema.Subclasses(ctx, "root/cimv2", "Test_Element", false); nil != err || 1 != len(names) {
+		t.Error(names, err)
+	}
+
+	var buf strings.Builder
+	if err := schema.Save(ctx, &buf); nil != err {
+		t.Fatal(err)
+	}
+	m.ResetRequests()
+	loaded := NewSchemaCache(c)
+	if err := loaded.Load(ctx, strings.NewReader(buf.String())); nil != err {
+		t.Fatal(err)
+	}
+	m.ResetRequests()
+	if class, err := loaded.GetClass(ctx, "root/cimv2", "Test_Disk"); nil != err || 3 != len(class.Properties) {
+		t.Error(class, err)
+	}
+	if 0 != len(m.Requests()) {
+		t.Error(m.Requests())
+	}
+
+	stale := strings.Replace(buf.String(), `"identity":"`, `"identity":"old`, 1)
+	if err := NewSchemaCache(c).Load(ctx, strings.NewReader(stale)); ErrSchemaStale != err {
+		t.Error(err)
+	}
+}
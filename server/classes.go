@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+func hasQualifier(qualifiers []gowbem.CimQualifier, name string) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, name) {
+			return nil == q.Value || !strings.EqualFold(q.Value.Value, "false")
+		}
+	}
+	return false
+}
+
+func containsFold(names []string, name string) bool {
+	for _, s := range names {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// classAssociations serves the Associators, AssociatorNames, References and
+// ReferenceNames operations on a class, the results are computed from the
+// schema of the class provider.
+func (h *handler) classAssociations(ctx context.Context, className string, isReferences bool,
+	assocClass, resultClass, role, resultRole string, opts *Options) (*gowbem.CimIReturnValue, error) {
+	provider, err := h.classProvider()
+	if nil != err {
+		return nil, err
+	}
+	classes, err := provider.EnumerateClasses(ctx, h.np.name, "", true)
+	if nil != err {
+		return nil, err
+	}
+
+	ancestors := h.superClasses(ctx, className)
+	isA := func(name, base string) bool {
+		return "" == base || containsFold(h.superClasses(ctx, name), base)
+	}
+
+	var results []*gowbem.CimClass
+	appendClass := func(class *gowbem.CimClass) {
+		for _, c := range results {
+			if strings.EqualFold(c.Name, class.Name) {
+				return
+			}
+		}
+		results = append(results, class)
+	}
+
+	for idx := range classes {
+		class := &classes[idx]
+		if !hasQualifier(class.Qualifiers, "Association") {
+			continue
+		}
+
+		matched := false
+		for _, pr := range class.Properties {
+			if nil == pr.PropertyReference {
+				continue
+			}
+			if ("" == role || strings.EqualFold(role, pr.PropertyReference.Name)) &&
+				containsFold(ancestors, pr.PropertyReference.ReferenceClass) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if isReferences {
+			if isA(class.Name, resultClass) {
+				appendClass(class)
+			}
+			continue
+		}
+
+		if !isA(class.Name, assocClass) {
+			continue
+		}
+		for _, pr := range class.Properties {
+			if nil == pr.PropertyReference ||
+				("" != resultRole && !strings.EqualFold(resultRole, pr.PropertyReference.Name)) ||
+				("" != role && strings.EqualFold(role, pr.PropertyReference.Name)) {
+				continue
+			}
+			if !isA(pr.PropertyReference.ReferenceClass, resultClass) {
+				continue
+			}
+			target, err := provider.GetClass(ctx, h.np.name, pr.PropertyReference.ReferenceClass)
+			if nil != err {
+				return nil, err
+			}
+			appendClass(target)
+		}
+	}
+
+	returnValue := &gowbem.CimIReturnValue{}
+	for _, class := range results {
+		classPath := &gowbem.CimClassPath{
+			NamespacePath: h.namespacePath(),
+			ClassName:     gowbem.CimClassName{Name: class.Name},
+		}
+		if "AssociatorNames" == h.op.Name || "ReferenceNames" == h.op.Name {
+			returnValue.ObjectPaths = append(returnValue.ObjectPaths, gowbem.CimObjectPath{ClassPath: classPath})
+			continue
+		}
+		returnValue.ValueObjectWithPaths = append(returnValue.ValueObjectWithPaths, gowbem.CimValueObjectWithPath{
+			ClassPath: classPath,
+			Class:     FilterClass(class, opts),
+		})
+	}
+	return returnValue, nil
+}
+
+func (h *handler) methodProvider(ctx context.Context, className string) (MethodProvider, error) {
+	for _, name := range h.superClasses(ctx, className) {
+		h.server.mu.RLock()
+		provider := h.np.methods[strings.ToLower(name)]
+		h.server.mu.RUnlock()
+		if nil != provider {
+			return provider, nil
+		}
+	}
+
+	h.server.mu.RLock()
+	provider := h.np.methods[""]
+	h.server.mu.RUnlock()
+	if nil == provider {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_METHOD_NOT_AVAILABLE,
+			"method provider of the class '"+className+"' isn't found.")
+	}
+	return provider, nil
+}
+
+func (s *Server) invokeMethod(ctx context.Context, np *namespaceProviders, op *gowbem.Operation, rsp *gowbem.CimMethodResponse) error {
+	h := &handler{server: s, np: np, op: op}
+	provider, err := h.methodProvider(ctx, op.ObjectName.ClassName)
+	if nil != err {
+		return err
+	}
+	returnValue, outParams, err := provider.InvokeMethod(ctx, np.name, op.ObjectName, op.Name, op.ParamValues)
+	if nil != err {
+		return err
+	}
+	rsp.ReturnValue = returnValue
+	rsp.ParamValues = outParams
+	return nil
+}
+
+// FilterInstance returns a copy of the instance that only contains the
+// properties in the PropertyList, the qualifiers and the class origins are
+// removed unless they are requested.
+func FilterInstance(instance *gowbem.CimInstance, opts *Options) *gowbem.CimInstance {
+	if nil == opts {
+		return instance
+	}
+	copyed := *instance
+	if !opts.IncludeQualifiers {
+		copyed.Qualifiers = nil
+	}
+	copyed.Properties = filterProperties(instance.Properties, opts)
+	return &copyed
+}
+
+// FilterClass is same as FilterInstance, the LocalOnly option removes the
+// propagated properties and methods.
+func FilterClass(class *gowbem.CimClass, opts *Options) *gowbem.CimClass {
+	if nil == opts {
+		return class
+	}
+	copyed := *class
+	if !opts.IncludeQualifiers {
+		copyed.Qualifiers = nil
+	}
+	properties := class.Properties
+	if opts.LocalOnly {
+		properties = make([]gowbem.CimAnyProperty, 0, len(class.Properties))
+		for _, pr := range class.Properties {
+			if p := pr.Get(); nil != p && !p.IsPropagated() {
+				properties = append(properties, pr)
+			}
+		}
+	}
+	copyed.Properties = filterProperties(properties, opts)
+
+	copyed.Methods = nil
+	for _, method := range class.Methods {
+		if opts.LocalOnly && method.Propagated {
+			continue
+		}
+		if !opts.IncludeQualifiers {
+			method.Qualifiers = nil
+		}
+		if !opts.IncludeClassOrigin {
+			method.ClassOrigin = ""
+		}
+		copyed.Methods = append(copyed.Methods, method)
+	}
+	return &copyed
+}
+
+func filterProperties(properties []gowbem.CimAnyProperty, opts *Options) []gowbem.CimAnyProperty {
+	if nil == properties {
+		return nil
+	}
+	results := make([]gowbem.CimAnyProperty, 0, len(properties))
+	for _, pr := range properties {
+		p := pr.Get()
+		if nil == p {
+			continue
+		}
+		if nil != opts.PropertyList && !containsFold(opts.PropertyList, p.GetName()) {
+			continue
+		}
+
+		switch {
+		case nil != pr.Property:
+			copyed := *pr.Property
+			if !opts.IncludeQualifiers {
+				copyed.Qualifiers = nil
+			}
+			if !opts.IncludeClassOrigin {
+				copyed.ClassOrigin = ""
+			}
+			results = append(results, gowbem.CimAnyProperty{Property: &copyed})
+		case nil != pr.PropertyArray:
+			copyed := *pr.PropertyArray
+			if !opts.IncludeQualifiers {
+				copyed.Qualifiers = nil
+			}
+			if !opts.IncludeClassOrigin {
+				copyed.ClassOrigin = ""
+			}
+			results = append(results, gowbem.CimAnyProperty{PropertyArray: &copyed})
+		case nil != pr.PropertyReference:
+			copyed := *pr.PropertyReference
+			if !opts.IncludeQualifiers {
+				copyed.Qualifiers = nil
+			}
+			if !opts.IncludeClassOrigin {
+				copyed.ClassOrigin = ""
+			}
+			results = append(results, gowbem.CimAnyProperty{PropertyReference: &copyed})
+		}
+	}
+	return results
+}
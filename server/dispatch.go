@@ -0,0 +1,528 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+type handler struct {
+	server *Server
+	np     *namespaceProviders
+	host   string
+	op     *gowbem.Operation
+}
+
+func notSupported(msg string) error {
+	return gowbem.WBEMException(gowbem.CIM_ERR_NOT_SUPPORTED, msg)
+}
+
+func invalidParameter(msg string) error {
+	return gowbem.WBEMException(gowbem.CIM_ERR_INVALID_PARAMETER, msg)
+}
+
+func (h *handler) serve(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	switch h.op.Name {
+	case "GetClass":
+		return h.getClass(ctx)
+	case "EnumerateClasses":
+		return h.enumerateClasses(ctx, false)
+	case "EnumerateClassNames":
+		return h.enumerateClasses(ctx, true)
+	case "EnumerateQualifiers":
+		return h.enumerateQualifiers(ctx)
+	case "GetQualifier":
+		return h.getQualifier(ctx)
+	case "GetInstance":
+		return h.getInstance(ctx)
+	case "GetProperty":
+		return h.getProperty(ctx)
+	case "EnumerateInstances":
+		return h.enumerateInstances(ctx)
+	case "EnumerateInstanceNames":
+		return h.enumerateInstanceNames(ctx)
+	case "CreateInstance":
+		return h.createInstance(ctx)
+	case "ModifyInstance":
+		return h.modifyInstance(ctx)
+	case "DeleteInstance":
+		return h.deleteInstance(ctx)
+	case "Associators", "AssociatorNames", "References", "ReferenceNames":
+		return h.associations(ctx)
+	case "ExecQuery":
+		return h.execQuery(ctx)
+	}
+	return nil, notSupported("operation '" + h.op.Name + "' isn't supported.")
+}
+
+func (h *handler) options(localOnly, deepInheritance, includeQualifiers bool) (*Options, error) {
+	var err error
+	opts := &Options{PropertyList: h.op.PropertyListParam()}
+	if opts.LocalOnly, err = h.op.BoolParam("LocalOnly", localOnly); nil != err {
+		return nil, err
+	}
+	if opts.DeepInheritance, err = h.op.BoolParam("DeepInheritance", deepInheritance); nil != err {
+		return nil, err
+	}
+	if opts.IncludeQualifiers, err = h.op.BoolParam("IncludeQualifiers", includeQualifiers); nil != err {
+		return nil, err
+	}
+	if opts.IncludeClassOrigin, err = h.op.BoolParam("IncludeClassOrigin", false); nil != err {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func (h *handler) classProvider() (ClassProvider, error) {
+	h.server.mu.RLock()
+	provider := h.np.classes
+	h.server.mu.RUnlock()
+	if nil == provider {
+		return nil, notSupported("class operations isn't supported in the namespace '" + h.np.name + "'.")
+	}
+	return provider, nil
+}
+
+// superClasses returns the class and its superclasses, it returns only the
+// class when the schema is unknown.
+func (h *handler) superClasses(ctx context.Context, className string) []string {
+	results := []string{className}
+
+	h.server.mu.RLock()
+	provider := h.np.classes
+	h.server.mu.RUnlock()
+	if nil == provider {
+		return results
+	}
+
+	for depth := 0; depth < 64; depth++ {
+		class, err := provider.GetClass(ctx, h.np.name, className)
+		if nil != err || nil == class || "" == class.SuperClass {
+			break
+		}
+		className = class.SuperClass
+		results = append(results, className)
+	}
+	return results
+}
+
+func (h *handler) instanceProvider(ctx context.Context, className string) (InstanceProvider, error) {
+	for _, name := range h.superClasses(ctx, className) {
+		h.server.mu.RLock()
+		provider := h.np.instances[strings.ToLower(name)]
+		h.server.mu.RUnlock()
+		if nil != provider {
+			return provider, nil
+		}
+	}
+
+	h.server.mu.RLock()
+	provider := h.np.instances[""]
+	h.server.mu.RUnlock()
+	if nil == provider {
+		return nil, notSupported("instance provider of the class '" + className + "' isn't found.")
+	}
+	return provider, nil
+}
+
+func (h *handler) getClass(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	provider, err := h.classProvider()
+	if nil != err {
+		return nil, err
+	}
+	className := h.op.ClassNameParam("ClassName")
+	if "" == className {
+		return nil, invalidParameter("ClassName is missing.")
+	}
+	opts, err := h.options(true, false, true)
+	if nil != err {
+		return nil, err
+	}
+	class, err := provider.GetClass(ctx, h.np.name, className)
+	if nil != err {
+		return nil, err
+	}
+	inner, err := toClassInnerXml(FilterClass(class, opts))
+	if nil != err {
+		return nil, err
+	}
+	return &gowbem.CimIReturnValue{Classes: []gowbem.CimClassInnerXml{*inner}}, nil
+}
+
+func (h *handler) enumerateClasses(ctx context.Context, onlyName bool) (*gowbem.CimIReturnValue, error) {
+	provider, err := h.classProvider()
+	if nil != err {
+		return nil, err
+	}
+	opts, err := h.options(true, false, true)
+	if nil != err {
+		return nil, err
+	}
+	classes, err := provider.EnumerateClasses(ctx, h.np.name, h.op.ClassNameParam("ClassName"), opts.DeepInheritance)
+	if nil != err {
+		return nil, err
+	}
+
+	returnValue := &gowbem.CimIReturnValue{}
+	for idx := range classes {
+		if onlyName {
+			returnValue.ClassNames = append(returnValue.ClassNames, gowbem.CimClassName{Name: classes[idx].Name})
+			continue
+		}
+		inner, err := toClassInnerXml(FilterClass(&classes[idx], opts))
+		if nil != err {
+			return nil, err
+		}
+		returnValue.Classes = append(returnValue.Classes, *inner)
+	}
+	return returnValue, nil
+}
+
+func (h *handler) enumerateQualifiers(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	provider, err := h.classProvider()
+	if nil != err {
+		return nil, err
+	}
+	qualifiers, err := provider.EnumerateQualifiers(ctx, h.np.name)
+	if nil != err {
+		return nil, err
+	}
+	return &gowbem.CimIReturnValue{QualifierDeclarations: qualifiers}, nil
+}
+
+func (h *handler) getQualifier(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	provider, err := h.classProvider()
+	if nil != err {
+		return nil, err
+	}
+	name := h.op.StringParam("QualifierName")
+	if "" == name {
+		return nil, invalidParameter("QualifierName is missing.")
+	}
+	qualifiers, err := provider.EnumerateQualifiers(ctx, h.np.name)
+	if nil != err {
+		return nil, err
+	}
+	for idx := range qualifiers {
+		if strings.EqualFold(qualifiers[idx].Name, name) {
+			return &gowbem.CimIReturnValue{QualifierDeclarations: qualifiers[idx : idx+1]}, nil
+		}
+	}
+	return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND, "qualifier '"+name+"' isn't found.")
+}
+
+func (h *handler) getInstance(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	instanceName := h.op.InstanceNameParam("InstanceName")
+	if nil == instanceName || "" == instanceName.ClassName {
+		return nil, invalidParameter("InstanceName is missing.")
+	}
+	opts, err := h.options(true, false, false)
+	if nil != err {
+		return nil, err
+	}
+	provider, err := h.instanceProvider(ctx, instanceName.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	instance, err := provider.GetInstance(ctx, h.np.name, instanceName, opts)
+	if nil != err {
+		return nil, err
+	}
+	if nil == instance {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND, "instance '"+instanceName.String()+"' isn't found.")
+	}
+	return &gowbem.CimIReturnValue{Instances: []gowbem.CimInstance{*FilterInstance(instance, opts)}}, nil
+}
+
+func (h *handler) getProperty(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	instanceName := h.op.InstanceNameParam("InstanceName")
+	if nil == instanceName || "" == instanceName.ClassName {
+		return nil, invalidParameter("InstanceName is missing.")
+	}
+	propertyName := h.op.StringParam("PropertyName")
+	if "" == propertyName {
+		return nil, invalidParameter("PropertyName is missing.")
+	}
+	provider, err := h.instanceProvider(ctx, instanceName.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	instance, err := provider.GetInstance(ctx, h.np.name, instanceName, &Options{PropertyList: []string{propertyName}})
+	if nil != err {
+		return nil, err
+	}
+	if nil == instance {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND, "instance '"+instanceName.String()+"' isn't found.")
+	}
+	for _, pr := range instance.Properties {
+		if nil != pr.Property && strings.EqualFold(pr.Property.Name, propertyName) {
+			if nil == pr.Property.Value {
+				return &gowbem.CimIReturnValue{}, nil
+			}
+			return &gowbem.CimIReturnValue{Values: []gowbem.CimValue{*pr.Property.Value}}, nil
+		}
+		if nil != pr.PropertyArray && strings.EqualFold(pr.PropertyArray.Name, propertyName) {
+			return &gowbem.CimIReturnValue{ValueArray: pr.PropertyArray.ValueArray}, nil
+		}
+		if nil != pr.PropertyReference && strings.EqualFold(pr.PropertyReference.Name, propertyName) {
+			return &gowbem.CimIReturnValue{ValueReference: pr.PropertyReference.ValueReference}, nil
+		}
+	}
+	return nil, gowbem.WBEMException(gowbem.CIM_ERR_NO_SUCH_PROPERTY, "property '"+propertyName+"' isn't found.")
+}
+
+func (h *handler) enumerateInstances(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	className := h.op.ClassNameParam("ClassName")
+	if "" == className {
+		return nil, invalidParameter("ClassName is missing.")
+	}
+	opts, err := h.options(true, true, false)
+	if nil != err {
+		return nil, err
+	}
+	provider, err := h.instanceProvider(ctx, className)
+	if nil != err {
+		return nil, err
+	}
+	instances, err := provider.EnumerateInstances(ctx, h.np.name, className, opts)
+	if nil != err {
+		return nil, err
+	}
+	returnValue := &gowbem.CimIReturnValue{}
+	for idx := range instances {
+		returnValue.ValueNamedInstances = append(returnValue.ValueNamedInstances, gowbem.CimValueNamedInstance{
+			InstanceName: instances[idx].InstanceName,
+			Instance:     *FilterInstance(&instances[idx].Instance, opts),
+		})
+	}
+	return returnValue, nil
+}
+
+func (h *handler) enumerateInstanceNames(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	className := h.op.ClassNameParam("ClassName")
+	if "" == className {
+		return nil, invalidParameter("ClassName is missing.")
+	}
+	provider, err := h.instanceProvider(ctx, className)
+	if nil != err {
+		return nil, err
+	}
+	names, err := provider.EnumerateInstanceNames(ctx, h.np.name, className)
+	if nil != err {
+		return nil, err
+	}
+	returnValue := &gowbem.CimIReturnValue{}
+	for idx := range names {
+		returnValue.InstanceNames = append(returnValue.InstanceNames, &names[idx])
+	}
+	return returnValue, nil
+}
+
+func (h *handler) createInstance(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	pv := h.op.IParam("NewInstance")
+	if nil == pv || nil == pv.Instance {
+		return nil, invalidParameter("NewInstance is missing.")
+	}
+	provider, err := h.instanceProvider(ctx, pv.Instance.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	name, err := provider.CreateInstance(ctx, h.np.name, pv.Instance)
+	if nil != err {
+		return nil, err
+	}
+	return &gowbem.CimIReturnValue{InstanceNames: []*gowbem.CimInstanceName{name}}, nil
+}
+
+func (h *handler) modifyInstance(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	pv := h.op.IParam("ModifiedInstance")
+	if nil == pv || nil == pv.ValueNamedInstance {
+		return nil, invalidParameter("ModifiedInstance is missing.")
+	}
+	opts, err := h.options(false, false, true)
+	if nil != err {
+		return nil, err
+	}
+	provider, err := h.instanceProvider(ctx, pv.ValueNamedInstance.InstanceName.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	return nil, provider.ModifyInstance(ctx, h.np.name, pv.ValueNamedInstance, opts)
+}
+
+func (h *handler) deleteInstance(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	instanceName := h.op.InstanceNameParam("InstanceName")
+	if nil == instanceName || "" == instanceName.ClassName {
+		return nil, invalidParameter("InstanceName is missing.")
+	}
+	provider, err := h.instanceProvider(ctx, instanceName.ClassName)
+	if nil != err {
+		return nil, err
+	}
+	return nil, provider.DeleteInstance(ctx, h.np.name, instanceName)
+}
+
+func (h *handler) execQuery(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	h.server.mu.RLock()
+	provider := h.np.query
+	h.server.mu.RUnlock()
+	if nil == provider {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_QUERY_LANGUAGE_NOT_SUPPORTED,
+			"query isn't supported in the namespace '"+h.np.name+"'.")
+	}
+	query := h.op.StringParam("Query")
+	if "" == query {
+		return nil, invalidParameter("Query is missing.")
+	}
+	objects, err := provider.ExecQuery(ctx, h.np.name, h.op.StringParam("QueryLanguage"), query)
+	if nil != err {
+		return nil, err
+	}
+	for idx := range objects {
+		h.fillInstancePath(objects[idx].InstancePath)
+	}
+	return &gowbem.CimIReturnValue{ValueObjectWithPaths: objects}, nil
+}
+
+func (h *handler) fillInstancePath(path *gowbem.CimInstancePath) {
+	if nil == path {
+		return
+	}
+	if "" == path.NamespacePath.Host.Value {
+		path.NamespacePath.Host.Value = h.host
+	}
+	if 0 == len(path.NamespacePath.LocalNamespacePath.Namespaces) {
+		path.NamespacePath.LocalNamespacePath.Namespaces = gowbem.ToCimNamespace(h.np.name)
+	}
+}
+
+func (h *handler) namespacePath() gowbem.CimNamespacePath {
+	return gowbem.CimNamespacePath{
+		Host:               gowbem.CimHost{Value: h.host},
+		LocalNamespacePath: gowbem.CimLocalNamespacePath{Namespaces: gowbem.ToCimNamespace(h.np.name)},
+	}
+}
+
+// associationProviders returns the provider of the association class, or all
+// association providers of the namespace when assocClass is empty.
+func (h *handler) associationProviders(ctx context.Context, assocClass string) ([]AssociationProvider, error) {
+	if "" != assocClass {
+		for _, name := range h.superClasses(ctx, assocClass) {
+			h.server.mu.RLock()
+			provider := h.np.associations[strings.ToLower(name)]
+			h.server.mu.RUnlock()
+			if nil != provider {
+				return []AssociationProvider{provider}, nil
+			}
+		}
+	}
+
+	h.server.mu.RLock()
+	defer h.server.mu.RUnlock()
+	if "" != assocClass {
+		if provider := h.np.associations[""]; nil != provider {
+			return []AssociationProvider{provider}, nil
+		}
+		return nil, notSupported("association provider of the class '" + assocClass + "' isn't found.")
+	}
+
+	var results []AssociationProvider
+	for _, provider := range h.np.associations {
+		exists := false
+		for _, p := range results {
+			if isComparable(p) && isComparable(provider) && p == provider {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			results = append(results, provider)
+		}
+	}
+	if 0 == len(results) {
+		return nil, notSupported("association provider isn't found in the namespace '" + h.np.name + "'.")
+	}
+	return results, nil
+}
+
+func (h *handler) associations(ctx context.Context) (*gowbem.CimIReturnValue, error) {
+	objectName := h.op.InstanceNameParam("ObjectName")
+	if nil == objectName || "" == objectName.ClassName {
+		return nil, invalidParameter("ObjectName is missing.")
+	}
+	opts, err := h.options(false, false, false)
+	if nil != err {
+		return nil, err
+	}
+
+	assocClass := h.op.ClassNameParam("AssocClass")
+	resultClass := h.op.ClassNameParam("ResultClass")
+	role := h.op.StringParam("Role")
+	resultRole := h.op.StringParam("ResultRole")
+
+	isReferences := "References" == h.op.Name || "ReferenceNames" == h.op.Name
+	if (&gowbem.Operation{ObjectName: objectName}).IsStatic() {
+		return h.classAssociations(ctx, objectName.ClassName, isReferences, assocClass, resultClass, role, resultRole, opts)
+	}
+
+	if isReferences {
+		// the ResultClass of References is the association class
+		assocClass = resultClass
+	}
+	providers, err := h.associationProviders(ctx, assocClass)
+	if nil != err {
+		return nil, err
+	}
+
+	returnValue := &gowbem.CimIReturnValue{}
+	for _, provider := range providers {
+		switch h.op.Name {
+		case "Associators", "References":
+			var objects []gowbem.CimValueObjectWithPath
+			if isReferences {
+				objects, err = provider.References(ctx, h.np.name, objectName, resultClass, role, opts)
+			} else {
+				objects, err = provider.Associators(ctx, h.np.name, objectName, assocClass, resultClass, role, resultRole, opts)
+			}
+			if nil != err {
+				return nil, err
+			}
+			for idx := range objects {
+				h.fillInstancePath(objects[idx].InstancePath)
+				if nil != objects[idx].Instance {
+					objects[idx].Instance = FilterInstance(objects[idx].Instance, opts)
+				}
+			}
+			returnValue.ValueObjectWithPaths = append(returnValue.ValueObjectWithPaths, objects...)
+		default:
+			var paths []gowbem.CimInstancePath
+			if isReferences {
+				paths, err = provider.ReferenceNames(ctx, h.np.name, objectName, resultClass, role)
+			} else {
+				paths, err = provider.AssociatorNames(ctx, h.np.name, objectName, assocClass, resultClass, role, resultRole)
+			}
+			if nil != err {
+				return nil, err
+			}
+			for idx := range paths {
+				h.fillInstancePath(&paths[idx])
+				returnValue.ObjectPaths = append(returnValue.ObjectPaths, gowbem.CimObjectPath{InstancePath: &paths[idx]})
+			}
+		}
+	}
+	return returnValue, nil
+}
+
+func toClassInnerXml(class *gowbem.CimClass) (*gowbem.CimClassInnerXml, error) {
+	bs, err := xml.Marshal(class)
+	if nil != err {
+		return nil, err
+	}
+	var inner gowbem.CimClassInnerXml
+	if err := xml.Unmarshal(bs, &inner); nil != err {
+		return nil, err
+	}
+	return &inner, nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Options is the common flags of the intrinsic methods, the server applies
+// PropertyList, IncludeQualifiers and IncludeClassOrigin to the results of
+// the providers, so providers can ignore them.
+type Options struct {
+	LocalOnly          bool
+	DeepInheritance    bool
+	IncludeQualifiers  bool
+	IncludeClassOrigin bool
+
+	// PropertyList is nil when all properties are requested.
+	PropertyList []string
+}
+
+// ClassProvider serves the schema of a namespace.
+type ClassProvider interface {
+	GetClass(ctx context.Context, namespaceName, className string) (*gowbem.CimClass, error)
+
+	// EnumerateClasses returns the subclasses of className, or the root
+	// classes when className is empty.
+	EnumerateClasses(ctx context.Context, namespaceName, className string, deepInheritance bool) ([]gowbem.CimClass, error)
+
+	EnumerateQualifiers(ctx context.Context, namespaceName string) ([]gowbem.CimQualifierDeclaration, error)
+}
+
+// InstanceProvider serves the instances of the classes it registered for.
+type InstanceProvider interface {
+	GetInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName, opts *Options) (*gowbem.CimInstance, error)
+	EnumerateInstances(ctx context.Context, namespaceName, className string, opts *Options) ([]gowbem.CimValueNamedInstance, error)
+	EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]gowbem.CimInstanceName, error)
+	CreateInstance(ctx context.Context, namespaceName string, instance *gowbem.CimInstance) (*gowbem.CimInstanceName, error)
+	ModifyInstance(ctx context.Context, namespaceName string, instance *gowbem.CimValueNamedInstance, opts *Options) error
+	DeleteInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName) error
+}
+
+// AssociationProvider serves the association traversal, it is registered
+// for the association classes. The returned paths may leave HOST and
+// NAMESPACE empty, the server fills them with the request's values.
+type AssociationProvider interface {
+	Associators(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		assocClass, resultClass, role, resultRole string, opts *Options) ([]gowbem.CimValueObjectWithPath, error)
+	AssociatorNames(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		assocClass, resultClass, role, resultRole string) ([]gowbem.CimInstancePath, error)
+	References(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		resultClass, role string, opts *Options) ([]gowbem.CimValueObjectWithPath, error)
+	ReferenceNames(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		resultClass, role string) ([]gowbem.CimInstancePath, error)
+}
+
+// MethodProvider serves the extrinsic methods, objectName only contains the
+// class name when the method is static.
+type MethodProvider interface {
+	InvokeMethod(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		methodName string, inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error)
+}
+
+// QueryProvider serves ExecQuery for a namespace.
+type QueryProvider interface {
+	ExecQuery(ctx context.Context, namespaceName, queryLanguage, query string) ([]gowbem.CimValueObjectWithPath, error)
+}
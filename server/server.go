@@ -0,0 +1,382 @@
+// Package server implements the server side of the CIM-XML protocol
+// (DSP0200), it decodes the CIM operation requests and dispatches them to
+// the registered providers.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// The values of the CIMError header, see DSP0200.
+const (
+	ErrUnsupportedProtocolVersion  = "unsupported-protocol-version"
+	ErrMultipleRequestsUnsupported = "multiple-requests-unsupported"
+	ErrUnsupportedCimVersion       = "unsupported-cim-version"
+	ErrUnsupportedDtdVersion       = "unsupported-dtd-version"
+	ErrRequestNotValid             = "request-not-valid"
+	ErrRequestNotWellFormed        = "request-not-well-formed"
+	ErrRequestNotLooselyValid      = "request-not-loosely-valid"
+	ErrHeaderMismatch              = "header-mismatch"
+	ErrUnsupportedOperation        = "unsupported-operation"
+)
+
+type namespaceProviders struct {
+	name         string
+	classes      ClassProvider
+	query        QueryProvider
+	instances    map[string]InstanceProvider
+	associations map[string]AssociationProvider
+	methods      map[string]MethodProvider
+}
+
+// Server is a http.Handler that serves the CIM operations over HTTP.
+type Server struct {
+	CimVersion      string
+	DtdVersion      string
+	ProtocolVersion string
+
+	// DisableMultipleRequests rejects MULTIREQ with the
+	// multiple-requests-unsupported error.
+	DisableMultipleRequests bool
+
+	// Authenticate checks the basic authorization of the request, all
+	// requests are accepted if it is nil.
+	Authenticate func(username, password string) bool
+
+	// Intercept is called before an operation is dispatched, the operation
+	// fails with the returned error if it isn't nil.
+	Intercept func(ctx context.Context, op *gowbem.Operation) error
+
+	mu         sync.RWMutex
+	namespaces map[string]*namespaceProviders
+}
+
+func NewServer() *Server {
+	return &Server{
+		CimVersion:      "2.0",
+		DtdVersion:      "2.0",
+		ProtocolVersion: "1.0",
+		namespaces:      map[string]*namespaceProviders{},
+	}
+}
+
+func namespaceKey(namespaceName string) string {
+	return strings.ToLower(strings.Trim(strings.Replace(namespaceName, "\\", "/", -1), "/"))
+}
+
+func (s *Server) namespace(namespaceName string, create bool) *namespaceProviders {
+	key := namespaceKey(namespaceName)
+	if create {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	} else {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+
+	np := s.namespaces[key]
+	if nil == np && create {
+		np = &namespaceProviders{
+			name:         strings.Trim(namespaceName, "/"),
+			instances:    map[string]InstanceProvider{},
+			associations: map[string]AssociationProvider{},
+			methods:      map[string]MethodProvider{},
+		}
+		s.namespaces[key] = np
+	}
+	return np
+}
+
+// AddNamespace adds a namespace without any provider.
+func (s *Server) AddNamespace(namespaceName string) {
+	s.namespace(namespaceName, true)
+}
+
+// Namespaces returns the names of all namespaces.
+func (s *Server) Namespaces() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]string, 0, len(s.namespaces))
+	for _, np := range s.namespaces {
+		results = append(results, np.name)
+	}
+	sort.Strings(results)
+	return results
+}
+
+func (s *Server) RegisterClassProvider(namespaceName string, provider ClassProvider) {
+	np := s.namespace(namespaceName, true)
+	s.mu.Lock()
+	np.classes = provider
+	s.mu.Unlock()
+}
+
+func (s *Server) RegisterQueryProvider(namespaceName string, provider QueryProvider) {
+	np := s.namespace(namespaceName, true)
+	s.mu.Lock()
+	np.query = provider
+	s.mu.Unlock()
+}
+
+// RegisterInstanceProvider registers the provider for the class, the
+// provider is the default of the namespace when className is empty.
+func (s *Server) RegisterInstanceProvider(namespaceName, className string, provider InstanceProvider) {
+	np := s.namespace(namespaceName, true)
+	s.mu.Lock()
+	np.instances[strings.ToLower(className)] = provider
+	s.mu.Unlock()
+}
+
+// RegisterAssociationProvider registers the provider for the association
+// class, the provider is the default of the namespace when className is
+// empty.
+func (s *Server) RegisterAssociationProvider(namespaceName, className string, provider AssociationProvider) {
+	np := s.namespace(namespaceName, true)
+	s.mu.Lock()
+	np.associations[strings.ToLower(className)] = provider
+	s.mu.Unlock()
+}
+
+// RegisterMethodProvider registers the provider for the class, the provider
+// is the default of the namespace when className is empty.
+func (s *Server) RegisterMethodProvider(namespaceName, className string, provider MethodProvider) {
+	np := s.namespace(namespaceName, true)
+	s.mu.Lock()
+	np.methods[strings.ToLower(className)] = provider
+	s.mu.Unlock()
+}
+
+// headerValue returns the value of the header, the extension headers of the
+// M-POST are prefixed with a two digit namespace, e.g. "73-CIMOperation".
+func headerValue(r *http.Request, name string) string {
+	if value := r.Header.Get(name); "" != value {
+		return value
+	}
+	if "M-POST" != r.Method {
+		return ""
+	}
+	suffix := "-" + strings.ToLower(name)
+	for key, values := range r.Header {
+		if 0 != len(values) && strings.HasSuffix(strings.ToLower(key), suffix) {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func writeHeaderError(w http.ResponseWriter, status int, cimError, detail string) {
+	w.Header().Set("CIMError", cimError)
+	if "" != detail {
+		w.Header().Set("PGErrorDetail", url.QueryEscape(detail))
+	}
+	w.WriteHeader(status)
+}
+
+func isVersion2(version string) bool {
+	return "2" == version || strings.HasPrefix(version, "2.")
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if "POST" != r.Method && "M-POST" != r.Method {
+		w.Header().Set("Allow", "POST, M-POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if nil != s.Authenticate {
+		username, password, ok := r.BasicAuth()
+		if !ok || !s.Authenticate(username, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="wbem"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if !strings.EqualFold("MethodCall", headerValue(r, "CIMOperation")) {
+		writeHeaderError(w, http.StatusBadRequest, ErrUnsupportedOperation, "CIMOperation header must be 'MethodCall'")
+		return
+	}
+
+	if version := headerValue(r, "CIMProtocolVersion"); "" != version &&
+		"1" != version && !strings.HasPrefix(version, "1.") {
+		writeHeaderError(w, http.StatusNotImplemented, ErrUnsupportedProtocolVersion, version)
+		return
+	}
+
+	if contentType := strings.ToLower(r.Header.Get("Content-Type")); "" != contentType &&
+		!strings.HasPrefix(contentType, "application/xml") &&
+		!strings.HasPrefix(contentType, "text/xml") {
+		writeHeaderError(w, http.StatusUnsupportedMediaType, ErrRequestNotValid, "Content-Type is '"+contentType+"'")
+		return
+	}
+
+	var req gowbem.CIM
+	if err := xml.NewDecoder(r.Body).Decode(&req); nil != err {
+		writeHeaderError(w, http.StatusBadRequest, ErrRequestNotWellFormed, err.Error())
+		return
+	}
+
+	if !isVersion2(req.CimVersion) {
+		writeHeaderError(w, http.StatusNotImplemented, ErrUnsupportedCimVersion, req.CimVersion)
+		return
+	}
+	if !isVersion2(req.DtdVersion) {
+		writeHeaderError(w, http.StatusNotImplemented, ErrUnsupportedDtdVersion, req.DtdVersion)
+		return
+	}
+
+	operations, err := gowbem.ParseOperations(&req)
+	if nil != err {
+		writeHeaderError(w, http.StatusBadRequest, ErrRequestNotValid, err.Error())
+		return
+	}
+
+	if nil != req.Message.MultiReq {
+		if s.DisableMultipleRequests {
+			writeHeaderError(w, http.StatusNotImplemented, ErrMultipleRequestsUnsupported, "")
+			return
+		}
+		if _, ok := r.Header["Cimbatch"]; !ok && "" == headerValue(r, "CIMBatch") {
+			writeHeaderError(w, http.StatusBadRequest, ErrHeaderMismatch, "CIMBatch header is missing")
+			return
+		}
+	} else {
+		if method := headerValue(r, "CIMMethod"); method != operations[0].Name {
+			writeHeaderError(w, http.StatusBadRequest, ErrHeaderMismatch, "CIMMethod header is '"+method+"'")
+			return
+		}
+		object, err := url.QueryUnescape(headerValue(r, "CIMObject"))
+		if nil != err || !matchObjectHeader(&operations[0], object) {
+			writeHeaderError(w, http.StatusBadRequest, ErrHeaderMismatch, "CIMObject header is '"+object+"'")
+			return
+		}
+	}
+
+	resp := s.process(r.Context(), r.Host, &req, operations)
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(resp); nil != err {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.Header().Set("CIMOperation", "MethodResponse")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, &buf)
+}
+
+func matchObjectHeader(op *gowbem.Operation, object string) bool {
+	object = namespaceKey(object)
+	ns := namespaceKey(op.Namespace)
+	if op.Intrinsic {
+		return object == ns
+	}
+	return object == ns || strings.HasPrefix(object, ns+":") || strings.HasPrefix(object, ns+"/")
+}
+
+// Process handles a decoded request message without the HTTP layer, host
+// is used to fill the HOST of the returned paths.
+func (s *Server) Process(ctx context.Context, host string, req *gowbem.CIM) (*gowbem.CIM, error) {
+	operations, err := gowbem.ParseOperations(req)
+	if nil != err {
+		return nil, err
+	}
+	return s.process(ctx, host, req, operations), nil
+}
+
+func (s *Server) process(ctx context.Context, host string, req *gowbem.CIM, operations []gowbem.Operation) *gowbem.CIM {
+	resp := &gowbem.CIM{
+		CimVersion: s.CimVersion,
+		DtdVersion: s.DtdVersion,
+		Message: &gowbem.CimMessage{
+			Id:              req.Message.Id,
+			ProtocolVersion: s.ProtocolVersion,
+		},
+	}
+
+	if nil == req.Message.MultiReq {
+		rsp := s.dispatch(ctx, host, &operations[0])
+		resp.Message.SimpleRsp = &rsp
+		return resp
+	}
+
+	multiRsp := &gowbem.CimMultiRsp{SimpleRsps: make([]gowbem.CimSimpleRsp, 0, len(operations))}
+	for idx := range operations {
+		multiRsp.SimpleRsps = append(multiRsp.SimpleRsps, s.dispatch(ctx, host, &operations[idx]))
+	}
+	resp.Message.MultiRsp = multiRsp
+	return resp
+}
+
+func toCimError(err error) *gowbem.CimError {
+	if we, ok := err.(*gowbem.WbemError); ok {
+		return &gowbem.CimError{Code: int(we.Code()), Description: we.Message()}
+	}
+	if code, ok := gowbem.GetCIMStatusCode(err); ok {
+		return &gowbem.CimError{Code: int(code), Description: err.Error()}
+	}
+	return &gowbem.CimError{Code: int(gowbem.CIM_ERR_FAILED), Description: err.Error()}
+}
+
+func (s *Server) dispatch(ctx context.Context, host string, op *gowbem.Operation) gowbem.CimSimpleRsp {
+	var intercepted error
+	if nil != s.Intercept {
+		intercepted = s.Intercept(ctx, op)
+	}
+
+	np := s.namespace(op.Namespace, false)
+	if !op.Intrinsic {
+		rsp := &gowbem.CimMethodResponse{Name: op.Name}
+		if nil != intercepted {
+			rsp.Error = toCimError(intercepted)
+		} else if nil == np {
+			rsp.Error = toCimError(gowbem.WBEMException(gowbem.CIM_ERR_INVALID_NAMESPACE,
+				"namespace '"+op.Namespace+"' isn't found."))
+		} else if err := s.invokeMethod(ctx, np, op, rsp); nil != err {
+			rsp.Error = toCimError(err)
+			rsp.ReturnValue = nil
+			rsp.ParamValues = nil
+		}
+		return gowbem.CimSimpleRsp{MethodResponse: rsp}
+	}
+
+	rsp := &gowbem.CimIMethodResponse{Name: op.Name}
+	if nil != intercepted {
+		rsp.Error = toCimError(intercepted)
+		return gowbem.CimSimpleRsp{IMethodResponse: rsp}
+	}
+	if nil == np {
+		rsp.Error = toCimError(gowbem.WBEMException(gowbem.CIM_ERR_INVALID_NAMESPACE,
+			"namespace '"+op.Namespace+"' isn't found."))
+		return gowbem.CimSimpleRsp{IMethodResponse: rsp}
+	}
+
+	h := &handler{server: s, np: np, host: host, op: op}
+	returnValue, err := h.serve(ctx)
+	if nil != err {
+		rsp.Error = toCimError(err)
+	} else {
+		rsp.ReturnValue = returnValue
+	}
+	return gowbem.CimSimpleRsp{IMethodResponse: rsp}
+}
+
+// isComparable guards the provider comparison, comparing two interfaces that
+// hold uncomparable values panics.
+func isComparable(v interface{}) bool {
+	return nil != v && reflect.TypeOf(v).Comparable()
+}
@@ -0,0 +1,261 @@
+package server_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/server"
+)
+
+type testProvider struct {
+	classes   map[string]*gowbem.CimClass
+	instances []gowbem.CimValueNamedInstance
+}
+
+func (p *testProvider) GetClass(ctx context.Context, namespaceName, className string) (*gowbem.CimClass, error) {
+	if class, ok := p.classes[strings.ToLower(className)]; ok {
+		return class, nil
+	}
+	return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_CLASS, className)
+}
+
+func (p *testProvider) EnumerateClasses(ctx context.Context, namespaceName, className string, deepInheritance bool) ([]gowbem.CimClass, error) {
+	var results []gowbem.CimClass
+	for _, class := range p.classes {
+		if deepInheritance || strings.EqualFold(class.SuperClass, className) {
+			results = append(results, *class)
+		}
+	}
+	return results, nil
+}
+
+func (p *testProvider) EnumerateQualifiers(ctx context.Context, namespaceName string) ([]gowbem.CimQualifierDeclaration, error) {
+	return []gowbem.CimQualifierDeclaration{{Name: "Key", Type: "boolean"}}, nil
+}
+
+func (p *testProvider) GetInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName, opts *server.Options) (*gowbem.CimInstance, error) {
+	for idx := range p.instances {
+		if p.instances[idx].InstanceName.String() == instanceName.String() {
+			return &p.instances[idx].Instance, nil
+		}
+	}
+	return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND, instanceName.String())
+}
+
+func (p *testProvider) EnumerateInstances(ctx context.Context, namespaceName, className string, opts *server.Options) ([]gowbem.CimValueNamedInstance, error) {
+	var results []gowbem.CimValueNamedInstance
+	for _, instance := range p.instances {
+		if strings.EqualFold(instance.InstanceName.ClassName, className) {
+			results = append(results, instance)
+		}
+	}
+	return results, nil
+}
+
+func (p *testProvider) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]gowbem.CimInstanceName, error) {
+	var results []gowbem.CimInstanceName
+	for _, instance := range p.instances {
+		if strings.EqualFold(instance.InstanceName.ClassName, className) {
+			results = append(results, instance.InstanceName)
+		}
+	}
+	return results, nil
+}
+
+func (p *testProvider) CreateInstance(ctx context.Context, namespaceName string, instance *gowbem.CimInstance) (*gowbem.CimInstanceName, error) {
+	return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_SUPPORTED, "CreateInstance")
+}
+
+func (p *testProvider) ModifyInstance(ctx context.Context, namespaceName string, instance *gowbem.CimValueNamedInstance, opts *server.Options) error {
+	return gowbem.WBEMException(gowbem.CIM_ERR_NOT_SUPPORTED, "ModifyInstance")
+}
+
+func (p *testProvider) DeleteInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName) error {
+	return gowbem.WBEMException(gowbem.CIM_ERR_NOT_SUPPORTED, "DeleteInstance")
+}
+
+func (p *testProvider) InvokeMethod(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	methodName string, inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error) {
+	if "Echo" != methodName {
+		return nil, nil, gowbem.WBEMException(gowbem.CIM_ERR_METHOD_NOT_FOUND, methodName)
+	}
+	return &gowbem.CimReturnValue{ParamType: "uint32", Value: &gowbem.CimValue{Value: "0"}},
+		[]gowbem.CimParamValue{{Name: "Out", ParamType: "string", Value: inParams[0].Value}}, nil
+}
+
+func makeTestServer() *server.Server {
+	provider := &testProvider{
+		classes: map[string]*gowbem.CimClass{
+			"test_device": &gowbem.CimClass{
+				Name: "Test_Device",
+				Properties: []gowbem.CimAnyProperty{
+					{Property: &gowbem.CimProperty{Name: "DeviceID", Type: "string",
+						Qualifiers: []gowbem.CimQualifier{{Name: "Key", Type: "boolean", Value: &gowbem.CimValue{Value: "true"}}}}},
+					{Property: &gowbem.CimProperty{Name: "Caption", Type: "string"}},
+				},
+			},
+		},
+	}
+	for _, id := range []string{"a", "b"} {
+		provider.instances = append(provider.instances, gowbem.CimValueNamedInstance{
+			InstanceName: gowbem.CimInstanceName{ClassName: "Test_Device",
+				KeyBindings: []gowbem.CimKeyBinding{{Name: "DeviceID",
+					KeyValue: &gowbem.CimKeyValue{ValueType: "string", Value: id}}}},
+			Instance: gowbem.CimInstance{ClassName: "Test_Device",
+				Properties: []gowbem.CimAnyProperty{
+					{Property: &gowbem.CimProperty{Name: "DeviceID", Type: "string", Value: &gowbem.CimValue{Value: id}}},
+					{Property: &gowbem.CimProperty{Name: "Caption", Type: "string", Value: &gowbem.CimValue{Value: "device " + id}}},
+				}},
+		})
+	}
+
+	srv := server.NewServer()
+	srv.RegisterClassProvider("root/test", provider)
+	srv.RegisterInstanceProvider("root/test", "Test_Device", provider)
+	srv.RegisterMethodProvider("root/test", "", provider)
+	srv.RegisterClassProvider("root/testsuite", provider)
+	return srv
+}
+
+func TestServerIntrinsic(t *testing.T) {
+	hsrv := httptest.NewServer(makeTestServer())
+	defer hsrv.Close()
+
+	u, _ := url.Parse(hsrv.URL)
+	c, err := gowbem.NewClientCIMXML(u, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	names, err := c.EnumerateInstanceNames(ctx, "root/test", "Test_Device")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) {
+		t.Fatal("want 2 instance names, got", len(names))
+	}
+
+	instance, err := c.GetInstanceByInstanceName(ctx, "root/test", names[1], false, false, false, []string{"Caption"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != instance.GetPropertyCount() || "device b" != instance.GetPropertyByName("Caption").GetValue() {
+		t.Error("property list isn't applied -", instance.(*gowbem.CimInstance).String())
+	}
+
+	instances, err := c.EnumerateInstances(ctx, "root/test", "Test_Device", false, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(instances) || "a" != instances[0].GetInstance().GetPropertyByName("DeviceID").GetValue() {
+		t.Error("EnumerateInstances is error -", instances)
+	}
+
+	classNames, err := c.EnumerateClassNames(ctx, "root/test", "", true)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(classNames) || "Test_Device" != classNames[0] {
+		t.Error("EnumerateClassNames is error -", classNames)
+	}
+
+	class, err := c.GetClass(ctx, "root/test", "Test_Device", false, true, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(class.String(), `NAME="Key"`) {
+		t.Error("GetClass is error -", class)
+	}
+
+	_, err = c.EnumerateInstanceNames(ctx, "root/notexists", "Test_Device")
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_INVALID_NAMESPACE != code {
+		t.Error("want CIM_ERR_INVALID_NAMESPACE, got", err)
+	}
+
+	_, err = c.GetInstanceByInstanceName(ctx, "root/test", &gowbem.CimInstanceName{ClassName: "Test_Device",
+		KeyBindings: []gowbem.CimKeyBinding{{Name: "DeviceID", KeyValue: &gowbem.CimKeyValue{Value: "c"}}}}, false, false, false, nil)
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_NOT_FOUND != code {
+		t.Error("want CIM_ERR_NOT_FOUND, got", err)
+	}
+}
+
+func TestServerInvokeMethod(t *testing.T) {
+	hsrv := httptest.NewServer(makeTestServer())
+	defer hsrv.Close()
+
+	u, _ := url.Parse(hsrv.URL)
+	c, err := gowbem.NewClientCIMXML(u, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	instanceName, _ := gowbem.ParseInstanceName(`Test_Device.DeviceID="a"`)
+	ret, outParams, err := c.InvokeMethod(context.Background(), "root/test", instanceName, "Echo",
+		[]gowbem.CIMParamValue{&gowbem.CimParamValue{Name: "In", Value: &gowbem.CimValue{Value: "hello"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "0" != ret.String() {
+		t.Error("return value is", ret)
+	}
+	if 1 != len(outParams) || "Out" != outParams[0].GetName() {
+		t.Error("out params is", outParams)
+	}
+
+	_, _, err = c.InvokeMethod(context.Background(), "root/test", instanceName, "Missing", nil)
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_METHOD_NOT_FOUND != code {
+		t.Error("want CIM_ERR_METHOD_NOT_FOUND, got", err)
+	}
+}
+
+func TestServerHeaders(t *testing.T) {
+	hsrv := httptest.NewServer(makeTestServer())
+	defer hsrv.Close()
+
+	body, err := ioutil.ReadFile("../testfiles/MultiReqInput.xml")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	post := func(headers map[string]string) *http.Response {
+		req, _ := http.NewRequest("POST", hsrv.URL, strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/xml")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post(map[string]string{"CIMProtocolVersion": "1.0", "CIMOperation": "MethodCall"})
+	resp.Body.Close()
+	if http.StatusBadRequest != resp.StatusCode || server.ErrHeaderMismatch != resp.Header.Get("CIMError") {
+		t.Error("want header-mismatch, got", resp.Status, resp.Header.Get("CIMError"))
+	}
+
+	resp = post(map[string]string{"CIMProtocolVersion": "1.0", "CIMOperation": "MethodCall", "CIMBatch": "CIMBatch"})
+	bs, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		t.Fatal(resp.Status)
+	}
+	if 6 != strings.Count(string(bs), "<SIMPLERSP>") || !strings.Contains(string(bs), "<MULTIRSP>") {
+		t.Error(string(bs))
+	}
+
+	resp = post(map[string]string{"CIMProtocolVersion": "2.0", "CIMOperation": "MethodCall", "CIMBatch": "CIMBatch"})
+	resp.Body.Close()
+	if server.ErrUnsupportedProtocolVersion != resp.Header.Get("CIMError") {
+		t.Error("want unsupported-protocol-version, got", resp.Status, resp.Header.Get("CIMError"))
+	}
+}
@@ -0,0 +1,202 @@
+package topology
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Node is an instance in the graph.
+type Node struct {
+	// Key is the canonical key of the instance name, see
+	// gowbem.CimInstanceName.Key.
+	Key   string
+	Name  *gowbem.CimInstanceName
+	Depth int
+	// Instance is nil unless Options.Instances is true.
+	Instance gowbem.CIMInstance
+}
+
+// Edge is an association instance between two nodes, the roles are the
+// names of the references to the nodes.
+type Edge struct {
+	Association *gowbem.CimInstanceName
+	From        string
+	FromRole    string
+	To          string
+	ToRole      string
+}
+
+func (e *Edge) key() string {
+	from, to := e.From+"|"+strings.ToLower(e.FromRole), e.To+"|"+strings.ToLower(e.ToRole)
+	if from > to {
+		from, to = to, from
+	}
+	return e.Association.Key() + "|" + from + "|" + to
+}
+
+// Graph is the result of Traverse, the nodes are sorted by the depth and the
+// key, the edges are sorted by the nodes.
+type Graph struct {
+	Nodes []*Node
+	Edges []*Edge
+
+	nodes map[string]*Node
+	edges map[string]*Edge
+}
+
+func newGraph() *Graph {
+	return &Graph{nodes: map[string]*Node{}, edges: map[string]*Edge{}}
+}
+
+// Node returns the node of the instance name, it returns nil if the
+// instance isn't in the graph.
+func (g *Graph) Node(name *gowbem.CimInstanceName) *Node {
+	return g.nodes[name.Key()]
+}
+
+func (g *Graph) addNode(name *gowbem.CimInstanceName, depth int) *Node {
+	node := &Node{Key: name.Key(), Name: name, Depth: depth}
+	g.nodes[node.Key] = node
+	g.Nodes = append(g.Nodes, node)
+	return node
+}
+
+// addEdge adds the edge, the association is found from the both sides, so
+// the edge in the reverse direction is the same edge.
+func (g *Graph) addEdge(edge *Edge) {
+	key := edge.key()
+	if _, exists := g.edges[key]; exists {
+		return
+	}
+	g.edges[key] = edge
+	g.Edges = append(g.Edges, edge)
+}
+
+func (g *Graph) sort() {
+	sort.SliceStable(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Depth != g.Nodes[j].Depth {
+			return g.Nodes[i].Depth < g.Nodes[j].Depth
+		}
+		return g.Nodes[i].Key < g.Nodes[j].Key
+	})
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Association.Key() < g.Edges[j].Association.Key()
+	})
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	ids := make(map[string]string, len(g.Nodes))
+	var buf strings.Builder
+	buf.WriteString("digraph topology {\n")
+	for idx, node := range g.Nodes {
+		ids[node.Key] = "n" + strconv.Itoa(idx)
+		buf.WriteString("  ")
+		buf.WriteString(ids[node.Key])
+		buf.WriteString(" [label=")
+		buf.WriteString(dotQuote(nodeLabel(node.Name)))
+		buf.WriteString("];\n")
+	}
+	for _, edge := range g.Edges {
+		buf.WriteString("  ")
+		buf.WriteString(ids[edge.From])
+		buf.WriteString(" -> ")
+		buf.WriteString(ids[edge.To])
+		buf.WriteString(" [label=")
+		buf.WriteString(dotQuote(edge.Association.ClassName + "\n" + edge.FromRole + " -> " + edge.ToRole))
+		buf.WriteString("];\n")
+	}
+	buf.WriteString("}\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// nodeLabel returns the class name and the keys of the instance name, the
+// keys are written as the object path since the name may have a KEYVALUE
+// or a VALUE.REFERENCE instead of the keybindings.
+func nodeLabel(name *gowbem.CimInstanceName) string {
+	path := gowbem.ObjectPathFromReference(&gowbem.CimValueReference{InstanceName: name})
+	if nil == path {
+		return name.ClassName
+	}
+	return name.ClassName + "\n" + strings.TrimPrefix(path.String(), name.ClassName+".")
+}
+
+func dotQuote(s string) string {
+	var buf strings.Builder
+	buf.WriteString(`"`)
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			buf.WriteRune('\\')
+			buf.WriteRune(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteString(`"`)
+	return buf.String()
+}
+
+type jsonNode struct {
+	Key        string                 `json:"key"`
+	ClassName  string                 `json:"class_name"`
+	Path       string                 `json:"path"`
+	Depth      int                    `json:"depth"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type jsonEdge struct {
+	Association string `json:"association"`
+	ClassName   string `json:"class_name"`
+	From        string `json:"from"`
+	FromRole    string `json:"from_role"`
+	To          string `json:"to"`
+	ToRole      string `json:"to_role"`
+}
+
+// MarshalJSON encodes the graph as {"nodes": [...], "edges": [...]}, the
+// edges refer to the nodes by the key.
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	var out struct {
+		Nodes []jsonNode `json:"nodes"`
+		Edges []jsonEdge `json:"edges"`
+	}
+	out.Nodes = make([]jsonNode, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		n := jsonNode{Key: node.Key, ClassName: node.Name.ClassName, Path: node.Name.String(), Depth: node.Depth}
+		if nil != node.Instance {
+			n.Properties = map[string]interface{}{}
+			for idx := 0; idx < node.Instance.GetPropertyCount(); idx++ {
+				pr := node.Instance.GetPropertyByIndex(idx)
+				n.Properties[pr.GetName()] = pr.GetValue()
+			}
+		}
+		out.Nodes = append(out.Nodes, n)
+	}
+	out.Edges = make([]jsonEdge, 0, len(g.Edges))
+	for _, edge := range g.Edges {
+		out.Edges = append(out.Edges, jsonEdge{
+			Association: edge.Association.String(),
+			ClassName:   edge.Association.ClassName,
+			From:        edge.From,
+			FromRole:    edge.FromRole,
+			To:          edge.To,
+			ToRole:      edge.ToRole,
+		})
+	}
+	return json.Marshal(&out)
+}
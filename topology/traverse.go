@@ -0,0 +1,264 @@
+// Package topology follows the associations from an instance and builds a
+// graph of the instances, such as the topology of a storage system.
+package topology
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// Client is the part of gowbem.ClientCIMXML used by Traverse.
+type Client interface {
+	GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName, localOnly bool,
+		includeQualifiers bool, includeClassOrigin bool, propertyList []string) (gowbem.CIMInstance, error)
+	AssociatorNames(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName,
+		assocClass, resultClass, role, resultRole string) ([]gowbem.CIMInstanceName, error)
+	AssociatorInstances(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName,
+		assocClass, resultClass, role, resultRole string, includeClassOrigin bool, propertyList []string) ([]gowbem.CIMInstanceWithName, error)
+	ReferenceNames(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName,
+		resultClass, role string) ([]gowbem.CIMInstanceName, error)
+}
+
+// Rule selects the associations followed from every node, the empty fields
+// match everything as the parameters of AssociatorNames.
+type Rule struct {
+	AssocClass  string
+	ResultClass string
+	Role        string
+	ResultRole  string
+}
+
+// Options of Traverse.
+type Options struct {
+	// Namespace is the namespace of the instances.
+	Namespace string
+	// Rules are the associations followed from every node, all associations
+	// are followed if it is empty.
+	Rules []Rule
+	// MaxDepth is the max distance from the start node, 0 is unlimited.
+	MaxDepth int
+	// Concurrency is the max number of the nodes expanded concurrently, the
+	// default is 4.
+	Concurrency int
+	// Instances is true if the instances of the nodes are fetched.
+	Instances bool
+	// PropertyList is the properties of the instances, nil is all.
+	PropertyList []string
+}
+
+type neighbor struct {
+	name     *gowbem.CimInstanceName
+	instance gowbem.CIMInstance
+}
+
+type expansion struct {
+	neighbors []neighbor
+	edges     []*Edge
+}
+
+// Traverse starts from the instance and follows the associations breadth
+// first until MaxDepth. The nodes are deduplicated by the canonical instance
+// name, the associations which are unsupported by the CIMOM are skipped.
+func Traverse(ctx context.Context, c Client, start gowbem.CIMInstanceName, opts Options) (*Graph, error) {
+	if "" == opts.Namespace {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_PARAMETER,
+			"namespace name is empty.")
+	}
+	rules := opts.Rules
+	if 0 == len(rules) {
+		rules = []Rule{{}}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	name, err := gowbem.AsCimInstanceName(start)
+	if nil != err {
+		return nil, err
+	}
+	graph := newGraph()
+	root := graph.addNode(name, 0)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Instances {
+		root.Instance, err = c.GetInstanceByInstanceName(ctx, opts.Namespace, name, false, false, false, opts.PropertyList)
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	frontier := []*Node{root}
+	for depth := 1; 0 != len(frontier) && (opts.MaxDepth <= 0 || depth <= opts.MaxDepth); depth++ {
+		results := make([]expansion, len(frontier))
+
+		// the first error cancels the others, it is kept since the others
+		// may be the errors of the canceled ctx.
+		var mu sync.Mutex
+		var firstErr error
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, concurrency)
+		for idx, node := range frontier {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(idx int, node *Node) {
+				defer func() {
+					<-semaphore
+					wg.Done()
+				}()
+				result, err := expand(ctx, c, node, rules, &opts)
+				if nil == err {
+					results[idx] = result
+					return
+				}
+				mu.Lock()
+				if nil == firstErr {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+			}(idx, node)
+		}
+		wg.Wait()
+
+		if nil != firstErr {
+			return nil, firstErr
+		}
+
+		var next []*Node
+		for _, result := range results {
+			for _, n := range result.neighbors {
+				node, exists := graph.nodes[n.name.Key()]
+				if !exists {
+					node = graph.addNode(n.name, depth)
+					next = append(next, node)
+				}
+				if nil == node.Instance && nil != n.instance {
+					node.Instance = n.instance
+				}
+			}
+			for _, edge := range result.edges {
+				graph.addEdge(edge)
+			}
+		}
+		frontier = next
+	}
+	graph.sort()
+	return graph, nil
+}
+
+// expand returns the neighbors of the node and the associations to them.
+func expand(ctx context.Context, c Client, node *Node, rules []Rule, opts *Options) (expansion, error) {
+	var result expansion
+	for _, rule := range rules {
+		neighbors := map[string]neighbor{}
+		if opts.Instances {
+			instances, err := c.AssociatorInstances(ctx, opts.Namespace, node.Name,
+				rule.AssocClass, rule.ResultClass, rule.Role, rule.ResultRole, false, opts.PropertyList)
+			if nil != err {
+				if gowbem.IsErrUnavailable(err) {
+					continue
+				}
+				return result, err
+			}
+			for _, instance := range instances {
+				name, err := gowbem.AsCimInstanceName(instance.GetName())
+				if nil != err {
+					return result, err
+				}
+				neighbors[name.Key()] = neighbor{name: name, instance: instance.GetInstance()}
+			}
+		} else {
+			names, err := c.AssociatorNames(ctx, opts.Namespace, node.Name,
+				rule.AssocClass, rule.ResultClass, rule.Role, rule.ResultRole)
+			if nil != err {
+				if gowbem.IsErrUnavailable(err) {
+					continue
+				}
+				return result, err
+			}
+			for _, instanceName := range names {
+				name, err := gowbem.AsCimInstanceName(instanceName)
+				if nil != err {
+					return result, err
+				}
+				neighbors[name.Key()] = neighbor{name: name}
+			}
+		}
+		if 0 == len(neighbors) {
+			continue
+		}
+
+		assocNames, err := c.ReferenceNames(ctx, opts.Namespace, node.Name, rule.AssocClass, rule.Role)
+		if nil != err && !gowbem.IsErrUnavailable(err) {
+			return result, err
+		}
+		for _, assocName := range assocNames {
+			assoc, err := gowbem.AsCimInstanceName(assocName)
+			if nil != err {
+				return result, err
+			}
+			result.edges = append(result.edges, edges(node, assoc, &rule, neighbors)...)
+		}
+
+		for _, n := range neighbors {
+			result.neighbors = append(result.neighbors, n)
+		}
+	}
+	return result, nil
+}
+
+// edges returns the edges from the node to the neighbors through the
+// association instance, an association with more than two references
+// has an edge for every other reference.
+func edges(node *Node, assoc *gowbem.CimInstanceName, rule *Rule, neighbors map[string]neighbor) []*Edge {
+	role := ""
+	for _, kb := range assoc.KeyBindings {
+		if name := referenceName(kb.ValueReference); nil != name && node.Key == name.Key() &&
+			("" == rule.Role || strings.EqualFold(rule.Role, kb.Name)) {
+			role = kb.Name
+			break
+		}
+	}
+	if "" == role {
+		return nil
+	}
+
+	var results []*Edge
+	for _, kb := range assoc.KeyBindings {
+		if kb.Name == role || ("" != rule.ResultRole && !strings.EqualFold(rule.ResultRole, kb.Name)) {
+			continue
+		}
+		name := referenceName(kb.ValueReference)
+		if nil == name {
+			continue
+		}
+		if _, ok := neighbors[name.Key()]; !ok {
+			continue
+		}
+		results = append(results, &Edge{
+			Association: assoc,
+			From:        node.Key,
+			FromRole:    role,
+			To:          name.Key(),
+			ToRole:      kb.Name,
+		})
+	}
+	return results
+}
+
+func referenceName(ref *gowbem.CimValueReference) *gowbem.CimInstanceName {
+	if nil == ref {
+		return nil
+	}
+	path := gowbem.ObjectPathFromReference(ref)
+	if nil == path || path.IsClass() {
+		return nil
+	}
+	return path.InstanceName()
+}
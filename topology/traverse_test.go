@@ -0,0 +1,226 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/wbemtest"
+)
+
+const testNamespace = "root/cimv2"
+
+const testMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Association : boolean = false, Scope(association), Flavor(DisableOverride, ToSubclass);
+
+class Test_System {
+	[Key] string Name;
+};
+
+class Test_Disk {
+	[Key] string DeviceID;
+	uint64 Size;
+};
+
+class Test_Partition {
+	[Key] string ID;
+};
+
+[Association]
+class Test_SystemDevice {
+	[Key] Test_System REF GroupComponent;
+	[Key] Test_Disk REF PartComponent;
+};
+
+[Association]
+class Test_BasedOn {
+	[Key] Test_Disk REF Antecedent;
+	[Key] Test_Partition REF Dependent;
+};
+
+instance of Test_System as $s1 { Name = "s1"; };
+instance of Test_Disk as $d1 { DeviceID = "d1"; Size = 1024; };
+instance of Test_Disk as $d2 { DeviceID = "d2"; Size = 2048; };
+instance of Test_Partition as $p1 { ID = "p1"; };
+instance of Test_Partition as $p2 { ID = "p2"; };
+instance of Test_Partition as $p3 { ID = "p3"; };
+
+instance of Test_SystemDevice { GroupComponent = $s1; PartComponent = $d1; };
+instance of Test_SystemDevice { GroupComponent = $s1; PartComponent = $d2; };
+instance of Test_BasedOn { Antecedent = $d1; Dependent = $p1; };
+instance of Test_BasedOn { Antecedent = $d1; Dependent = $p2; };
+instance of Test_BasedOn { Antecedent = $d2; Dependent = $p3; };
+`
+
+func startCIMOM(t *testing.T) (*wbemtest.CIMOM, *gowbem.ClientCIMXML, func()) {
+	m := wbemtest.New()
+	if err := m.LoadMOF(testNamespace, testMOF); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	c, err := wbemtest.NewClient(hsrv)
+	if nil != err {
+		hsrv.Close()
+		t.Fatal(err)
+	}
+	return m, c, hsrv.Close
+}
+
+func TestTraverse(t *testing.T) {
+	_, c, closer := startCIMOM(t)
+	defer closer()
+
+	system, _ := gowbem.ParseInstanceName(`Test_System.Name="s1"`)
+	graph, err := Traverse(context.Background(), c, system, Options{Namespace: testNamespace, Concurrency: 1})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 6 != len(graph.Nodes) || 5 != len(graph.Edges) {
+		t.Fatalf("nodes is %d, edges is %d", len(graph.Nodes), len(graph.Edges))
+	}
+	if graph.Nodes[0].Key != system.Key() || 0 != graph.Nodes[0].Depth {
+		t.Error(graph.Nodes[0])
+	}
+
+	partition, _ := gowbem.ParseInstanceName(`Test_Partition.ID="p3"`)
+	if node := graph.Node(partition); nil == node || 2 != node.Depth {
+		t.Error(node)
+	}
+	disk, _ := gowbem.ParseInstanceName(`Test_Disk.DeviceID="d2"`)
+	found := false
+	for _, edge := range graph.Edges {
+		if edge.To == partition.Key() || edge.From == partition.Key() {
+			found = true
+			if "Test_BasedOn" != edge.Association.ClassName ||
+				edge.From != disk.Key() || "Antecedent" != edge.FromRole || "Dependent" != edge.ToRole {
+				t.Errorf("%#v", edge)
+			}
+		}
+	}
+	if !found {
+		t.Error("edge of p3 isn't found")
+	}
+}
+
+func TestTraverseRules(t *testing.T) {
+	_, c, closer := startCIMOM(t)
+	defer closer()
+	ctx := context.Background()
+
+	system, _ := gowbem.ParseInstanceName(`Test_System.Name="s1"`)
+	graph, err := Traverse(ctx, c, system, Options{Namespace: testNamespace, MaxDepth: 1})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(graph.Nodes) || 2 != len(graph.Edges) {
+		t.Errorf("nodes is %d, edges is %d", len(graph.Nodes), len(graph.Edges))
+	}
+
+	graph, err = Traverse(ctx, c, system, Options{Namespace: testNamespace,
+		Rules: []Rule{{AssocClass: "Test_SystemDevice"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(graph.Nodes) || 2 != len(graph.Edges) {
+		t.Errorf("nodes is %d, edges is %d", len(graph.Nodes), len(graph.Edges))
+	}
+
+	disk, _ := gowbem.ParseInstanceName(`Test_Disk.DeviceID="d1"`)
+	graph, err = Traverse(ctx, c, disk, Options{Namespace: testNamespace,
+		Rules: []Rule{{Role: "Antecedent", ResultRole: "Dependent"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(graph.Nodes) || 2 != len(graph.Edges) {
+		t.Errorf("nodes is %d, edges is %d", len(graph.Nodes), len(graph.Edges))
+	}
+}
+
+// failingClient fails AssociatorNames of d2, the others wait until ctx is
+// canceled.
+type failingClient struct {
+	*gowbem.ClientCIMXML
+}
+
+func (c failingClient) AssociatorNames(ctx context.Context, namespaceName string, instanceName gowbem.CIMInstanceName,
+	assocClass, resultClass, role, resultRole string) ([]gowbem.CIMInstanceName, error) {
+	if "Test_Disk" != instanceName.GetClassName() {
+		return c.ClientCIMXML.AssociatorNames(ctx, namespaceName, instanceName, assocClass, resultClass, role, resultRole)
+	}
+	if "d2" == instanceName.GetKeyBindings().Get(0).GetValue() {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_ACCESS_DENIED, "d2")
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTraverseError(t *testing.T) {
+	_, c, closer := startCIMOM(t)
+	defer closer()
+
+	system, _ := gowbem.ParseInstanceName(`Test_System.Name="s1"`)
+	_, err := Traverse(context.Background(), failingClient{c}, system, Options{Namespace: testNamespace})
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_ACCESS_DENIED != code {
+		t.Error("excepted is CIM_ERR_ACCESS_DENIED, actual is", err)
+	}
+}
+
+func TestGraphExport(t *testing.T) {
+	_, c, closer := startCIMOM(t)
+	defer closer()
+
+	system, _ := gowbem.ParseInstanceName(`Test_System.Name="s1"`)
+	graph, err := Traverse(context.Background(), c, system, Options{Namespace: testNamespace, Instances: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var dot strings.Builder
+	if err := graph.WriteDOT(&dot); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph topology {") || 5 != strings.Count(dot.String(), " -> n") ||
+		!strings.Contains(dot.String(), `[label="Test_System\nName=\"s1\""]`) {
+		t.Error(dot.String())
+	}
+
+	singleton := newGraph()
+	singleton.addNode(&gowbem.CimInstanceName{ClassName: "Test_Singleton",
+		KeyValue: &gowbem.CimKeyValue{ValueType: "string", Value: "v1"}}, 0)
+	dot.Reset()
+	if err := singleton.WriteDOT(&dot); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), `[label="Test_Singleton\n\"v1\""]`) {
+		t.Error(dot.String())
+	}
+
+	bs, err := json.Marshal(graph)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var out struct {
+		Nodes []struct {
+			Key        string
+			Depth      int
+			Properties map[string]interface{}
+		}
+		Edges []struct {
+			From     string
+			FromRole string `json:"from_role"`
+			To       string
+		}
+	}
+	if err := json.Unmarshal(bs, &out); nil != err {
+		t.Fatal(err)
+	}
+	if 6 != len(out.Nodes) || 5 != len(out.Edges) {
+		t.Fatal(string(bs))
+	}
+	if "s1" != out.Nodes[0].Properties["Name"] || "Antecedent" != out.Edges[0].FromRole {
+		t.Error(string(bs))
+	}
+}
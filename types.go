@@ -3,8 +3,6 @@ package gowbem
 import (
 	"encoding/xml"
 	"errors"
-	"net/url"
-	"strconv"
 	"strings"
 )
 
@@ -215,6 +213,26 @@ type CimQualifierDeclaration struct {
 	ValueArray *CimValueArray `xml:"VALUE.ARRAY,omitempty"`
 }
 
+func (self *CimQualifierDeclaration) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimQualifierDeclaration
+	decl := plain{CimQualifierFlavor: defaultQualifierFlavor}
+	if err := d.DecodeElement(&decl, &start); nil != err {
+		return err
+	}
+	*self = CimQualifierDeclaration(decl)
+	return nil
+}
+
+func (self CimQualifierDeclaration) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain CimQualifierDeclaration
+	decl := plain(self)
+	var attrs []xml.Attr
+	decl.CimQualifierFlavor, attrs = marshalFlavor(self.CimQualifierFlavor)
+	start.Name = xml.Name{Local: "QUALIFIER.DECLARATION"}
+	start.Attr = append(start.Attr, attrs...)
+	return e.EncodeElement(decl, start)
+}
+
 //     <xs:element name="SCOPE">
 //         <xs:annotation>
 //             <xs:documentation>Defines the scope of a qualifier type/declaration.
@@ -1084,15 +1102,9 @@ func (self *CimInstanceName) ToString(buf *strings.Builder) {
 		CimKeyBindings(self.KeyBindings).ToString(buf)
 		return
 	}
-	if nil != self.KeyValue {
-		buf.WriteString(".")
-		self.KeyValue.ToString(buf)
-		return
-	}
-
-	if nil != self.ValueReference {
+	if nil != self.KeyValue || nil != self.ValueReference {
 		buf.WriteString(".")
-		self.KeyValue.ToString(buf)
+		formatKeyBindingValue(buf, &CimKeyBinding{KeyValue: self.KeyValue, ValueReference: self.ValueReference})
 		return
 	}
 }
@@ -1204,16 +1216,7 @@ func (self *CimKeyBinding) IsNil() bool {
 func (self *CimKeyBinding) ToString(buf *strings.Builder) {
 	buf.WriteString(self.Name)
 	buf.WriteString("=")
-
-	if nil != self.KeyValue {
-		self.KeyValue.ToString(buf)
-		return
-	}
-
-	if nil != self.ValueReference {
-		buf.WriteString(url.QueryEscape(self.ValueReference.String()))
-		return
-	}
+	formatKeyBindingValue(buf, self)
 }
 
 func (self *CimKeyBinding) String() string {
@@ -1292,34 +1295,7 @@ func (self *CimKeyValue) GetType() string {
 }
 
 func (self *CimKeyValue) ToString(buf *strings.Builder) {
-	t := self.Type
-	if "" == t {
-		t = self.ValueType
-	}
-
-	if "" == t {
-		if "true" == strings.ToLower(self.Value) ||
-			"false" == strings.ToLower(self.Value) {
-			buf.WriteString(self.Value)
-		} else if _, ok := strconv.ParseFloat(self.Value, 64); nil == ok {
-			buf.WriteString(self.Value)
-			//} else if _, e := time.Parse(layout, self.Value); nil == e {
-			//	buf.WriteString(self.Value)
-		} else {
-			buf.WriteString("\"")
-			buf.WriteString(self.Value)
-			buf.WriteString("\"")
-		}
-	} else if "string" == t {
-		buf.WriteString("\"")
-		buf.WriteString(self.Value)
-		buf.WriteString("\"")
-	} else {
-		buf.WriteString("(")
-		buf.WriteString(t)
-		buf.WriteString(")")
-		buf.WriteString(self.Value)
-	}
+	formatKeyBindingValue(buf, &CimKeyBinding{KeyValue: self})
 }
 
 func (self *CimKeyValue) String() string {
@@ -1584,6 +1560,48 @@ type CimQualifierFlavor struct {
 	Translatable bool `xml:"TRANSLATABLE,attr,omitempty"`
 }
 
+// defaultQualifierFlavor is the flavor if the attributes are absent.
+var defaultQualifierFlavor = CimQualifierFlavor{Overridable: true, ToSubclass: true}
+
+// marshalFlavor returns the flavor which is written by omitempty and the
+// attributes of OVERRIDABLE and TOSUBCLASS which differ from the defaults.
+// The zero flavor is the flavor which isn't set, nothing is written.
+func marshalFlavor(flavor CimQualifierFlavor) (CimQualifierFlavor, []xml.Attr) {
+	if (CimQualifierFlavor{}) == flavor {
+		return flavor, nil
+	}
+	var attrs []xml.Attr
+	if !flavor.Overridable {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "OVERRIDABLE"}, Value: "false"})
+	}
+	if !flavor.ToSubclass {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "TOSUBCLASS"}, Value: "false"})
+	}
+	flavor.Overridable = false
+	flavor.ToSubclass = false
+	return flavor, attrs
+}
+
+func (self CimQualifier) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain CimQualifier
+	q := plain(self)
+	var attrs []xml.Attr
+	q.CimQualifierFlavor, attrs = marshalFlavor(self.CimQualifierFlavor)
+	start.Name = xml.Name{Local: "QUALIFIER"}
+	start.Attr = append(start.Attr, attrs...)
+	return e.EncodeElement(q, start)
+}
+
+func (self *CimQualifier) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain CimQualifier
+	q := plain{CimQualifierFlavor: defaultQualifierFlavor}
+	if err := d.DecodeElement(&q, &start); nil != err {
+		return err
+	}
+	*self = CimQualifier(q)
+	return nil
+}
+
 //     <xs:element name="PROPERTY">
 //         <xs:annotation>
 //             <xs:documentation>Defines a non-reference scalar property, that is used as a property value in a CIM instance
@@ -1611,7 +1629,7 @@ type CimProperty struct {
 	Propagated     bool           `xml:"PROPAGATED,attr,omitempty"`
 	EmbeddedObject string         `xml:"EmbeddedObject,attr,omitempty"`
 	Lang           string         `xml:"lang,attr,omitempty"`
-	Qualifiers     []CimQualifier `xml:"QUALIFIER",omitempty`
+	Qualifiers     []CimQualifier `xml:"QUALIFIER,omitempty"`
 	Value          *CimValue      `xml:"VALUE,omitempty"`
 }
 
@@ -2194,7 +2212,7 @@ type CimIParamValue struct {
 	ValueArray           *CimValueArray           `xml:"VALUE.ARRAY,omitempty"`
 	ClassName            *CimClassName            `xml:"CLASSNAME,omitempty"`
 	InstanceName         *CimInstanceName         `xml:"INSTANCENAME,omitempty"`
-	QualifierDeclaration *CimQualifierDeclaration `xml:""QUALIFIER.DECLARATION,omitempty"`
+	QualifierDeclaration *CimQualifierDeclaration `xml:"QUALIFIER.DECLARATION,omitempty"`
 	Class                *CimClass                `xml:"CLASS,omitempty"`
 	Instance             *CimInstance             `xml:"INSTANCE,omitempty"`
 	ValueNamedInstance   *CimValueNamedInstance   `xml:"VALUE.NAMEDINSTANCE,omitempty"`
@@ -2213,7 +2231,7 @@ type CimIParamValue struct {
 //     </xs:element>
 type CimMultiRsp struct {
 	XMLName    xml.Name       `xml:"MULTIRSP"`
-	SimpleRsps []CimSimpleRsp `xml:"SIMPLEREQ"`
+	SimpleRsps []CimSimpleRsp `xml:"SIMPLERSP"`
 }
 
 //     <xs:element name="SIMPLERSP">
@@ -2307,6 +2325,14 @@ type CimInstanceArray struct {
 	Instance []CimInstance `xml:",any,omitempty"`
 }
 
+func (self CimInstanceArray) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if 0 == len(self.Instance) {
+		return nil
+	}
+	type plain CimInstanceArray
+	return e.EncodeElement(plain(self), start)
+}
+
 //     <xs:element name="RETURNVALUE">
 //         <xs:annotation>
 //             <xs:documentation>Defines the return value of an extrinsic (= class defined) method within a response.
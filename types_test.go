@@ -394,6 +394,7 @@ func TestMultiReq(t *testing.T) {
 
 	opts := []cmp.Option{
 		cmpopts.IgnoreFields(xml.Name{}, "Local"),
+		flavorDefaults,
 		cmpopts.IgnoreUnexported(CIM{}),
 	}
 	if !cmp.Equal(*req, req2, opts...) {
@@ -673,6 +674,7 @@ func TestCimClass(t *testing.T) {
 	// }
 	opts := []cmp.Option{
 		cmpopts.IgnoreFields(xml.Name{}, "Local"),
+		flavorDefaults,
 	}
 	if !cmp.Equal(*class, cls2, opts...) {
 		t.Error(cmp.Diff(*class, cls2, opts...))
@@ -1058,8 +1060,64 @@ func TestCimDeclaration(t *testing.T) {
 
 	opts := []cmp.Option{
 		cmpopts.IgnoreFields(xml.Name{}, "Local"),
+		flavorDefaults,
 	}
 	if !cmp.Equal(declaration, declaration2, opts...) {
 		t.Error(cmp.Diff(declaration, declaration2, opts...))
 	}
 }
+
+func TestQualifierFlavorDefaults(t *testing.T) {
+	var q CimQualifier
+	if e := xml.Unmarshal([]byte(`<QUALIFIER NAME="Abstract" TYPE="boolean" TOSUBCLASS="false"><VALUE>TRUE</VALUE></QUALIFIER>`), &q); nil != e {
+		t.Fatal(e)
+	}
+	if !q.Overridable || q.ToSubclass || q.Translatable {
+		t.Errorf("%#v", q.CimQualifierFlavor)
+	}
+
+	bs, e := xml.Marshal(&q)
+	if nil != e {
+		t.Fatal(e)
+	}
+	var q2 CimQualifier
+	if e := xml.Unmarshal(bs, &q2); nil != e {
+		t.Fatal(e)
+	}
+	if q.CimQualifierFlavor != q2.CimQualifierFlavor {
+		t.Error(string(bs))
+	}
+}
+
+// flavorDefaults compares the zero flavor as the defaults, the zero flavor
+// isn't written and the defaults are read back.
+var flavorDefaults = cmp.Transformer("flavorDefaults", func(flavor CimQualifierFlavor) CimQualifierFlavor {
+	if (CimQualifierFlavor{}) == flavor {
+		return defaultQualifierFlavor
+	}
+	return flavor
+})
+
+func TestQualifierFlavorMarshal(t *testing.T) {
+	for _, test := range []struct {
+		q        CimQualifier
+		excepted string
+	}{
+		{q: CimQualifier{Name: "Description", Type: "string"},
+			excepted: `<QUALIFIER NAME="Description" TYPE="string"></QUALIFIER>`},
+		{q: CimQualifier{CimQualifierFlavor: defaultQualifierFlavor, Name: "Description", Type: "string"},
+			excepted: `<QUALIFIER NAME="Description" TYPE="string"></QUALIFIER>`},
+		{q: CimQualifier{CimQualifierFlavor: CimQualifierFlavor{ToSubclass: true}, Name: "Key", Type: "boolean"},
+			excepted: `<QUALIFIER OVERRIDABLE="false" NAME="Key" TYPE="boolean"></QUALIFIER>`},
+		{q: CimQualifier{CimQualifierFlavor: CimQualifierFlavor{Overridable: true, Translatable: true}, Name: "DisplayName", Type: "string"},
+			excepted: `<QUALIFIER TOSUBCLASS="false" TRANSLATABLE="true" NAME="DisplayName" TYPE="string"></QUALIFIER>`},
+	} {
+		bs, e := xml.Marshal(test.q)
+		if nil != e {
+			t.Fatal(e)
+		}
+		if test.excepted != string(bs) {
+			t.Errorf("excepted is %s, actual is %s", test.excepted, bs)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package gowbem
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInstanceNameRoundTrip(t *testing.T) {
+	system := &CimInstanceName{ClassName: "CIM_ComputerSystem", KeyBindings: []CimKeyBinding{
+		{Name: "CreationClassName", KeyValue: &CimKeyValue{ValueType: "string", Value: "CIM_ComputerSystem"}},
+		{Name: "Name", KeyValue: &CimKeyValue{ValueType: "string", Value: `a "quoted" \ name`}},
+	}}
+
+	for _, name := range []*CimInstanceName{
+		{ClassName: "CIM_SystemDevice", KeyBindings: []CimKeyBinding{
+			{Name: "GroupComponent", ValueReference: &CimValueReference{LocalInstancePath: &CimLocalInstancePath{
+				LocalNamespacePath: CimLocalNamespacePath{Namespaces: ToCimNamespace("root/cimv2")},
+				InstanceName:       *system}}},
+			{Name: "PartComponent", ValueReference: &CimValueReference{InstanceName: &CimInstanceName{
+				ClassName: "CIM_Disk", KeyBindings: []CimKeyBinding{
+					{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "numeric", Type: "uint32", Value: "1"}},
+				}}}},
+		}},
+		{ClassName: "CIM_ElementConformsToProfile", KeyBindings: []CimKeyBinding{
+			{Name: "ConformantStandard", ValueReference: &CimValueReference{InstancePath: &CimInstancePath{
+				NamespacePath: CimNamespacePath{Host: CimHost{Value: "server:5989"},
+					LocalNamespacePath: CimLocalNamespacePath{Namespaces: ToCimNamespace("root/interop")}},
+				InstanceName: CimInstanceName{ClassName: "CIM_RegisteredProfile", KeyBindings: []CimKeyBinding{
+					{Name: "InstanceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "DMTF:Profile"}},
+				}}}}},
+			{Name: "ManagedElement", ValueReference: &CimValueReference{InstanceName: system}},
+		}},
+		{ClassName: "CIM_Test", KeyBindings: []CimKeyBinding{
+			{Name: "ClassRef", ValueReference: &CimValueReference{ClassName: &CimClassName{Name: "CIM_Disk"}}},
+			{Name: "PathLike", KeyValue: &CimKeyValue{ValueType: "string", Value: `CIM_Disk.DeviceID="1"`}},
+			{Name: "Flag", KeyValue: &CimKeyValue{ValueType: "boolean", Value: "true"}},
+		}},
+		{ClassName: "CIM_Singleton", KeyValue: &CimKeyValue{ValueType: "string", Value: "only"}},
+		{ClassName: "CIM_Singleton", KeyValue: &CimKeyValue{ValueType: "numeric", Value: "12"}},
+		{ClassName: "CIM_Singleton", ValueReference: &CimValueReference{InstanceName: system}},
+	} {
+		s := name.String()
+		parsed, err := ParseInstanceName(s)
+		if nil != err {
+			t.Error(s, err)
+			continue
+		}
+		if s != parsed.String() {
+			t.Errorf("excepted is %s, actual is %s", s, parsed.String())
+		}
+		if !name.Equal(parsed) {
+			t.Errorf("%s: %s != %s", s, name.Key(), parsed.Key())
+		}
+	}
+}
+
+func TestParseInstanceNameTestFiles(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testfiles", "*.xml"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, file := range files {
+		for _, name := range readInstanceNames(t, file) {
+			s := name.String()
+			parsed, err := ParseInstanceName(s)
+			if nil != err {
+				t.Error(file, s, err)
+				continue
+			}
+			if s != parsed.String() || !name.Equal(parsed) {
+				t.Errorf("%s: excepted is %s, actual is %s", file, s, parsed.String())
+			}
+			count++
+		}
+	}
+	if 0 == count {
+		t.Error("instance names aren't found")
+	}
+}
+
+func readInstanceNames(t *testing.T, file string) []*CimInstanceName {
+	in, err := os.Open(file)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var names []*CimInstanceName
+	decoder := xml.NewDecoder(in)
+	for {
+		token, err := decoder.Token()
+		if nil != err {
+			if io.EOF != err {
+				t.Log(file, err)
+			}
+			return names
+		}
+		if start, ok := token.(xml.StartElement); ok && "INSTANCENAME" == start.Name.Local {
+			name := &CimInstanceName{}
+			if err := decoder.DecodeElement(name, &start); nil != err {
+				t.Error(file, err)
+				return names
+			}
+			names = append(names, name)
+		}
+	}
+}
+
+func TestParseKeyBindings(t *testing.T) {
+	keyBindings, err := ParseKeyBindings(`Name="a,b",ID=(uint16)7`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	excepted := CimKeyBindings{
+		{Name: "Name", KeyValue: &CimKeyValue{ValueType: "string", Value: "a,b"}},
+		{Name: "ID", KeyValue: &CimKeyValue{ValueType: "numeric", Type: "uint16", Value: "7"}},
+	}
+	if !reflect.DeepEqual(excepted, keyBindings) {
+		t.Errorf("%#v", keyBindings)
+	}
+
+	if _, err := ParseInstanceName(`root/cimv2:CIM_Disk.DeviceID="1"`); nil == err {
+		t.Error("namespace isn't empty")
+	}
+	path, err := ParseLocalInstancePath(`root/cimv2:CIM_Disk.DeviceID="1"`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "root/cimv2" != path.LocalNamespacePath.String() || "CIM_Disk" != path.InstanceName.ClassName {
+		t.Errorf("%#v", path)
+	}
+}
@@ -0,0 +1,407 @@
+package gowbem
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is the error of a property or a parameter.
+type FieldError struct {
+	// Field is the name of the property or the parameter.
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if "" == e.Field {
+		return e.Message
+	}
+	return "'" + e.Field + "' " + e.Message
+}
+
+// ValidationErrors is returned by ValidateInstance and ValidateParameters.
+type ValidationErrors []*FieldError
+
+func (errs ValidationErrors) Error() string {
+	if 1 == len(errs) {
+		return errs[0].Error()
+	}
+	var buf strings.Builder
+	buf.WriteString("validate failed:")
+	for _, e := range errs {
+		buf.WriteString("\r\n\t")
+		buf.WriteString(e.Error())
+	}
+	return buf.String()
+}
+
+// Field returns the errors of the field, the case is ignored.
+func (errs ValidationErrors) Field(name string) []*FieldError {
+	var results []*FieldError
+	for _, e := range errs {
+		if strings.EqualFold(e.Field, name) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+type fieldDecl struct {
+	name       string
+	typ        string
+	isArray    bool
+	isRef      bool
+	qualifiers []CimQualifier
+}
+
+type fieldValue struct {
+	typ     string
+	isArray bool
+	isRef   bool
+	isNull  bool
+	// values are the values of the elements, nil is a null element.
+	values []*string
+}
+
+// ValidateInstance checks the instance against the class, the class should
+// have the inherited properties and the qualifiers, see SchemaCache.GetClass.
+// It returns ValidationErrors if the instance is invalid.
+func ValidateInstance(class *CimClass, instance *CimInstance) error {
+	var errs ValidationErrors
+	if "" != instance.ClassName && !strings.EqualFold(instance.ClassName, class.Name) {
+		errs = append(errs, &FieldError{Message: "class name '" + instance.ClassName + "' isn't '" + class.Name + "'"})
+	}
+
+	values := map[string]fieldValue{}
+	for _, pr := range instance.Properties {
+		name := anyPropertyName(pr)
+		local := findAnyProperty(class.Properties, name)
+		if nil == local {
+			errs = append(errs, &FieldError{Field: name, Message: "isn't a property of the class '" + class.Name + "'"})
+			continue
+		}
+		value := propertyValue(pr)
+		values[strings.ToLower(name)] = value
+		errs = append(errs, validateField(propertyDecl(*local), value)...)
+	}
+
+	for _, pr := range class.Properties {
+		decl := propertyDecl(pr)
+		if !hasTrueQualifier(decl.qualifiers, "Key") && !hasTrueQualifier(decl.qualifiers, "Required") {
+			continue
+		}
+		if value, ok := values[strings.ToLower(decl.name)]; !ok || value.isNull {
+			if hasTrueQualifier(decl.qualifiers, "Key") {
+				errs = append(errs, &FieldError{Field: decl.name, Message: "is a key, it is required"})
+			} else {
+				errs = append(errs, &FieldError{Field: decl.name, Message: "is required"})
+			}
+		}
+	}
+	if 0 == len(errs) {
+		return nil
+	}
+	return errs
+}
+
+// ValidateParameters checks the input parameters against the method, it
+// returns ValidationErrors if the parameters are invalid.
+func ValidateParameters(method *CimMethod, params []CIMParamValue) error {
+	var errs ValidationErrors
+	values := map[string]fieldValue{}
+	for _, param := range params {
+		name := param.GetName()
+		var decl *fieldDecl
+		for _, p := range method.Parameters {
+			if d := parameterDecl(p); strings.EqualFold(d.name, name) {
+				decl = &d
+				break
+			}
+		}
+		if nil == decl {
+			errs = append(errs, &FieldError{Field: name, Message: "isn't a parameter of the method '" + method.Name + "'"})
+			continue
+		}
+		if !isInParameter(decl.qualifiers) {
+			errs = append(errs, &FieldError{Field: name, Message: "is an output parameter"})
+			continue
+		}
+
+		paramValue, ok := param.(*CimParamValue)
+		if !ok {
+			continue
+		}
+		value := parameterValue(paramValue)
+		values[strings.ToLower(name)] = value
+		errs = append(errs, validateField(*decl, value)...)
+	}
+
+	for _, p := range method.Parameters {
+		decl := parameterDecl(p)
+		if !hasTrueQualifier(decl.qualifiers, "Required") || !isInParameter(decl.qualifiers) {
+			continue
+		}
+		if value, ok := values[strings.ToLower(decl.name)]; !ok || value.isNull {
+			errs = append(errs, &FieldError{Field: decl.name, Message: "is required"})
+		}
+	}
+	if 0 == len(errs) {
+		return nil
+	}
+	return errs
+}
+
+func propertyDecl(pr CimAnyProperty) fieldDecl {
+	switch {
+	case nil != pr.Property:
+		return fieldDecl{name: pr.Property.Name, typ: pr.Property.Type, qualifiers: pr.Property.Qualifiers}
+	case nil != pr.PropertyArray:
+		return fieldDecl{name: pr.PropertyArray.Name, typ: pr.PropertyArray.Type, isArray: true, qualifiers: pr.PropertyArray.Qualifiers}
+	case nil != pr.PropertyReference:
+		return fieldDecl{name: pr.PropertyReference.Name, typ: "reference", isRef: true, qualifiers: pr.PropertyReference.Qualifiers}
+	}
+	return fieldDecl{}
+}
+
+func propertyValue(pr CimAnyProperty) fieldValue {
+	switch {
+	case nil != pr.Property:
+		value := fieldValue{typ: pr.Property.Type, isNull: nil == pr.Property.Value}
+		if nil != pr.Property.Value {
+			value.values = []*string{&pr.Property.Value.Value}
+		}
+		return value
+	case nil != pr.PropertyArray:
+		value := fieldValue{typ: pr.PropertyArray.Type, isArray: true, isNull: nil == pr.PropertyArray.ValueArray}
+		if nil != pr.PropertyArray.ValueArray {
+			value.values = arrayValues(pr.PropertyArray.ValueArray)
+		}
+		return value
+	case nil != pr.PropertyReference:
+		return fieldValue{typ: "reference", isRef: true, isNull: nil == pr.PropertyReference.ValueReference}
+	}
+	return fieldValue{isNull: true}
+}
+
+func parameterDecl(p CimAnyParameter) fieldDecl {
+	switch {
+	case nil != p.Parameter:
+		return fieldDecl{name: p.Parameter.Name, typ: p.Parameter.Type, qualifiers: p.Parameter.Qualifiers}
+	case nil != p.ParameterArray:
+		return fieldDecl{name: p.ParameterArray.Name, typ: p.ParameterArray.Type, isArray: true, qualifiers: p.ParameterArray.Qualifiers}
+	case nil != p.ParameterReference:
+		return fieldDecl{name: p.ParameterReference.Name, typ: "reference", isRef: true, qualifiers: p.ParameterReference.Qualifiers}
+	case nil != p.ParameterRefArray:
+		return fieldDecl{name: p.ParameterRefArray.Name, typ: "reference", isArray: true, isRef: true, qualifiers: p.ParameterRefArray.Qualifiers}
+	}
+	return fieldDecl{}
+}
+
+func parameterValue(p *CimParamValue) fieldValue {
+	switch {
+	case nil != p.Value:
+		return fieldValue{typ: p.ParamType, values: []*string{&p.Value.Value}}
+	case nil != p.ValueArray:
+		return fieldValue{typ: p.ParamType, isArray: true, values: arrayValues(p.ValueArray)}
+	case nil != p.ValueReference, nil != p.InstanceName, nil != p.ClassName:
+		return fieldValue{typ: "reference", isRef: true}
+	case nil != p.ValueRefArray:
+		return fieldValue{typ: "reference", isRef: true, isArray: true}
+	case nil != p.Instance, nil != p.ValueNamedInstance, nil != p.Class:
+		return fieldValue{typ: p.ParamType}
+	}
+	return fieldValue{typ: p.ParamType, isNull: true}
+}
+
+func arrayValues(array *CimValueArray) []*string {
+	values := make([]*string, len(array.Values))
+	for idx := range array.Values {
+		if nil != array.Values[idx].Value {
+			values[idx] = &array.Values[idx].Value.Value
+		}
+	}
+	return values
+}
+
+func isInParameter(qualifiers []CimQualifier) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold("In", q.Name) {
+			return nil == q.Value || !strings.EqualFold("false", strings.TrimSpace(q.Value.Value))
+		}
+	}
+	return true
+}
+
+func hasTrueQualifier(qualifiers []CimQualifier, name string) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, name) {
+			return nil == q.Value || strings.EqualFold("true", strings.TrimSpace(q.Value.Value))
+		}
+	}
+	return false
+}
+
+func validateField(decl fieldDecl, value fieldValue) []*FieldError {
+	if decl.isRef != value.isRef {
+		if decl.isRef {
+			return []*FieldError{{Field: decl.name, Message: "is a reference"}}
+		}
+		return []*FieldError{{Field: decl.name, Message: "isn't a reference"}}
+	}
+	if decl.isArray != value.isArray && !value.isNull {
+		if decl.isArray {
+			return []*FieldError{{Field: decl.name, Message: "is an array"}}
+		}
+		return []*FieldError{{Field: decl.name, Message: "isn't an array"}}
+	}
+	if decl.isRef {
+		return nil
+	}
+	if "" != value.typ && !strings.EqualFold(decl.typ, value.typ) {
+		return []*FieldError{{Field: decl.name, Message: "type is '" + decl.typ + "', but got '" + value.typ + "'"}}
+	}
+
+	var errs []*FieldError
+	var valueMap *ValueMap
+	if vm, vs := qualifierStrings(decl.qualifiers, "ValueMap"), qualifierStrings(decl.qualifiers, "Values"); 0 != len(vm) || 0 != len(vs) {
+		valueMap, _ = NewValueMap(vm, vs)
+	}
+	maxLen, hasMaxLen := qualifierInt(decl.qualifiers, "MaxLen")
+	minLen, hasMinLen := qualifierInt(decl.qualifiers, "MinLen")
+	minValue, hasMinValue := qualifierNumber(decl.qualifiers, "MinValue")
+	maxValue, hasMaxValue := qualifierNumber(decl.qualifiers, "MaxValue")
+
+	for idx, s := range value.values {
+		if nil == s {
+			continue
+		}
+		field := decl.name
+		if value.isArray {
+			field = decl.name + "[" + strconv.Itoa(idx) + "]"
+		}
+		if msg := checkValueType(decl.typ, *s); "" != msg {
+			errs = append(errs, &FieldError{Field: field, Message: msg})
+			continue
+		}
+		if isStringType(decl.typ) {
+			n := int64(utf8.RuneCountInString(*s))
+			if hasMaxLen && n > maxLen {
+				errs = append(errs, &FieldError{Field: field, Message: "is longer than " + strconv.FormatInt(maxLen, 10)})
+			}
+			if hasMinLen && n < minLen {
+				errs = append(errs, &FieldError{Field: field, Message: "is shorter than " + strconv.FormatInt(minLen, 10)})
+			}
+		} else if isNumberType(decl.typ) {
+			v, _ := new(big.Float).SetString(strings.TrimSpace(*s))
+			if hasMinValue && nil != v && v.Cmp(minValue) < 0 {
+				errs = append(errs, &FieldError{Field: field, Message: "is less than " + minValue.String()})
+			}
+			if hasMaxValue && nil != v && v.Cmp(maxValue) > 0 {
+				errs = append(errs, &FieldError{Field: field, Message: "is greater than " + maxValue.String()})
+			}
+		}
+		if nil != valueMap {
+			if _, ok := valueMap.Lookup(*s); !ok {
+				errs = append(errs, &FieldError{Field: field, Message: "'" + *s + "' isn't in the ValueMap"})
+			}
+		}
+	}
+	return errs
+}
+
+func qualifierInt(qualifiers []CimQualifier, name string) (int64, bool) {
+	values := qualifierStrings(qualifiers, name)
+	if 0 == len(values) {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+	return i, nil == err
+}
+
+func qualifierNumber(qualifiers []CimQualifier, name string) (*big.Float, bool) {
+	values := qualifierStrings(qualifiers, name)
+	if 0 == len(values) {
+		return nil, false
+	}
+	f, ok := new(big.Float).SetString(strings.TrimSpace(values[0]))
+	return f, ok
+}
+
+func isStringType(typ string) bool {
+	return strings.EqualFold("string", typ) || strings.EqualFold("char16", typ)
+}
+
+func isNumberType(typ string) bool {
+	switch strings.ToLower(typ) {
+	case "uint8", "uint16", "uint32", "uint64", "sint8", "sint16", "sint32", "sint64", "real32", "real64":
+		return true
+	}
+	return false
+}
+
+// checkValueType returns the error message if the string isn't a value of
+// the type.
+func checkValueType(typ, s string) string {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(typ) {
+	case "boolean":
+		if !strings.EqualFold("true", s) && !strings.EqualFold("false", s) {
+			return "'" + s + "' isn't a boolean"
+		}
+	case "uint8", "uint16", "uint32", "uint64":
+		bits, _ := strconv.Atoi(typ[4:])
+		if _, err := strconv.ParseUint(s, 0, bits); nil != err {
+			return "'" + s + "' isn't a " + strings.ToLower(typ)
+		}
+	case "sint8", "sint16", "sint32", "sint64":
+		bits, _ := strconv.Atoi(typ[4:])
+		if _, err := strconv.ParseInt(s, 0, bits); nil != err {
+			return "'" + s + "' isn't a " + strings.ToLower(typ)
+		}
+	case "real32", "real64":
+		bits, _ := strconv.Atoi(typ[4:])
+		if _, err := strconv.ParseFloat(s, bits); nil != err {
+			return "'" + s + "' isn't a " + strings.ToLower(typ)
+		}
+	case "char16":
+		if 1 != utf8.RuneCountInString(s) {
+			return "'" + s + "' isn't a char16"
+		}
+	case "datetime":
+		if !isDatetime(s) {
+			return "'" + s + "' isn't a datetime"
+		}
+	}
+	return ""
+}
+
+// isDatetime checks the format of DSP0004, the timestamp is
+// yyyymmddhhmmss.mmmmmmsutc and the interval is ddddddddhhmmss.mmmmmm:000,
+// the asterisks are allowed for the unused fields.
+func isDatetime(s string) bool {
+	if 25 != len(s) || '.' != s[14] {
+		return false
+	}
+	for idx := 0; idx < 21; idx++ {
+		if 14 == idx {
+			continue
+		}
+		if c := s[idx]; ('0' > c || '9' < c) && '*' != c {
+			return false
+		}
+	}
+	switch s[21] {
+	case '+', '-':
+		for _, c := range s[22:] {
+			if ('0' > c || '9' < c) && '*' != c {
+				return false
+			}
+		}
+		return true
+	case ':':
+		return "000" == s[22:]
+	}
+	return false
+}
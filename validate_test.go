@@ -0,0 +1,128 @@
+package gowbem
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const validateClass = `<CLASS NAME="Test_Account">
+  <PROPERTY NAME="UserID" TYPE="string">
+    <QUALIFIER NAME="Key" TYPE="boolean"><VALUE>true</VALUE></QUALIFIER>
+    <QUALIFIER NAME="MaxLen" TYPE="uint32"><VALUE>8</VALUE></QUALIFIER>
+  </PROPERTY>
+  <PROPERTY NAME="Name" TYPE="string">
+    <QUALIFIER NAME="Required" TYPE="boolean"><VALUE>true</VALUE></QUALIFIER>
+  </PROPERTY>
+  <PROPERTY NAME="Age" TYPE="uint8">
+    <QUALIFIER NAME="MinValue" TYPE="sint64"><VALUE>18</VALUE></QUALIFIER>
+    <QUALIFIER NAME="MaxValue" TYPE="sint64"><VALUE>99</VALUE></QUALIFIER>
+  </PROPERTY>
+  <PROPERTY.ARRAY NAME="Roles" TYPE="uint16">
+    <QUALIFIER NAME="ValueMap" TYPE="string">
+      <VALUE.ARRAY><VALUE>1</VALUE><VALUE>2</VALUE><VALUE>0x8000..</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+  </PROPERTY.ARRAY>
+  <PROPERTY NAME="Created" TYPE="datetime"></PROPERTY>
+  <PROPERTY.REFERENCE NAME="Owner" REFERENCECLASS="Test_Account"></PROPERTY.REFERENCE>
+  <METHOD NAME="ChangePassword" TYPE="uint32">
+    <PARAMETER NAME="Password" TYPE="string">
+      <QUALIFIER NAME="Required" TYPE="boolean"><VALUE>true</VALUE></QUALIFIER>
+      <QUALIFIER NAME="MinLen" TYPE="uint32"><VALUE>6</VALUE></QUALIFIER>
+    </PARAMETER>
+    <PARAMETER.ARRAY NAME="Flags" TYPE="uint16"></PARAMETER.ARRAY>
+    <PARAMETER.REFERENCE NAME="Job" REFERENCECLASS="CIM_ConcreteJob">
+      <QUALIFIER NAME="In" TYPE="boolean"><VALUE>false</VALUE></QUALIFIER>
+      <QUALIFIER NAME="Out" TYPE="boolean"><VALUE>true</VALUE></QUALIFIER>
+    </PARAMETER.REFERENCE>
+  </METHOD>
+</CLASS>`
+
+func TestValidateInstance(t *testing.T) {
+	var class CimClass
+	if err := xml.Unmarshal([]byte(validateClass), &class); nil != err {
+		t.Fatal(err)
+	}
+
+	valid := &CimInstance{ClassName: "Test_Account", Properties: []CimAnyProperty{
+		{Property: &CimProperty{Name: "UserID", Type: "string", Value: &CimValue{Value: "u1"}}},
+		{Property: &CimProperty{Name: "Name", Type: "string", Value: &CimValue{Value: "user"}}},
+		{Property: &CimProperty{Name: "Age", Value: &CimValue{Value: "20"}}},
+		{PropertyArray: &CimPropertyArray{Name: "Roles", Type: "uint16", ValueArray: &CimValueArray{
+			Values: []CimValueOrNull{{Value: &CimValue{Value: "2"}}, {Value: &CimValue{Value: "32770"}}}}}},
+		{Property: &CimProperty{Name: "Created", Type: "datetime", Value: &CimValue{Value: "20200102030405.000000+480"}}},
+	}}
+	if err := ValidateInstance(&class, valid); nil != err {
+		t.Fatal(err)
+	}
+
+	invalid := &CimInstance{ClassName: "Test_Account", Properties: []CimAnyProperty{
+		{Property: &CimProperty{Name: "UserID", Type: "string", Value: &CimValue{Value: "too long user"}}},
+		{Property: &CimProperty{Name: "Age", Value: &CimValue{Value: "17"}}},
+		{Property: &CimProperty{Name: "Roles", Type: "uint16", Value: &CimValue{Value: "1"}}},
+		{Property: &CimProperty{Name: "Created", Type: "string", Value: &CimValue{Value: "now"}}},
+		{Property: &CimProperty{Name: "Owner", Value: &CimValue{Value: "u2"}}},
+		{Property: &CimProperty{Name: "Unknown", Type: "string", Value: &CimValue{Value: "a"}}},
+	}}
+	err := ValidateInstance(&class, invalid)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"UserID", "Name", "Age", "Roles", "Created", "Owner", "Unknown"} {
+		if 1 != len(errs.Field(name)) {
+			t.Errorf("%s: %v", name, errs.Field(name))
+		}
+	}
+	if 7 != len(errs) {
+		t.Error(err)
+	}
+
+	invalid = &CimInstance{ClassName: "Test_Account", Properties: []CimAnyProperty{
+		{Property: &CimProperty{Name: "UserID", Value: &CimValue{Value: "u1"}}},
+		{Property: &CimProperty{Name: "Name", Value: &CimValue{Value: "user"}}},
+		{Property: &CimProperty{Name: "Age", Value: &CimValue{Value: "256"}}},
+		{PropertyArray: &CimPropertyArray{Name: "Roles", ValueArray: &CimValueArray{
+			Values: []CimValueOrNull{{Value: &CimValue{Value: "3"}}, {Null: &CimValueNull{}}}}}},
+	}}
+	errs, _ = ValidateInstance(&class, invalid).(ValidationErrors)
+	if 2 != len(errs) || 1 != len(errs.Field("Age")) || 1 != len(errs.Field("Roles[0]")) {
+		t.Error(errs)
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	var class CimClass
+	if err := xml.Unmarshal([]byte(validateClass), &class); nil != err {
+		t.Fatal(err)
+	}
+	method := &class.Methods[0]
+
+	if err := ValidateParameters(method, []CIMParamValue{
+		&CimParamValue{Name: "Password", Value: &CimValue{Value: "secret"}},
+		&CimParamValue{Name: "Flags", ValueArray: &CimValueArray{Values: []CimValueOrNull{{Value: &CimValue{Value: "1"}}}}},
+	}); nil != err {
+		t.Fatal(err)
+	}
+
+	err := ValidateParameters(method, []CIMParamValue{
+		&CimParamValue{Name: "Flags", Value: &CimValue{Value: "1"}},
+		&CimParamValue{Name: "Job", ValueReference: &CimValueReference{}},
+		&CimParamValue{Name: "Other", Value: &CimValue{Value: "1"}},
+	})
+	errs, ok := err.(ValidationErrors)
+	if !ok || 4 != len(errs) {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Password", "Flags", "Job", "Other"} {
+		if 1 != len(errs.Field(name)) {
+			t.Errorf("%s: %v", name, errs.Field(name))
+		}
+	}
+
+	errs, _ = ValidateParameters(method, []CIMParamValue{
+		&CimParamValue{Name: "password", ParamType: "string", Value: &CimValue{Value: "short"}},
+	}).(ValidationErrors)
+	if 1 != len(errs) || "is shorter than 6" != errs[0].Message {
+		t.Error(errs)
+	}
+}
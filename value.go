@@ -0,0 +1,195 @@
+package gowbem
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseValue converts the string of the value into the Go value of the CIM
+// type, the integers are uint8 ... int64, the reals are float32 and
+// float64, the datetime is a time.Time or a time.Duration for the interval,
+// it is kept as the string if some fields are the asterisks.
+func ParseValue(typ, s string) (interface{}, error) {
+	t := strings.TrimSpace(s)
+	switch strings.ToLower(typ) {
+	case "boolean":
+		switch {
+		case strings.EqualFold("true", t):
+			return true, nil
+		case strings.EqualFold("false", t):
+			return false, nil
+		}
+		return nil, errors.New("'" + s + "' isn't a boolean")
+	case "uint8", "uint16", "uint32", "uint64":
+		bits, _ := strconv.Atoi(typ[4:])
+		u, err := strconv.ParseUint(t, 10, bits)
+		if nil != err {
+			if u, err = strconv.ParseUint(t, 0, bits); nil != err {
+				return nil, errors.New("'" + s + "' isn't a " + strings.ToLower(typ))
+			}
+		}
+		switch bits {
+		case 8:
+			return uint8(u), nil
+		case 16:
+			return uint16(u), nil
+		case 32:
+			return uint32(u), nil
+		}
+		return u, nil
+	case "sint8", "sint16", "sint32", "sint64":
+		bits, _ := strconv.Atoi(typ[4:])
+		i, err := strconv.ParseInt(t, 10, bits)
+		if nil != err {
+			if i, err = strconv.ParseInt(t, 0, bits); nil != err {
+				return nil, errors.New("'" + s + "' isn't a " + strings.ToLower(typ))
+			}
+		}
+		switch bits {
+		case 8:
+			return int8(i), nil
+		case 16:
+			return int16(i), nil
+		case 32:
+			return int32(i), nil
+		}
+		return i, nil
+	case "real32":
+		f, err := strconv.ParseFloat(t, 32)
+		if nil != err {
+			return nil, errors.New("'" + s + "' isn't a real32")
+		}
+		return float32(f), nil
+	case "real64":
+		f, err := strconv.ParseFloat(t, 64)
+		if nil != err {
+			return nil, errors.New("'" + s + "' isn't a real64")
+		}
+		return f, nil
+	case "datetime":
+		if v, err := ParseDatetime(t); nil == err {
+			return v, nil
+		}
+		if !isDatetime(t) {
+			return nil, errors.New("'" + s + "' isn't a datetime")
+		}
+		return s, nil
+	case "reference":
+		return ParseObjectPath(t)
+	}
+	return s, nil
+}
+
+// FormatValue converts the Go value into the string of the CIM type, the
+// value may be a string, a boolean, a number or the types derived from
+// them, the time.Time and the time.Duration are accepted for the datetime.
+func FormatValue(typ string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", errors.New("value is nil")
+	case time.Time:
+		if strings.EqualFold("datetime", typ) || "" == typ {
+			return FormatDatetime(v), nil
+		}
+	case time.Duration:
+		if strings.EqualFold("datetime", typ) || "" == typ {
+			return FormatInterval(v), nil
+		}
+	case *ObjectPath:
+		return v.String(), nil
+	case CIMInstanceName:
+		return v.String(), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if reflect.Ptr == rv.Kind() {
+		if rv.IsNil() {
+			return "", errors.New("value is nil")
+		}
+		return FormatValue(typ, rv.Elem().Interface())
+	}
+
+	var s string
+	switch rv.Kind() {
+	case reflect.String:
+		s = rv.String()
+	case reflect.Bool:
+		if "" != typ && !strings.EqualFold("boolean", typ) {
+			return "", errors.New("boolean isn't a " + strings.ToLower(typ))
+		}
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32:
+		s = strconv.FormatFloat(rv.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		s = strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+	default:
+		return "", errors.New("type '" + fmt.Sprintf("%T", value) + "' isn't supported")
+	}
+	if msg := checkValueType(typ, s); "" != msg {
+		return "", errors.New(msg)
+	}
+	return s, nil
+}
+
+// FormatDatetime formats the time as yyyymmddhhmmss.mmmmmmsutc.
+func FormatDatetime(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%s.%06d%c%03d", t.Format("20060102150405"), t.Nanosecond()/1000, sign, offset/60)
+}
+
+// FormatInterval formats the duration as ddddddddhhmmss.mmmmmm:000.
+func FormatInterval(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	return fmt.Sprintf("%08d%02d%02d%02d.%06d:000", days, hours, minutes, seconds, d/time.Microsecond)
+}
+
+// ParseDatetime parses the timestamp into a time.Time and the interval into
+// a time.Duration, an error is returned if some fields are the asterisks.
+func ParseDatetime(s string) (interface{}, error) {
+	if !isDatetime(s) || strings.Contains(s, "*") {
+		return nil, errors.New("'" + s + "' isn't a datetime")
+	}
+	micro, _ := strconv.Atoi(s[15:21])
+	if ':' == s[21] {
+		days, _ := strconv.Atoi(s[:8])
+		hours, _ := strconv.Atoi(s[8:10])
+		minutes, _ := strconv.Atoi(s[10:12])
+		seconds, _ := strconv.Atoi(s[12:14])
+		return time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour +
+			time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second +
+			time.Duration(micro)*time.Microsecond, nil
+	}
+
+	offset, _ := strconv.Atoi(s[22:])
+	if '-' == s[21] {
+		offset = -offset
+	}
+	t, err := time.ParseInLocation("20060102150405", s[:14], time.FixedZone("", offset*60))
+	if nil != err {
+		return nil, errors.New("'" + s + "' isn't a datetime")
+	}
+	return t.Add(time.Duration(micro) * time.Microsecond), nil
+}
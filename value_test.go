@@ -0,0 +1,103 @@
+package gowbem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseValue(t *testing.T) {
+	for _, test := range []struct {
+		typ   string
+		s     string
+		value interface{}
+	}{
+		{"boolean", "TRUE", true},
+		{"uint8", "255", uint8(255)},
+		{"uint16", "0x10", uint16(16)},
+		{"uint64", "18446744073709551615", uint64(18446744073709551615)},
+		{"sint32", "-12", int32(-12)},
+		{"real64", "1.5", float64(1.5)},
+		{"string", " a ", " a "},
+		{"datetime", "00000001020304.000005:000", 26*time.Hour + 3*time.Minute + 4*time.Second + 5*time.Microsecond},
+		{"datetime", "2026101912****.******+000", "2026101912****.******+000"},
+	} {
+		value, err := ParseValue(test.typ, test.s)
+		if nil != err {
+			t.Error(test.typ, test.s, err)
+			continue
+		}
+		if value != test.value {
+			t.Errorf("%s %q: want %#v, got %#v", test.typ, test.s, test.value, value)
+		}
+	}
+
+	for _, test := range []struct{ typ, s string }{
+		{"boolean", "yes"},
+		{"uint8", "256"},
+		{"sint8", "abc"},
+		{"datetime", "2026"},
+	} {
+		if _, err := ParseValue(test.typ, test.s); nil == err {
+			t.Error(test.typ, test.s, "error is excepted")
+		}
+	}
+}
+
+func TestDatetime(t *testing.T) {
+	tm := time.Date(2026, 10, 19, 12, 30, 45, 123456000, time.FixedZone("", -300*60))
+	s := FormatDatetime(tm)
+	if "20261019123045.123456-300" != s {
+		t.Error(s)
+	}
+	value, err := ParseDatetime(s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !tm.Equal(value.(time.Time)) {
+		t.Error(value)
+	}
+
+	d := 3*24*time.Hour + 4*time.Hour + 5*time.Second
+	if s := FormatInterval(d); "00000003040005.000000:000" != s {
+		t.Error(s)
+	}
+	if value, err := ParseDatetime(FormatInterval(d)); nil != err || d != value {
+		t.Error(value, err)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	type level uint16
+	for _, test := range []struct {
+		typ   string
+		value interface{}
+		s     string
+	}{
+		{"uint16", level(3), "3"},
+		{"boolean", true, "true"},
+		{"real32", float32(0.5), "0.5"},
+		{"string", "abc", "abc"},
+		{"datetime", 90 * time.Second, "00000000000130.000000:000"},
+		{"reference", &ObjectPath{ClassName: "CIM_Disk"}, "CIM_Disk"},
+	} {
+		s, err := FormatValue(test.typ, test.value)
+		if nil != err || test.s != s {
+			t.Errorf("%s %#v: want %q, got %q, %v", test.typ, test.value, test.s, s, err)
+		}
+	}
+
+	for _, test := range []struct {
+		typ   string
+		value interface{}
+	}{
+		{"uint8", 256},
+		{"uint16", -1},
+		{"uint32", true},
+		{"string", nil},
+		{"string", struct{}{}},
+	} {
+		if _, err := FormatValue(test.typ, test.value); nil == err {
+			t.Errorf("%s %#v: error is excepted", test.typ, test.value)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package gowbem
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// ValueMap is the mapping of the ValueMap and Values qualifiers, the
+// entries of ValueMap may be the integers, the ranges such as "4..7",
+// "0x8000.." and ".." or the strings if the property is a string.
+type ValueMap struct {
+	entries []valueMapEntry
+}
+
+type valueMapEntry struct {
+	raw   string
+	text  string
+	low   *big.Int
+	high  *big.Int
+	isAll bool
+	isNum bool
+	isRng bool
+}
+
+// NewValueMap creates the mapping, the values of ValueMap are the indexes
+// of Values if valueMap is empty.
+func NewValueMap(valueMap, values []string) (*ValueMap, error) {
+	if 0 == len(valueMap) {
+		for idx := range values {
+			valueMap = append(valueMap, fmt.Sprint(idx))
+		}
+	}
+	if 0 != len(values) && len(values) != len(valueMap) {
+		return nil, errors.New("the length of ValueMap isn't equal to the length of Values")
+	}
+
+	m := &ValueMap{entries: make([]valueMapEntry, 0, len(valueMap))}
+	for idx, raw := range valueMap {
+		entry := valueMapEntry{raw: raw, text: raw}
+		if 0 != len(values) {
+			entry.text = values[idx]
+		}
+		s := strings.TrimSpace(raw)
+		if ".." == s {
+			entry.isAll = true
+		} else if pos := strings.Index(s, ".."); pos >= 0 {
+			entry.isRng = true
+			if low := strings.TrimSpace(s[:pos]); "" != low {
+				if entry.low = ParseInteger(low); nil == entry.low {
+					return nil, errors.New("ValueMap '" + raw + "' is invalid")
+				}
+			}
+			if high := strings.TrimSpace(s[pos+2:]); "" != high {
+				if entry.high = ParseInteger(high); nil == entry.high {
+					return nil, errors.New("ValueMap '" + raw + "' is invalid")
+				}
+			}
+		} else if entry.low = ParseInteger(s); nil != entry.low {
+			entry.isNum = true
+		}
+		m.entries = append(m.entries, entry)
+	}
+	return m, nil
+}
+
+// ParseInteger parses the integer value of DSP0004, it is the decimal, the
+// hex such as 0x8000, the binary such as 101b or the octal such as 0777
+// with an optional sign. It returns nil if the string isn't a integer.
+func ParseInteger(s string) *big.Int {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		negative = '-' == s[0]
+		s = s[1:]
+	}
+	n := len(s)
+	if 0 == n {
+		return nil
+	}
+	digits, base := s, 10
+	switch {
+	case n > 2 && '0' == s[0] && ('x' == s[1] || 'X' == s[1]):
+		digits, base = s[2:], 16
+	case n > 1 && ('b' == s[n-1] || 'B' == s[n-1]):
+		digits, base = s[:n-1], 2
+	case n > 1 && '0' == s[0]:
+		digits, base = s[1:], 8
+	}
+	// the explicit base doesn't accept the prefixes, the signs and the
+	// underscores of Go.
+	if '+' == digits[0] || '-' == digits[0] {
+		return nil
+	}
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil
+	}
+	if negative {
+		i.Neg(i)
+	}
+	return i
+}
+
+func (e *valueMapEntry) contains(v *big.Int) bool {
+	if e.isAll {
+		return true
+	}
+	if e.isNum {
+		return 0 == e.low.Cmp(v)
+	}
+	if !e.isRng {
+		return false
+	}
+	return (nil == e.low || e.low.Cmp(v) <= 0) && (nil == e.high || e.high.Cmp(v) >= 0)
+}
+
+// Lookup returns the string in Values of the value, the single values are
+// matched first, then the ranges and the ".." entry at last.
+func (m *ValueMap) Lookup(value interface{}) (string, bool) {
+	if nil == m || nil == value {
+		return "", false
+	}
+	s := strings.TrimSpace(fmt.Sprint(value))
+	for _, entry := range m.entries {
+		if !entry.isRng && !entry.isAll && entry.raw == s {
+			return entry.text, true
+		}
+	}
+
+	v := ParseInteger(s)
+	if nil == v {
+		return "", false
+	}
+	for _, entry := range m.entries {
+		if entry.isNum && entry.contains(v) {
+			return entry.text, true
+		}
+	}
+	for _, entry := range m.entries {
+		if entry.isRng && entry.contains(v) {
+			return entry.text, true
+		}
+	}
+	for _, entry := range m.entries {
+		if entry.isAll {
+			return entry.text, true
+		}
+	}
+	return "", false
+}
+
+// Translate returns the string in Values if the value is a scalar and the
+// strings in Values if the value is an array, the value which isn't in the
+// ValueMap is returned as it is.
+func (m *ValueMap) Translate(value interface{}) interface{} {
+	if nil == value {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if reflect.Slice != rv.Kind() || reflect.TypeOf([]byte(nil)) == rv.Type() {
+		if s, ok := m.Lookup(value); ok {
+			return s
+		}
+		return value
+	}
+
+	results := make([]string, rv.Len())
+	for idx := range results {
+		elem := rv.Index(idx).Interface()
+		if s, ok := m.Lookup(elem); ok {
+			results[idx] = s
+		} else if nil != elem {
+			results[idx] = fmt.Sprint(elem)
+		}
+	}
+	return results
+}
+
+// Value returns the value in ValueMap of the string in Values, the case is
+// ignored, the lower bound is returned if the entry is a range.
+func (m *ValueMap) Value(text string) (string, bool) {
+	if nil == m {
+		return "", false
+	}
+	for _, entry := range m.entries {
+		if !strings.EqualFold(entry.text, text) {
+			continue
+		}
+		switch {
+		case entry.isNum:
+			return entry.low.String(), true
+		case entry.isRng && nil != entry.low:
+			return entry.low.String(), true
+		case entry.isRng || entry.isAll:
+			return "", false
+		}
+		return entry.raw, true
+	}
+	return "", false
+}
+
+// Values returns the values in ValueMap of the strings in Values.
+func (m *ValueMap) Values(texts []string) ([]string, error) {
+	results := make([]string, len(texts))
+	for idx, text := range texts {
+		value, ok := m.Value(text)
+		if !ok {
+			return nil, errors.New("'" + text + "' isn't found in the Values")
+		}
+		results[idx] = value
+	}
+	return results, nil
+}
+
+// PropertyMetadata is the ValueMap, MappingStrings and Units qualifiers of
+// a property.
+type PropertyMetadata struct {
+	Name    string
+	Type    string
+	IsArray bool
+	// ValueMap is nil if the property hasn't the ValueMap and the Values
+	// qualifiers.
+	ValueMap       *ValueMap
+	MappingStrings []string
+	Units          string
+	PUnit          string
+}
+
+// Translate translates the value by the ValueMap, see ValueMap.Translate.
+func (p *PropertyMetadata) Translate(value interface{}) interface{} {
+	if nil == p.ValueMap {
+		return value
+	}
+	return p.ValueMap.Translate(value)
+}
+
+// GetPropertyMetadata returns the metadata of the property in the class,
+// the class should be fetched with the qualifiers.
+func GetPropertyMetadata(class *CimClass, propertyName string) (*PropertyMetadata, error) {
+	pr := findAnyProperty(class.Properties, propertyName)
+	if nil == pr {
+		return nil, WBEMException(CIM_ERR_NO_SUCH_PROPERTY,
+			"property '"+propertyName+"' isn't found in the class '"+class.Name+"'.")
+	}
+
+	p := &PropertyMetadata{Name: anyPropertyName(*pr)}
+	switch {
+	case nil != pr.Property:
+		p.Type = pr.Property.Type
+	case nil != pr.PropertyArray:
+		p.Type = pr.PropertyArray.Type
+		p.IsArray = true
+	case nil != pr.PropertyReference:
+		p.Type = "reference"
+	}
+
+	qualifiers := anyPropertyQualifiers(*pr)
+	p.MappingStrings = qualifierStrings(qualifiers, "MappingStrings")
+	if units := qualifierStrings(qualifiers, "Units"); 0 != len(units) {
+		p.Units = units[0]
+	}
+	if punit := qualifierStrings(qualifiers, "PUnit"); 0 != len(punit) {
+		p.PUnit = punit[0]
+	}
+
+	valueMap, values := qualifierStrings(qualifiers, "ValueMap"), qualifierStrings(qualifiers, "Values")
+	if 0 != len(valueMap) || 0 != len(values) {
+		m, err := NewValueMap(valueMap, values)
+		if nil != err {
+			return nil, errors.New("property '" + p.Name + "' of the class '" + class.Name + "' is invalid, " + err.Error())
+		}
+		p.ValueMap = m
+	}
+	return p, nil
+}
+
+func qualifierStrings(qualifiers []CimQualifier, name string) []string {
+	for _, q := range qualifiers {
+		if !strings.EqualFold(q.Name, name) {
+			continue
+		}
+		if nil != q.Value {
+			return []string{q.Value.Value}
+		}
+		if nil == q.ValueArray {
+			return nil
+		}
+		results := make([]string, 0, len(q.ValueArray.Values))
+		for _, v := range q.ValueArray.Values {
+			if nil != v.Value {
+				results = append(results, v.Value.Value)
+			} else {
+				results = append(results, "")
+			}
+		}
+		return results
+	}
+	return nil
+}
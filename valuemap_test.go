@@ -0,0 +1,121 @@
+package gowbem
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+const valueMapClass = `<CLASS NAME="CIM_EnabledLogicalElement">
+  <PROPERTY.ARRAY NAME="OperationalStatus" TYPE="uint16">
+    <QUALIFIER NAME="ValueMap" TYPE="string">
+      <VALUE.ARRAY><VALUE>0</VALUE><VALUE>2</VALUE><VALUE>3</VALUE><VALUE>..</VALUE><VALUE>0x8000..</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+    <QUALIFIER NAME="Values" TYPE="string" TRANSLATABLE="true">
+      <VALUE.ARRAY><VALUE>Unknown</VALUE><VALUE>OK</VALUE><VALUE>Degraded</VALUE><VALUE>DMTF Reserved</VALUE><VALUE>Vendor Reserved</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+    <QUALIFIER NAME="MappingStrings" TYPE="string">
+      <VALUE.ARRAY><VALUE>MIF.DMTF|Operational State|006.4</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+  </PROPERTY.ARRAY>
+  <PROPERTY NAME="HealthState" TYPE="uint16">
+    <QUALIFIER NAME="ValueMap" TYPE="string">
+      <VALUE.ARRAY><VALUE>0</VALUE><VALUE>5</VALUE><VALUE>10..15</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+    <QUALIFIER NAME="Values" TYPE="string">
+      <VALUE.ARRAY><VALUE>Unknown</VALUE><VALUE>OK</VALUE><VALUE>Degraded</VALUE></VALUE.ARRAY>
+    </QUALIFIER>
+  </PROPERTY>
+  <PROPERTY NAME="MaxSpeed" TYPE="uint64">
+    <QUALIFIER NAME="Units" TYPE="string"><VALUE>Bits per Second</VALUE></QUALIFIER>
+    <QUALIFIER NAME="PUnit" TYPE="string"><VALUE>bit / second</VALUE></QUALIFIER>
+  </PROPERTY>
+</CLASS>`
+
+func TestValueMap(t *testing.T) {
+	var class CimClass
+	if err := xml.Unmarshal([]byte(valueMapClass), &class); nil != err {
+		t.Fatal(err)
+	}
+
+	status, err := GetPropertyMetadata(&class, "operationalstatus")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !status.IsArray || "uint16" != status.Type || 1 != len(status.MappingStrings) {
+		t.Errorf("%#v", status)
+	}
+	actual := status.Translate([]interface{}{"2", "3", "4", "32769", nil})
+	excepted := []string{"OK", "Degraded", "DMTF Reserved", "Vendor Reserved", ""}
+	if !reflect.DeepEqual(excepted, actual) {
+		t.Errorf("excepted is %v, actual is %v", excepted, actual)
+	}
+	if values, err := status.ValueMap.Values([]string{"ok", "Vendor Reserved"}); nil != err || !reflect.DeepEqual([]string{"2", "32768"}, values) {
+		t.Error(values, err)
+	}
+	if _, ok := status.ValueMap.Value("DMTF Reserved"); ok {
+		t.Error("value of '..' is excepted to be not found")
+	}
+
+	health, err := GetPropertyMetadata(&class, "HealthState")
+	if nil != err {
+		t.Fatal(err)
+	}
+	for value, excepted := range map[interface{}]string{"5": "OK", uint16(12): "Degraded", "0x0f": "Degraded"} {
+		if s, ok := health.ValueMap.Lookup(value); !ok || excepted != s {
+			t.Errorf("%v: excepted is %s, actual is %s", value, excepted, s)
+		}
+	}
+	if v := health.Translate("20"); "20" != v {
+		t.Error(v)
+	}
+
+	speed, err := GetPropertyMetadata(&class, "MaxSpeed")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != speed.ValueMap || "Bits per Second" != speed.Units || "bit / second" != speed.PUnit {
+		t.Errorf("%#v", speed)
+	}
+
+	if _, err := GetPropertyMetadata(&class, "Unknown"); nil == err {
+		t.Error("error is excepted")
+	}
+	if _, err := NewValueMap([]string{"1", "2"}, []string{"a"}); nil == err {
+		t.Error("error is excepted")
+	}
+	if m, _ := NewValueMap(nil, []string{"a", "b"}); "b" != m.Translate(1) {
+		t.Error("index of Values is excepted")
+	}
+}
+
+func TestParseInteger(t *testing.T) {
+	for s, excepted := range map[string]string{
+		"10":     "10",
+		"010":    "8",
+		"0x10":   "16",
+		"0X1f":   "31",
+		"101b":   "5",
+		"-0x10":  "-16",
+		"+7":     "7",
+		"0":      "0",
+		"1_000":  "",
+		"0o17":   "",
+		"08":     "",
+		"0x":     "",
+		"--1":    "",
+		"0x-1":   "",
+		"abc":    "",
+		"":       "",
+		" 12 ":   "12",
+		"0b1010": "",
+	} {
+		actual := ""
+		if i := ParseInteger(s); nil != i {
+			actual = i.String()
+		}
+		if excepted != actual {
+			t.Errorf("%q: excepted is %q, actual is %q", s, excepted, actual)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/mof"
 )
 
 var (
@@ -31,8 +33,36 @@ var (
 	userpassword = flag.String("password", "root", "用户密码")
 	output       = flag.String("output", "", "结果的输出目录, 缺省值为当前目录")
 	debug        = flag.Bool("debug", true, "是不是在调试")
+	record       = flag.String("record", "", "将请求和响应录制到指定的文件中, 用于离线重现问题")
+	format       = flag.String("format", "xml", "输出文件的格式, 可选值: xml, mof")
+
+	recorder *gowbem.Recorder
 )
 
+func saveRecording() {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Recording().SaveFile(*record); err != nil {
+		fmt.Println("保存录制文件失败，", err)
+	}
+}
+
+// writeMOF 将 MOF 写到文件, 文件开头是 #pragma namespace
+func writeMOF(filename, ns string, qualifiers []gowbem.CimQualifierDeclaration, write func(w *mof.Writer) error) error {
+	var buf bytes.Buffer
+	w := mof.NewWriter(&buf)
+	w.Qualifiers = qualifiers
+	if err := w.WritePragma("namespace", ns); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	if err := write(w); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 666)
+}
+
 func createURI() *url.URL {
 	return &url.URL{
 		Scheme: *schema,
@@ -50,12 +80,26 @@ func main() {
 	}
 	flag.Parse()
 
+	err := run()
+	// 出错时也要保存录制文件, 用于离线重现问题
+	saveRecording()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println("导出成功！")
+}
+
+func run() error {
+	if *format != "xml" && *format != "mof" {
+		return errors.New("format 的值只能是 xml 或 mof")
+	}
+
 	if *output == "" {
 		*output = "./" + *host
 	}
 
 	if err := os.MkdirAll(*output, 666); err != nil && !os.IsExist(err) {
-		log.Fatalln(err)
+		return err
 	}
 
 	if *debug {
@@ -83,23 +127,27 @@ func main() {
 
 	c, e := gowbem.NewClientCIMXML(createURI(), true)
 	if nil != e {
-		log.Fatalln("连接失败，", e)
+		return errors.New("连接失败，" + e.Error())
+	}
+	if *record != "" {
+		recorder = gowbem.NewRecorder(c.Transport)
+		c.Transport = recorder
 	}
 
 	if *classname != "" && *namespace != "" {
 		instancePaths := make(map[string]error, 1024)
-		dumpClass(c, *namespace, *classname, instancePaths)
-		return
+		return dumpClass(c, *namespace, *classname, nil, instancePaths)
 	}
 
 	var namespaces []string
-	timeCtx, _ := context.WithTimeout(context.Background(), 30*time.Second)
+	timeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
 	if "" == *namespace {
 		var err error
 		namespaces, err = c.EnumerateNamespaces(timeCtx, []string{"root/cimv2"}, 10*time.Second, nil)
 		if nil != err {
-			log.Fatalln("连接失败，", err)
+			return errors.New("连接失败，" + err.Error())
 		}
 	} else {
 		namespaces = []string{*namespace}
@@ -108,17 +156,17 @@ func main() {
 	fmt.Println("命令空间有：", namespaces)
 	for _, ns := range namespaces {
 		fmt.Println("开始处理", ns)
-		dumpNS(c, ns)
+		if err := dumpNS(c, ns); err != nil {
+			return err
+		}
 	}
 	if len(namespaces) == 0 {
-		fmt.Println("导出失败！")
-		os.Exit(1)
-		return
+		return errors.New("导出失败！")
 	}
-	fmt.Println("导出成功！")
+	return nil
 }
 
-func dumpNS(c *gowbem.ClientCIMXML, ns string) {
+func dumpNS(c *gowbem.ClientCIMXML, ns string) error {
 	qualifiers, e := c.EnumerateQualifierTypes(context.Background(), ns)
 	if nil != e {
 		fmt.Println("枚举 QualifierType 失败，", e)
@@ -130,38 +178,51 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 		nsPath = strings.Replace(nsPath, "\\", "@", -1)
 
 		/// @begin 将 Qualifier 定义写到文件
-		filename := filepath.Join(*output, nsPath, "qa.xml")
 		if err := os.MkdirAll(filepath.Join(*output, nsPath), 666); err != nil && !os.IsExist(err) {
-			log.Fatalln(err)
+			return err
 		}
+		if *format == "mof" {
+			if err := writeMOF(filepath.Join(*output, nsPath, "qa.mof"), ns, qualifiers, func(w *mof.Writer) error {
+				for idx := range qualifiers {
+					if err := w.WriteQualifierDeclaration(&qualifiers[idx]); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		} else {
+			filename := filepath.Join(*output, nsPath, "qa.xml")
 
-		var sb bytes.Buffer
-		sb.WriteString(`<?xml version="1.0"?>
+			var sb bytes.Buffer
+			sb.WriteString(`<?xml version="1.0"?>
 <CIM CIMVERSION="2.0" DTDVERSION="2.0">
 <DECLARATION>
 <DECLGROUP>`)
-		for idx := range qualifiers {
-			sb.WriteString("\r\n")
-			sb.WriteString(`<VALUE.OBJECT>`)
-			sb.WriteString("\r\n")
-
-			bs, err := xml.MarshalIndent(qualifiers[idx], "", "  ")
-			if err != nil {
-				log.Fatalln(err)
+			for idx := range qualifiers {
+				sb.WriteString("\r\n")
+				sb.WriteString(`<VALUE.OBJECT>`)
+				sb.WriteString("\r\n")
+
+				bs, err := xml.MarshalIndent(qualifiers[idx], "", "  ")
+				if err != nil {
+					return err
+				}
+				sb.Write(bs)
+
+				sb.WriteString("\r\n")
+				sb.WriteString(`</VALUE.OBJECT>`)
+				sb.WriteString("\r\n")
 			}
-			sb.Write(bs)
 
-			sb.WriteString("\r\n")
-			sb.WriteString(`</VALUE.OBJECT>`)
-			sb.WriteString("\r\n")
-		}
-
-		sb.WriteString(`</DECLGROUP>
+			sb.WriteString(`</DECLGROUP>
 </DECLARATION>
 </CIM>`)
 
-		if err := ioutil.WriteFile(filename, sb.Bytes(), 666); err != nil {
-			log.Fatalln(err)
+			if err := ioutil.WriteFile(filename, sb.Bytes(), 666); err != nil {
+				return err
+			}
 		}
 		/// @end
 	}
@@ -171,11 +232,11 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 		if !gowbem.IsErrNotSupported(e) && !gowbem.IsEmptyResults(e) {
 			fmt.Println("枚举类名失败，", e)
 		}
-		return
+		return nil
 	}
 	if 0 == len(classNames) {
 		fmt.Println("没有类定义？，")
-		return
+		return nil
 	}
 
 	if *onlyclass {
@@ -183,7 +244,7 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 		for _, className := range classNames {
 			fmt.Println(className)
 		}
-		return
+		return nil
 	}
 
 	instancePaths := make(map[string]error, 1024)
@@ -191,7 +252,15 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 
 	for _, className := range classNames {
 		timeCtx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-		class, err := c.GetClass(timeCtx, ns, className, true, true, true, nil)
+		var class *gowbem.CimClass
+		var classXML string
+		var err error
+		if *format == "mof" {
+			class, err = c.GetClass(timeCtx, ns, className, true, true, true, nil)
+		} else {
+			// 保存服务器返回的原始 XML
+			classXML, err = c.GetClassXML(timeCtx, ns, className, true, true, true, nil)
+		}
 		if err != nil {
 			fmt.Println("取数名失败 - ", err)
 		}
@@ -200,16 +269,26 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 		nsPath = strings.Replace(nsPath, "\\", "@", -1)
 
 		/// @begin 将类定义写到文件
-		filename := filepath.Join(*output, nsPath, className+".xml")
 		if err := os.MkdirAll(filepath.Join(*output, nsPath), 666); err != nil && !os.IsExist(err) {
-			log.Fatalln(err)
+			return err
 		}
-		if err := ioutil.WriteFile(filename, []byte(class), 666); err != nil {
-			log.Fatalln(err)
+		if class != nil {
+			if err := writeMOF(filepath.Join(*output, nsPath, className+".mof"), ns, qualifiers, func(w *mof.Writer) error {
+				return w.WriteClass(class)
+			}); err != nil {
+				return err
+			}
+		} else if classXML != "" {
+			filename := filepath.Join(*output, nsPath, className+".xml")
+			if err := ioutil.WriteFile(filename, []byte(classXML), 666); err != nil {
+				return err
+			}
 		}
 		/// @end
 
-		dumpClass(c, ns, className, instancePaths)
+		if err := dumpClass(c, ns, className, qualifiers, instancePaths); err != nil {
+			return err
+		}
 	}
 
 	for key, err := range instancePaths {
@@ -217,9 +296,10 @@ func dumpNS(c *gowbem.ClientCIMXML, ns string) {
 			fmt.Println(key, "获取失败:", err)
 		}
 	}
+	return nil
 }
 
-func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[string]error) {
+func dumpClass(c *gowbem.ClientCIMXML, ns, className string, qualifiers []gowbem.CimQualifierDeclaration, instancePaths map[string]error) error {
 	nsPath := strings.Replace(ns, "/", "#", -1)
 	nsPath = strings.Replace(nsPath, "\\", "@", -1)
 
@@ -230,10 +310,10 @@ func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[s
 		/// @begin 将类定义写到文件
 		classPath := filepath.Join(*output, nsPath)
 		if e := os.MkdirAll(classPath, 666); e != nil && !os.IsExist(e) {
-			log.Fatalln(e)
+			return e
 		}
 		if e := ioutil.WriteFile(filepath.Join(classPath, "error.txt"), []byte(err.Error()), 666); e != nil {
-			log.Fatalln(e)
+			return e
 		}
 
 		fmt.Println(className, 0, err)
@@ -241,18 +321,18 @@ func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[s
 		if !gowbem.IsErrNotSupported(err) && !gowbem.IsEmptyResults(err) {
 			fmt.Println(fmt.Sprintf("%T %v", err, err))
 		}
-		return
+		return nil
 	}
 	fmt.Println(className, len(instanceNames))
 
 	if len(instanceNames) == 0 {
-		return
+		return nil
 	}
 
 	/// @begin 将类定义写到文件
 	classPath := filepath.Join(*output, nsPath, className)
 	if err := os.MkdirAll(classPath, 666); err != nil && !os.IsExist(err) {
-		log.Fatalln(err)
+		return err
 	}
 	var buf bytes.Buffer
 	for _, instanceName := range instanceNames {
@@ -260,19 +340,20 @@ func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[s
 		buf.WriteString("\r\n")
 	}
 	if err := ioutil.WriteFile(filepath.Join(classPath, "instances.txt"), buf.Bytes(), 666); err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	/// @end
 
 	for idx, instanceName := range instanceNames {
-		if _, exists := instancePaths[instanceName.String()]; exists {
+		key := gowbem.InstanceNameKey(instanceName)
+		if _, exists := instancePaths[key]; exists {
 			continue
 		}
 
 		timeCtx, _ := context.WithTimeout(context.Background(), 30*time.Second)
 		instance, err := c.GetInstanceByInstanceName(timeCtx, ns, instanceName, false, true, true, nil)
 		if err != nil {
-			instancePaths[instanceName.String()] = err
+			instancePaths[key] = err
 
 			if !gowbem.IsErrNotSupported(err) && !gowbem.IsEmptyResults(err) {
 				fmt.Println(fmt.Sprintf("%T %v", err, err))
@@ -281,22 +362,30 @@ func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[s
 		}
 
 		/// @begin 将类定义写到文件
-		bs, err := xml.MarshalIndent(instance, "", "  ")
-		if err != nil {
-			log.Fatalln(err)
-		}
-
 		subclassPath := filepath.Join(*output, nsPath, instanceName.GetClassName())
 		if err := os.MkdirAll(subclassPath, 666); err != nil && !os.IsExist(err) {
-			log.Fatalln(err)
+			return err
 		}
 
-		if err := ioutil.WriteFile(filepath.Join(subclassPath, "instance_"+strconv.Itoa(idx)+".xml"), bs, 666); err != nil {
-			log.Fatalln(err)
+		if cimInstance, ok := instance.(*gowbem.CimInstance); ok && *format == "mof" {
+			if err := writeMOF(filepath.Join(subclassPath, "instance_"+strconv.Itoa(idx)+".mof"), ns, qualifiers, func(w *mof.Writer) error {
+				return w.WriteInstance(cimInstance)
+			}); err != nil {
+				return err
+			}
+		} else {
+			bs, err := xml.MarshalIndent(instance, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			if err := ioutil.WriteFile(filepath.Join(subclassPath, "instance_"+strconv.Itoa(idx)+".xml"), bs, 666); err != nil {
+				return err
+			}
 		}
 		/// @end
 
-		instancePaths[instanceName.String()] = nil
+		instancePaths[key] = nil
 
 		// fmt.Println()
 		// fmt.Println()
@@ -305,4 +394,5 @@ func dumpClass(c *gowbem.ClientCIMXML, ns, className string, instancePaths map[s
 		//	fmt.Println(k.GetName(), k.GetValue())
 		//}
 	}
+	return nil
 }
@@ -0,0 +1,93 @@
+package gowbem
+
+import (
+	"context"
+	"time"
+)
+
+// WBEMClient is the operations of a WBEM client, it is implemented by
+// ClientCIMXML, ClientCIMRS and ClientWSMan, so the code which depends on
+// it may be used with any protocol, a mock or the decorators in
+// decorator.go.
+//
+// The operations which aren't supported by a protocol return the
+// CIM_ERR_NOT_SUPPORTED error, see IsErrNotSupported.
+type WBEMClient interface {
+	// EnumerateNamespaces returns the names of the namespaces.
+	EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error)
+
+	// EnumerateClassNames returns the names of the subclasses of the class.
+	EnumerateClassNames(ctx context.Context, namespaceName, className string, deep bool) ([]string, error)
+
+	// EnumerateClasses returns the subclasses of the class.
+	EnumerateClasses(ctx context.Context, namespaceName string, className string, deepInheritance bool,
+		localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]CimClass, error)
+
+	// GetClass returns the class.
+	GetClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+		includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClass, error)
+
+	// EnumerateQualifierTypes returns the qualifier declarations of the namespace.
+	EnumerateQualifierTypes(ctx context.Context, namespaceName string) ([]CimQualifierDeclaration, error)
+
+	// EnumerateInstanceNames returns the names of the instances of the class.
+	EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error)
+
+	// EnumerateInstances returns the instances of the class.
+	EnumerateInstances(ctx context.Context, namespaceName, className string, deepInheritance bool,
+		localOnly bool, includeQualifiers bool, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error)
+
+	// GetInstance returns the instance of the class with the keys.
+	GetInstance(ctx context.Context, namespaceName, className string, keyBindings CIMKeyBindings, localOnly bool,
+		includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error)
+
+	// GetInstanceByInstanceName returns the instance of the instance name.
+	GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName CIMInstanceName, localOnly bool,
+		includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error)
+
+	// AssociatorNames returns the names of the instances associated with the instance.
+	AssociatorNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+		assocClass, resultClass, role, resultRole string) ([]CIMInstanceName, error)
+
+	// AssociatorInstances returns the instances associated with the instance.
+	AssociatorInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+		assocClass, resultClass, role, resultRole string, includeClassOrigin bool,
+		propertyList []string) ([]CIMInstanceWithName, error)
+
+	// AssociatorClasses returns the classes associated with the class.
+	AssociatorClasses(ctx context.Context, namespaceName, className, assocClass, resultClass, role, resultRole string,
+		includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error)
+
+	// ReferenceNames returns the names of the association instances which
+	// refer to the instance.
+	ReferenceNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+		resultClass, role string) ([]CIMInstanceName, error)
+
+	// ReferenceInstances returns the association instances which refer to
+	// the instance.
+	ReferenceInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+		resultClass, role string, includeClassOrigin bool, propertyList []string) ([]CIMInstance, error)
+
+	// ReferenceClasses returns the association classes which refer to the class.
+	ReferenceClasses(ctx context.Context, namespaceName, className, resultClass, role string,
+		includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error)
+
+	// InvokeMethod invokes the method of the instance.
+	InvokeMethod(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+		methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error)
+
+	// InvokeStaticMethod invokes the static method of the class.
+	InvokeStaticMethod(ctx context.Context, namespaceName string, className string,
+		methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error)
+}
+
+var (
+	_ WBEMClient = &ClientCIMXML{}
+	_ WBEMClient = &ClientCIMRS{}
+	_ WBEMClient = &ClientWSMan{}
+)
+
+// notSupported returns the CIM_ERR_NOT_SUPPORTED error of the operation.
+func notSupported(protocol, operation string) error {
+	return WBEMException(CIM_ERR_NOT_SUPPORTED, operation+" isn't supported by "+protocol)
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/mof"
+)
+
+// Generator generates the Go code of the CIM classes.
+type Generator struct {
+	Package string
+
+	classes  map[string]*gowbem.CimClass
+	names    []string
+	resolved map[string]*gowbem.CimClass
+	compiler *mof.Compiler
+}
+
+func NewGenerator(pkg string) *Generator {
+	return &Generator{Package: pkg,
+		classes:  map[string]*gowbem.CimClass{},
+		resolved: map[string]*gowbem.CimClass{},
+		compiler: mof.NewCompiler()}
+}
+
+// AddClass adds the class, the class with the same name is replaced.
+func (g *Generator) AddClass(class *gowbem.CimClass) {
+	key := strings.ToLower(class.Name)
+	if _, exists := g.classes[key]; !exists {
+		g.names = append(g.names, class.Name)
+	}
+	copyed := *class
+	g.classes[key] = &copyed
+	g.resolved = map[string]*gowbem.CimClass{}
+}
+
+// LoadXML adds the CLASS elements in any depth of the document, so it may
+// be the result of GetClass, a CIM response or a file of the wbem_dump.
+func (g *Generator) LoadXML(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if nil != err {
+			if io.EOF == err {
+				return nil
+			}
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || "CLASS" != start.Name.Local {
+			continue
+		}
+		var class gowbem.CimClass
+		if err := decoder.DecodeElement(&class, &start); nil != err {
+			return err
+		}
+		g.AddClass(&class)
+	}
+}
+
+// LoadMOF compiles the MOF file and adds the classes of all namespaces.
+func (g *Generator) LoadMOF(filename string) error {
+	if err := g.compiler.ParseFile(filename); nil != err {
+		return err
+	}
+	for _, ns := range g.compiler.Namespaces() {
+		for idx := range ns.Classes {
+			g.AddClass(&ns.Classes[idx])
+		}
+	}
+	return nil
+}
+
+// Load adds the classes of the file or the directory, the *.xml and *.mof
+// files are loaded in a directory such as the output of wbem_dump, qa.mof is
+// loaded before the other files of its directory.
+func (g *Generator) Load(filename string) error {
+	st, err := os.Stat(filename)
+	if nil != err {
+		return err
+	}
+	if !st.IsDir() {
+		if strings.EqualFold(".mof", filepath.Ext(filename)) {
+			return g.LoadMOF(filename)
+		}
+		in, err := os.Open(filename)
+		if nil != err {
+			return err
+		}
+		defer in.Close()
+		if err := g.LoadXML(in); nil != err {
+			return errors.New(filename + ": " + err.Error())
+		}
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(filename)
+	if nil != err {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.EqualFold("qa.mof", files[i].Name()) && !strings.EqualFold("qa.mof", files[j].Name())
+	})
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || ".xml" == ext || ".mof" == ext {
+			if err := g.Load(filepath.Join(filename, file.Name())); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Class returns the class with the inherited features, it returns nil if
+// the class isn't loaded.
+func (g *Generator) Class(name string) (*gowbem.CimClass, error) {
+	return g.class(name, map[string]bool{})
+}
+
+func (g *Generator) class(name string, visiting map[string]bool) (*gowbem.CimClass, error) {
+	key := strings.ToLower(name)
+	if class := g.resolved[key]; nil != class {
+		return class, nil
+	}
+	loaded := g.classes[key]
+	if nil == loaded {
+		return nil, nil
+	}
+	if visiting[key] {
+		return nil, errors.New("class '" + name + "' is a superclass of itself")
+	}
+	visiting[key] = true
+
+	class := localClass(loaded)
+	if "" != class.SuperClass {
+		super, err := g.class(class.SuperClass, visiting)
+		if nil != err {
+			return nil, err
+		}
+		if nil != super {
+			if err := gowbem.InheritClass(class, super); nil != err {
+				return nil, errors.New("class '" + name + "' is invalid, " + err.Error())
+			}
+		}
+	}
+	g.resolved[key] = class
+	return class, nil
+}
+
+// localClass returns a copy of the class without the propagated features,
+// the class origin of the local features is set.
+func localClass(loaded *gowbem.CimClass) *gowbem.CimClass {
+	class := &gowbem.CimClass{Name: loaded.Name, SuperClass: loaded.SuperClass}
+	for _, q := range loaded.Qualifiers {
+		if !q.Propagated {
+			class.Qualifiers = append(class.Qualifiers, q)
+		}
+	}
+	for _, pr := range loaded.Properties {
+		switch {
+		case nil != pr.Property && !pr.Property.Propagated:
+			copyed := *pr.Property
+			copyed.ClassOrigin = loaded.Name
+			class.Properties = append(class.Properties, gowbem.CimAnyProperty{Property: &copyed})
+		case nil != pr.PropertyArray && !pr.PropertyArray.Propagated:
+			copyed := *pr.PropertyArray
+			copyed.ClassOrigin = loaded.Name
+			class.Properties = append(class.Properties, gowbem.CimAnyProperty{PropertyArray: &copyed})
+		case nil != pr.PropertyReference && !pr.PropertyReference.Propagated:
+			copyed := *pr.PropertyReference
+			copyed.ClassOrigin = loaded.Name
+			class.Properties = append(class.Properties, gowbem.CimAnyProperty{PropertyReference: &copyed})
+		}
+	}
+	for _, method := range loaded.Methods {
+		if !method.Propagated {
+			method.ClassOrigin = loaded.Name
+			class.Methods = append(class.Methods, method)
+		}
+	}
+	return class
+}
+
+// Generate writes the code of the classes, all of the loaded classes are
+// generated if classNames is empty.
+func (g *Generator) Generate(w io.Writer, classNames []string) error {
+	if 0 == len(classNames) {
+		classNames = append(classNames, g.names...)
+		sort.Strings(classNames)
+	}
+
+	gen := &generation{g: g, generated: map[string]bool{}, enums: map[string]bool{}}
+	var classes []*gowbem.CimClass
+	for _, name := range classNames {
+		class, err := g.Class(name)
+		if nil != err {
+			return err
+		}
+		if nil == class {
+			return errors.New("class '" + name + "' isn't found")
+		}
+		classes = append(classes, class)
+		gen.generated[strings.ToLower(class.Name)] = true
+	}
+	if 0 == len(classes) {
+		return errors.New("classes aren't found")
+	}
+	for _, class := range classes {
+		if err := gen.class(class); nil != err {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by wbemgen. DO NOT EDIT.\n\n")
+	out.WriteString("package " + g.Package + "\n\n")
+	out.WriteString("import (\n")
+	if gen.useContext {
+		out.WriteString("\t\"context\"\n")
+	}
+	if gen.useStrconv {
+		out.WriteString("\t\"strconv\"\n")
+	}
+	out.WriteString("\n\t\"github.com/runner-mei/gowbem\"\n)\n\n")
+	out.Write(gen.buf.Bytes())
+
+	bs, err := format.Source(out.Bytes())
+	if nil != err {
+		return errors.New("format generated code, " + err.Error())
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+type generation struct {
+	g          *Generator
+	buf        bytes.Buffer
+	generated  map[string]bool
+	enums      map[string]bool
+	useContext bool
+	useStrconv bool
+}
+
+func (gen *generation) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&gen.buf, format, args...)
+}
+
+func (gen *generation) class(class *gowbem.CimClass) error {
+	typeName := goName(class.Name)
+
+	gen.printf("\n// %s is a reference to %s.\n", typeName+"Ref", class.Name)
+	gen.printf("type %sRef gowbem.ObjectPath\n\n", typeName)
+	gen.printf("// ObjectPath returns the path of the reference.\n")
+	gen.printf("func (r *%sRef) ObjectPath() *gowbem.ObjectPath {\n\treturn (*gowbem.ObjectPath)(r)\n}\n", typeName)
+
+	gen.printf("\n")
+	gen.comment(typeName+" is the CIM class "+class.Name, localDescription(class.Qualifiers))
+	gen.printf("type %s struct {\n", typeName)
+	var enums []func() error
+	for _, pr := range class.Properties {
+		decl := propertyOf(pr)
+		goType, enum := gen.goType(decl.origin+"_"+decl.name, decl)
+		if nil != enum {
+			enums = append(enums, enum)
+		}
+		tag := decl.name
+		if decl.isKey {
+			tag += ",key"
+		}
+		if "" != decl.typ {
+			tag += ",type=" + decl.typ
+		}
+		gen.printf("\t%s %s `cim:\"%s\"`\n", goName(decl.name), goType, tag)
+	}
+	gen.printf("}\n\n")
+	gen.printf("// CIMClassName returns the name of the class.\n")
+	gen.printf("func (*%s) CIMClassName() string {\n\treturn %q\n}\n", typeName, class.Name)
+
+	for _, method := range class.Methods {
+		if method.Propagated {
+			continue
+		}
+		var err error
+		if enums, err = gen.method(class, method, enums); nil != err {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err := enum(); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gen *generation) method(class *gowbem.CimClass, method gowbem.CimMethod, enums []func() error) ([]func() error, error) {
+	gen.useContext = true
+	prefix := goName(class.Name) + "_" + goName(method.Name)
+
+	var in, out []string
+	for _, p := range method.Parameters {
+		decl := parameterOf(p)
+		goType, enum := gen.goType(prefix+"_"+decl.name, decl)
+		if nil != enum {
+			enums = append(enums, enum)
+		}
+		tag := decl.name
+		if "" != decl.typ {
+			tag += ",type=" + decl.typ
+		}
+		if decl.isIn {
+			inType := goType
+			if !decl.isRequired && !strings.HasPrefix(goType, "*") && !strings.HasPrefix(goType, "[]") {
+				inType = "*" + goType
+			}
+			in = append(in, fmt.Sprintf("\t%s %s `cim:\"%s\"`\n", goName(decl.name), inType, tag))
+		}
+		if decl.isOut {
+			out = append(out, fmt.Sprintf("\t%s %s `cim:\"%s\"`\n", goName(decl.name), goType, tag))
+		}
+	}
+
+	ret := fieldDecl{name: "ReturnValue", typ: method.Type, qualifiers: method.Qualifiers}
+	retType, enum := gen.goType(prefix+"_ReturnValue", ret)
+	if nil != enum {
+		enums = append(enums, enum)
+	}
+
+	gen.printf("\n// %s_In is the input parameters of %s.%s.\n", prefix, class.Name, method.Name)
+	gen.printf("type %s_In struct {\n%s}\n", prefix, strings.Join(in, ""))
+	gen.printf("\n// %s_Out is the return value and the output parameters of %s.%s.\n", prefix, class.Name, method.Name)
+	gen.printf("type %s_Out struct {\n", prefix)
+	if "" != method.Type {
+		gen.printf("\tReturnValue %s `cim:\"ReturnValue,type=%s\"`\n", retType, method.Type)
+	}
+	gen.printf("%s}\n\n", strings.Join(out, ""))
+
+	gen.comment(prefix+" invokes "+class.Name+"."+method.Name, localDescription(method.Qualifiers))
+	gen.printf(`func %[1]s(ctx context.Context, c *gowbem.ClientCIMXML, namespaceName string,
+	instanceName gowbem.CIMInstanceName, in *%[1]s_In) (*%[1]s_Out, error) {
+	var params []gowbem.CIMParamValue
+	if nil != in {
+		var err error
+		if params, err = gowbem.MarshalParamValues(in); nil != err {
+			return nil, err
+		}
+	}
+	returnValue, outParams, err := c.InvokeMethod(ctx, namespaceName, instanceName, %[2]q, params)
+	if nil != err {
+		return nil, err
+	}
+	out := &%[1]s_Out{}
+	if err := gowbem.UnmarshalParamValues(returnValue, outParams, out); nil != err {
+		return nil, err
+	}
+	return out, nil
+}
+`, prefix, method.Name)
+	return enums, nil
+}
+
+// comment writes the summary and the description as the doc comment.
+func (gen *generation) comment(summary, description string) {
+	gen.printf("// %s.\n", summary)
+	words := strings.Fields(description)
+	if 0 == len(words) {
+		return
+	}
+	gen.printf("//\n")
+	line := "//"
+	for _, word := range words {
+		if len(line)+len(word) > 78 && "//" != line {
+			gen.printf("%s\n", line)
+			line = "//"
+		}
+		line += " " + word
+	}
+	gen.printf("%s\n", line)
+}
+
+// localDescription returns the Description qualifier which isn't
+// propagated from the superclass.
+func localDescription(qualifiers []gowbem.CimQualifier) string {
+	for _, q := range qualifiers {
+		if strings.EqualFold("Description", q.Name) && !q.Propagated && nil != q.Value {
+			return q.Value.Value
+		}
+	}
+	return ""
+}
+
+type fieldDecl struct {
+	name       string
+	typ        string
+	origin     string
+	refClass   string
+	isArray    bool
+	isRef      bool
+	isKey      bool
+	isIn       bool
+	isOut      bool
+	isRequired bool
+	qualifiers []gowbem.CimQualifier
+}
+
+func propertyOf(pr gowbem.CimAnyProperty) fieldDecl {
+	var decl fieldDecl
+	switch {
+	case nil != pr.Property:
+		decl = fieldDecl{name: pr.Property.Name, typ: pr.Property.Type, origin: pr.Property.ClassOrigin, qualifiers: pr.Property.Qualifiers}
+	case nil != pr.PropertyArray:
+		decl = fieldDecl{name: pr.PropertyArray.Name, typ: pr.PropertyArray.Type, origin: pr.PropertyArray.ClassOrigin, isArray: true, qualifiers: pr.PropertyArray.Qualifiers}
+	case nil != pr.PropertyReference:
+		decl = fieldDecl{name: pr.PropertyReference.Name, origin: pr.PropertyReference.ClassOrigin, refClass: pr.PropertyReference.ReferenceClass, isRef: true, qualifiers: pr.PropertyReference.Qualifiers}
+	}
+	decl.isKey = qualifierBool(decl.qualifiers, "Key", false)
+	return decl
+}
+
+func parameterOf(p gowbem.CimAnyParameter) fieldDecl {
+	var decl fieldDecl
+	switch {
+	case nil != p.Parameter:
+		decl = fieldDecl{name: p.Parameter.Name, typ: p.Parameter.Type, qualifiers: p.Parameter.Qualifiers}
+	case nil != p.ParameterArray:
+		decl = fieldDecl{name: p.ParameterArray.Name, typ: p.ParameterArray.Type, isArray: true, qualifiers: p.ParameterArray.Qualifiers}
+	case nil != p.ParameterReference:
+		decl = fieldDecl{name: p.ParameterReference.Name, refClass: p.ParameterReference.ReferenceClass, isRef: true, qualifiers: p.ParameterReference.Qualifiers}
+	case nil != p.ParameterRefArray:
+		decl = fieldDecl{name: p.ParameterRefArray.Name, refClass: p.ParameterRefArray.ReferenceClass, isRef: true, isArray: true, qualifiers: p.ParameterRefArray.Qualifiers}
+	}
+	decl.isIn = qualifierBool(decl.qualifiers, "In", true)
+	decl.isOut = qualifierBool(decl.qualifiers, "Out", false)
+	decl.isRequired = qualifierBool(decl.qualifiers, "Required", false)
+	return decl
+}
+
+var goTypes = map[string]string{
+	"boolean":  "bool",
+	"string":   "string",
+	"char16":   "string",
+	"datetime": "string",
+	"uint8":    "uint8",
+	"uint16":   "uint16",
+	"uint32":   "uint32",
+	"uint64":   "uint64",
+	"sint8":    "int8",
+	"sint16":   "int16",
+	"sint32":   "int32",
+	"sint64":   "int64",
+	"real32":   "float32",
+	"real64":   "float64",
+}
+
+// goType returns the Go type of the field, the enum is generated by the
+// returned function if the field has the ValueMap of the integers.
+func (gen *generation) goType(enumName string, decl fieldDecl) (string, func() error) {
+	var goType string
+	var enum func() error
+	if decl.isRef {
+		goType = "*gowbem.ObjectPath"
+		if gen.generated[strings.ToLower(decl.refClass)] {
+			goType = "*" + goName(decl.refClass) + "Ref"
+		}
+	} else {
+		goType = goTypes[strings.ToLower(decl.typ)]
+		if "" == goType {
+			goType = "string"
+		}
+		valueMap := qualifierStrings(decl.qualifiers, "ValueMap")
+		values := qualifierStrings(decl.qualifiers, "Values")
+		if 0 != len(values) && isIntegerType(decl.typ) {
+			typeName := goName(enumName)
+			baseType := goType
+			goType = typeName
+			if !gen.enums[typeName] {
+				gen.enums[typeName] = true
+				enum = func() error {
+					return gen.enum(typeName, baseType, decl.name, valueMap, values)
+				}
+			}
+		}
+	}
+	if decl.isArray {
+		goType = "[]" + goType
+	}
+	return goType, enum
+}
+
+func (gen *generation) enum(typeName, baseType, name string, valueMap, values []string) error {
+	if 0 == len(valueMap) {
+		for idx := range values {
+			valueMap = append(valueMap, fmt.Sprint(idx))
+		}
+	}
+	if len(valueMap) != len(values) {
+		return errors.New("'" + name + "' is invalid, the length of ValueMap isn't equal to the length of Values")
+	}
+	gen.useStrconv = true
+
+	type constant struct{ name, value, text string }
+	var constants []constant
+	names := map[string]bool{}
+	for idx, value := range valueMap {
+		value, ok, err := enumValue(value, baseType)
+		if nil != err {
+			return errors.New("'" + name + "' is invalid, " + err.Error())
+		}
+		if !ok {
+			continue
+		}
+		constName := typeName + "_" + camelName(values[idx])
+		if names[constName] || gen.enums[constName] {
+			constName += "_" + goName(value)
+		}
+		for base, n := constName, 2; names[constName] || gen.enums[constName]; n++ {
+			constName = base + "_" + strconv.Itoa(n)
+		}
+		names[constName] = true
+		constants = append(constants, constant{name: constName, value: value, text: values[idx]})
+	}
+
+	gen.printf("\n// %s is the ValueMap of %s.\n", typeName, name)
+	gen.printf("type %s %s\n\n", typeName, baseType)
+	if 0 != len(constants) {
+		gen.printf("const (\n")
+		for _, c := range constants {
+			gen.printf("\t%s %s = %s\n", c.name, typeName, c.value)
+		}
+		gen.printf(")\n\n")
+	}
+	gen.printf("func (v %s) String() string {\n", typeName)
+	if 0 != len(constants) {
+		gen.printf("\tswitch v {\n")
+		seen := map[string]bool{}
+		for _, c := range constants {
+			if seen[c.value] {
+				continue
+			}
+			seen[c.value] = true
+			gen.printf("\tcase %s:\n\t\treturn %q\n", c.name, c.text)
+		}
+		gen.printf("\t}\n")
+	}
+	if strings.HasPrefix(baseType, "u") {
+		gen.printf("\treturn strconv.FormatUint(uint64(v), 10)\n}\n")
+	} else {
+		gen.printf("\treturn strconv.FormatInt(int64(v), 10)\n}\n")
+	}
+	return nil
+}
+
+// enumValue returns the decimal value of the entry of the ValueMap, the
+// ranges and the invalid values are skipped, the values which overflow the
+// Go type are errors.
+func enumValue(s, goType string) (string, bool, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "..") {
+		return "", false, nil
+	}
+	i := gowbem.ParseInteger(s)
+	if nil == i {
+		return "", false, nil
+	}
+	bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(goType, "u"), "int"))
+	if nil != err {
+		return "", false, errors.New("'" + goType + "' isn't a integer type")
+	}
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if !strings.HasPrefix(goType, "u") {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	max.Sub(max, big.NewInt(1))
+	if i.Cmp(min) < 0 || i.Cmp(max) > 0 {
+		return "", false, errors.New("value '" + s + "' overflows " + goType)
+	}
+	return i.String(), true, nil
+}
+
+func isIntegerType(typ string) bool {
+	t := strings.ToLower(typ)
+	return strings.HasPrefix(t, "uint") || strings.HasPrefix(t, "sint")
+}
+
+// goName converts the name into an exported identifier.
+func goName(name string) string {
+	var buf strings.Builder
+	for _, c := range name {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || '_' == c {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteRune('_')
+		}
+	}
+	s := buf.String()
+	if "" == s {
+		return "X"
+	}
+	if first := []rune(s)[0]; !unicode.IsLetter(first) {
+		return "X" + s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// camelName converts the text such as "Power Saving Mode" into PowerSavingMode.
+func camelName(text string) string {
+	var buf strings.Builder
+	upper := true
+	for _, c := range text {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			upper = true
+			continue
+		}
+		if upper {
+			buf.WriteRune(unicode.ToUpper(c))
+			upper = false
+		} else {
+			buf.WriteRune(c)
+		}
+	}
+	if 0 == buf.Len() {
+		return "X"
+	}
+	return buf.String()
+}
+
+func qualifierStrings(qualifiers []gowbem.CimQualifier, name string) []string {
+	for _, q := range qualifiers {
+		if !strings.EqualFold(q.Name, name) {
+			continue
+		}
+		if nil != q.Value {
+			return []string{q.Value.Value}
+		}
+		if nil == q.ValueArray {
+			return nil
+		}
+		var results []string
+		for _, v := range q.ValueArray.Values {
+			if nil != v.Value {
+				results = append(results, v.Value.Value)
+			} else {
+				results = append(results, "")
+			}
+		}
+		return results
+	}
+	return nil
+}
+
+func qualifierBool(qualifiers []gowbem.CimQualifier, name string, defaultValue bool) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, name) {
+			return nil == q.Value || strings.EqualFold("true", strings.TrimSpace(q.Value.Value))
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMOF = `
+Qualifier Key : boolean = false, Scope(property, reference), Flavor(DisableOverride, ToSubclass);
+Qualifier Description : string = null, Scope(any), Flavor(Translatable);
+Qualifier ValueMap : string[], Scope(property, method, parameter);
+Qualifier Values : string[], Scope(property, method, parameter), Flavor(Translatable);
+Qualifier In : boolean = true, Scope(parameter), Flavor(DisableOverride);
+Qualifier Out : boolean = false, Scope(parameter), Flavor(DisableOverride);
+Qualifier Required : boolean = false, Scope(property, reference, parameter, method), Flavor(DisableOverride);
+
+[Description("The base class.")]
+class Test_ManagedElement {
+	[Key] string InstanceID;
+	[ValueMap {"0", "2", "3", "..", "0x8000.."},
+	 Values {"Unknown", "OK", "Degraded", "DMTF Reserved", "Vendor Reserved"}]
+	uint16 OperationalStatus[];
+};
+
+class Test_Job : Test_ManagedElement {
+	uint16 PercentComplete;
+	[ValueMap {"010", "0x10", "16", "-1"}, Values {"Octal", "Hex", "Hex", "Negative"}]
+	sint8 Radix;
+};
+
+class Test_System : Test_ManagedElement {
+	string Name;
+	Test_Job REF LastJob;
+
+	[ValueMap {"0", "1", "4096"}, Values {"Completed", "Failed", "Job Started"}]
+	uint32 RequestStateChange(
+		[In, Required, ValueMap {"2", "3"}, Values {"Enabled", "Disabled"}] uint16 RequestedState,
+		[In, Out(false)] datetime TimeoutPeriod,
+		[In(false), Out] Test_Job REF Job);
+};
+`
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wbemgen")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.mof")
+	if err := ioutil.WriteFile(filename, []byte(testMOF), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	g := NewGenerator("cim")
+	if err := g.Load(dir); nil != err {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := g.Generate(&buf, nil); nil != err {
+		t.Fatal(err)
+	}
+	code := buf.String()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cim_gen.go", code, 0)
+	if nil != err {
+		t.Fatal(err, "\r\n", code)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("cim", fset, []*ast.File{file}, nil); nil != err {
+		t.Fatal(err, "\r\n", code)
+	}
+
+	for _, s := range []string{
+		"type Test_ManagedElement_OperationalStatus uint16",
+		"Test_Job_Radix_Octal Test_Job_Radix = 8",
+		"Test_Job_Radix_Hex_X16 Test_Job_Radix = 16",
+		"Test_Job_Radix_Negative Test_Job_Radix = -1",
+		"Test_ManagedElement_OperationalStatus_Degraded Test_ManagedElement_OperationalStatus = 3",
+		"OperationalStatus []Test_ManagedElement_OperationalStatus `cim:\"OperationalStatus,type=uint16\"`",
+		"InstanceID string `cim:\"InstanceID,key,type=string\"`",
+		"LastJob *Test_JobRef `cim:\"LastJob\"`",
+		"type Test_JobRef gowbem.ObjectPath",
+		"RequestedState Test_System_RequestStateChange_RequestedState `cim:\"RequestedState,type=uint16\"`",
+		"TimeoutPeriod *string `cim:\"TimeoutPeriod,type=datetime\"`",
+		"ReturnValue Test_System_RequestStateChange_ReturnValue `cim:\"ReturnValue,type=uint32\"`",
+		"Job *Test_JobRef `cim:\"Job\"`",
+		"Test_System_RequestStateChange_ReturnValue_JobStarted Test_System_RequestStateChange_ReturnValue = 4096",
+		"func Test_System_RequestStateChange(ctx context.Context, c *gowbem.ClientCIMXML,",
+		"// Test_ManagedElement is the CIM class Test_ManagedElement. // // The base class.",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(code), " "), s) {
+			t.Error(s, "isn't found")
+		}
+	}
+	if 1 != strings.Count(code, "type Test_ManagedElement_OperationalStatus ") ||
+		strings.Contains(code, "VendorReserved") || 1 != strings.Count(code, "The base class.") {
+		t.Error(code)
+	}
+
+	buf.Reset()
+	if err := g.Generate(&buf, []string{"Test_Job"}); nil != err {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Test_System") || strings.Contains(buf.String(), "\"context\"") {
+		t.Error(buf.String())
+	}
+	if err := g.Generate(&buf, []string{"Test_Unknown"}); nil == err {
+		t.Error("error is excepted")
+	}
+
+	overflow := strings.Replace(testMOF, `"-1"}`, `"128"}`, 1)
+	if err := ioutil.WriteFile(filename, []byte(overflow), 0644); nil != err {
+		t.Fatal(err)
+	}
+	g = NewGenerator("cim")
+	if err := g.Load(dir); nil != err {
+		t.Fatal(err)
+	}
+	if err := g.Generate(&buf, nil); nil == err || !strings.Contains(err.Error(), "overflows int8") {
+		t.Error("excepted is overflow, actual is", err)
+	}
+}
@@ -0,0 +1,63 @@
+// wbemgen generates the Go structs, the enums of the ValueMap and the
+// method wrappers of the CIM classes.
+//
+//	wbemgen -package=cim -output=cim_gen.go -class=CIM_ComputerSystem,CIM_NumericSensor ./192.168.1.157
+//
+// The arguments are the XML files of GetClass, the MOF files or the
+// directories of the wbem_dump.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	pkg       = flag.String("package", "cim", "生成代码的包名")
+	output    = flag.String("output", "", "输出文件, 缺省值为标准输出")
+	classname = flag.String("class", "", "要生成的类名, 多个类名用逗号分隔, 缺省值为全部的类")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Println("使用方法： wbemgen -package=cim -output=cim_gen.go -class=CIM_ComputerSystem 类定义文件或目录...\r\n" +
+			"可用选项")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if 0 == flag.NArg() {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	g := NewGenerator(*pkg)
+	for _, filename := range flag.Args() {
+		if err := g.Load(filename); nil != err {
+			log.Fatalln(err)
+		}
+	}
+
+	var classNames []string
+	for _, name := range strings.Split(*classname, ",") {
+		if name = strings.TrimSpace(name); "" != name {
+			classNames = append(classNames, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := g.Generate(&buf, classNames); nil != err {
+		log.Fatalln(err)
+	}
+	if "" == *output {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); nil != err {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,613 @@
+// Package wbemtest provides an in-memory CIMOM for testing the WBEM clients
+// without a live server.
+//
+// The CIMOM keeps the classes, qualifiers and instances of each namespace in
+// memory and serves them with the server package, so every intrinsic
+// operation the client supports works, including the associations which are
+// computed from the reference properties of the association instances. The
+// extrinsic methods are served by the hooks registered with HandleMethod.
+//
+//	m := wbemtest.New()
+//	m.AddClass("root/cimv2", class)
+//	m.AddInstance("root/cimv2", instance)
+//	hsrv := m.Start()
+//	defer hsrv.Close()
+//	c, _ := wbemtest.NewClient(hsrv)
+package wbemtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/mof"
+	"github.com/runner-mei/gowbem/server"
+)
+
+// Quirks makes the CIMOM behave like a specific server.
+type Quirks struct {
+	// InteropNamespace and NamespaceClass are where the CIMOM publishes the
+	// namespaces, the namespaces aren't published when NamespaceClass is
+	// empty.
+	InteropNamespace string
+	NamespaceClass   string
+
+	// TextXMLOnly rejects the requests that the Content-Type isn't text/xml
+	// like some old servers.
+	TextXMLOnly bool
+
+	// HeaderErrors reports the errors of the operations with the CIMError
+	// and PGErrorDetail headers and an empty body like the old Pegasus.
+	HeaderErrors bool
+
+	// OmitEmptyReturnValue omits the IRETURNVALUE element when the result
+	// is empty.
+	OmitEmptyReturnValue bool
+
+	// Chunked sends the responses without the Content-Length header.
+	Chunked bool
+}
+
+// Fault describes an error that the CIMOM injects into the matched
+// requests. It is a HTTP level fault when StatusCode or Body is set,
+// otherwise the matched operation fails with Err.
+type Fault struct {
+	// Operation, Namespace and ClassName select the requests, the empty
+	// value matches all.
+	Operation string
+	Namespace string
+	ClassName string
+
+	// Times is the number of the requests the fault is applied to, it is
+	// applied forever when Times is 0.
+	Times int
+
+	// Delay delays the matched requests.
+	Delay time.Duration
+
+	Err error
+
+	StatusCode int
+	CIMError   string
+	Body       string
+}
+
+func (f *Fault) isHTTP() bool {
+	return 0 != f.StatusCode || "" != f.Body
+}
+
+func (f *Fault) match(op *gowbem.Operation) bool {
+	return ("" == f.Operation || strings.EqualFold(f.Operation, op.Name)) &&
+		("" == f.Namespace || namespaceKey(f.Namespace) == namespaceKey(op.Namespace)) &&
+		("" == f.ClassName || strings.EqualFold(f.ClassName, operationClassName(op)))
+}
+
+func operationClassName(op *gowbem.Operation) string {
+	if !op.Intrinsic {
+		if nil != op.ObjectName {
+			return op.ObjectName.ClassName
+		}
+		return ""
+	}
+	for _, name := range []string{"ClassName", "InstanceName", "ObjectName"} {
+		if className := op.ClassNameParam(name); "" != className {
+			return className
+		}
+	}
+	return ""
+}
+
+// CIMOM is an in-memory WBEM server, it is a http.Handler.
+type CIMOM struct {
+	// Server is the underlying CIM-XML server, its Authenticate can be set
+	// to test the authorization.
+	Server *server.Server
+
+	// Latency delays every request.
+	Latency time.Duration
+
+	Quirks Quirks
+
+	mu         sync.RWMutex
+	namespaces map[string]*repository
+	methods    map[string]MethodFunc
+	faults     []*Fault
+	requests   []gowbem.Operation
+}
+
+func New() *CIMOM {
+	m := &CIMOM{
+		Server:     server.NewServer(),
+		namespaces: map[string]*repository{},
+		methods:    map[string]MethodFunc{},
+		Quirks: Quirks{
+			InteropNamespace: "root/interop",
+			NamespaceClass:   "CIM_Namespace",
+		},
+	}
+	m.Server.Intercept = m.intercept
+	return m
+}
+
+func namespaceKey(namespaceName string) string {
+	return strings.ToLower(strings.Trim(strings.Replace(namespaceName, "\\", "/", -1), "/"))
+}
+
+// namespace returns the repository of the namespace, it is created and
+// registered to the server if it doesn't exist.
+func (m *CIMOM) namespace(namespaceName string) *repository {
+	key := namespaceKey(namespaceName)
+
+	m.mu.Lock()
+	r := m.namespaces[key]
+	created := nil == r
+	if created {
+		r = newRepository(strings.Trim(namespaceName, "/"))
+		m.namespaces[key] = r
+	}
+	m.mu.Unlock()
+
+	if created {
+		m.Server.RegisterClassProvider(namespaceName, m)
+		m.Server.RegisterInstanceProvider(namespaceName, "", m)
+		m.Server.RegisterAssociationProvider(namespaceName, "", m)
+		m.Server.RegisterMethodProvider(namespaceName, "", m)
+	}
+	return r
+}
+
+// AddNamespace adds an empty namespace.
+func (m *CIMOM) AddNamespace(namespaceName string) {
+	m.namespace(namespaceName)
+}
+
+func (m *CIMOM) AddClass(namespaceName string, class *gowbem.CimClass) {
+	r := m.namespace(namespaceName)
+	m.mu.Lock()
+	r.addClass(class)
+	m.mu.Unlock()
+}
+
+func (m *CIMOM) AddQualifier(namespaceName string, qualifier *gowbem.CimQualifierDeclaration) {
+	r := m.namespace(namespaceName)
+	m.mu.Lock()
+	r.addQualifier(qualifier)
+	m.mu.Unlock()
+}
+
+// AddInstance adds the instance and returns its name, the name is built from
+// the key properties of its class. An existing instance with the same name
+// is replaced.
+func (m *CIMOM) AddInstance(namespaceName string, instance *gowbem.CimInstance) (*gowbem.CimInstanceName, error) {
+	r := m.namespace(namespaceName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	instanceName, err := r.instanceName(instance)
+	if nil != err {
+		return nil, err
+	}
+	r.addInstance(&gowbem.CimValueNamedInstance{InstanceName: *instanceName, Instance: *instance})
+	return instanceName, nil
+}
+
+// AddNamedInstance adds the instance with the given name.
+func (m *CIMOM) AddNamedInstance(namespaceName string, instance *gowbem.CimValueNamedInstance) {
+	r := m.namespace(namespaceName)
+	m.mu.Lock()
+	r.addInstance(instance)
+	m.mu.Unlock()
+}
+
+// AddInstanceValues adds an instance of the class with the values, the
+// types of the properties come from the class if it is loaded. The values
+// may be strings, booleans, numbers, slices of them or *gowbem.CimInstanceName
+// for the references.
+func (m *CIMOM) AddInstanceValues(namespaceName, className string, values map[string]interface{}) (*gowbem.CimInstanceName, error) {
+	m.mu.RLock()
+	var class *gowbem.CimClass
+	if r := m.namespaces[namespaceKey(namespaceName)]; nil != r {
+		class = r.getClass(className)
+	}
+	m.mu.RUnlock()
+
+	instance, err := NewInstance(class, className, values)
+	if nil != err {
+		return nil, err
+	}
+	return m.AddInstance(namespaceName, instance)
+}
+
+// LoadXML loads the classes, qualifier declarations and instances from a
+// XML document, the CLASS, QUALIFIER.DECLARATION, INSTANCE and
+// VALUE.NAMEDINSTANCE elements are searched in any depth, so the document
+// may be a CIM response or a file of the wbem_dump.
+func (m *CIMOM) LoadXML(namespaceName string, r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if nil != err {
+			if io.EOF == err {
+				return nil
+			}
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "CLASS":
+			var class gowbem.CimClass
+			if err := decoder.DecodeElement(&class, &start); nil != err {
+				return err
+			}
+			m.AddClass(namespaceName, &class)
+		case "QUALIFIER.DECLARATION":
+			var qualifier gowbem.CimQualifierDeclaration
+			if err := decoder.DecodeElement(&qualifier, &start); nil != err {
+				return err
+			}
+			m.AddQualifier(namespaceName, &qualifier)
+		case "VALUE.NAMEDINSTANCE":
+			var instance gowbem.CimValueNamedInstance
+			if err := decoder.DecodeElement(&instance, &start); nil != err {
+				return err
+			}
+			m.AddNamedInstance(namespaceName, &instance)
+		case "INSTANCE":
+			var instance gowbem.CimInstance
+			if err := decoder.DecodeElement(&instance, &start); nil != err {
+				return err
+			}
+			if _, err := m.AddInstance(namespaceName, &instance); nil != err {
+				return err
+			}
+		}
+	}
+}
+
+func (m *CIMOM) LoadXMLFile(namespaceName, filename string) error {
+	bs, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return err
+	}
+	return m.LoadXML(namespaceName, bytes.NewReader(bs))
+}
+
+// LoadMOFFile compiles the MOF file and loads its declarations, the
+// declarations before the first #pragma namespace are loaded into
+// namespaceName.
+func (m *CIMOM) LoadMOFFile(namespaceName, filename string) error {
+	c := mof.NewCompiler()
+	if err := c.ParseFile(filename); nil != err {
+		return err
+	}
+	return m.loadMOF(namespaceName, c)
+}
+
+// LoadMOF compiles the MOF source and loads its declarations like
+// LoadMOFFile.
+func (m *CIMOM) LoadMOF(namespaceName, src string) error {
+	c := mof.NewCompiler()
+	if err := c.Parse("<mof>", src); nil != err {
+		return err
+	}
+	return m.loadMOF(namespaceName, c)
+}
+
+func (m *CIMOM) loadMOF(namespaceName string, c *mof.Compiler) error {
+	for _, ns := range c.Namespaces() {
+		name := ns.Name
+		if mof.DefaultNamespace == name {
+			name = namespaceName
+		}
+		for idx := range ns.Qualifiers {
+			m.AddQualifier(name, &ns.Qualifiers[idx])
+		}
+		for idx := range ns.Classes {
+			m.AddClass(name, &ns.Classes[idx])
+		}
+		for idx := range ns.Instances {
+			if _, err := m.AddInstance(name, &ns.Instances[idx].Instance); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleMethod registers the hook of the extrinsic method, the hook of the
+// superclass is used if the class hasn't one, and the hook is used for all
+// classes when className is empty.
+func (m *CIMOM) HandleMethod(namespaceName, className, methodName string, fn MethodFunc) {
+	m.namespace(namespaceName)
+	m.mu.Lock()
+	m.methods[methodKey(namespaceName, className, methodName)] = fn
+	m.mu.Unlock()
+}
+
+func (m *CIMOM) InjectFault(fault Fault) {
+	m.mu.Lock()
+	m.faults = append(m.faults, &fault)
+	m.mu.Unlock()
+}
+
+func (m *CIMOM) ClearFaults() {
+	m.mu.Lock()
+	m.faults = nil
+	m.mu.Unlock()
+}
+
+// Requests returns the operations that the CIMOM has received.
+func (m *CIMOM) Requests() []gowbem.Operation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]gowbem.Operation(nil), m.requests...)
+}
+
+func (m *CIMOM) ResetRequests() {
+	m.mu.Lock()
+	m.requests = nil
+	m.mu.Unlock()
+}
+
+// takeFault returns the first fault that matches one of the operations.
+func (m *CIMOM) takeFault(isHTTP bool, operations []gowbem.Operation) *Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for idx, fault := range m.faults {
+		if isHTTP != fault.isHTTP() {
+			continue
+		}
+		for opIdx := range operations {
+			if !fault.match(&operations[opIdx]) {
+				continue
+			}
+			if fault.Times > 0 {
+				fault.Times--
+				if 0 == fault.Times {
+					m.faults = append(m.faults[:idx], m.faults[idx+1:]...)
+				}
+			}
+			copyed := *fault
+			return &copyed
+		}
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *CIMOM) intercept(ctx context.Context, op *gowbem.Operation) error {
+	m.mu.Lock()
+	m.requests = append(m.requests, *op)
+	m.mu.Unlock()
+
+	fault := m.takeFault(false, []gowbem.Operation{*op})
+	if nil == fault {
+		return nil
+	}
+	if err := sleep(ctx, fault.Delay); nil != err {
+		return err
+	}
+	return fault.Err
+}
+
+// Start starts a httptest.Server that serves the CIMOM, the caller should
+// close it. The interop namespace of the Quirks is created here, so the
+// Quirks should be set before Start.
+func (m *CIMOM) Start() *httptest.Server {
+	if "" != m.Quirks.NamespaceClass && "" != m.Quirks.InteropNamespace {
+		m.namespace(m.Quirks.InteropNamespace)
+	}
+	return httptest.NewServer(m)
+}
+
+// NewClient returns a CIM-XML client that connects to the test server.
+func NewClient(hsrv *httptest.Server) (*gowbem.ClientCIMXML, error) {
+	u, err := url.Parse(hsrv.URL)
+	if nil != err {
+		return nil, err
+	}
+	return gowbem.NewClientCIMXML(u, true)
+}
+
+func (m *CIMOM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := sleep(r.Context(), m.Latency); nil != err {
+		return
+	}
+
+	if m.Quirks.TextXMLOnly && !strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "text/xml") {
+		w.Header().Set("CIMError", server.ErrRequestNotValid)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var req gowbem.CIM
+	if err := xml.Unmarshal(body, &req); nil == err {
+		if operations, err := gowbem.ParseOperations(&req); nil == err {
+			if fault := m.takeFault(true, operations); nil != fault {
+				if err := sleep(r.Context(), fault.Delay); nil != err {
+					return
+				}
+				m.writeFault(w, fault)
+				return
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	m.Server.ServeHTTP(recorder, r)
+
+	respBody := recorder.Body.Bytes()
+	if http.StatusOK == recorder.Code && (m.Quirks.HeaderErrors || m.Quirks.OmitEmptyReturnValue) {
+		var resp gowbem.CIM
+		if err := xml.Unmarshal(respBody, &resp); nil == err {
+			if m.Quirks.HeaderErrors {
+				if cimError := responseError(&resp); nil != cimError {
+					w.Header().Set("CIMError", "request-not-valid")
+					w.Header().Set("PGErrorDetail", url.QueryEscape(
+						gowbem.CIMStatusCode(cimError.Code).String()+": "+cimError.Description))
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			if m.Quirks.OmitEmptyReturnValue {
+				omitEmptyReturnValue(&resp)
+			}
+
+			var buf bytes.Buffer
+			buf.WriteString(xml.Header)
+			if err := xml.NewEncoder(&buf).Encode(&resp); nil != err {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			respBody = buf.Bytes()
+		}
+	}
+
+	for key, values := range recorder.Header() {
+		w.Header()[key] = values
+	}
+	if !m.Quirks.Chunked {
+		w.Header().Set("Content-Length", strconv.Itoa(len(respBody)))
+	}
+	w.WriteHeader(recorder.Code)
+	if m.Quirks.Chunked {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	w.Write(respBody)
+}
+
+func (m *CIMOM) writeFault(w http.ResponseWriter, fault *Fault) {
+	if "" != fault.CIMError {
+		w.Header().Set("CIMError", fault.CIMError)
+	}
+	if 0 == fault.StatusCode {
+		w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+		w.Header().Set("CIMOperation", "MethodResponse")
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(fault.StatusCode)
+	}
+	io.WriteString(w, fault.Body)
+}
+
+func responseError(resp *gowbem.CIM) *gowbem.CimError {
+	if nil == resp.Message || nil == resp.Message.SimpleRsp {
+		return nil
+	}
+	if rsp := resp.Message.SimpleRsp.IMethodResponse; nil != rsp {
+		return rsp.Error
+	}
+	if rsp := resp.Message.SimpleRsp.MethodResponse; nil != rsp {
+		return rsp.Error
+	}
+	return nil
+}
+
+func omitEmptyReturnValue(resp *gowbem.CIM) {
+	if nil == resp.Message {
+		return
+	}
+	var responses []*gowbem.CimSimpleRsp
+	if nil != resp.Message.SimpleRsp {
+		responses = append(responses, resp.Message.SimpleRsp)
+	}
+	if nil != resp.Message.MultiRsp {
+		for idx := range resp.Message.MultiRsp.SimpleRsps {
+			responses = append(responses, &resp.Message.MultiRsp.SimpleRsps[idx])
+		}
+	}
+
+	for _, rsp := range responses {
+		if nil == rsp.IMethodResponse || nil == rsp.IMethodResponse.ReturnValue {
+			continue
+		}
+		bs, err := xml.Marshal(rsp.IMethodResponse.ReturnValue)
+		if nil == err && "<IRETURNVALUE></IRETURNVALUE>" == string(bs) {
+			rsp.IMethodResponse.ReturnValue = nil
+		}
+	}
+}
+
+// namespaceInstance returns the published instance of the namespace.
+func (m *CIMOM) namespaceInstance(namespaceName string, instanceName *gowbem.CimInstanceName) *gowbem.CimValueNamedInstance {
+	for _, instance := range m.namespaceInstances(namespaceName, instanceName.ClassName) {
+		if sameInstanceName(&instance.InstanceName, instanceName) {
+			return &instance
+		}
+	}
+	return nil
+}
+
+// namespaceInstances returns the instances of the NamespaceClass in the
+// interop namespace, it returns nil for other classes.
+func (m *CIMOM) namespaceInstances(namespaceName, className string) []gowbem.CimValueNamedInstance {
+	if "" == m.Quirks.NamespaceClass ||
+		!strings.EqualFold(m.Quirks.NamespaceClass, className) ||
+		namespaceKey(m.Quirks.InteropNamespace) != namespaceKey(namespaceName) {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]gowbem.CimValueNamedInstance, 0, len(m.namespaces))
+	for _, r := range m.namespaces {
+		results = append(results, gowbem.CimValueNamedInstance{
+			InstanceName: gowbem.CimInstanceName{
+				ClassName: m.Quirks.NamespaceClass,
+				KeyBindings: []gowbem.CimKeyBinding{
+					{Name: "CreationClassName", KeyValue: &gowbem.CimKeyValue{ValueType: "string", Value: m.Quirks.NamespaceClass}},
+					{Name: "Name", KeyValue: &gowbem.CimKeyValue{ValueType: "string", Value: r.name}},
+				},
+			},
+			Instance: gowbem.CimInstance{
+				ClassName: m.Quirks.NamespaceClass,
+				Properties: []gowbem.CimAnyProperty{
+					{Property: &gowbem.CimProperty{Name: "CreationClassName", Type: "string",
+						Value: &gowbem.CimValue{Value: m.Quirks.NamespaceClass}}},
+					{Property: &gowbem.CimProperty{Name: "Name", Type: "string",
+						Value: &gowbem.CimValue{Value: r.name}}},
+				},
+			},
+		})
+	}
+	return results
+}
@@ -0,0 +1,364 @@
+package wbemtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/gowbem"
+)
+
+const testNamespace = "root/cimv2"
+
+func keyProperty(name, typ string) gowbem.CimAnyProperty {
+	return gowbem.CimAnyProperty{Property: &gowbem.CimProperty{Name: name, Type: typ,
+		Qualifiers: []gowbem.CimQualifier{{Name: "Key", Type: "boolean", Value: &gowbem.CimValue{Value: "true"}}}}}
+}
+
+func makeCIMOM(t *testing.T) *CIMOM {
+	m := New()
+	m.AddClass(testNamespace, &gowbem.CimClass{Name: "Test_System",
+		Properties: []gowbem.CimAnyProperty{keyProperty("Name", "string"),
+			{Property: &gowbem.CimProperty{Name: "Caption", Type: "string"}}}})
+	m.AddClass(testNamespace, &gowbem.CimClass{Name: "Test_Disk",
+		Properties: []gowbem.CimAnyProperty{keyProperty("DeviceID", "string"),
+			{Property: &gowbem.CimProperty{Name: "Size", Type: "uint64"}}}})
+	m.AddClass(testNamespace, &gowbem.CimClass{Name: "Test_SystemDevice",
+		Qualifiers: []gowbem.CimQualifier{{Name: "Association", Type: "boolean", Value: &gowbem.CimValue{Value: "true"}}},
+		Properties: []gowbem.CimAnyProperty{
+			{PropertyReference: &gowbem.CimPropertyReference{Name: "GroupComponent", ReferenceClass: "Test_System",
+				Qualifiers: []gowbem.CimQualifier{{Name: "Key", Type: "boolean"}}}},
+			{PropertyReference: &gowbem.CimPropertyReference{Name: "PartComponent", ReferenceClass: "Test_Disk",
+				Qualifiers: []gowbem.CimQualifier{{Name: "Key", Type: "boolean"}}}}}})
+
+	system, err := m.AddInstanceValues(testNamespace, "Test_System", map[string]interface{}{"Name": "s1", "Caption": "system 1"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"d1", "d2"} {
+		disk, err := m.AddInstanceValues(testNamespace, "Test_Disk", map[string]interface{}{"DeviceID": id, "Size": uint64(1024)})
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, err := m.AddInstanceValues(testNamespace, "Test_SystemDevice",
+			map[string]interface{}{"GroupComponent": system, "PartComponent": disk}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestInstances(t *testing.T) {
+	m := makeCIMOM(t)
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	names, err := c.EnumerateInstanceNames(ctx, testNamespace, "Test_Disk")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) {
+		t.Fatal("want 2 disks, got", names)
+	}
+
+	instance, err := c.GetInstanceByInstanceName(ctx, testNamespace, names[1], false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "d2" != instance.GetPropertyByName("DeviceID").GetValue() || "1024" != instance.GetPropertyByName("Size").GetValue() {
+		t.Error(instance)
+	}
+
+	classNames, err := c.EnumerateClassNames(ctx, testNamespace, "", false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(classNames) {
+		t.Error(classNames)
+	}
+
+	_, err = c.EnumerateInstances(ctx, testNamespace, "Test_NotExists", false, false, false, false, nil)
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_INVALID_CLASS != code {
+		t.Error("want CIM_ERR_INVALID_CLASS, got", err)
+	}
+}
+
+func TestAssociations(t *testing.T) {
+	m := makeCIMOM(t)
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	system, _ := gowbem.ParseInstanceName(`Test_System.Name="s1"`)
+	names, err := c.AssociatorNames(ctx, testNamespace, system, "Test_SystemDevice", "", "", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) || "Test_Disk" != names[0].GetClassName() {
+		t.Error(names)
+	}
+
+	instances, err := c.AssociatorInstances(ctx, testNamespace, system, "", "Test_Disk", "GroupComponent", "PartComponent", false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(instances) || "d1" != instances[0].GetInstance().GetPropertyByName("DeviceID").GetValue() {
+		t.Error(instances)
+	}
+
+	instances, err = c.AssociatorInstances(ctx, testNamespace, system, "", "", "PartComponent", "", false, nil)
+	if nil != err && !gowbem.IsEmptyResults(err) {
+		t.Fatal(err)
+	}
+	if 0 != len(instances) {
+		t.Error("role isn't applied -", instances)
+	}
+
+	disk, _ := gowbem.ParseInstanceName(`Test_Disk.DeviceID="d2"`)
+	refNames, err := c.ReferenceNames(ctx, testNamespace, disk, "Test_SystemDevice", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(refNames) || "Test_SystemDevice" != refNames[0].GetClassName() {
+		t.Error(refNames)
+	}
+
+	refs, err := c.ReferenceInstances(ctx, testNamespace, disk, "", "PartComponent", false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(refs) {
+		t.Error(refs)
+	}
+}
+
+func TestInvokeMethod(t *testing.T) {
+	m := makeCIMOM(t)
+	m.HandleMethod(testNamespace, "Test_Disk", "Format", func(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+		inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error) {
+		if 1 != len(inParams) || "Quick" != inParams[0].Name {
+			return nil, nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_PARAMETER, "Quick is missing")
+		}
+		return &gowbem.CimReturnValue{ParamType: "uint32", Value: &gowbem.CimValue{Value: "4096"}},
+			[]gowbem.CimParamValue{{Name: "Job", ParamType: "string", Value: &gowbem.CimValue{Value: "job1"}}}, nil
+	})
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	disk, _ := gowbem.ParseInstanceName(`Test_Disk.DeviceID="d1"`)
+	ret, outParams, err := c.InvokeMethod(context.Background(), testNamespace, disk, "Format",
+		[]gowbem.CIMParamValue{&gowbem.CimParamValue{Name: "Quick", Value: &gowbem.CimValue{Value: "true"}}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "4096" != ret.String() || 1 != len(outParams) {
+		t.Error(ret, outParams)
+	}
+
+	_, _, err = c.InvokeMethod(context.Background(), testNamespace, disk, "Erase", nil)
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_METHOD_NOT_FOUND != code {
+		t.Error("want CIM_ERR_METHOD_NOT_FOUND, got", err)
+	}
+
+	requests := m.Requests()
+	if 2 != len(requests) || "Format" != requests[0].Name || requests[0].Intrinsic {
+		t.Error(requests)
+	}
+}
+
+func TestLoadXML(t *testing.T) {
+	m := New()
+	if err := m.LoadXMLFile(testNamespace, "../testfiles/enumerateClasses.xml"); nil != err {
+		t.Fatal(err)
+	}
+	if err := m.LoadXMLFile(testNamespace, "../testfiles/EmbObjGetInstance.xml"); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	class, err := c.GetClass(ctx, testNamespace, "CIM_Collection", false, true, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(class.String(), "Abstract") {
+		t.Error(class)
+	}
+	classXML, err := c.GetClassXML(ctx, testNamespace, "CIM_Collection", false, true, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(classXML, `<CLASS NAME="CIM_Collection"`) || !strings.Contains(classXML, "Abstract") {
+		t.Error(classXML)
+	}
+
+	instanceName, _ := gowbem.ParseInstanceName(`TestClass.ID="00"`)
+	instance, err := c.GetInstanceByInstanceName(ctx, testNamespace, instanceName, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil == instance.GetPropertyByName("InstValueWithInstAttr") {
+		t.Error(instance)
+	}
+}
+
+func TestLoadMOF(t *testing.T) {
+	m := New()
+	if err := m.LoadMOFFile(testNamespace, "../testfiles/CIM_Min25.mof"); nil != err {
+		t.Fatal(err)
+	}
+	if err := m.LoadMOF(testNamespace, `
+class Test_Computer : CIM_ComputerSystem {
+};
+
+instance of Test_Computer {
+	CreationClassName = "Test_Computer";
+	Name = "c1";
+};`); nil != err {
+		t.Fatal(err)
+	}
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	names, err := c.EnumerateInstanceNames(ctx, testNamespace, "Test_Computer")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(names) || 2 != names[0].GetKeyBindings().Len() {
+		t.Fatal(names)
+	}
+	instance, err := c.GetInstanceByInstanceName(ctx, testNamespace, names[0], false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if pr := instance.GetPropertyByName("Name"); nil == pr || "c1" != pr.GetValue() {
+		t.Error(instance)
+	}
+}
+
+func TestEnumerateNamespaces(t *testing.T) {
+	m := makeCIMOM(t)
+	m.AddNamespace("root/vendor")
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	namespaces, err := c.EnumerateNamespaces(context.Background(), nil, time.Second, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, ns := range namespaces {
+		found[ns] = true
+	}
+	if !found[testNamespace] || !found["root/vendor"] || !found["root/interop"] {
+		t.Error(namespaces)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	m := makeCIMOM(t)
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	m.InjectFault(Fault{Operation: "EnumerateInstanceNames", ClassName: "Test_Disk", Times: 1,
+		Err: gowbem.WBEMException(gowbem.CIM_ERR_ACCESS_DENIED, "denied")})
+	_, err = c.EnumerateInstanceNames(ctx, testNamespace, "Test_Disk")
+	if code, ok := gowbem.GetCIMStatusCode(err); !ok || gowbem.CIM_ERR_ACCESS_DENIED != code {
+		t.Error("want CIM_ERR_ACCESS_DENIED, got", err)
+	}
+	if _, err = c.EnumerateInstanceNames(ctx, testNamespace, "Test_Disk"); nil != err {
+		t.Error("fault should fire once -", err)
+	}
+
+	m.InjectFault(Fault{Operation: "GetClass", StatusCode: http.StatusServiceUnavailable})
+	if _, err = c.GetClass(ctx, testNamespace, "Test_Disk", false, false, false, nil); nil == err ||
+		!strings.Contains(err.Error(), "503") {
+		t.Error("want 503, got", err)
+	}
+
+	m.ClearFaults()
+	m.InjectFault(Fault{Body: "<CIM><MESSAGE"})
+	if _, err = c.GetClass(ctx, testNamespace, "Test_Disk", false, false, false, nil); nil == err {
+		t.Error("want decode error")
+	} else if _, ok := err.(*gowbem.DecodeError); !ok {
+		t.Errorf("want DecodeError, got %T %v", err, err)
+	}
+
+	m.ClearFaults()
+	m.InjectFault(Fault{Delay: time.Second, Err: errors.New("slow")})
+	timeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = c.GetClass(timeCtx, testNamespace, "Test_Disk", false, false, false, nil); nil == err {
+		t.Error("want timeout")
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	m := makeCIMOM(t)
+	m.Quirks.TextXMLOnly = true
+	m.Quirks.OmitEmptyReturnValue = true
+	m.Quirks.Chunked = true
+	hsrv := m.Start()
+	defer hsrv.Close()
+	c, err := NewClient(hsrv)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// the client falls back to text/xml after the first request failed
+	names, err := c.EnumerateInstanceNames(ctx, testNamespace, "Test_Disk")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) {
+		t.Error(names)
+	}
+
+	m.AddClass(testNamespace, &gowbem.CimClass{Name: "Test_Empty"})
+	_, err = c.EnumerateInstances(ctx, testNamespace, "Test_Empty", false, false, false, false, nil)
+	if !gowbem.IsEmptyResults(err) || !strings.Contains(err.Error(), "IMETHODRESPONSE.RETURNVALUE isn't exists") {
+		t.Error("want empty results, got", err)
+	}
+
+	m.Quirks.HeaderErrors = true
+	_, err = c.EnumerateInstanceNames(ctx, testNamespace, "Test_NotExists")
+	if nil == err || !strings.Contains(err.Error(), "CIM_ERR_INVALID_CLASS") {
+		t.Error("want header error, got", err)
+	}
+}
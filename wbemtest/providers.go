@@ -0,0 +1,414 @@
+package wbemtest
+
+import (
+	"context"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+	"github.com/runner-mei/gowbem/server"
+)
+
+// MethodFunc is the hook of an extrinsic method, objectName only contains
+// the class name when the method is static.
+type MethodFunc func(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error)
+
+func copyInstance(instance *gowbem.CimInstance) *gowbem.CimInstance {
+	copyed := *instance
+	copyed.Properties = append([]gowbem.CimAnyProperty(nil), instance.Properties...)
+	return &copyed
+}
+
+func (m *CIMOM) repository(namespaceName string) (*repository, error) {
+	r := m.namespaces[namespaceKey(namespaceName)]
+	if nil == r {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_NAMESPACE,
+			"namespace '"+namespaceName+"' isn't found.")
+	}
+	return r, nil
+}
+
+func (m *CIMOM) GetClass(ctx context.Context, namespaceName, className string) (*gowbem.CimClass, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	class := r.getClass(className)
+	if nil == class {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND,
+			"class '"+className+"' isn't found.")
+	}
+	return class, nil
+}
+
+func (m *CIMOM) EnumerateClasses(ctx context.Context, namespaceName, className string, deepInheritance bool) ([]gowbem.CimClass, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	if "" != className && nil == r.getClass(className) {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_CLASS,
+			"class '"+className+"' isn't found.")
+	}
+
+	var results []gowbem.CimClass
+	for _, key := range r.classNames {
+		class := r.classes[key]
+		if strings.EqualFold(class.SuperClass, className) ||
+			(deepInheritance && !strings.EqualFold(class.Name, className) && r.isA(class.Name, className)) {
+			results = append(results, *class)
+		}
+	}
+	return results, nil
+}
+
+func (m *CIMOM) EnumerateQualifiers(ctx context.Context, namespaceName string) ([]gowbem.CimQualifierDeclaration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	return append([]gowbem.CimQualifierDeclaration(nil), r.qualifiers...), nil
+}
+
+func (m *CIMOM) GetInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName, opts *server.Options) (*gowbem.CimInstance, error) {
+	if instance := m.namespaceInstance(namespaceName, instanceName); nil != instance {
+		return &instance.Instance, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	instance := r.getInstance(instanceName)
+	if nil == instance {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND,
+			"instance '"+instanceName.String()+"' isn't found.")
+	}
+	return copyInstance(&instance.Instance), nil
+}
+
+func (m *CIMOM) EnumerateInstances(ctx context.Context, namespaceName, className string, opts *server.Options) ([]gowbem.CimValueNamedInstance, error) {
+	if instances := m.namespaceInstances(namespaceName, className); nil != instances {
+		return instances, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	if 0 != len(r.classes) && nil == r.getClass(className) {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_CLASS,
+			"class '"+className+"' isn't found.")
+	}
+
+	var results []gowbem.CimValueNamedInstance
+	for _, instance := range r.instances {
+		if r.isA(instance.InstanceName.ClassName, className) {
+			results = append(results, gowbem.CimValueNamedInstance{
+				InstanceName: instance.InstanceName,
+				Instance:     *copyInstance(&instance.Instance),
+			})
+		}
+	}
+	return results, nil
+}
+
+func (m *CIMOM) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]gowbem.CimInstanceName, error) {
+	instances, err := m.EnumerateInstances(ctx, namespaceName, className, nil)
+	if nil != err {
+		return nil, err
+	}
+	results := make([]gowbem.CimInstanceName, 0, len(instances))
+	for _, instance := range instances {
+		results = append(results, instance.InstanceName)
+	}
+	return results, nil
+}
+
+func (m *CIMOM) CreateInstance(ctx context.Context, namespaceName string, instance *gowbem.CimInstance) (*gowbem.CimInstanceName, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return nil, err
+	}
+	if 0 != len(r.classes) && nil == r.getClass(instance.ClassName) {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_CLASS,
+			"class '"+instance.ClassName+"' isn't found.")
+	}
+	instanceName, err := r.instanceName(instance)
+	if nil != err {
+		return nil, err
+	}
+	if nil != r.getInstance(instanceName) {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_ALREADY_EXISTS,
+			"instance '"+instanceName.String()+"' is already exists.")
+	}
+	r.addInstance(&gowbem.CimValueNamedInstance{InstanceName: *instanceName, Instance: *copyInstance(instance)})
+	return instanceName, nil
+}
+
+func (m *CIMOM) ModifyInstance(ctx context.Context, namespaceName string, instance *gowbem.CimValueNamedInstance, opts *server.Options) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return err
+	}
+	old := r.getInstance(&instance.InstanceName)
+	if nil == old {
+		return gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND,
+			"instance '"+instance.InstanceName.String()+"' isn't found.")
+	}
+
+	modified := copyInstance(&old.Instance)
+	for _, pr := range instance.Instance.Properties {
+		name, _ := propertyQualifiers(pr)
+		if nil != opts && nil != opts.PropertyList && !containsFold(opts.PropertyList, name) {
+			continue
+		}
+		replaced := false
+		for idx := range modified.Properties {
+			if oldName, _ := propertyQualifiers(modified.Properties[idx]); strings.EqualFold(oldName, name) {
+				modified.Properties[idx] = pr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			modified.Properties = append(modified.Properties, pr)
+		}
+	}
+	r.addInstance(&gowbem.CimValueNamedInstance{InstanceName: old.InstanceName, Instance: *modified})
+	return nil
+}
+
+func (m *CIMOM) DeleteInstance(ctx context.Context, namespaceName string, instanceName *gowbem.CimInstanceName) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return err
+	}
+	if !r.deleteInstance(instanceName) {
+		return gowbem.WBEMException(gowbem.CIM_ERR_NOT_FOUND,
+			"instance '"+instanceName.String()+"' isn't found.")
+	}
+	return nil
+}
+
+// walkAssociations calls cb for every reference of the association
+// instances that points to objectName, other is the rest references of the
+// association.
+func (m *CIMOM) walkAssociations(namespaceName string, objectName *gowbem.CimInstanceName, assocClass, role string,
+	cb func(r *repository, assoc *gowbem.CimValueNamedInstance, ref *gowbem.CimPropertyReference, others []*gowbem.CimPropertyReference)) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		return err
+	}
+	for _, instance := range r.instances {
+		if !r.isA(instance.InstanceName.ClassName, assocClass) {
+			continue
+		}
+
+		var refs []*gowbem.CimPropertyReference
+		for _, pr := range instance.Instance.Properties {
+			if nil != pr.PropertyReference && nil != referenceName(pr.PropertyReference.ValueReference) {
+				refs = append(refs, pr.PropertyReference)
+			}
+		}
+		if len(refs) < 2 {
+			continue
+		}
+
+		for idx, ref := range refs {
+			if "" != role && !strings.EqualFold(role, ref.Name) {
+				continue
+			}
+			if !sameInstanceName(referenceName(ref.ValueReference), objectName) {
+				continue
+			}
+			others := make([]*gowbem.CimPropertyReference, 0, len(refs)-1)
+			others = append(others, refs[:idx]...)
+			others = append(others, refs[idx+1:]...)
+			cb(r, instance, ref, others)
+		}
+	}
+	return nil
+}
+
+func (m *CIMOM) associatorNames(namespaceName string, objectName *gowbem.CimInstanceName,
+	assocClass, resultClass, role, resultRole string) (*repository, []*gowbem.CimInstanceName, error) {
+	var repo *repository
+	var results []*gowbem.CimInstanceName
+	err := m.walkAssociations(namespaceName, objectName, assocClass, role,
+		func(r *repository, assoc *gowbem.CimValueNamedInstance, ref *gowbem.CimPropertyReference, others []*gowbem.CimPropertyReference) {
+			repo = r
+			for _, other := range others {
+				if "" != resultRole && !strings.EqualFold(resultRole, other.Name) {
+					continue
+				}
+				target := referenceName(other.ValueReference)
+				if !r.isA(target.ClassName, resultClass) {
+					continue
+				}
+				exists := false
+				for _, name := range results {
+					if sameInstanceName(name, target) {
+						exists = true
+						break
+					}
+				}
+				if !exists {
+					results = append(results, target)
+				}
+			}
+		})
+	return repo, results, err
+}
+
+func (m *CIMOM) Associators(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	assocClass, resultClass, role, resultRole string, opts *server.Options) ([]gowbem.CimValueObjectWithPath, error) {
+	r, names, err := m.associatorNames(namespaceName, objectName, assocClass, resultClass, role, resultRole)
+	if nil != err {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []gowbem.CimValueObjectWithPath
+	for _, name := range names {
+		instance := r.getInstance(name)
+		if nil == instance {
+			continue
+		}
+		results = append(results, gowbem.CimValueObjectWithPath{
+			InstancePath: &gowbem.CimInstancePath{InstanceName: instance.InstanceName},
+			Instance:     copyInstance(&instance.Instance),
+		})
+	}
+	return results, nil
+}
+
+func (m *CIMOM) AssociatorNames(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	assocClass, resultClass, role, resultRole string) ([]gowbem.CimInstancePath, error) {
+	_, names, err := m.associatorNames(namespaceName, objectName, assocClass, resultClass, role, resultRole)
+	if nil != err {
+		return nil, err
+	}
+	results := make([]gowbem.CimInstancePath, 0, len(names))
+	for _, name := range names {
+		results = append(results, gowbem.CimInstancePath{InstanceName: *name})
+	}
+	return results, nil
+}
+
+func (m *CIMOM) references(namespaceName string, objectName *gowbem.CimInstanceName,
+	resultClass, role string) ([]*gowbem.CimValueNamedInstance, error) {
+	var results []*gowbem.CimValueNamedInstance
+	err := m.walkAssociations(namespaceName, objectName, resultClass, role,
+		func(r *repository, assoc *gowbem.CimValueNamedInstance, ref *gowbem.CimPropertyReference, others []*gowbem.CimPropertyReference) {
+			for _, instance := range results {
+				if instance == assoc {
+					return
+				}
+			}
+			results = append(results, assoc)
+		})
+	return results, err
+}
+
+func (m *CIMOM) References(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	resultClass, role string, opts *server.Options) ([]gowbem.CimValueObjectWithPath, error) {
+	instances, err := m.references(namespaceName, objectName, resultClass, role)
+	if nil != err {
+		return nil, err
+	}
+	results := make([]gowbem.CimValueObjectWithPath, 0, len(instances))
+	for _, instance := range instances {
+		results = append(results, gowbem.CimValueObjectWithPath{
+			InstancePath: &gowbem.CimInstancePath{InstanceName: instance.InstanceName},
+			Instance:     copyInstance(&instance.Instance),
+		})
+	}
+	return results, nil
+}
+
+func (m *CIMOM) ReferenceNames(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	resultClass, role string) ([]gowbem.CimInstancePath, error) {
+	instances, err := m.references(namespaceName, objectName, resultClass, role)
+	if nil != err {
+		return nil, err
+	}
+	results := make([]gowbem.CimInstancePath, 0, len(instances))
+	for _, instance := range instances {
+		results = append(results, gowbem.CimInstancePath{InstanceName: instance.InstanceName})
+	}
+	return results, nil
+}
+
+func (m *CIMOM) InvokeMethod(ctx context.Context, namespaceName string, objectName *gowbem.CimInstanceName,
+	methodName string, inParams []gowbem.CimParamValue) (*gowbem.CimReturnValue, []gowbem.CimParamValue, error) {
+	m.mu.RLock()
+	r, err := m.repository(namespaceName)
+	if nil != err {
+		m.mu.RUnlock()
+		return nil, nil, err
+	}
+
+	var fn MethodFunc
+	className := objectName.ClassName
+	for i := 0; i < 64 && "" != className && nil == fn; i++ {
+		fn = m.methods[methodKey(namespaceName, className, methodName)]
+		if class := r.getClass(className); nil != class {
+			className = class.SuperClass
+		} else {
+			className = ""
+		}
+	}
+	if nil == fn {
+		fn = m.methods[methodKey(namespaceName, "", methodName)]
+	}
+	m.mu.RUnlock()
+
+	if nil == fn {
+		return nil, nil, gowbem.WBEMException(gowbem.CIM_ERR_METHOD_NOT_FOUND,
+			"method '"+objectName.ClassName+"."+methodName+"' isn't found.")
+	}
+	return fn(ctx, namespaceName, objectName, inParams)
+}
+
+func methodKey(namespaceName, className, methodName string) string {
+	return namespaceKey(namespaceName) + ":" + strings.ToLower(className) + "." + strings.ToLower(methodName)
+}
+
+func containsFold(names []string, name string) bool {
+	for _, s := range names {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package wbemtest
+
+import (
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// repository is the in-memory storage of a namespace.
+type repository struct {
+	name       string
+	qualifiers []gowbem.CimQualifierDeclaration
+	classes    map[string]*gowbem.CimClass
+	classNames []string
+	instances  []*gowbem.CimValueNamedInstance
+}
+
+func newRepository(name string) *repository {
+	return &repository{name: name, classes: map[string]*gowbem.CimClass{}}
+}
+
+func (r *repository) addClass(class *gowbem.CimClass) {
+	key := strings.ToLower(class.Name)
+	if _, ok := r.classes[key]; !ok {
+		r.classNames = append(r.classNames, key)
+	}
+	r.classes[key] = class
+}
+
+func (r *repository) addQualifier(qualifier *gowbem.CimQualifierDeclaration) {
+	for idx := range r.qualifiers {
+		if strings.EqualFold(r.qualifiers[idx].Name, qualifier.Name) {
+			r.qualifiers[idx] = *qualifier
+			return
+		}
+	}
+	r.qualifiers = append(r.qualifiers, *qualifier)
+}
+
+func (r *repository) getClass(className string) *gowbem.CimClass {
+	return r.classes[strings.ToLower(className)]
+}
+
+// isA returns true if className is baseName or a subclass of it, the class
+// chain stops at the first class that isn't defined in the repository.
+func (r *repository) isA(className, baseName string) bool {
+	if "" == baseName {
+		return true
+	}
+	for i := 0; i < 64 && "" != className; i++ {
+		if strings.EqualFold(className, baseName) {
+			return true
+		}
+		class := r.getClass(className)
+		if nil == class {
+			return false
+		}
+		className = class.SuperClass
+	}
+	return false
+}
+
+func (r *repository) hasClassQualifier(className, name string) bool {
+	for i := 0; i < 64 && "" != className; i++ {
+		class := r.getClass(className)
+		if nil == class {
+			return false
+		}
+		if hasQualifier(class.Qualifiers, name) {
+			return true
+		}
+		className = class.SuperClass
+	}
+	return false
+}
+
+// keyNames returns the names of the key properties of the class, they are
+// searched in the class chain.
+func (r *repository) keyNames(className string) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < 64 && "" != className; i++ {
+		class := r.getClass(className)
+		if nil == class {
+			break
+		}
+		for _, pr := range class.Properties {
+			if name, qualifiers := propertyQualifiers(pr); hasQualifier(qualifiers, "Key") {
+				keys[strings.ToLower(name)] = true
+			}
+		}
+		className = class.SuperClass
+	}
+	return keys
+}
+
+// instanceName builds the name of the instance from its key properties, the
+// keys come from the class or, when the class isn't loaded, from the Key
+// qualifiers of the instance's properties.
+func (r *repository) instanceName(instance *gowbem.CimInstance) (*gowbem.CimInstanceName, error) {
+	keys := r.keyNames(instance.ClassName)
+	name := &gowbem.CimInstanceName{ClassName: instance.ClassName}
+	for _, pr := range instance.Properties {
+		propertyName, qualifiers := propertyQualifiers(pr)
+		if !keys[strings.ToLower(propertyName)] && !hasQualifier(qualifiers, "Key") {
+			continue
+		}
+
+		switch {
+		case nil != pr.Property:
+			value := ""
+			if nil != pr.Property.Value {
+				value = pr.Property.Value.Value
+			}
+			name.KeyBindings = append(name.KeyBindings, gowbem.CimKeyBinding{
+				Name:     pr.Property.Name,
+				KeyValue: &gowbem.CimKeyValue{ValueType: valueType(pr.Property.Type), Value: value},
+			})
+		case nil != pr.PropertyReference:
+			name.KeyBindings = append(name.KeyBindings, gowbem.CimKeyBinding{
+				Name:           pr.PropertyReference.Name,
+				ValueReference: pr.PropertyReference.ValueReference,
+			})
+		default:
+			return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_PARAMETER,
+				"key property '"+propertyName+"' of the class '"+instance.ClassName+"' is an array.")
+		}
+	}
+	if 0 == len(name.KeyBindings) {
+		return nil, gowbem.WBEMException(gowbem.CIM_ERR_INVALID_CLASS,
+			"keys of the class '"+instance.ClassName+"' aren't found.")
+	}
+	return name, nil
+}
+
+func (r *repository) findInstance(instanceName *gowbem.CimInstanceName) int {
+	for idx, instance := range r.instances {
+		if sameInstanceName(&instance.InstanceName, instanceName) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (r *repository) getInstance(instanceName *gowbem.CimInstanceName) *gowbem.CimValueNamedInstance {
+	if idx := r.findInstance(instanceName); idx >= 0 {
+		return r.instances[idx]
+	}
+	return nil
+}
+
+func (r *repository) addInstance(instance *gowbem.CimValueNamedInstance) {
+	if idx := r.findInstance(&instance.InstanceName); idx >= 0 {
+		r.instances[idx] = instance
+		return
+	}
+	r.instances = append(r.instances, instance)
+}
+
+func (r *repository) deleteInstance(instanceName *gowbem.CimInstanceName) bool {
+	idx := r.findInstance(instanceName)
+	if idx < 0 {
+		return false
+	}
+	copy(r.instances[idx:], r.instances[idx+1:])
+	r.instances = r.instances[:len(r.instances)-1]
+	return true
+}
+
+func propertyQualifiers(pr gowbem.CimAnyProperty) (string, []gowbem.CimQualifier) {
+	switch {
+	case nil != pr.Property:
+		return pr.Property.Name, pr.Property.Qualifiers
+	case nil != pr.PropertyArray:
+		return pr.PropertyArray.Name, pr.PropertyArray.Qualifiers
+	case nil != pr.PropertyReference:
+		return pr.PropertyReference.Name, pr.PropertyReference.Qualifiers
+	}
+	return "", nil
+}
+
+func hasQualifier(qualifiers []gowbem.CimQualifier, name string) bool {
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, name) {
+			return nil == q.Value || !strings.EqualFold(q.Value.Value, "false")
+		}
+	}
+	return false
+}
+
+// valueType returns the VALUETYPE of the KEYVALUE for the CIM type.
+func valueType(typ string) string {
+	switch strings.ToLower(typ) {
+	case "boolean":
+		return "boolean"
+	case "string", "char16", "datetime", "":
+		return "string"
+	}
+	return "numeric"
+}
+
+func referenceName(ref *gowbem.CimValueReference) *gowbem.CimInstanceName {
+	switch {
+	case nil == ref:
+		return nil
+	case nil != ref.InstanceName:
+		return ref.InstanceName
+	case nil != ref.InstancePath:
+		return &ref.InstancePath.InstanceName
+	case nil != ref.LocalInstancePath:
+		return &ref.LocalInstancePath.InstanceName
+	}
+	return nil
+}
+
+func sameKeyBinding(a, b *gowbem.CimKeyBinding) bool {
+	switch {
+	case nil != a.KeyValue && nil != b.KeyValue:
+		if "boolean" == a.KeyValue.ValueType || "boolean" == b.KeyValue.ValueType {
+			return strings.EqualFold(a.KeyValue.Value, b.KeyValue.Value)
+		}
+		return a.KeyValue.Value == b.KeyValue.Value
+	case nil != a.ValueReference && nil != b.ValueReference:
+		aName, bName := referenceName(a.ValueReference), referenceName(b.ValueReference)
+		return nil != aName && nil != bName && sameInstanceName(aName, bName)
+	}
+	return false
+}
+
+func sameInstanceName(a, b *gowbem.CimInstanceName) bool {
+	if !strings.EqualFold(a.ClassName, b.ClassName) || len(a.KeyBindings) != len(b.KeyBindings) {
+		return false
+	}
+	if nil != a.KeyValue || nil != b.KeyValue {
+		return nil != a.KeyValue && nil != b.KeyValue && a.KeyValue.Value == b.KeyValue.Value
+	}
+	for idx := range a.KeyBindings {
+		found := false
+		for j := range b.KeyBindings {
+			if strings.EqualFold(a.KeyBindings[idx].Name, b.KeyBindings[j].Name) {
+				found = sameKeyBinding(&a.KeyBindings[idx], &b.KeyBindings[j])
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
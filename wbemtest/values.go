@@ -0,0 +1,141 @@
+package wbemtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/runner-mei/gowbem"
+)
+
+// NewInstance builds an instance of the class from the values, class may be
+// nil and then the types of the properties are guessed from the values. The
+// properties are sorted by the order of the class or by name.
+func NewInstance(class *gowbem.CimClass, className string, values map[string]interface{}) (*gowbem.CimInstance, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	types := map[string]string{}
+	if nil != class {
+		order := map[string]int{}
+		for idx, pr := range class.Properties {
+			name, _ := propertyQualifiers(pr)
+			order[strings.ToLower(name)] = idx
+			switch {
+			case nil != pr.Property:
+				types[strings.ToLower(name)] = pr.Property.Type
+			case nil != pr.PropertyArray:
+				types[strings.ToLower(name)] = pr.PropertyArray.Type
+			}
+		}
+		sort.SliceStable(names, func(i, j int) bool {
+			a, aok := order[strings.ToLower(names[i])]
+			b, bok := order[strings.ToLower(names[j])]
+			if aok && bok {
+				return a < b
+			}
+			return aok && !bok
+		})
+	}
+
+	instance := &gowbem.CimInstance{ClassName: className}
+	for _, name := range names {
+		pr, err := newProperty(name, types[strings.ToLower(name)], values[name])
+		if nil != err {
+			return nil, err
+		}
+		instance.Properties = append(instance.Properties, pr)
+	}
+	return instance, nil
+}
+
+func newProperty(name, typ string, value interface{}) (gowbem.CimAnyProperty, error) {
+	switch v := value.(type) {
+	case *gowbem.CimInstanceName:
+		return gowbem.CimAnyProperty{PropertyReference: &gowbem.CimPropertyReference{
+			Name:           name,
+			ReferenceClass: v.ClassName,
+			ValueReference: &gowbem.CimValueReference{InstanceName: v},
+		}}, nil
+	case nil:
+		if "" == typ {
+			typ = "string"
+		}
+		return gowbem.CimAnyProperty{Property: &gowbem.CimProperty{Name: name, Type: typ}}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if reflect.Slice == rv.Kind() {
+		array := &gowbem.CimPropertyArray{Name: name, Type: typ, ValueArray: &gowbem.CimValueArray{}}
+		for i := 0; i < rv.Len(); i++ {
+			elemType, s := formatValue(rv.Index(i).Interface())
+			if "" == array.Type {
+				array.Type = elemType
+			}
+			array.ValueArray.Values = append(array.ValueArray.Values,
+				gowbem.CimValueOrNull{Value: &gowbem.CimValue{Value: s}})
+		}
+		if "" == array.Type {
+			array.Type = formatType(rv.Type().Elem())
+		}
+		if "" == array.Type {
+			return gowbem.CimAnyProperty{}, errors.New("type of the property '" + name + "' is unknown.")
+		}
+		return gowbem.CimAnyProperty{PropertyArray: array}, nil
+	}
+
+	elemType, s := formatValue(value)
+	if "" == typ {
+		typ = elemType
+	}
+	if "" == typ {
+		return gowbem.CimAnyProperty{}, errors.New("type of the property '" + name + "' is unknown.")
+	}
+	return gowbem.CimAnyProperty{Property: &gowbem.CimProperty{Name: name, Type: typ,
+		Value: &gowbem.CimValue{Value: s}}}, nil
+}
+
+func formatValue(value interface{}) (string, string) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return "boolean", "true"
+		}
+		return "boolean", "false"
+	}
+	return formatType(reflect.TypeOf(value)), fmt.Sprint(value)
+}
+
+func formatType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int8:
+		return "sint8"
+	case reflect.Int16:
+		return "sint16"
+	case reflect.Int32:
+		return "sint32"
+	case reflect.Int, reflect.Int64:
+		return "sint64"
+	case reflect.Uint8:
+		return "uint8"
+	case reflect.Uint16:
+		return "uint16"
+	case reflect.Uint32:
+		return "uint32"
+	case reflect.Uint, reflect.Uint64:
+		return "uint64"
+	case reflect.Float32:
+		return "real32"
+	case reflect.Float64:
+		return "real64"
+	}
+	return ""
+}
@@ -0,0 +1,1281 @@
+package gowbem
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The namespaces of WS-Management and the WS-CIM binding.
+const (
+	nsSOAP        = "http://www.w3.org/2003/05/soap-envelope"
+	nsAddressing  = "http://schemas.xmlsoap.org/ws/2004/08/addressing"
+	nsEnumeration = "http://schemas.xmlsoap.org/ws/2004/09/enumeration"
+	nsTransfer    = "http://schemas.xmlsoap.org/ws/2004/09/transfer"
+	nsWSMan       = "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"
+	nsCIMBinding  = "http://schemas.dmtf.org/wbem/wsman/1/cimbinding.xsd"
+	nsXSI         = "http://www.w3.org/2001/XMLSchema-instance"
+	nsCIMCommon   = "http://schemas.dmtf.org/wbem/wscim/1/common"
+)
+
+const (
+	wsmanActionGet         = nsTransfer + "/Get"
+	wsmanActionEnumerate   = nsEnumeration + "/Enumerate"
+	wsmanActionPull        = nsEnumeration + "/Pull"
+	wsmanActionRelease     = nsEnumeration + "/Release"
+	wsmanAnonymous         = nsAddressing + "/role/anonymous"
+	wsmanAssociationFilter = "http://schemas.dmtf.org/wbem/wsman/1/cimbinding/associationFilter"
+	wsmanAllClasses        = "http://schemas.dmtf.org/wbem/wscim/1/*"
+	wsmanNamespaceSelector = "__cimnamespace"
+
+	wsmanEnumerateEPR          = "EnumerateEPR"
+	wsmanEnumerateObjectAndEPR = "EnumerateObjectAndEPR"
+)
+
+// DefaultResourceURIs maps the prefixes of the class names to the bases of
+// the resource URIs (DSP0227, DSP0230), the longest prefix is used. The
+// resource URIs of the WMI classes (Win32_ and MSFT_) contain the namespace,
+// so they aren't here.
+var DefaultResourceURIs = map[string]string{
+	"CIM_":  "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/",
+	"DCIM_": "http://schemas.dell.com/wbem/wscim/1/cim-schema/2/",
+	"AMT_":  "http://intel.com/wbem/wscim/1/amt-schema/1/",
+	"IPS_":  "http://intel.com/wbem/wscim/1/ips-schema/1/",
+	"OMC_":  "http://schema.omc-project.org/wbem/wscim/1/cim-schema/2/",
+}
+
+const wmiResourceURI = "http://schemas.microsoft.com/wbem/wsman/1/wmi/"
+
+// The values of ClientWSMan.Auth.
+const (
+	WSManAuthBasic  = "basic"
+	WSManAuthDigest = "digest"
+)
+
+// ClientWSMan is the client of WS-Management (DSP0226) with the WS-CIM
+// binding (DSP0227, DSP0230), the CIM operations are mapped onto Get,
+// Enumerate/Pull and the custom actions of the methods. The user of the url
+// is used to authenticate, the results are the same types returned by
+// ClientCIMXML.
+//
+// WS-Management doesn't send the types of the properties, so the values
+// are the strings excepted the references, the datetimes and the embedded
+// instances, the types may be got from the schema.
+type ClientWSMan struct {
+	Client
+
+	// Auth is WSManAuthBasic or WSManAuthDigest. The Basic is sent with
+	// the first request only if it is WSManAuthBasic, otherwise the request
+	// is sent without the credentials and the scheme asked by the server is
+	// used, the Digest is preferred and the Basic is used only if Auth is
+	// empty.
+	Auth string
+	// MaxElements is the max number of the items in an Enumerate or Pull
+	// response, the default is 100.
+	MaxElements int
+	// MaxEnvelopeSize is the max size of the response, the default is
+	// 512000.
+	MaxEnvelopeSize int
+	// OperationTimeout is the timeout of the operation in the server, the
+	// default is 60s.
+	OperationTimeout time.Duration
+	// ResourceURIs overrides DefaultResourceURIs, it maps the prefixes of
+	// the class names to the bases of the resource URIs.
+	ResourceURIs map[string]string
+
+	mu     sync.Mutex
+	digest *digestAuth
+	basic  bool
+}
+
+func NewClientWSMan(u *url.URL, insecure bool) (*ClientWSMan, error) {
+	c := &ClientWSMan{}
+	c.Client.init(u, insecure)
+	return c, nil
+}
+
+// ResourceURI returns the resource URI of the class.
+func (c *ClientWSMan) ResourceURI(namespaceName, className string) string {
+	if strings.HasPrefix(className, "http://") || strings.HasPrefix(className, "https://") {
+		return className
+	}
+	for _, uris := range []map[string]string{c.ResourceURIs, DefaultResourceURIs} {
+		prefix := ""
+		for key := range uris {
+			if len(key) > len(prefix) && strings.HasPrefix(className, key) {
+				prefix = key
+			}
+		}
+		if "" != prefix {
+			return strings.TrimSuffix(uris[prefix], "/") + "/" + className
+		}
+	}
+	if strings.HasPrefix(className, "Win32_") || strings.HasPrefix(className, "MSFT_") {
+		if "" == namespaceName {
+			namespaceName = "root/cimv2"
+		}
+		return wmiResourceURI + strings.ToLower(strings.Trim(strings.Replace(namespaceName, "\\", "/", -1), "/")) + "/" + className
+	}
+	return DefaultResourceURIs["CIM_"] + className
+}
+
+// allClassesURI returns the resource URI of the association filters.
+func allClassesURI(resourceURI string) string {
+	if strings.HasPrefix(resourceURI, wmiResourceURI) {
+		return resourceURI[:strings.LastIndex(resourceURI, "/")] + "/*"
+	}
+	return wsmanAllClasses
+}
+
+func classNameOfURI(resourceURI string) string {
+	resourceURI = strings.TrimSpace(resourceURI)
+	return resourceURI[strings.LastIndex(resourceURI, "/")+1:]
+}
+
+// wsmanNode is an element of the SOAP messages.
+type wsmanNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr  `xml:",any,attr"`
+	Text     string      `xml:",chardata"`
+	Children []wsmanNode `xml:",any"`
+}
+
+func (n *wsmanNode) child(name string) *wsmanNode {
+	if nil == n {
+		return nil
+	}
+	for idx := range n.Children {
+		if name == n.Children[idx].XMLName.Local {
+			return &n.Children[idx]
+		}
+	}
+	return nil
+}
+
+func (n *wsmanNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if name == attr.Name.Local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (n *wsmanNode) text() string {
+	if nil == n {
+		return ""
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+func (n *wsmanNode) isNil() bool {
+	for _, attr := range n.Attrs {
+		if "nil" == attr.Name.Local && (nsXSI == attr.Name.Space || "xsi" == attr.Name.Space) {
+			return "true" == strings.TrimSpace(attr.Value)
+		}
+	}
+	return false
+}
+
+// epr returns the endpoint reference in the element, the element may be
+// the EndpointReference or contain it.
+func (n *wsmanNode) epr() *wsmanNode {
+	if nil != n.child("ReferenceParameters") {
+		return n
+	}
+	if epr := n.child("EndpointReference"); nil != epr && nil != epr.child("ReferenceParameters") {
+		return epr
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func newMessageID() string {
+	var bs [16]byte
+	rand.Read(bs[:])
+	bs[6] = (bs[6] & 0x0f) | 0x40
+	bs[8] = (bs[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(bs[:])
+	return "uuid:" + s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// selectorSet returns the SelectorSet of the path, the namespace of the
+// path is used if it isn't empty.
+func (c *ClientWSMan) selectorSet(namespaceName string, path *ObjectPath) string {
+	if "" != path.Namespace {
+		namespaceName = path.Namespace
+	}
+	var buf strings.Builder
+	buf.WriteString("<w:SelectorSet>")
+	for _, kb := range path.KeyBindings {
+		name := kb.Name
+		if "" == name {
+			name = "__value"
+		}
+		buf.WriteString(`<w:Selector Name="`)
+		buf.WriteString(xmlEscape(name))
+		buf.WriteString(`">`)
+		switch {
+		case nil != kb.ValueReference:
+			if ref := ObjectPathFromReference(kb.ValueReference); nil != ref {
+				buf.WriteString("<a:EndpointReference>")
+				buf.WriteString(c.endpointReference(namespaceName, ref))
+				buf.WriteString("</a:EndpointReference>")
+			}
+		case nil != kb.KeyValue:
+			buf.WriteString(xmlEscape(kb.KeyValue.Value))
+		}
+		buf.WriteString("</w:Selector>")
+	}
+	if "" != namespaceName {
+		buf.WriteString(`<w:Selector Name="` + wsmanNamespaceSelector + `">`)
+		buf.WriteString(xmlEscape(namespaceName))
+		buf.WriteString("</w:Selector>")
+	} else if 0 == len(path.KeyBindings) {
+		return ""
+	}
+	buf.WriteString("</w:SelectorSet>")
+	return buf.String()
+}
+
+// endpointReference returns the content of the EPR of the path.
+func (c *ClientWSMan) endpointReference(namespaceName string, path *ObjectPath) string {
+	if "" != path.Namespace {
+		namespaceName = path.Namespace
+	}
+	return "<a:Address>" + wsmanAnonymous + "</a:Address><a:ReferenceParameters><w:ResourceURI>" +
+		xmlEscape(c.ResourceURI(namespaceName, path.ClassName)) + "</w:ResourceURI>" +
+		c.selectorSet(namespaceName, path) + "</a:ReferenceParameters>"
+}
+
+// wsmanPath converts the EPR into the path, the selectors are the string
+// keys and __cimnamespace is the namespace.
+func wsmanPath(epr *wsmanNode) (*ObjectPath, error) {
+	rp := epr.child("ReferenceParameters")
+	if nil == rp || nil == rp.child("ResourceURI") {
+		return nil, errors.New("ResourceURI of the endpoint reference is missing")
+	}
+	path := &ObjectPath{ClassName: classNameOfURI(rp.child("ResourceURI").Text)}
+	for _, selector := range rp.child("SelectorSet").children("Selector") {
+		name := selector.attr("Name")
+		if wsmanNamespaceSelector == name {
+			path.Namespace = selector.text()
+			continue
+		}
+		if "__value" == name {
+			name = ""
+		}
+		if ref := selector.epr(); nil != ref {
+			refPath, err := wsmanPath(ref)
+			if nil != err {
+				return nil, err
+			}
+			path.KeyBindings = append(path.KeyBindings, CimKeyBinding{Name: name, ValueReference: refPath.ValueReference()})
+			continue
+		}
+		path.KeyBindings = append(path.KeyBindings, CimKeyBinding{Name: name,
+			KeyValue: &CimKeyValue{ValueType: "string", Value: selector.Text}})
+	}
+	return path, nil
+}
+
+func (n *wsmanNode) children(name string) []*wsmanNode {
+	if nil == n {
+		return nil
+	}
+	var results []*wsmanNode
+	for idx := range n.Children {
+		if name == n.Children[idx].XMLName.Local {
+			results = append(results, &n.Children[idx])
+		}
+	}
+	return results
+}
+
+// wsmanInstanceName returns the instance name of the path, the name of a
+// singleton instance has the class name only.
+func wsmanInstanceName(path *ObjectPath) *CimInstanceName {
+	if path.IsClass() {
+		return &CimInstanceName{ClassName: path.ClassName}
+	}
+	return path.InstanceName()
+}
+
+func (c *ClientWSMan) envelope(action, resourceURI, selectorSet, body string) []byte {
+	maxEnvelopeSize := c.MaxEnvelopeSize
+	if maxEnvelopeSize <= 0 {
+		maxEnvelopeSize = 512000
+	}
+	timeout := c.OperationTimeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	to := c.u
+	to.User = nil
+
+	var buf bytes.Buffer
+	buf.WriteString(`<s:Envelope xmlns:s="` + nsSOAP + `" xmlns:a="` + nsAddressing + `" xmlns:n="` + nsEnumeration +
+		`" xmlns:w="` + nsWSMan + `" xmlns:b="` + nsCIMBinding + `" xmlns:xsi="` + nsXSI + `" xmlns:cim="` + nsCIMCommon + `">`)
+	buf.WriteString("<s:Header>")
+	buf.WriteString("<a:To>" + xmlEscape(to.String()) + "</a:To>")
+	buf.WriteString(`<w:ResourceURI s:mustUnderstand="true">` + xmlEscape(resourceURI) + "</w:ResourceURI>")
+	buf.WriteString(`<a:ReplyTo><a:Address s:mustUnderstand="true">` + wsmanAnonymous + "</a:Address></a:ReplyTo>")
+	buf.WriteString(`<a:Action s:mustUnderstand="true">` + xmlEscape(action) + "</a:Action>")
+	buf.WriteString(`<w:MaxEnvelopeSize s:mustUnderstand="true">` + strconv.Itoa(maxEnvelopeSize) + "</w:MaxEnvelopeSize>")
+	buf.WriteString("<a:MessageID>" + newMessageID() + "</a:MessageID>")
+	buf.WriteString("<w:OperationTimeout>" + formatXSDuration(timeout) + "</w:OperationTimeout>")
+	buf.WriteString(selectorSet)
+	buf.WriteString("</s:Header>")
+	if "" == body {
+		buf.WriteString("<s:Body/>")
+	} else {
+		buf.WriteString("<s:Body>" + body + "</s:Body>")
+	}
+	buf.WriteString("</s:Envelope>")
+	return buf.Bytes()
+}
+
+// do sends the request and returns the Body of the response, the SOAP fault
+// is converted into the WbemError.
+func (c *ClientWSMan) do(ctx context.Context, action, resourceURI, selectorSet, body string) (*wsmanNode, error) {
+	reqBytes := c.envelope(action, resourceURI, selectorSet, body)
+	httpres, resBytes, err := c.post(ctx, reqBytes)
+	if nil != err {
+		return nil, err
+	}
+
+	if 0 == len(bytes.TrimSpace(resBytes)) {
+		if http.StatusOK != httpres.StatusCode {
+			return nil, errors.New(httpres.Status)
+		}
+		return &wsmanNode{}, nil
+	}
+	envelope := &wsmanNode{}
+	if err := xml.Unmarshal(resBytes, envelope); nil != err {
+		if http.StatusOK != httpres.StatusCode {
+			return nil, errors.New(httpres.Status + ":" + string(resBytes))
+		}
+		return nil, &DecodeError{bytes: resBytes, err: err}
+	}
+	resBody := envelope.child("Body")
+	if nil == resBody {
+		return nil, &DecodeError{bytes: resBytes, err: errors.New("Body of the SOAP envelope is missing")}
+	}
+	if fault := resBody.child("Fault"); nil != fault {
+		return nil, &FaultError{bytes: resBytes, err: wsmanFault(fault)}
+	}
+	if http.StatusOK != httpres.StatusCode {
+		return nil, errors.New(httpres.Status + ":" + string(resBytes))
+	}
+	return resBody, nil
+}
+
+// post sends the request with the authentication, it is sent again with
+// the credentials if the server asks for them, see ClientWSMan.Auth.
+func (c *ClientWSMan) post(ctx context.Context, reqBytes []byte) (*http.Response, []byte, error) {
+	u := c.u
+	user := u.User
+	u.User = nil
+
+	for retry := 0; ; retry++ {
+		sentBasic := false
+		httpreq, err := http.NewRequest("POST", u.String(), bytes.NewReader(reqBytes))
+		if nil != err {
+			return nil, nil, err
+		}
+		if ctx != nil {
+			httpreq = httpreq.WithContext(ctx)
+		}
+		httpreq.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+
+		if nil != user {
+			password, _ := user.Password()
+			c.mu.Lock()
+			digest, basic := c.digest, c.basic
+			c.mu.Unlock()
+			if nil != digest {
+				authorization, err := digest.authorization("POST", u.RequestURI(), user.Username(), password)
+				if nil != err {
+					return nil, nil, err
+				}
+				httpreq.Header.Set("Authorization", authorization)
+			} else if basic || WSManAuthBasic == c.Auth {
+				httpreq.SetBasicAuth(user.Username(), password)
+				sentBasic = true
+			}
+		}
+
+		var dumpWriter io.WriteCloser
+		if DebugEnabled() {
+			num := atomic.AddUint64(&c.rn, 1)
+			b, _ := httputil.DumpRequestOut(httpreq, false)
+			dumpWriter = DebugNewFile(fmt.Sprintf("%d-%04d.log", c.cn, num))
+			dumpWriter.Write(b)
+			dumpWriter.Write(reqBytes)
+		}
+
+		httpres, err := c.Client.Client.Do(httpreq)
+		if nil != err {
+			if nil != dumpWriter {
+				dumpWriter.Close()
+			}
+			return nil, nil, err
+		}
+		resBytes, err := io.ReadAll(httpres.Body)
+		httpres.Body.Close()
+		if nil != dumpWriter {
+			b, _ := httputil.DumpResponse(httpres, false)
+			dumpWriter.Write([]byte("\r\n"))
+			dumpWriter.Write(b)
+			dumpWriter.Write(resBytes)
+			dumpWriter.Close()
+		}
+		if nil != err {
+			return nil, nil, err
+		}
+
+		if http.StatusUnauthorized != httpres.StatusCode {
+			return httpres, resBytes, nil
+		}
+		if nil == user || retry > 0 || WSManAuthBasic == c.Auth {
+			return nil, nil, ErrUnauthorized
+		}
+		var digest *digestAuth
+		basic := false
+		for _, challenge := range httpres.Header.Values("WWW-Authenticate") {
+			if digest = parseDigestChallenge(challenge); nil != digest {
+				break
+			}
+			if fields := strings.Fields(challenge); 0 != len(fields) && strings.EqualFold("Basic", fields[0]) {
+				basic = true
+			}
+		}
+		if nil == digest && (!basic || sentBasic || WSManAuthDigest == c.Auth) {
+			return nil, nil, ErrUnauthorized
+		}
+		c.mu.Lock()
+		c.digest = digest
+		c.basic = nil == digest
+		c.mu.Unlock()
+	}
+}
+
+// wsmanFault converts the SOAP fault into the WbemError, the CIM_Error in
+// the Detail is preferred.
+func wsmanFault(fault *wsmanNode) error {
+	code := fault.child("Code")
+	subcode := code.child("Subcode").child("Value").text()
+	if "" == subcode {
+		subcode = code.child("Value").text()
+	}
+	if idx := strings.LastIndex(subcode, ":"); idx >= 0 {
+		subcode = subcode[idx+1:]
+	}
+
+	message := fault.child("Reason").child("Text").text()
+	detail := fault.child("Detail")
+	if s := detail.child("FaultDetail").text(); "" != s {
+		message += " (" + s + ")"
+	}
+	if "" == message {
+		message = subcode
+	}
+
+	statusCode := CIM_ERR_FAILED
+	switch subcode {
+	case "DestinationUnreachable", "InvalidSelectors":
+		statusCode = CIM_ERR_NOT_FOUND
+	case "ActionNotSupported", "UnsupportedFeature", "FilterDialectRequestedUnavailable":
+		statusCode = CIM_ERR_NOT_SUPPORTED
+	case "AccessDenied":
+		statusCode = CIM_ERR_ACCESS_DENIED
+	case "SchemaValidationError", "InvalidRepresentation", "InvalidParameter", "CannotProcessFilter", "EncodingLimit":
+		statusCode = CIM_ERR_INVALID_PARAMETER
+	case "AlreadyExists":
+		statusCode = CIM_ERR_ALREADY_EXISTS
+	case "InvalidEnumerationContext":
+		statusCode = CIM_ERR_INVALID_ENUMERATION_CONTEXT
+	}
+	if cimError := detail.child("CIM_Error"); nil != cimError {
+		if i, err := strconv.Atoi(cimError.child("CIMStatusCode").text()); nil == err && 0 != i {
+			statusCode = CIMStatusCode(i)
+		}
+		if s := cimError.child("Message").text(); "" != s {
+			message = s
+		}
+	}
+	return WBEMException(statusCode, message)
+}
+
+// wsmanValue converts the element of a property or a parameter, the
+// result is a *CimValue, a *CimValueReference or nil for the null value.
+func wsmanValue(n *wsmanNode) (interface{}, string, string, error) {
+	if n.isNil() {
+		return nil, "string", "", nil
+	}
+	if epr := n.epr(); nil != epr {
+		path, err := wsmanPath(epr)
+		if nil != err {
+			return nil, "", "", err
+		}
+		return path.ValueReference(), "reference", "", nil
+	}
+	if 0 == len(n.Children) {
+		return &CimValue{Value: n.Text}, "string", "", nil
+	}
+
+	child := &n.Children[0]
+	switch child.XMLName.Local {
+	case "Datetime", "Date", "Time", "Interval", "CIM_DateTime":
+		s, err := parseWSManDatetime(child.XMLName.Local, child.text())
+		if nil != err {
+			return nil, "", "", err
+		}
+		return &CimValue{Value: s}, "datetime", "", nil
+	}
+	instance, err := wsmanInstance(child)
+	if nil != err {
+		return nil, "", "", err
+	}
+	s, kind, err := EncodeEmbeddedObject(instance)
+	if nil != err {
+		return nil, "", "", err
+	}
+	return &CimValue{Value: s}, "string", kind, nil
+}
+
+// wsmanInstance converts the element of the instance, the repeated
+// elements are the arrays.
+func wsmanInstance(n *wsmanNode) (*CimInstance, error) {
+	instance := &CimInstance{ClassName: n.XMLName.Local}
+	var names []string
+	groups := map[string][]*wsmanNode{}
+	for idx := range n.Children {
+		name := n.Children[idx].XMLName.Local
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], &n.Children[idx])
+	}
+
+	for _, name := range names {
+		nodes := groups[name]
+		if 1 == len(nodes) {
+			value, typ, embedded, err := wsmanValue(nodes[0])
+			if nil != err {
+				return nil, errors.New("'" + name + "' is invalid, " + err.Error())
+			}
+			if ref, ok := value.(*CimValueReference); ok {
+				instance.Properties = append(instance.Properties, CimAnyProperty{PropertyReference: &CimPropertyReference{
+					Name: name, ValueReference: ref}})
+				continue
+			}
+			pr := &CimProperty{Name: name, Type: typ, EmbeddedObject: embedded}
+			if v, ok := value.(*CimValue); ok {
+				pr.Value = v
+			}
+			instance.Properties = append(instance.Properties, CimAnyProperty{Property: pr})
+			continue
+		}
+
+		pr := &CimPropertyArray{Name: name, Type: "string", ValueArray: &CimValueArray{Values: make([]CimValueOrNull, len(nodes))}}
+		for idx, node := range nodes {
+			value, typ, embedded, err := wsmanValue(node)
+			if nil != err {
+				return nil, errors.New("'" + name + "' is invalid, " + err.Error())
+			}
+			switch v := value.(type) {
+			case nil:
+				pr.ValueArray.Values[idx].Null = &CimValueNull{}
+			case *CimValueReference:
+				pr.ValueArray.Values[idx].Value = &CimValue{Value: ObjectPathFromReference(v).String()}
+			case *CimValue:
+				pr.ValueArray.Values[idx].Value = v
+				if "reference" != typ && "string" != typ {
+					pr.Type = typ
+				}
+				if "" != embedded {
+					pr.EmbeddedObject = embedded
+				}
+			}
+		}
+		instance.Properties = append(instance.Properties, CimAnyProperty{PropertyArray: pr})
+	}
+	return instance, nil
+}
+
+// wsmanNamedInstance converts the item of EnumerateObjectAndEPR, the name
+// has the class name only if the EPR is missing.
+func wsmanNamedInstance(item *wsmanNode) (*CimValueNamedInstance, error) {
+	var epr, object *wsmanNode
+	if "Item" == item.XMLName.Local {
+		for idx := range item.Children {
+			if "EndpointReference" == item.Children[idx].XMLName.Local {
+				epr = &item.Children[idx]
+			} else if nil == object {
+				object = &item.Children[idx]
+			}
+		}
+	} else {
+		object = item
+	}
+	if nil == object {
+		return nil, errors.New("instance of the item is missing")
+	}
+
+	instance, err := wsmanInstance(object)
+	if nil != err {
+		return nil, err
+	}
+	result := &CimValueNamedInstance{Instance: *instance, InstanceName: CimInstanceName{ClassName: instance.ClassName}}
+	if nil != epr {
+		path, err := wsmanPath(epr)
+		if nil != err {
+			return nil, err
+		}
+		result.InstanceName = *wsmanInstanceName(path)
+	}
+	return result, nil
+}
+
+func parseWSManDatetime(kind, s string) (string, error) {
+	switch kind {
+	case "CIM_DateTime":
+		return s, nil
+	case "Interval":
+		d, err := parseXSDuration(s)
+		if nil != err {
+			return "", err
+		}
+		return FormatInterval(d), nil
+	case "Date":
+		for _, layout := range []string{"2006-01-02Z07:00", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); nil == err {
+				return FormatDatetime(t), nil
+			}
+		}
+	case "Time":
+		for _, layout := range []string{"15:04:05.999999999Z07:00", "15:04:05.999999999"} {
+			if t, err := time.Parse(layout, s); nil == err {
+				return FormatDatetime(t), nil
+			}
+		}
+	default:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+			if t, err := time.Parse(layout, s); nil == err {
+				return FormatDatetime(t), nil
+			}
+		}
+	}
+	return "", errors.New("'" + s + "' isn't a " + kind)
+}
+
+// parseXSDuration parses the xs:duration, the years and the months aren't
+// supported because they haven't the fixed lengths.
+func parseXSDuration(s string) (time.Duration, error) {
+	text := strings.TrimPrefix(strings.TrimSpace(s), "-")
+	if !strings.HasPrefix(text, "P") || len(text) < 3 {
+		return 0, errors.New("'" + s + "' isn't a duration")
+	}
+	var d time.Duration
+	inTime := false
+	start := 1
+	for idx := 1; idx < len(text); idx++ {
+		ch := text[idx]
+		if 'T' == ch {
+			inTime, start = true, idx+1
+			continue
+		}
+		if (ch >= '0' && ch <= '9') || '.' == ch {
+			continue
+		}
+		f, err := strconv.ParseFloat(text[start:idx], 64)
+		if nil != err {
+			return 0, errors.New("'" + s + "' isn't a duration")
+		}
+		var unit time.Duration
+		switch {
+		case 'D' == ch && !inTime:
+			unit = 24 * time.Hour
+		case 'H' == ch && inTime:
+			unit = time.Hour
+		case 'M' == ch && inTime:
+			unit = time.Minute
+		case 'S' == ch && inTime:
+			unit = time.Second
+		default:
+			return 0, errors.New("'" + s + "' isn't a supported duration")
+		}
+		d += time.Duration(f * float64(unit))
+		start = idx + 1
+	}
+	if start != len(text) {
+		return 0, errors.New("'" + s + "' isn't a duration")
+	}
+	return d, nil
+}
+
+func formatXSDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	s := "P" + strconv.FormatInt(int64(days), 10) + "DT" + strconv.FormatInt(int64(d/time.Hour), 10) + "H" +
+		strconv.FormatInt(int64((d%time.Hour)/time.Minute), 10) + "M"
+	return s + strconv.FormatFloat((d%time.Minute).Seconds(), 'f', -1, 64) + "S"
+}
+
+// enumerate sends Enumerate with the optimized enumeration and Pull until
+// the end of the sequence, cb is called with the items.
+func (c *ClientWSMan) enumerate(ctx context.Context, resourceURI, selectorSet, mode, filter string,
+	cb func(item *wsmanNode) error) error {
+	maxElements := c.MaxElements
+	if maxElements <= 0 {
+		maxElements = 100
+	}
+
+	var body strings.Builder
+	body.WriteString("<n:Enumerate><w:OptimizeEnumeration/><w:MaxElements>")
+	body.WriteString(strconv.Itoa(maxElements))
+	body.WriteString("</w:MaxElements>")
+	if "" != mode {
+		body.WriteString("<w:EnumerationMode>" + mode + "</w:EnumerationMode>")
+	}
+	body.WriteString(filter)
+	body.WriteString("</n:Enumerate>")
+
+	resBody, err := c.do(ctx, wsmanActionEnumerate, resourceURI, selectorSet, body.String())
+	if nil != err {
+		return err
+	}
+	response := resBody.child("EnumerateResponse")
+	if nil == response {
+		return errors.New("EnumerateResponse is missing")
+	}
+
+	for {
+		enumerationContext := response.child("EnumerationContext").text()
+		for idx := range response.child("Items").Children {
+			if err := cb(&response.child("Items").Children[idx]); nil != err {
+				if "" != enumerationContext && nil == response.child("EndOfSequence") {
+					c.do(ctx, wsmanActionRelease, resourceURI, selectorSet,
+						"<n:Release><n:EnumerationContext>"+xmlEscape(enumerationContext)+"</n:EnumerationContext></n:Release>")
+				}
+				return err
+			}
+		}
+		if nil != response.child("EndOfSequence") || "" == enumerationContext {
+			return nil
+		}
+
+		resBody, err := c.do(ctx, wsmanActionPull, resourceURI, selectorSet,
+			"<n:Pull><n:EnumerationContext>"+xmlEscape(enumerationContext)+"</n:EnumerationContext><n:MaxElements>"+
+				strconv.Itoa(maxElements)+"</n:MaxElements></n:Pull>")
+		if nil != err {
+			return err
+		}
+		if response = resBody.child("PullResponse"); nil == response {
+			return errors.New("PullResponse is missing")
+		}
+	}
+}
+
+func (c *ClientWSMan) enumerateNames(ctx context.Context, resourceURI, selectorSet, filter string) ([]CIMInstanceName, error) {
+	var results []CIMInstanceName
+	err := c.enumerate(ctx, resourceURI, selectorSet, wsmanEnumerateEPR, filter, func(item *wsmanNode) error {
+		epr := item.epr()
+		if nil == epr {
+			return errors.New("'" + item.XMLName.Local + "' isn't a endpoint reference")
+		}
+		path, err := wsmanPath(epr)
+		if nil != err {
+			return err
+		}
+		results = append(results, wsmanInstanceName(path))
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *ClientWSMan) enumerateInstances(ctx context.Context, resourceURI, selectorSet, filter string) ([]CIMInstanceWithName, error) {
+	var results []CIMInstanceWithName
+	err := c.enumerate(ctx, resourceURI, selectorSet, wsmanEnumerateObjectAndEPR, filter, func(item *wsmanNode) error {
+		instance, err := wsmanNamedInstance(item)
+		if nil != err {
+			return err
+		}
+		results = append(results, instance)
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *ClientWSMan) EnumerateInstanceNames(ctx context.Context, namespaceName, className string) ([]CIMInstanceName, error) {
+	if "" == className {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	return c.enumerateNames(ctx, c.ResourceURI(namespaceName, className),
+		c.selectorSet(namespaceName, &ObjectPath{}), "")
+}
+
+// EnumerateInstances enumerates the instances with the EPRs, the flags and
+// the property list are ignored because WS-Management doesn't support
+// them.
+func (c *ClientWSMan) EnumerateInstances(ctx context.Context, namespaceName, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error) {
+	if "" == className {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	return c.enumerateInstances(ctx, c.ResourceURI(namespaceName, className),
+		c.selectorSet(namespaceName, &ObjectPath{}), "")
+}
+
+func (c *ClientWSMan) GetInstance(ctx context.Context, namespaceName, className string, keyBindings CIMKeyBindings, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	instanceName := &CimInstanceName{
+		ClassName: className,
+	}
+
+	switch keyBindings.Len() {
+	case 0:
+		return nil, errors.New("keyBindings is empty.")
+	case 1:
+		kb := keyBindings.Get(0)
+		if "_" == kb.GetName() {
+			instanceName.KeyValue = kb.(*CimKeyBinding).KeyValue
+			instanceName.ValueReference = kb.(*CimKeyBinding).ValueReference
+			break
+		}
+		fallthrough
+	default:
+		instanceName.KeyBindings = keyBindings.(CimKeyBindings)
+	}
+	return c.GetInstanceByInstanceName(ctx, namespaceName, instanceName, localOnly, includeQualifiers, includeClassOrigin, propertyList)
+}
+
+// GetInstanceByInstanceName gets the instance by the Get of WS-Transfer,
+// the flags and the property list are ignored.
+func (c *ClientWSMan) GetInstanceByInstanceName(ctx context.Context, namespaceName string, instanceName CIMInstanceName, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (CIMInstance, error) {
+	path, err := toReference(instanceName)
+	if nil != err {
+		return nil, err
+	}
+	if "" == path.ClassName {
+		return nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	resBody, err := c.do(ctx, wsmanActionGet, c.ResourceURI(namespaceName, path.ClassName),
+		c.selectorSet(namespaceName, path), "")
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(resBody.Children) {
+		return nil, WBEMException(CIM_ERR_NOT_FOUND, "instance '"+path.String()+"' isn't found.")
+	}
+	return wsmanInstance(&resBody.Children[0])
+}
+
+// associationFilter returns the filter of the association dialect, the
+// element is AssociatedInstances or AssociationInstances.
+func (c *ClientWSMan) associationFilter(namespaceName string, path *ObjectPath, element string,
+	params [][2]string, propertyList []string) string {
+	var buf strings.Builder
+	buf.WriteString(`<w:Filter Dialect="` + wsmanAssociationFilter + `"><b:` + element + "><b:Object>")
+	buf.WriteString(c.endpointReference(namespaceName, path))
+	buf.WriteString("</b:Object>")
+	for _, param := range params {
+		if "" != param[1] {
+			buf.WriteString("<b:" + param[0] + ">" + xmlEscape(param[1]) + "</b:" + param[0] + ">")
+		}
+	}
+	for _, name := range propertyList {
+		buf.WriteString("<b:IncludeResultProperty>" + xmlEscape(name) + "</b:IncludeResultProperty>")
+	}
+	buf.WriteString("</b:" + element + "></w:Filter>")
+	return buf.String()
+}
+
+func (c *ClientWSMan) associationTarget(namespaceName string, instanceName CIMInstanceName) (*ObjectPath, string, string, error) {
+	path, err := toReference(instanceName)
+	if nil != err {
+		return nil, "", "", err
+	}
+	if "" != path.Namespace {
+		namespaceName = path.Namespace
+	}
+	resourceURI := allClassesURI(c.ResourceURI(namespaceName, path.ClassName))
+	return path, resourceURI, c.selectorSet(namespaceName, &ObjectPath{}), nil
+}
+
+func (c *ClientWSMan) AssociatorNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string) ([]CIMInstanceName, error) {
+	path, resourceURI, selectorSet, err := c.associationTarget(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	return c.enumerateNames(ctx, resourceURI, selectorSet, c.associationFilter(namespaceName, path, "AssociatedInstances",
+		[][2]string{{"AssociationClassName", assocClass}, {"Role", role}, {"ResultClassName", resultClass}, {"ResultRole", resultRole}}, nil))
+}
+
+func (c *ClientWSMan) AssociatorInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	assocClass, resultClass, role, resultRole string, includeClassOrigin bool, propertyList []string) ([]CIMInstanceWithName, error) {
+	path, resourceURI, selectorSet, err := c.associationTarget(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	return c.enumerateInstances(ctx, resourceURI, selectorSet, c.associationFilter(namespaceName, path, "AssociatedInstances",
+		[][2]string{{"AssociationClassName", assocClass}, {"Role", role}, {"ResultClassName", resultClass}, {"ResultRole", resultRole}}, propertyList))
+}
+
+func (c *ClientWSMan) ReferenceNames(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string) ([]CIMInstanceName, error) {
+	path, resourceURI, selectorSet, err := c.associationTarget(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	return c.enumerateNames(ctx, resourceURI, selectorSet, c.associationFilter(namespaceName, path, "AssociationInstances",
+		[][2]string{{"ResultClassName", resultClass}, {"Role", role}}, nil))
+}
+
+func (c *ClientWSMan) ReferenceInstances(ctx context.Context, namespaceName string, instanceName CIMInstanceName,
+	resultClass, role string, includeClassOrigin bool, propertyList []string) ([]CIMInstance, error) {
+	path, resourceURI, selectorSet, err := c.associationTarget(namespaceName, instanceName)
+	if nil != err {
+		return nil, err
+	}
+	instances, err := c.enumerateInstances(ctx, resourceURI, selectorSet, c.associationFilter(namespaceName, path, "AssociationInstances",
+		[][2]string{{"ResultClassName", resultClass}, {"Role", role}}, propertyList))
+	if nil != err {
+		return nil, err
+	}
+	results := make([]CIMInstance, len(instances))
+	for idx, instance := range instances {
+		results[idx] = instance.GetInstance()
+	}
+	return results, nil
+}
+
+func (c *ClientWSMan) InvokeMethod(ctx context.Context, namespaceName string,
+	instanceName CIMInstanceName, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if nil == instanceName {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"instance name is nil.")
+	}
+	path, err := toReference(instanceName)
+	if nil != err {
+		return nil, nil, err
+	}
+	return c.invokeMethod(ctx, namespaceName, path, methodName, inParams)
+}
+
+func (c *ClientWSMan) InvokeStaticMethod(ctx context.Context, namespaceName string,
+	className string, methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	return c.invokeMethod(ctx, namespaceName, &ObjectPath{ClassName: className}, methodName, inParams)
+}
+
+func (c *ClientWSMan) invokeMethod(ctx context.Context, namespaceName string, path *ObjectPath,
+	methodName string, inParams []CIMParamValue) (Valuer, []CIMParamValue, error) {
+	if "" == path.ClassName {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"class name is empty.")
+	}
+	if "" == methodName {
+		return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+			"method name is empty.")
+	}
+	if "" != path.Namespace {
+		namespaceName = path.Namespace
+	}
+	resourceURI := c.ResourceURI(namespaceName, path.ClassName)
+
+	var body strings.Builder
+	body.WriteString("<p:" + methodName + `_INPUT xmlns:p="` + xmlEscape(resourceURI) + `">`)
+	for _, param := range inParams {
+		p, ok := param.(*CimParamValue)
+		if !ok {
+			return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"parameter '"+param.GetName()+"' isn't a *CimParamValue.")
+		}
+		if err := c.writeParamValue(&body, namespaceName, p); nil != err {
+			return nil, nil, WBEMException(CIM_ERR_INVALID_PARAMETER,
+				"parameter '"+p.Name+"' is invalid, "+err.Error())
+		}
+	}
+	body.WriteString("</p:" + methodName + "_INPUT>")
+
+	resBody, err := c.do(ctx, resourceURI+"/"+methodName, resourceURI, c.selectorSet(namespaceName, path), body.String())
+	if nil != err {
+		return nil, nil, err
+	}
+	output := resBody.child(methodName + "_OUTPUT")
+	if nil == output {
+		if 0 == len(resBody.Children) {
+			return nil, nil, returnValueNotExists
+		}
+		output = &resBody.Children[0]
+	}
+	return wsmanOutput(output)
+}
+
+// wsmanOutput converts the output of the method into the return value and
+// the output parameters.
+func wsmanOutput(output *wsmanNode) (Valuer, []CIMParamValue, error) {
+	var returnValue Valuer
+	var names []string
+	groups := map[string][]*wsmanNode{}
+	for idx := range output.Children {
+		name := output.Children[idx].XMLName.Local
+		if "ReturnValue" == name {
+			if !output.Children[idx].isNil() {
+				returnValue = &CimValue{Value: output.Children[idx].text()}
+			}
+			continue
+		}
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], &output.Children[idx])
+	}
+
+	var outParams []CIMParamValue
+	for _, name := range names {
+		nodes := groups[name]
+		param := &CimParamValue{Name: name}
+		for idx, node := range nodes {
+			value, typ, embedded, err := wsmanValue(node)
+			if nil != err {
+				return nil, nil, errors.New("'" + name + "' is invalid, " + err.Error())
+			}
+			if nil != value {
+				param.ParamType = typ
+			}
+			if "" != embedded {
+				param.EmbeddedObject = embedded
+			}
+			if 1 == len(nodes) {
+				switch v := value.(type) {
+				case *CimValue:
+					param.Value = v
+				case *CimValueReference:
+					param.ValueReference = v
+				}
+				continue
+			}
+
+			switch v := value.(type) {
+			case *CimValueReference:
+				if nil == param.ValueRefArray {
+					param.ValueRefArray = &CimValueRefArray{Values: make([]CimValueReferenceOrNull, len(nodes))}
+				}
+				param.ValueRefArray.Values[idx].Value = v
+			default:
+				if nil == param.ValueArray {
+					param.ValueArray = &CimValueArray{Values: make([]CimValueOrNull, len(nodes))}
+				}
+				if cv, ok := v.(*CimValue); ok {
+					param.ValueArray.Values[idx].Value = cv
+				} else {
+					param.ValueArray.Values[idx].Null = &CimValueNull{}
+				}
+			}
+		}
+		outParams = append(outParams, param)
+	}
+	return returnValue, outParams, nil
+}
+
+// writeParamValue writes the parameter as the element of the input, the
+// references are the EPRs, the datetimes are the cim:Datetime or the
+// cim:Interval and the embedded instances are the elements.
+func (c *ClientWSMan) writeParamValue(buf *strings.Builder, namespaceName string, p *CimParamValue) error {
+	name := "p:" + p.Name
+	switch {
+	case nil != p.Value:
+		return c.writeValue(buf, namespaceName, name, p.ParamType, p.EmbeddedObject, p.Value.Value)
+	case nil != p.ValueArray:
+		for _, v := range p.ValueArray.Values {
+			if nil == v.Value {
+				buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+				continue
+			}
+			if err := c.writeValue(buf, namespaceName, name, p.ParamType, p.EmbeddedObject, v.Value.Value); nil != err {
+				return err
+			}
+		}
+	case nil != p.ValueReference:
+		c.writeReference(buf, namespaceName, name, p.ValueReference)
+	case nil != p.ValueRefArray:
+		for _, v := range p.ValueRefArray.Values {
+			if nil == v.Value {
+				buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+				continue
+			}
+			c.writeReference(buf, namespaceName, name, v.Value)
+		}
+	case nil != p.InstanceName:
+		path := &ObjectPath{}
+		path.setInstanceName(p.InstanceName)
+		buf.WriteString("<" + name + ">" + c.endpointReference(namespaceName, path) + "</" + name + ">")
+	case nil != p.Instance:
+		buf.WriteString("<" + name + ">")
+		if err := c.writeInstance(buf, namespaceName, p.Instance); nil != err {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+	case nil != p.ValueNamedInstance:
+		buf.WriteString("<" + name + ">")
+		if err := c.writeInstance(buf, namespaceName, &p.ValueNamedInstance.Instance); nil != err {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+	default:
+		buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+	}
+	return nil
+}
+
+func (c *ClientWSMan) writeReference(buf *strings.Builder, namespaceName, name string, ref *CimValueReference) {
+	path := ObjectPathFromReference(ref)
+	if nil == path {
+		buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+		return
+	}
+	buf.WriteString("<" + name + ">" + c.endpointReference(namespaceName, path) + "</" + name + ">")
+}
+
+func (c *ClientWSMan) writeValue(buf *strings.Builder, namespaceName, name, typ, embedded, s string) error {
+	buf.WriteString("<" + name + ">")
+	switch {
+	case "" != EmbeddedKind(embedded, nil):
+		value, err := DecodeEmbeddedObject(s)
+		if nil != err {
+			return err
+		}
+		instance, ok := value.(*CimInstance)
+		if !ok {
+			return errors.New("embedded class isn't supported")
+		}
+		if err := c.writeInstance(buf, namespaceName, instance); nil != err {
+			return err
+		}
+	case "datetime" == typ:
+		value, err := ParseDatetime(s)
+		if nil != err {
+			return err
+		}
+		switch v := value.(type) {
+		case time.Time:
+			buf.WriteString("<cim:Datetime>" + v.Format(time.RFC3339Nano) + "</cim:Datetime>")
+		case time.Duration:
+			buf.WriteString("<cim:Interval>" + formatXSDuration(v) + "</cim:Interval>")
+		}
+	default:
+		buf.WriteString(xmlEscape(s))
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// writeInstance writes the instance as the element of the class in the
+// namespace of the resource URI of the class.
+func (c *ClientWSMan) writeInstance(buf *strings.Builder, namespaceName string, instance *CimInstance) error {
+	buf.WriteString("<q:" + instance.ClassName + ` xmlns:q="` + xmlEscape(c.ResourceURI(namespaceName, instance.ClassName)) + `">`)
+	for idx := range instance.Properties {
+		name := "q:" + instance.Properties[idx].Get().GetName()
+		switch pr := instance.Properties[idx].Get().(type) {
+		case *CimProperty:
+			if nil == pr.Value {
+				buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+				continue
+			}
+			if err := c.writeValue(buf, namespaceName, name, pr.Type, EmbeddedKind(pr.EmbeddedObject, pr.Qualifiers), pr.Value.Value); nil != err {
+				return err
+			}
+		case *CimPropertyArray:
+			if nil == pr.ValueArray {
+				buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+				continue
+			}
+			for _, v := range pr.ValueArray.Values {
+				if nil == v.Value {
+					buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+					continue
+				}
+				if err := c.writeValue(buf, namespaceName, name, pr.Type, EmbeddedKind(pr.EmbeddedObject, pr.Qualifiers), v.Value.Value); nil != err {
+					return err
+				}
+			}
+		case *CimPropertyReference:
+			if nil == pr.ValueReference {
+				buf.WriteString("<" + name + ` xsi:nil="true"/>`)
+				continue
+			}
+			c.writeReference(buf, namespaceName, name, pr.ValueReference)
+		}
+	}
+	buf.WriteString("</q:" + instance.ClassName + ">")
+	return nil
+}
+
+// The namespaces, the classes and the qualifiers aren't supported by the
+// WS-Management binding, the operations are here so that ClientWSMan implements WBEMClient.
+
+func (c *ClientWSMan) EnumerateNamespaces(ctx context.Context, nsList []string, timeout time.Duration, cb func(int, int)) ([]string, error) {
+	return nil, notSupported("WS-Management", "EnumerateNamespaces")
+}
+
+func (c *ClientWSMan) EnumerateClassNames(ctx context.Context, namespaceName, className string, deep bool) ([]string, error) {
+	return nil, notSupported("WS-Management", "EnumerateClassNames")
+}
+
+func (c *ClientWSMan) EnumerateClasses(ctx context.Context, namespaceName string, className string, deepInheritance bool,
+	localOnly bool, includeQualifiers bool, includeClassOrigin bool) ([]CimClass, error) {
+	return nil, notSupported("WS-Management", "EnumerateClasses")
+}
+
+func (c *ClientWSMan) GetClass(ctx context.Context, namespaceName string, className string, localOnly bool,
+	includeQualifiers bool, includeClassOrigin bool, propertyList []string) (*CimClass, error) {
+	return nil, notSupported("WS-Management", "GetClass")
+}
+
+func (c *ClientWSMan) EnumerateQualifierTypes(ctx context.Context, namespaceName string) ([]CimQualifierDeclaration, error) {
+	return nil, notSupported("WS-Management", "EnumerateQualifierTypes")
+}
+
+func (c *ClientWSMan) AssociatorClasses(ctx context.Context, namespaceName, className, assocClass, resultClass, role, resultRole string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	return nil, notSupported("WS-Management", "AssociatorClasses")
+}
+
+func (c *ClientWSMan) ReferenceClasses(ctx context.Context, namespaceName, className, resultClass, role string,
+	includeQualifiers, includeClassOrigin bool, propertyList []string) ([]string, error) {
+	return nil, notSupported("WS-Management", "ReferenceClasses")
+}
@@ -0,0 +1,366 @@
+package gowbem
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const wsmanDiskURI = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_Disk"
+const wsmanSystemURI = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_System"
+
+func wsmanDiskEPR(id string) string {
+	return `<a:Address>` + wsmanAnonymous + `</a:Address><a:ReferenceParameters><w:ResourceURI>` + wsmanDiskURI +
+		`</w:ResourceURI><w:SelectorSet><w:Selector Name="DeviceID">` + id +
+		`</w:Selector><w:Selector Name="__cimnamespace">root/cimv2</w:Selector></w:SelectorSet></a:ReferenceParameters>`
+}
+
+func wsmanDisk(id string) string {
+	return `<p:CIM_Disk xmlns:p="` + wsmanDiskURI + `">` +
+		`<p:DeviceID>` + id + `</p:DeviceID>` +
+		`<p:Size>1024</p:Size>` +
+		`<p:OperationalStatus>2</p:OperationalStatus><p:OperationalStatus>3</p:OperationalStatus>` +
+		`<p:Name xsi:nil="true"/>` +
+		`<p:InstallDate><cim:Datetime>2020-01-02T03:04:05Z</cim:Datetime></p:InstallDate>` +
+		`<p:System><a:Address>` + wsmanAnonymous + `</a:Address><a:ReferenceParameters><w:ResourceURI>` + wsmanSystemURI +
+		`</w:ResourceURI><w:SelectorSet><w:Selector Name="Name">s1</w:Selector></w:SelectorSet></a:ReferenceParameters></p:System>` +
+		`</p:CIM_Disk>`
+}
+
+func wsmanEnvelope(action, body string) string {
+	return `<s:Envelope xmlns:s="` + nsSOAP + `" xmlns:a="` + nsAddressing + `" xmlns:n="` + nsEnumeration +
+		`" xmlns:w="` + nsWSMan + `" xmlns:xsi="` + nsXSI + `" xmlns:cim="` + nsCIMCommon + `"><s:Header><a:Action>` + action +
+		`</a:Action></s:Header><s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+func wsmanFaultEnvelope(subcode, reason string) string {
+	return wsmanEnvelope(nsAddressing+"/fault", `<s:Fault><s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>w:`+subcode+
+		`</s:Value></s:Subcode></s:Code><s:Reason><s:Text xml:lang="en-US">`+reason+`</s:Text></s:Reason></s:Fault>`)
+}
+
+// wsmanServer is a WS-Management stand-in, it serves three disks of a
+// system, the Digest is required if digest is true.
+func wsmanServer(t *testing.T, digest bool) *httptest.Server {
+	disks := []string{"d1", "d2", "d3"}
+	items := func(mode string, ids []string) string {
+		var buf strings.Builder
+		for _, id := range ids {
+			switch mode {
+			case wsmanEnumerateEPR:
+				buf.WriteString("<a:EndpointReference>" + wsmanDiskEPR(id) + "</a:EndpointReference>")
+			case wsmanEnumerateObjectAndEPR:
+				buf.WriteString("<w:Item>" + wsmanDisk(id) + "<a:EndpointReference>" + wsmanDiskEPR(id) + "</a:EndpointReference></w:Item>")
+			default:
+				buf.WriteString(wsmanDisk(id))
+			}
+		}
+		return buf.String()
+	}
+	page := func(mode string, skip, max int) string {
+		end := skip + max
+		if end >= len(disks) {
+			return "<w:Items>" + items(mode, disks[skip:]) + "</w:Items><w:EndOfSequence/>"
+		}
+		return "<n:EnumerationContext>" + mode + ":" + strconv.Itoa(end) + "</n:EnumerationContext><w:Items>" + items(mode, disks[skip:end]) + "</w:Items>"
+	}
+
+	authorize := func(r *http.Request) bool {
+		if _, _, ok := r.BasicAuth(); ok && digest {
+			t.Error("password is sent with the Basic")
+		}
+		if !digest {
+			user, password, ok := r.BasicAuth()
+			return ok && "u" == user && "p" == password
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			return false
+		}
+		fields := map[string]string{}
+		for _, field := range splitDigestFields(auth[7:]) {
+			if idx := strings.IndexByte(field, '='); idx > 0 {
+				fields[strings.TrimSpace(field[:idx])] = strings.Trim(strings.TrimSpace(field[idx+1:]), `"`)
+			}
+		}
+		sum := func(s string) string {
+			bs := md5.Sum([]byte(s))
+			return hex.EncodeToString(bs[:])
+		}
+		ha1 := sum("u:wsman:p")
+		ha2 := sum(r.Method + ":" + fields["uri"])
+		return "abc" == fields["nonce"] && "xyz" == fields["opaque"] && r.URL.RequestURI() == fields["uri"] &&
+			sum(ha1+":abc:"+fields["nc"]+":"+fields["cnonce"]+":auth:"+ha2) == fields["response"]
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(r) {
+			if digest {
+				w.Header().Add("WWW-Authenticate", `Negotiate`)
+				w.Header().Add("WWW-Authenticate", `Digest realm="wsman", nonce="abc", opaque="xyz", qop="auth,auth-int", algorithm=MD5`)
+			} else {
+				w.Header().Add("WWW-Authenticate", `Basic realm="wsman"`)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/soap+xml") {
+			t.Error("Content-Type is", r.Header.Get("Content-Type"))
+		}
+
+		bs, _ := io.ReadAll(r.Body)
+		envelope := &wsmanNode{}
+		if err := xml.Unmarshal(bs, envelope); nil != err {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		header, body := envelope.child("Header"), envelope.child("Body")
+		action := header.child("Action").text()
+		resourceURI := header.child("ResourceURI").text()
+		if "" == header.child("MessageID").text() || nil == header.child("MaxEnvelopeSize") {
+			t.Error(string(bs))
+		}
+		selectors := map[string]string{}
+		for _, selector := range header.child("SelectorSet").children("Selector") {
+			selectors[selector.attr("Name")] = selector.text()
+		}
+
+		var response string
+		switch action {
+		case wsmanActionGet:
+			if wsmanDiskURI != resourceURI || "root/cimv2" != selectors["__cimnamespace"] {
+				t.Error(string(bs))
+			}
+			for _, id := range disks {
+				if id == selectors["DeviceID"] {
+					response = wsmanEnvelope(nsTransfer+"/GetResponse", wsmanDisk(id))
+				}
+			}
+			if "" == response {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, wsmanFaultEnvelope("DestinationUnreachable", "instance isn't found"))
+				return
+			}
+		case wsmanActionEnumerate:
+			enumerate := body.child("Enumerate")
+			if nil == enumerate.child("OptimizeEnumeration") {
+				t.Error(string(bs))
+			}
+			if filter := enumerate.child("Filter"); nil != filter {
+				associated := filter.child("AssociatedInstances")
+				if wsmanAllClasses != resourceURI || wsmanAssociationFilter != filter.attr("Dialect") || nil == associated ||
+					"CIM_SystemDevice" != associated.child("AssociationClassName").text() {
+					t.Error(string(bs))
+				}
+				path, err := wsmanPath(associated.child("Object"))
+				if nil != err || "CIM_System" != path.ClassName || "s1" != path.KeyBindings[0].KeyValue.Value {
+					t.Error(err, path)
+				}
+			} else if wsmanDiskURI != resourceURI {
+				t.Error(string(bs))
+			}
+			max, _ := strconv.Atoi(enumerate.child("MaxElements").text())
+			response = wsmanEnvelope(nsEnumeration+"/EnumerateResponse",
+				"<n:EnumerateResponse>"+page(enumerate.child("EnumerationMode").text(), 0, max)+"</n:EnumerateResponse>")
+		case wsmanActionPull:
+			pull := body.child("Pull")
+			ss := strings.SplitN(pull.child("EnumerationContext").text(), ":", 2)
+			skip, _ := strconv.Atoi(ss[1])
+			max, _ := strconv.Atoi(pull.child("MaxElements").text())
+			response = wsmanEnvelope(nsEnumeration+"/PullResponse", "<n:PullResponse>"+page(ss[0], skip, max)+"</n:PullResponse>")
+		case wsmanSystemURI + "/RequestStateChange":
+			input := body.child("RequestStateChange_INPUT")
+			if "s1" != selectors["Name"] || "3" != input.child("RequestedState").text() ||
+				"P0DT0H1M30S" != input.child("TimeoutPeriod").child("Interval").text() {
+				t.Error(string(bs))
+			}
+			response = wsmanEnvelope(wsmanSystemURI+"/RequestStateChangeResponse",
+				`<p:RequestStateChange_OUTPUT xmlns:p="`+wsmanSystemURI+`"><p:Job><a:Address>`+wsmanAnonymous+
+					`</a:Address><a:ReferenceParameters><w:ResourceURI>http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ConcreteJob</w:ResourceURI>`+
+					`<w:SelectorSet><w:Selector Name="InstanceID">j1</w:Selector></w:SelectorSet></a:ReferenceParameters></p:Job>`+
+					`<p:Messages>a</p:Messages><p:Messages>b</p:Messages>`+
+					`<p:ReturnValue>4096</p:ReturnValue></p:RequestStateChange_OUTPUT>`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, wsmanFaultEnvelope("ActionNotSupported", "action isn't supported"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+		io.WriteString(w, response)
+	}))
+}
+
+func TestWSMan(t *testing.T) {
+	for _, digest := range []bool{false, true} {
+		hsrv := wsmanServer(t, digest)
+		u, _ := url.Parse(hsrv.URL + "/wsman")
+		u.User = url.UserPassword("u", "p")
+		c, _ := NewClientWSMan(u, false)
+		testWSMan(t, c)
+
+		if !digest {
+			c, _ = NewClientWSMan(u, false)
+			c.Auth = WSManAuthBasic
+			if _, err := c.EnumerateInstanceNames(context.Background(), "root/cimv2", "CIM_Disk"); nil != err {
+				t.Error(err)
+			}
+		}
+
+		u.User = url.UserPassword("u", "x")
+		c, _ = NewClientWSMan(u, false)
+		if _, err := c.EnumerateInstanceNames(context.Background(), "root/cimv2", "CIM_Disk"); ErrUnauthorized != err {
+			t.Error(digest, err)
+		}
+		hsrv.Close()
+	}
+}
+
+func testWSMan(t *testing.T, c *ClientWSMan) {
+	ctx := context.Background()
+	for _, maxElements := range []int{0, 1, 2} {
+		c.MaxElements = maxElements
+		instances, err := c.EnumerateInstances(ctx, "root/cimv2", "CIM_Disk", true, false, false, false, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 3 != len(instances) {
+			t.Fatal(maxElements, len(instances))
+		}
+		if "d2" != instances[1].GetName().GetKeyBindings().Get(0).GetValue() {
+			t.Errorf("%#v", instances[1].GetName())
+		}
+
+		names, err := c.EnumerateInstanceNames(ctx, "root/cimv2", "CIM_Disk")
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 3 != len(names) || "CIM_Disk" != names[2].GetClassName() || "d3" != names[2].GetKeyBindings().Get(0).GetValue() {
+			t.Errorf("%#v", names)
+		}
+	}
+
+	instance, err := c.GetInstance(ctx, "root/cimv2", "CIM_Disk",
+		CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d1"}}}, false, false, false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "CIM_Disk" != instance.GetClassName() || "1024" != instance.GetPropertyByName("Size").GetValue() {
+		t.Errorf("%#v", instance)
+	}
+	if values, ok := instance.GetPropertyByName("OperationalStatus").GetValue().([]interface{}); !ok || 2 != len(values) || "3" != values[1] {
+		t.Errorf("%#v", instance.GetPropertyByName("OperationalStatus").GetValue())
+	}
+	if nil != instance.GetPropertyByName("Name").GetValue() {
+		t.Errorf("%#v", instance.GetPropertyByName("Name").GetValue())
+	}
+	if pr := instance.GetPropertyByName("InstallDate").(*CimProperty); "datetime" != pr.Type || "20200102030405.000000+000" != pr.Value.Value {
+		t.Errorf("%#v", pr)
+	}
+	if pr, ok := instance.GetPropertyByName("System").(*CimPropertyReference); !ok ||
+		"CIM_System.Name=\"s1\"" != ObjectPathFromReference(pr.ValueReference).String() {
+		t.Errorf("%#v", instance.GetPropertyByName("System"))
+	}
+
+	_, err = c.GetInstance(ctx, "root/cimv2", "CIM_Disk",
+		CimKeyBindings{{Name: "DeviceID", KeyValue: &CimKeyValue{ValueType: "string", Value: "d4"}}}, false, false, false, nil)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_NOT_FOUND != code || !strings.Contains(err.Error(), "instance isn't found") {
+		t.Error(err)
+	}
+
+	system, _ := ParseObjectPath(`CIM_System.Name="s1"`)
+	c.MaxElements = 2
+	associators, err := c.AssociatorInstances(ctx, "root/cimv2", system.InstanceName(), "CIM_SystemDevice", "", "", "", false, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(associators) {
+		t.Errorf("%#v", associators)
+	}
+	names, err := c.AssociatorNames(ctx, "root/cimv2", system.InstanceName(), "CIM_SystemDevice", "", "", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(names) {
+		t.Errorf("%#v", names)
+	}
+
+	returnValue, outParams, err := c.InvokeMethod(ctx, "root/cimv2", system.InstanceName(), "RequestStateChange",
+		[]CIMParamValue{
+			&CimParamValue{Name: "RequestedState", ParamType: "uint16", Value: &CimValue{Value: "3"}},
+			&CimParamValue{Name: "TimeoutPeriod", ParamType: "datetime", Value: &CimValue{Value: FormatInterval(90 * time.Second)}},
+		})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil == returnValue || "4096" != returnValue.String() || 2 != len(outParams) {
+		t.Fatalf("%#v %#v", returnValue, outParams)
+	}
+	if job, ok := paramValue(outParams[0]).(*ObjectPath); !ok || "CIM_ConcreteJob" != job.ClassName {
+		t.Errorf("%#v", outParams[0])
+	}
+	if messages := outParams[1].(*CimParamValue); nil == messages.ValueArray || 2 != len(messages.ValueArray.Values) {
+		t.Errorf("%#v", messages)
+	}
+
+	_, _, err = c.InvokeStaticMethod(ctx, "root/cimv2", "CIM_System", "Unknown", nil)
+	if code, ok := GetCIMStatusCode(err); !ok || CIM_ERR_NOT_SUPPORTED != code {
+		t.Error(err)
+	}
+}
+
+func TestWSManResourceURI(t *testing.T) {
+	c, _ := NewClientWSMan(&url.URL{Scheme: "http", Host: "127.0.0.1:5985", Path: "/wsman"}, false)
+	c.ResourceURIs = map[string]string{"Linux_": "http://sblim.sf.net/wbem/wscim/1/cim-schema/2/"}
+	for _, test := range []struct{ namespace, class, uri string }{
+		{"root/cimv2", "CIM_Disk", "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_Disk"},
+		{"root/dcim", "DCIM_SystemView", "http://schemas.dell.com/wbem/wscim/1/cim-schema/2/DCIM_SystemView"},
+		{"interop", "AMT_GeneralSettings", "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings"},
+		{"root\\StandardCimv2", "MSFT_NetAdapter", "http://schemas.microsoft.com/wbem/wsman/1/wmi/root/standardcimv2/MSFT_NetAdapter"},
+		{"", "Win32_Service", "http://schemas.microsoft.com/wbem/wsman/1/wmi/root/cimv2/Win32_Service"},
+		{"root/cimv2", "Linux_OperatingSystem", "http://sblim.sf.net/wbem/wscim/1/cim-schema/2/Linux_OperatingSystem"},
+	} {
+		if uri := c.ResourceURI(test.namespace, test.class); test.uri != uri {
+			t.Error(test.class, uri)
+		}
+	}
+	if uri := allClassesURI(c.ResourceURI("root/cimv2", "Win32_Service")); "http://schemas.microsoft.com/wbem/wsman/1/wmi/root/cimv2/*" != uri {
+		t.Error(uri)
+	}
+
+	for s, excepted := range map[string]time.Duration{
+		"PT60S":        60 * time.Second,
+		"P1DT2H3M4.5S": 26*time.Hour + 3*time.Minute + 4500*time.Millisecond,
+		"P0DT0H1M30S":  90 * time.Second,
+		"PT0.000001S":  time.Microsecond,
+		"P2D":          48 * time.Hour,
+		"-PT1H":        time.Hour,
+		"P1Y":          -1,
+		"1H":           -1,
+		"PT1.5.5S":     -1,
+		"P1DT2H3M4S5":  -1,
+		"P":            -1,
+	} {
+		d, err := parseXSDuration(s)
+		if excepted < 0 {
+			if nil == err {
+				t.Error(s, "error is excepted")
+			}
+			continue
+		}
+		if nil != err || excepted != d {
+			t.Error(s, d, err)
+		}
+	}
+	if s := formatXSDuration(90 * time.Second); "P0DT0H1M30S" != s {
+		t.Error(s)
+	}
+}